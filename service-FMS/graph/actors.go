@@ -0,0 +1,90 @@
+package graph
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// minActorTokenLength is the minimum length of an API token, so tokens cannot
+// be guessed.
+const minActorTokenLength = 32
+
+// ActorTokens maps the users allowed to modify the space inventory to their
+// API tokens. Requests authenticate with an "Authorization: Bearer <token>"
+// header, the user the token belongs to is recorded in the audit trail.
+type ActorTokens map[string]string
+
+// LoadActorTokens reads the API tokens from a JSON object mapping every user
+// to their token. Without a tokens file no user can modify the inventory.
+func LoadActorTokens(path string) (ActorTokens, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Printf("No API tokens found at %s, the space inventory is read-only", path)
+		return ActorTokens{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API tokens: %w", err)
+	}
+
+	var tokens ActorTokens
+	if err := json.Unmarshal(content, &tokens); err != nil {
+		return nil, fmt.Errorf("invalid API tokens file %s: %w", path, err)
+	}
+	for actor, token := range tokens {
+		if strings.TrimSpace(actor) == "" {
+			return nil, fmt.Errorf("API tokens file %s contains a token without a user", path)
+		}
+		if len(token) < minActorTokenLength {
+			return nil, fmt.Errorf("the API token of %s in %s must be at least %d characters long", actor, path, minActorTokenLength)
+		}
+	}
+
+	log.Printf("Loaded API tokens for %d users from %s", len(tokens), path)
+	return tokens, nil
+}
+
+// authenticate returns the user the given token belongs to, or an empty
+// string if it belongs to none. Every token is compared in constant time.
+func (t ActorTokens) authenticate(token string) string {
+	var actor string
+	for candidate, candidateToken := range t {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(candidateToken)) == 1 {
+			actor = candidate
+		}
+	}
+	return actor
+}
+
+type actorContextKey struct{}
+
+// WithActor authenticates the API token in the Authorization header and
+// stores the user it belongs to in the request context, so mutations can
+// record who made a change. Requests without a valid token can still query
+// the inventory.
+func WithActor(tokens ActorTokens, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var actor string
+		if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			actor = tokens.authenticate(strings.TrimSpace(token))
+		}
+		ctx := context.WithValue(r.Context(), actorContextKey{}, actor)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// actorFromContext returns the user making the current request, or an error
+// if the request is not authenticated.
+func actorFromContext(ctx context.Context) (string, error) {
+	actor, _ := ctx.Value(actorContextKey{}).(string)
+	if actor == "" {
+		return "", fmt.Errorf("a valid API token in the Authorization header is required to modify the space inventory")
+	}
+	return actor, nil
+}
@@ -0,0 +1,282 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/LarsDepuydt/masterthesis-api-aggregation/service-FMS/graph/model"
+)
+
+// spaceAlias registers the identifier an external system uses for a building,
+// floor or room.
+type spaceAlias struct {
+	System     model.ExternalSystem `json:"system"`
+	ExternalID string               `json:"externalId"`
+	SpaceID    string               `json:"spaceId"`
+}
+
+// aliasKey identifies an alias. External identifiers are compared
+// case-insensitively, as e.g. mailboxes are not written consistently.
+type aliasKey struct {
+	system     model.ExternalSystem
+	externalID string
+}
+
+func newAliasKey(system model.ExternalSystem, externalID string) aliasKey {
+	return aliasKey{system: system, externalID: strings.ToLower(strings.TrimSpace(externalID))}
+}
+
+// entityID returns the ID of the alias in the inventory change log.
+func (a spaceAlias) entityID() string {
+	return fmt.Sprintf("%s:%s", a.System, a.ExternalID)
+}
+
+// AliasRegistry maps the identifiers other systems use for buildings, floors
+// and rooms to their canonical IDs. Changes are written back to the registry
+// file and recorded in the inventory change log.
+type AliasRegistry struct {
+	mu        sync.RWMutex
+	path      string
+	aliases   map[aliasKey]spaceAlias
+	inventory *Inventory
+}
+
+// NewAliasRegistry loads the alias registry from path. If the file does not
+// exist yet, the registry is initialised from seedPath, so aliases registered
+// at runtime are kept separately from the aliases shipped with the service.
+// Aliases referring to spaces that are not in the inventory are logged.
+func NewAliasRegistry(path, seedPath string, inventory *Inventory) (*AliasRegistry, error) {
+	reg := &AliasRegistry{
+		path:      path,
+		aliases:   make(map[aliasKey]spaceAlias),
+		inventory: inventory,
+	}
+	buildings := inventory.Buildings()
+
+	source := path
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && seedPath != "" {
+		source = seedPath
+		content, err = os.ReadFile(seedPath)
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		log.Printf("No space aliases found at %s, starting with an empty registry", source)
+		return reg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read space aliases: %w", err)
+	}
+
+	var aliases []spaceAlias
+	if err := json.Unmarshal(content, &aliases); err != nil {
+		return nil, fmt.Errorf("invalid space aliases file %s: %w", source, err)
+	}
+	for i, alias := range aliases {
+		if !alias.System.IsValid() || strings.TrimSpace(alias.ExternalID) == "" || alias.SpaceID == "" {
+			return nil, fmt.Errorf("space alias %d in %s needs a valid system, an externalId and a spaceId", i, source)
+		}
+		key := newAliasKey(alias.System, alias.ExternalID)
+		if existing, ok := reg.aliases[key]; ok {
+			return nil, fmt.Errorf("space alias %s %q in %s is registered for both %s and %s",
+				alias.System, alias.ExternalID, source, existing.SpaceID, alias.SpaceID)
+		}
+		if b, _, _ := findSpace(buildings, alias.SpaceID); b == nil {
+			log.Printf("Space alias %s %q refers to unknown space %s", alias.System, alias.ExternalID, alias.SpaceID)
+		}
+		reg.aliases[key] = alias
+	}
+
+	log.Printf("Loaded %d space aliases from %s", len(reg.aliases), source)
+	return reg, nil
+}
+
+// Lookup returns the alias registered for an external identifier.
+func (reg *AliasRegistry) Lookup(system model.ExternalSystem, externalID string) (spaceAlias, bool) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	alias, ok := reg.aliases[newAliasKey(system, externalID)]
+	return alias, ok
+}
+
+// ForSpace returns the aliases registered for a building, floor or room,
+// ordered by system and identifier.
+func (reg *AliasRegistry) ForSpace(spaceID string) []spaceAlias {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	var result []spaceAlias
+	for _, alias := range reg.aliases {
+		if alias.SpaceID == spaceID {
+			result = append(result, alias)
+		}
+	}
+	sortAliases(result)
+	return result
+}
+
+// Register maps an external identifier to a space, replacing an earlier
+// registration of the identifier.
+func (reg *AliasRegistry) Register(ctx context.Context, alias spaceAlias) error {
+	actor, err := actorFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	alias.ExternalID = strings.TrimSpace(alias.ExternalID)
+	if alias.ExternalID == "" {
+		return fmt.Errorf("external ID must not be empty")
+	}
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	key := newAliasKey(alias.System, alias.ExternalID)
+	previous, existed := reg.aliases[key]
+	undo := func() {
+		if existed {
+			reg.aliases[key] = previous
+		} else {
+			delete(reg.aliases, key)
+		}
+	}
+	reg.aliases[key] = alias
+	if err := reg.save(); err != nil {
+		undo()
+		return err
+	}
+
+	operation, before := model.InventoryOperationCreate, any(nil)
+	if existed {
+		operation, before = model.InventoryOperationUpdate, previous
+	}
+	if err := reg.inventory.record(ctx, operation, model.InventoryEntityTypeAlias, alias.entityID(), before, alias); err != nil {
+		undo()
+		reg.restore()
+		return err
+	}
+
+	log.Printf("%s registered space alias %s %q for %s", actor, alias.System, alias.ExternalID, alias.SpaceID)
+	return nil
+}
+
+// Remove deletes the registration of an external identifier. It reports
+// whether the identifier was registered.
+func (reg *AliasRegistry) Remove(ctx context.Context, system model.ExternalSystem, externalID string) (bool, error) {
+	actor, err := actorFromContext(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	key := newAliasKey(system, externalID)
+	previous, ok := reg.aliases[key]
+	if !ok {
+		return false, nil
+	}
+	delete(reg.aliases, key)
+	if err := reg.save(); err != nil {
+		reg.aliases[key] = previous
+		return false, err
+	}
+	if err := reg.inventory.record(ctx, model.InventoryOperationDelete, model.InventoryEntityTypeAlias, previous.entityID(), previous, nil); err != nil {
+		reg.aliases[key] = previous
+		reg.restore()
+		return false, err
+	}
+
+	log.Printf("%s removed space alias %s %q for %s", actor, system, previous.ExternalID, previous.SpaceID)
+	return true, nil
+}
+
+// save writes the registry to its file. The caller must hold the lock.
+func (reg *AliasRegistry) save() error {
+	aliases := make([]spaceAlias, 0, len(reg.aliases))
+	for _, alias := range reg.aliases {
+		aliases = append(aliases, alias)
+	}
+	sortAliases(aliases)
+
+	content, err := json.MarshalIndent(aliases, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode space aliases: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(reg.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create space aliases directory: %w", err)
+	}
+
+	// Write to a temporary file first, so a failed write keeps the old file
+	tmp, err := os.CreateTemp(filepath.Dir(reg.path), ".aliases-*")
+	if err != nil {
+		return fmt.Errorf("failed to save space aliases: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(content, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save space aliases: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save space aliases: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), reg.path); err != nil {
+		return fmt.Errorf("failed to save space aliases: %w", err)
+	}
+	return nil
+}
+
+// restore writes the registry back to its file after a change could not be
+// recorded in the change log. The caller must hold the lock.
+func (reg *AliasRegistry) restore() {
+	if err := reg.save(); err != nil {
+		log.Printf("Error restoring space aliases after a failed change: %v", err)
+	}
+}
+
+// sortAliases orders aliases by system and identifier.
+func sortAliases(aliases []spaceAlias) {
+	sort.Slice(aliases, func(i, j int) bool {
+		if aliases[i].System != aliases[j].System {
+			return aliases[i].System < aliases[j].System
+		}
+		return aliases[i].ExternalID < aliases[j].ExternalID
+	})
+}
+
+// findSpace returns the building, floor or room with the given ID along with
+// the spaces containing it. The building is nil if the ID is unknown.
+func findSpace(buildings map[string]*model.Building, id string) (*model.Building, *model.Floor, *model.Room) {
+	if building, ok := buildings[id]; ok {
+		return building, nil, nil
+	}
+	if floor := findFloor(buildings, id); floor != nil {
+		return floor.Building, floor, nil
+	}
+	if room := findRoom(buildings, id); room != nil {
+		return room.Floor.Building, room.Floor, room
+	}
+	return nil, nil, nil
+}
+
+// findRoomsByNumber returns the rooms with the given room number, compared
+// case-insensitively.
+func findRoomsByNumber(buildings map[string]*model.Building, roomNumber string) []*model.Room {
+	var rooms []*model.Room
+	for _, building := range buildings {
+		for _, floor := range building.Floors {
+			for _, room := range floor.Rooms {
+				if strings.EqualFold(room.RoomNumber, strings.TrimSpace(roomNumber)) {
+					rooms = append(rooms, room)
+				}
+			}
+		}
+	}
+	return rooms
+}
@@ -0,0 +1,195 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/LarsDepuydt/masterthesis-api-aggregation/service-FMS/graph/model"
+)
+
+// testBuildings returns two buildings sharing the room number A.001.
+func testBuildings() map[string]*model.Building {
+	buildings := make(map[string]*model.Building)
+	for _, id := range []string{"TMV25", "TMV27"} {
+		building := &model.Building{ID: id, Address: id, Floors: []*model.Floor{}}
+		addImportedRoom(building, "Stue", 0, &model.Room{RoomNumber: "A.001", Type: "office", Area: 10, Circumference: 13})
+		buildings[id] = building
+	}
+	addImportedRoom(buildings["TMV25"], "1. Sal", 1, &model.Room{RoomNumber: "B.101", Type: "office", Area: 10, Circumference: 13})
+	return buildings
+}
+
+// newTestAliasRegistry creates an alias registry with the given seed aliases
+// for the test buildings.
+func newTestAliasRegistry(t *testing.T, seed []spaceAlias) (*AliasRegistry, string) {
+	t.Helper()
+	dir := t.TempDir()
+	seedPath := filepath.Join(dir, "seed.json")
+	content, _ := json.Marshal(seed)
+	if err := os.WriteFile(seedPath, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	inventory, err := NewInventory(testBuildings(), nil, filepath.Join(dir, "data", "inventory-changes.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "data", "aliases.json")
+	reg, err := NewAliasRegistry(path, seedPath, inventory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reg, path
+}
+
+func TestResolveSpace(t *testing.T) {
+	reg, _ := newTestAliasRegistry(t, []spaceAlias{
+		{System: model.ExternalSystemOutlook, ExternalID: "Room-A001@example.com", SpaceID: "TMV25-Stue-A.001"},
+		{System: model.ExternalSystemBms, ExternalID: "TMV27 A.001", SpaceID: "TMV27-Stue-A.001"},
+		{System: model.ExternalSystemDoorcounters, ExternalID: "Entrance", SpaceID: "TMV25"},
+		{System: model.ExternalSystemOutlook, ExternalID: "removed@example.com", SpaceID: "TMV25-Stue-Z.999"},
+	})
+	r := &Resolver{Inventory: reg.inventory, Aliases: reg}
+
+	tests := []struct {
+		name        string
+		system      model.ExternalSystem
+		externalID  string
+		wantSpaceID string // empty if unresolved
+	}{
+		{name: "alias", system: model.ExternalSystemOutlook, externalID: "Room-A001@example.com", wantSpaceID: "TMV25-Stue-A.001"},
+		{name: "alias in other case", system: model.ExternalSystemOutlook, externalID: " room-a001@EXAMPLE.com", wantSpaceID: "TMV25-Stue-A.001"},
+		{name: "alias of another system", system: model.ExternalSystemDoorcounters, externalID: "Room-A001@example.com"},
+		{name: "alias of a building", system: model.ExternalSystemDoorcounters, externalID: "Entrance", wantSpaceID: "TMV25"},
+		{name: "alias of an unknown space", system: model.ExternalSystemOutlook, externalID: "removed@example.com"},
+		{name: "unique BMS room number", system: model.ExternalSystemBms, externalID: "b.101", wantSpaceID: "TMV25-1. Sal-B.101"},
+		{name: "ambiguous BMS room number", system: model.ExternalSystemBms, externalID: "A.001"},
+		{name: "BMS alias for an ambiguous room number", system: model.ExternalSystemBms, externalID: "TMV27 A.001", wantSpaceID: "TMV27-Stue-A.001"},
+		{name: "coffee space ID", system: model.ExternalSystemCoffee, externalID: "TMV25-Stue", wantSpaceID: "TMV25-Stue"},
+		{name: "unknown coffee space ID", system: model.ExternalSystemCoffee, externalID: "TMV29"},
+		{name: "Outlook without alias", system: model.ExternalSystemOutlook, externalID: "TMV25-Stue-A.001"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolution := r.resolveSpace(tt.system, tt.externalID)
+			if tt.wantSpaceID == "" {
+				if resolution != nil {
+					t.Errorf("got %s, want no resolution", resolution.SpaceID)
+				}
+				return
+			}
+			if resolution == nil {
+				t.Fatalf("got no resolution, want %s", tt.wantSpaceID)
+			}
+			if resolution.SpaceID != tt.wantSpaceID || resolution.System != tt.system || resolution.ExternalID != tt.externalID {
+				t.Errorf("got %+v, want %s", resolution, tt.wantSpaceID)
+			}
+			// The containing spaces are filled in down to the resolved one
+			switch {
+			case resolution.Room != nil:
+				if resolution.Room.Floor != resolution.Floor || resolution.Floor.Building != resolution.Building {
+					t.Error("the room is not within the resolved floor and building")
+				}
+			case resolution.Floor != nil:
+				if resolution.Floor.Building != resolution.Building {
+					t.Error("the floor is not within the resolved building")
+				}
+			}
+		})
+	}
+}
+
+func TestAliasRegistryChanges(t *testing.T) {
+	reg, path := newTestAliasRegistry(t, []spaceAlias{
+		{System: model.ExternalSystemOutlook, ExternalID: "a001@example.com", SpaceID: "TMV25-Stue-A.001"},
+	})
+	ctx := asActor("alice")
+
+	alias := spaceAlias{System: model.ExternalSystemBms, ExternalID: " AHU-1 ", SpaceID: "TMV25-1. Sal-B.101"}
+	if err := reg.Register(context.Background(), alias); err == nil {
+		t.Fatal("expected an error without an actor")
+	}
+	if err := reg.Register(ctx, alias); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Registering the identifier again replaces the space it refers to
+	if err := reg.Register(ctx, spaceAlias{System: model.ExternalSystemBms, ExternalID: "ahu-1", SpaceID: "TMV25-1. Sal"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if removed, err := reg.Remove(ctx, model.ExternalSystemOutlook, "A001@example.com"); err != nil || !removed {
+		t.Fatalf("got %v, %v, want the alias removed", removed, err)
+	}
+	if removed, err := reg.Remove(ctx, model.ExternalSystemOutlook, "A001@example.com"); err != nil || removed {
+		t.Fatalf("got %v, %v, want nothing removed", removed, err)
+	}
+	if err := reg.Register(ctx, spaceAlias{System: model.ExternalSystemBms, ExternalID: " ", SpaceID: "TMV25"}); err == nil {
+		t.Fatal("expected an error for an empty external ID")
+	}
+
+	wantChanges := []struct {
+		operation model.InventoryOperation
+		entityID  string
+	}{
+		{model.InventoryOperationCreate, "BMS:AHU-1"},
+		{model.InventoryOperationUpdate, "BMS:ahu-1"},
+		{model.InventoryOperationDelete, "OUTLOOK:a001@example.com"},
+	}
+	changes := reg.inventory.Changes()
+	if len(changes) != len(wantChanges) {
+		t.Fatalf("got %d changes, want %d", len(changes), len(wantChanges))
+	}
+	for i, change := range changes {
+		if change.EntityType != model.InventoryEntityTypeAlias || change.Operation != wantChanges[i].operation || change.EntityID != wantChanges[i].entityID {
+			t.Errorf("change %d: got %s %s %s", i, change.Operation, change.EntityType, change.EntityID)
+		}
+	}
+
+	// The registry file replaces the seed on the next start
+	reloaded, err := NewAliasRegistry(path, filepath.Join(t.TempDir(), "missing.json"), reg.inventory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []*AliasRegistry{reg, reloaded} {
+		if _, ok := r.Lookup(model.ExternalSystemOutlook, "a001@example.com"); ok {
+			t.Error("the removed alias is still registered")
+		}
+		if got, ok := r.Lookup(model.ExternalSystemBms, "AHU-1"); !ok || got.SpaceID != "TMV25-1. Sal" {
+			t.Errorf("got %+v, %v, want the replaced alias", got, ok)
+		}
+		if got := r.ForSpace("TMV25-1. Sal"); len(got) != 1 {
+			t.Errorf("got aliases %+v for the floor, want one", got)
+		}
+	}
+}
+
+func TestNewAliasRegistryRejectsInvalidAliases(t *testing.T) {
+	tests := []struct {
+		name    string
+		aliases string
+	}{
+		{name: "unknown system", aliases: `[{"system": "SAP", "externalId": "x", "spaceId": "TMV25"}]`},
+		{name: "without space", aliases: `[{"system": "BMS", "externalId": "x"}]`},
+		{name: "registered twice", aliases: `[{"system": "BMS", "externalId": "x", "spaceId": "TMV25"}, {"system": "BMS", "externalId": "X", "spaceId": "TMV27"}]`},
+		{name: "not a list", aliases: `{"system": "BMS"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			inventory, err := NewInventory(testBuildings(), nil, filepath.Join(dir, "inventory-changes.jsonl"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(dir, "aliases.json")
+			if err := os.WriteFile(path, []byte(tt.aliases), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := NewAliasRegistry(path, "", inventory); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,380 @@
+package graph
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/LarsDepuydt/masterthesis-api-aggregation/service-FMS/graph/model"
+)
+
+// Columns of the room attribute files. Only the room number is required.
+const (
+	attributeColumnBuilding   = "buildingId"
+	attributeColumnRoom       = "roomNumber"
+	attributeColumnCapacity   = "capacity"
+	attributeColumnSeats      = "seatCount"
+	attributeColumnEquipment  = "avEquipment"
+	attributeColumnAccessible = "wheelchairAccessible"
+	attributeColumnBookable   = "bookable"
+)
+
+// equipmentSynonyms maps alternative names used in attribute files to the
+// equipment they denote.
+var equipmentSynonyms = map[string]model.AVEquipment{
+	"SCREEN":          model.AVEquipmentDisplay,
+	"TV":              model.AVEquipmentDisplay,
+	"SKÆRM":           model.AVEquipmentDisplay,
+	"PROJEKTOR":       model.AVEquipmentProjector,
+	"VIDEOCONFERENCE": model.AVEquipmentVideoConference,
+	"VIDEOMØDE":       model.AVEquipmentVideoConference,
+	"HØJTTALERE":      model.AVEquipmentSpeakers,
+	"MIKROFON":        model.AVEquipmentMicrophone,
+	"TAVLE":           model.AVEquipmentWhiteboard,
+}
+
+// RoomAttributes holds the attributes of a room that are not part of the FMS
+// export. Nil values are unknown.
+type RoomAttributes struct {
+	Capacity             *int32
+	SeatCount            *int32
+	AVEquipment          []model.AVEquipment
+	WheelchairAccessible *bool
+	Bookable             *bool
+}
+
+// HasEquipment reports whether all of the given equipment is available.
+func (a *RoomAttributes) HasEquipment(equipment []model.AVEquipment) bool {
+	for _, e := range equipment {
+		found := false
+		for _, available := range a.AVEquipment {
+			found = found || available == e
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// RoomAttributeIndex provides the supplementary attributes of all rooms. The
+// attributes are joined to rooms by building and room number, so they also
+// apply to rooms added to the inventory later on.
+type RoomAttributeIndex struct {
+	rooms map[string]*RoomAttributes
+}
+
+// roomAttributeKey identifies a room by building and room number.
+func roomAttributeKey(buildingID, roomNumber string) string {
+	return buildingID + "|" + strings.ToLower(strings.TrimSpace(roomNumber))
+}
+
+// Room returns the attributes of a room. Rooms without imported attributes
+// get an empty set of attributes.
+func (idx *RoomAttributeIndex) Room(room *model.Room) *RoomAttributes {
+	if idx != nil && room.Floor != nil && room.Floor.Building != nil {
+		if attrs, ok := idx.rooms[roomAttributeKey(room.Floor.Building.ID, room.RoomNumber)]; ok {
+			return attrs
+		}
+	}
+	return &RoomAttributes{}
+}
+
+// LoadRoomAttributes imports the room attributes from all CSV files in dir,
+// in lexical order, producing an import report per file. Files must have a
+// roomNumber column and may have buildingId, capacity, seatCount,
+// avEquipment (separated by ';'), wheelchairAccessible and bookable columns.
+// Empty cells leave the attribute unknown, so several files can each provide
+// some of the attributes of a room. Without a buildingId, the room number
+// must identify a single room among all buildings. Problems with single
+// files only appear in the reports; an error is returned if the directory
+// cannot be searched.
+func LoadRoomAttributes(dir string, buildingsData map[string]*model.Building) (*RoomAttributeIndex, []*model.ImportReport, error) {
+	index := &RoomAttributeIndex{rooms: make(map[string]*RoomAttributes)}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.csv"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to search room attribute directory %s: %w", dir, err)
+	}
+	if len(files) == 0 {
+		if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+			log.Printf("No room attribute directory found at %s, rooms will have no attributes", dir)
+		}
+		return index, nil, nil
+	}
+	sort.Strings(files)
+
+	reports := make([]*model.ImportReport, 0, len(files))
+	for _, file := range files {
+		report := newImportReport("", "attributes", file)
+		reports = append(reports, report)
+		if err := loadRoomAttributeFile(file, buildingsData, index, report); err != nil {
+			addIssue(report, model.ImportIssueSeverityError, 0, "", err.Error())
+			continue
+		}
+		log.Printf("Imported attributes of %d of %d rooms from %s with %d errors and %d warnings",
+			report.ImportedRowCount, report.RowCount, file, report.ErrorCount, report.WarningCount)
+	}
+	return index, reports, nil
+}
+
+// loadRoomAttributeFile imports a single room attribute file into index.
+// Rows with errors are skipped and reported.
+func loadRoomAttributeFile(file string, buildingsData map[string]*model.Building, index *RoomAttributeIndex, report *model.ImportReport) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("error opening CSV file: %w", err)
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1 // Rows with a wrong number of fields are reported below
+	records, err := reader.ReadAll()
+	if err != nil {
+		return fmt.Errorf("error reading CSV file: %w", err)
+	}
+	if len(records) < 1 {
+		return fmt.Errorf("file is empty")
+	}
+	report.RowCount = int32(len(records) - 1)
+
+	header := records[0]
+	if indexOf(header, attributeColumnRoom) == -1 {
+		addIssue(report, model.ImportIssueSeverityError, 1, attributeColumnRoom, "required column is missing")
+		return fmt.Errorf("file is missing required columns")
+	}
+	value := func(row []string, column string) string {
+		if idx := indexOf(header, column); idx != -1 {
+			return strings.TrimSpace(row[idx])
+		}
+		return ""
+	}
+
+	// Buildings referred to by the file, and the line on which each room was
+	// first seen to detect duplicates
+	buildingIDs := make(map[string]bool)
+	seenRooms := make(map[string]int)
+
+	for i, row := range records[1:] {
+		line := i + 2
+		if len(row) != len(header) {
+			addIssue(report, model.ImportIssueSeverityError, line, "",
+				fmt.Sprintf("row has %d fields, expected %d", len(row), len(header)))
+			continue
+		}
+
+		roomNumber := value(row, attributeColumnRoom)
+		if roomNumber == "" {
+			addIssue(report, model.ImportIssueSeverityError, line, attributeColumnRoom, "value is empty")
+			continue
+		}
+
+		// Determine the building the room belongs to
+		buildingID := value(row, attributeColumnBuilding)
+		if buildingID != "" {
+			building, ok := buildingsData[buildingID]
+			if !ok {
+				addIssue(report, model.ImportIssueSeverityError, line, attributeColumnBuilding, fmt.Sprintf("unknown building %q", buildingID))
+				continue
+			}
+			if len(findRoomsByNumber(map[string]*model.Building{buildingID: building}, roomNumber)) == 0 {
+				addIssue(report, model.ImportIssueSeverityWarning, line, attributeColumnRoom,
+					fmt.Sprintf("room %s does not exist in building %s yet, its attributes apply once it is added", roomNumber, buildingID))
+			}
+		} else {
+			rooms := findRoomsByNumber(buildingsData, roomNumber)
+			if len(rooms) == 0 {
+				addIssue(report, model.ImportIssueSeverityWarning, line, attributeColumnRoom,
+					fmt.Sprintf("unknown room %s, specify the buildingId to import its attributes", roomNumber))
+				continue
+			}
+			if len(rooms) > 1 {
+				addIssue(report, model.ImportIssueSeverityError, line, attributeColumnRoom,
+					fmt.Sprintf("room number %s exists in several buildings, specify the buildingId", roomNumber))
+				continue
+			}
+			buildingID = rooms[0].Floor.Building.ID
+		}
+
+		key := roomAttributeKey(buildingID, roomNumber)
+		if firstLine, duplicate := seenRooms[key]; duplicate {
+			addIssue(report, model.ImportIssueSeverityError, line, attributeColumnRoom,
+				fmt.Sprintf("room %s of building %s is a duplicate of row %d", roomNumber, buildingID, firstLine))
+			continue
+		}
+
+		attrs, valid := parseRoomAttributes(line, func(column string) string { return value(row, column) }, report)
+		if !valid {
+			continue
+		}
+		seenRooms[key] = line
+		buildingIDs[buildingID] = true
+
+		// Attributes from earlier files are kept unless this file provides them
+		existing, ok := index.rooms[key]
+		if !ok {
+			existing = &RoomAttributes{}
+			index.rooms[key] = existing
+		}
+		if attrs.Capacity != nil {
+			existing.Capacity = attrs.Capacity
+		}
+		if attrs.SeatCount != nil {
+			existing.SeatCount = attrs.SeatCount
+		}
+		if attrs.AVEquipment != nil {
+			existing.AVEquipment = attrs.AVEquipment
+		}
+		if attrs.WheelchairAccessible != nil {
+			existing.WheelchairAccessible = attrs.WheelchairAccessible
+		}
+		if attrs.Bookable != nil {
+			existing.Bookable = attrs.Bookable
+		}
+		report.ImportedRowCount++
+	}
+
+	if len(buildingIDs) == 1 {
+		for buildingID := range buildingIDs {
+			report.BuildingID = buildingID
+		}
+	}
+	return nil
+}
+
+// parseRoomAttributes parses the attribute columns of a row. It reports
+// whether the row is valid.
+func parseRoomAttributes(line int, value func(column string) string, report *model.ImportReport) (*RoomAttributes, bool) {
+	attrs := &RoomAttributes{}
+	valid := true
+
+	for _, field := range []struct {
+		column string
+		target **int32
+	}{
+		{attributeColumnCapacity, &attrs.Capacity},
+		{attributeColumnSeats, &attrs.SeatCount},
+	} {
+		raw := value(field.column)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(raw, 10, 32)
+		if err != nil || n < 0 {
+			addIssue(report, model.ImportIssueSeverityError, line, field.column, fmt.Sprintf("invalid count %q", raw))
+			valid = false
+			continue
+		}
+		count := int32(n)
+		*field.target = &count
+	}
+	if attrs.Capacity != nil && attrs.SeatCount != nil && *attrs.SeatCount > *attrs.Capacity {
+		addIssue(report, model.ImportIssueSeverityWarning, line, attributeColumnSeats,
+			fmt.Sprintf("room has %d seats but a capacity of %d", *attrs.SeatCount, *attrs.Capacity))
+	}
+
+	for _, field := range []struct {
+		column string
+		target **bool
+	}{
+		{attributeColumnAccessible, &attrs.WheelchairAccessible},
+		{attributeColumnBookable, &attrs.Bookable},
+	} {
+		raw := value(field.column)
+		if raw == "" {
+			continue
+		}
+		b, err := parseAttributeBool(raw)
+		if err != nil {
+			addIssue(report, model.ImportIssueSeverityError, line, field.column, err.Error())
+			valid = false
+			continue
+		}
+		*field.target = &b
+	}
+
+	if raw := value(attributeColumnEquipment); raw != "" {
+		// An explicit "none" records that the room has no equipment
+		attrs.AVEquipment = []model.AVEquipment{}
+		for _, name := range strings.FieldsFunc(raw, func(r rune) bool { return r == ';' || r == ',' }) {
+			name = strings.ToUpper(strings.TrimSpace(name))
+			name = strings.NewReplacer(" ", "_", "-", "_").Replace(name)
+			if name == "" || name == "NONE" || name == "INGEN" {
+				continue
+			}
+			equipment := model.AVEquipment(name)
+			if synonym, ok := equipmentSynonyms[name]; ok {
+				equipment = synonym
+			}
+			if !equipment.IsValid() {
+				addIssue(report, model.ImportIssueSeverityWarning, line, attributeColumnEquipment, fmt.Sprintf("unknown equipment %q is ignored", name))
+				continue
+			}
+			if !attrs.HasEquipment([]model.AVEquipment{equipment}) {
+				attrs.AVEquipment = append(attrs.AVEquipment, equipment)
+			}
+		}
+	}
+
+	return attrs, valid
+}
+
+// parseAttributeBool parses a yes/no value in English or Danish.
+func parseAttributeBool(raw string) (bool, error) {
+	switch strings.ToLower(raw) {
+	case "true", "yes", "ja", "1", "x":
+		return true, nil
+	case "false", "no", "nej", "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid yes/no value %q", raw)
+}
+
+// matchesRoomFilter reports whether a room meets all criteria of filter.
+func matchesRoomFilter(room *model.Room, attrs *RoomAttributes, filter *model.RoomFilter) bool {
+	if filter == nil {
+		return true
+	}
+	floor := room.Floor
+	if len(filter.BuildingIds) > 0 && (floor == nil || floor.Building == nil || !slices.Contains(filter.BuildingIds, floor.Building.ID)) {
+		return false
+	}
+	if len(filter.FloorIds) > 0 && (floor == nil || !slices.Contains(filter.FloorIds, floor.ID)) {
+		return false
+	}
+	if filter.FloorLevel != nil && (floor == nil || floor.Level != *filter.FloorLevel) {
+		return false
+	}
+	if len(filter.Types) > 0 {
+		matches := false
+		for _, t := range filter.Types {
+			matches = matches || strings.EqualFold(strings.TrimSpace(t), strings.TrimSpace(room.Type))
+		}
+		if !matches {
+			return false
+		}
+	}
+	if filter.MinCapacity != nil && (attrs.Capacity == nil || *attrs.Capacity < *filter.MinCapacity) {
+		return false
+	}
+	if filter.MinSeatCount != nil && (attrs.SeatCount == nil || *attrs.SeatCount < *filter.MinSeatCount) {
+		return false
+	}
+	if !attrs.HasEquipment(filter.AvEquipment) {
+		return false
+	}
+	if filter.WheelchairAccessible != nil && (attrs.WheelchairAccessible == nil || *attrs.WheelchairAccessible != *filter.WheelchairAccessible) {
+		return false
+	}
+	if filter.Bookable != nil && (attrs.Bookable == nil || *attrs.Bookable != *filter.Bookable) {
+		return false
+	}
+	return true
+}
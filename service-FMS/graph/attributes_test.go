@@ -0,0 +1,195 @@
+package graph
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/LarsDepuydt/masterthesis-api-aggregation/service-FMS/graph/model"
+)
+
+func TestLoadRoomAttributes(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"1-capacity.csv": "buildingId,roomNumber,capacity,seatCount,bookable\n" +
+			"TMV25,A.001,12,10,ja\n" +
+			"TMV27,a.001,4,6,nej\n" +
+			"TMV29,A.001,4,4,ja\n" +
+			"TMV25,A.001,8,8,ja\n" +
+			"TMV25,C.301,20,,yes\n",
+		"2-equipment.csv": "roomNumber,avEquipment,wheelchairAccessible\n" +
+			"B.101,Projektor; tavle; hologram,x\n" +
+			"A.001,,\n" +
+			"B.102,TV,maybe\n" +
+			"TMV25-C.301,,\n",
+		"notes.txt": "ignored",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// C.301 does not exist yet and the only row for B.102 is invalid
+	buildings := testBuildings()
+	addImportedRoom(buildings["TMV25"], "1. Sal", 1, &model.Room{RoomNumber: "B.102", Type: "office", Area: 10, Circumference: 13})
+	index, reports, err := LoadRoomAttributes(dir, buildings)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	wantIssues := [][]issueKey{
+		{
+			{model.ImportIssueSeverityWarning, 3, attributeColumnSeats},
+			{model.ImportIssueSeverityError, 4, attributeColumnBuilding},
+			{model.ImportIssueSeverityError, 5, attributeColumnRoom},
+			{model.ImportIssueSeverityWarning, 6, attributeColumnRoom},
+		},
+		{
+			{model.ImportIssueSeverityWarning, 2, attributeColumnEquipment},
+			{model.ImportIssueSeverityError, 3, attributeColumnRoom},
+			{model.ImportIssueSeverityError, 4, attributeColumnAccessible},
+			{model.ImportIssueSeverityWarning, 5, attributeColumnRoom},
+		},
+	}
+	if len(reports) != len(wantIssues) {
+		t.Fatalf("got %d reports, want one per CSV file", len(reports))
+	}
+	for i, report := range reports {
+		got := issueKeys(report)
+		if len(got) != len(wantIssues[i]) {
+			t.Errorf("report %s: got issues %v, want %v", report.Source, got, wantIssues[i])
+			continue
+		}
+		for j := range got {
+			if got[j] != wantIssues[i][j] {
+				t.Errorf("report %s, issue %d: got %v, want %v", report.Source, j, got[j], wantIssues[i][j])
+			}
+		}
+	}
+	if reports[0].BuildingID != "" || reports[1].BuildingID != "TMV25" {
+		t.Errorf("got building IDs %q and %q, want none for the file covering several buildings", reports[0].BuildingID, reports[1].BuildingID)
+	}
+
+	room := func(buildingID, roomNumber string) *model.Room {
+		building := &model.Building{ID: buildingID}
+		return &model.Room{RoomNumber: roomNumber, Floor: &model.Floor{Building: building}}
+	}
+	count := func(n int32) *int32 { return &n }
+	yes, no := true, false
+
+	tests := []struct {
+		room *model.Room
+		want RoomAttributes
+	}{
+		{room("TMV25", "A.001"), RoomAttributes{Capacity: count(12), SeatCount: count(10), Bookable: &yes}},
+		{room("TMV27", "A.001"), RoomAttributes{Capacity: count(4), SeatCount: count(6), Bookable: &no}},
+		{room("TMV25", "b.101"), RoomAttributes{AVEquipment: []model.AVEquipment{model.AVEquipmentProjector, model.AVEquipmentWhiteboard}, WheelchairAccessible: &yes}},
+		{room("TMV25", "C.301"), RoomAttributes{Capacity: count(20), Bookable: &yes}},
+		{room("TMV25", "B.102"), RoomAttributes{}},
+		{room("TMV27", "B.101"), RoomAttributes{}},
+	}
+	for _, tt := range tests {
+		got := index.Room(tt.room)
+		name := tt.room.Floor.Building.ID + " " + tt.room.RoomNumber
+		if !equalCounts(got.Capacity, tt.want.Capacity) || !equalCounts(got.SeatCount, tt.want.SeatCount) {
+			t.Errorf("%s: got capacity %v and seats %v, want %v and %v", name, got.Capacity, got.SeatCount, tt.want.Capacity, tt.want.SeatCount)
+		}
+		if !equalFlags(got.Bookable, tt.want.Bookable) || !equalFlags(got.WheelchairAccessible, tt.want.WheelchairAccessible) {
+			t.Errorf("%s: got bookable %v and accessible %v", name, got.Bookable, got.WheelchairAccessible)
+		}
+		if !slices.Equal(got.AVEquipment, tt.want.AVEquipment) {
+			t.Errorf("%s: got equipment %v, want %v", name, got.AVEquipment, tt.want.AVEquipment)
+		}
+	}
+}
+
+func equalCounts(a, b *int32) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+}
+
+func equalFlags(a, b *bool) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+}
+
+func TestLoadRoomAttributesAfterReplay(t *testing.T) {
+	// A room added through a mutation is only known after the change log is
+	// replayed, which is what its attributes are matched against
+	logPath := filepath.Join(t.TempDir(), "inventory-changes.jsonl")
+	entry := `{"sequence":1,"actor":"alice","operation":"CREATE","entityType":"ROOM","entityId":"TMV25-Stue-A.009",` +
+		`"after":{"id":"TMV25-Stue-A.009","floorId":"TMV25-Stue","roomNumber":"A.009","type":"office","area":10,"circumference":13}}` + "\n"
+	if err := os.WriteFile(logPath, []byte(entry), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	inventory, err := NewInventory(testBuildings(), nil, logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "attributes.csv"), []byte("roomNumber,capacity\nA.009,6\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	index, reports, err := LoadRoomAttributes(dir, inventory.Buildings())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reports[0].ErrorCount != 0 || reports[0].WarningCount != 0 {
+		t.Errorf("got issues %v", issueKeys(reports[0]))
+	}
+	if got := index.Room(findRoom(inventory.Buildings(), "TMV25-Stue-A.009")).Capacity; got == nil || *got != 6 {
+		t.Errorf("got capacity %v, want 6", got)
+	}
+}
+
+func TestLoadRoomAttributesDirectory(t *testing.T) {
+	index, reports, err := LoadRoomAttributes(filepath.Join(t.TempDir(), "missing"), testBuildings())
+	if err != nil || index == nil || len(reports) != 0 {
+		t.Errorf("missing directory: got %v, %v, %v, want an empty index", index, reports, err)
+	}
+	if _, _, err := LoadRoomAttributes(filepath.Join(t.TempDir(), "[attributes"), testBuildings()); err == nil {
+		t.Error("malformed directory name: expected an error")
+	}
+}
+
+func TestMatchesRoomFilter(t *testing.T) {
+	building := &model.Building{ID: "TMV25"}
+	floor := &model.Floor{ID: "TMV25-1. Sal", Level: 1, Building: building}
+	room := &model.Room{RoomNumber: "B.101", Type: " Meeting room", Floor: floor}
+	capacity, seats, yes := int32(10), int32(8), true
+	attrs := &RoomAttributes{
+		Capacity:    &capacity,
+		SeatCount:   &seats,
+		AVEquipment: []model.AVEquipment{model.AVEquipmentDisplay, model.AVEquipmentWhiteboard},
+		Bookable:    &yes,
+	}
+	count := func(n int32) *int32 { return &n }
+	flag := func(b bool) *bool { return &b }
+
+	tests := []struct {
+		name   string
+		filter *model.RoomFilter
+		want   bool
+	}{
+		{name: "no filter", want: true},
+		{name: "building", filter: &model.RoomFilter{BuildingIds: []string{"TMV23", "TMV25"}}, want: true},
+		{name: "other building", filter: &model.RoomFilter{BuildingIds: []string{"TMV23"}}},
+		{name: "floor level", filter: &model.RoomFilter{FloorLevel: count(1), FloorIds: []string{"TMV25-1. Sal"}}, want: true},
+		{name: "other floor level", filter: &model.RoomFilter{FloorLevel: count(0)}},
+		{name: "type in other case", filter: &model.RoomFilter{Types: []string{"office", "meeting ROOM"}}, want: true},
+		{name: "minimum capacity", filter: &model.RoomFilter{MinCapacity: count(10), MinSeatCount: count(8)}, want: true},
+		{name: "capacity too low", filter: &model.RoomFilter{MinCapacity: count(11)}},
+		{name: "available equipment", filter: &model.RoomFilter{AvEquipment: []model.AVEquipment{model.AVEquipmentWhiteboard}}, want: true},
+		{name: "missing equipment", filter: &model.RoomFilter{AvEquipment: []model.AVEquipment{model.AVEquipmentDisplay, model.AVEquipmentProjector}}},
+		{name: "bookable", filter: &model.RoomFilter{Bookable: flag(true)}, want: true},
+		{name: "not bookable", filter: &model.RoomFilter{Bookable: flag(false)}},
+		{name: "unknown accessibility", filter: &model.RoomFilter{WheelchairAccessible: flag(false)}},
+	}
+
+	for _, tt := range tests {
+		if got := matchesRoomFilter(room, attrs, tt.filter); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
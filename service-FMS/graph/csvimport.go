@@ -0,0 +1,392 @@
+package graph
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/LarsDepuydt/masterthesis-api-aggregation/service-FMS/graph/model"
+)
+
+// requiredColumns lists the columns the FMS export must contain.
+var requiredColumns = []string{"Gruppe", "Bygning", "Etage", "Rumnummer", "Areal", "Omkreds", "Ejendom", "Bynavn"}
+
+// csvImporter imports a building from an FMS CSV export.
+type csvImporter struct{}
+
+func (csvImporter) Import(source SpaceSource, report *model.ImportReport) (*model.Building, error) {
+	// Open the CSV file
+	f, err := os.Open(source.Path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening CSV file: %w", err)
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1 // Rows with a wrong number of fields are reported below
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("error reading CSV file: %w", err)
+	}
+	return importTable(records, source, report)
+}
+
+// xlsxImporter imports a building from an FMS export saved as an Excel
+// workbook. The first worksheet must have the same columns as the CSV export.
+type xlsxImporter struct{}
+
+func (xlsxImporter) Import(source SpaceSource, report *model.ImportReport) (*model.Building, error) {
+	records, err := readXLSXSheet(source.Path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading XLSX file: %w", err)
+	}
+	return importTable(records, source, report)
+}
+
+// importTable validates the rows of an FMS export and builds the building from
+// them. Rows with errors are skipped and reported.
+func importTable(records [][]string, source SpaceSource, report *model.ImportReport) (*model.Building, error) {
+	if len(records) < 1 {
+		return nil, fmt.Errorf("file is empty")
+	}
+	report.RowCount = int32(len(records) - 1)
+
+	// Get header indices
+	header := records[0]
+	columns := make(map[string]int)
+	for _, column := range requiredColumns {
+		idx := indexOf(header, column)
+		if idx == -1 {
+			addIssue(report, model.ImportIssueSeverityError, 1, column, "required column is missing")
+			continue
+		}
+		columns[column] = idx
+	}
+	if len(columns) < len(requiredColumns) {
+		return nil, fmt.Errorf("file is missing required columns")
+	}
+	idxGruppe := columns["Gruppe"]
+	idxBygning := columns["Bygning"]
+	idxEtage := columns["Etage"]
+	idxRumnummer := columns["Rumnummer"]
+	idxAreal := columns["Areal"]
+	idxOmkreds := columns["Omkreds"]
+	idxEjendom := columns["Ejendom"]
+	idxBynavn := columns["Bynavn"]
+
+	var b *model.Building
+
+	// Line number on which each room was first seen, to detect duplicates
+	seenRooms := make(map[string]int)
+
+	// Process each row (skip header)
+	for i, row := range records[1:] {
+		line := i + 2
+		if len(row) != len(header) {
+			addIssue(report, model.ImportIssueSeverityError, line, "",
+				fmt.Sprintf("row has %d fields, expected %d", len(row), len(header)))
+			continue
+		}
+
+		buildingAddress := strings.TrimSpace(row[idxBygning])
+		floorName := strings.TrimSpace(row[idxEtage])
+		roomNumber := strings.TrimSpace(row[idxRumnummer])
+
+		valid := true
+		for _, field := range []struct{ column, value string }{
+			{"Bygning", buildingAddress},
+			{"Etage", floorName},
+			{"Rumnummer", roomNumber},
+		} {
+			if field.value == "" {
+				addIssue(report, model.ImportIssueSeverityError, line, field.column, "value is empty")
+				valid = false
+			}
+		}
+
+		// Convert area and circumference values
+		area, err := strconv.ParseFloat(strings.TrimSpace(row[idxAreal]), 64)
+		if err != nil {
+			addIssue(report, model.ImportIssueSeverityError, line, "Areal", fmt.Sprintf("invalid number %q", row[idxAreal]))
+			valid = false
+		} else if area <= 0 {
+			addIssue(report, model.ImportIssueSeverityError, line, "Areal", fmt.Sprintf("area must be positive, got %g", area))
+			valid = false
+		}
+		circumference, err := strconv.ParseFloat(strings.TrimSpace(row[idxOmkreds]), 64)
+		if err != nil {
+			addIssue(report, model.ImportIssueSeverityError, line, "Omkreds", fmt.Sprintf("invalid number %q", row[idxOmkreds]))
+			valid = false
+		} else if circumference <= 0 {
+			addIssue(report, model.ImportIssueSeverityError, line, "Omkreds", fmt.Sprintf("circumference must be positive, got %g", circumference))
+			valid = false
+		}
+
+		level, err := parseFloorLevel(floorName)
+		if floorName != "" && err != nil {
+			addIssue(report, model.ImportIssueSeverityError, line, "Etage", err.Error())
+			valid = false
+		}
+
+		if b != nil && buildingAddress != "" && buildingAddress != b.Address {
+			addIssue(report, model.ImportIssueSeverityError, line, "Bygning",
+				fmt.Sprintf("row belongs to %q, but this source imports building %s at %q", buildingAddress, b.ID, b.Address))
+			valid = false
+		}
+
+		roomKey := floorName + "|" + roomNumber
+		if firstLine, duplicate := seenRooms[roomKey]; duplicate && roomNumber != "" {
+			addIssue(report, model.ImportIssueSeverityError, line, "Rumnummer",
+				fmt.Sprintf("room %s on floor %s is a duplicate of row %d", roomNumber, floorName, firstLine))
+			valid = false
+		}
+		if !valid {
+			continue
+		}
+		seenRooms[roomKey] = line
+
+		if strings.TrimSpace(row[idxGruppe]) == "" {
+			addIssue(report, model.ImportIssueSeverityWarning, line, "Gruppe", "room type is empty")
+		}
+
+		// Create the Building from the first valid row
+		if b == nil {
+			b = &model.Building{
+				ID:       source.BuildingID,
+				Address:  buildingAddress,
+				City:     row[idxBynavn],
+				Property: row[idxEjendom],
+				Floors:   []*model.Floor{},
+			}
+		} else if b.City != row[idxBynavn] || b.Property != row[idxEjendom] {
+			addIssue(report, model.ImportIssueSeverityWarning, line, "",
+				fmt.Sprintf("city or property differs from earlier rows of building %q, keeping %q, %q", buildingAddress, b.City, b.Property))
+		}
+
+		addImportedRoom(b, floorName, level, &model.Room{
+			RoomNumber:    roomNumber,
+			Type:          row[idxGruppe],
+			Area:          area,
+			Circumference: circumference,
+		})
+		report.ImportedRowCount++
+	}
+
+	if b == nil {
+		return nil, fmt.Errorf("file contains no valid rows")
+	}
+	return b, nil
+}
+
+// indexOf returns the index of target in slice or -1 if not found.
+func indexOf(slice []string, target string) int {
+	for i, v := range slice {
+		if v == target {
+			return i
+		}
+	}
+	return -1
+}
+
+// xlsxMaxRows and xlsxMaxColumns are the dimensions of an Excel worksheet.
+const (
+	xlsxMaxRows    = 1048576
+	xlsxMaxColumns = 16384
+)
+
+// xlsxWorkbook, xlsxRelationships, xlsxSharedStrings and xlsxWorksheet are
+// the subsets of the SpreadsheetML parts needed to read cell values.
+type xlsxWorkbook struct {
+	Sheets []struct {
+		RelationshipID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxSharedStrings struct {
+	Items []xlsxRichText `xml:"si"`
+}
+
+type xlsxRichText struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+// String returns the plain text of a possibly formatted string.
+func (t xlsxRichText) String() string {
+	if len(t.Runs) == 0 {
+		return t.Text
+	}
+	var b strings.Builder
+	for _, run := range t.Runs {
+		b.WriteString(run.Text)
+	}
+	return b.String()
+}
+
+type xlsxWorksheet struct {
+	Rows []struct {
+		Number int `xml:"r,attr"`
+		Cells  []struct {
+			Reference string       `xml:"r,attr"`
+			Type      string       `xml:"t,attr"`
+			Value     string       `xml:"v"`
+			Inline    xlsxRichText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// readXLSXSheet reads the cell values of the first worksheet of an Excel
+// workbook. Missing cells are returned as empty strings, so every row has as
+// many fields as the widest row.
+func readXLSXSheet(filename string) ([][]string, error) {
+	archive, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	files := make(map[string]*zip.File)
+	for _, f := range archive.File {
+		files[f.Name] = f
+	}
+	decode := func(name string, v any) error {
+		f, ok := files[name]
+		if !ok {
+			return fmt.Errorf("workbook part %s not found", name)
+		}
+		r, err := f.Open()
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		if err := xml.NewDecoder(r).Decode(v); err != nil && err != io.EOF {
+			return fmt.Errorf("invalid workbook part %s: %w", name, err)
+		}
+		return nil
+	}
+
+	// Find the first worksheet through the workbook relationships
+	sheetPart := "xl/worksheets/sheet1.xml"
+	var workbook xlsxWorkbook
+	var relationships xlsxRelationships
+	if err := decode("xl/workbook.xml", &workbook); err != nil {
+		return nil, err
+	}
+	if len(workbook.Sheets) == 0 {
+		return nil, fmt.Errorf("workbook contains no worksheets")
+	}
+	if err := decode("xl/_rels/workbook.xml.rels", &relationships); err == nil {
+		for _, rel := range relationships.Relationships {
+			if rel.ID != workbook.Sheets[0].RelationshipID {
+				continue
+			}
+			if strings.HasPrefix(rel.Target, "/") {
+				sheetPart = strings.TrimPrefix(rel.Target, "/")
+			} else {
+				sheetPart = path.Join("xl", rel.Target)
+			}
+		}
+	}
+
+	var sharedStrings xlsxSharedStrings
+	if _, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := decode("xl/sharedStrings.xml", &sharedStrings); err != nil {
+			return nil, err
+		}
+	}
+
+	var sheet xlsxWorksheet
+	if err := decode(sheetPart, &sheet); err != nil {
+		return nil, err
+	}
+
+	var records [][]string
+	width := 0
+	for _, row := range sheet.Rows {
+		if row.Number > xlsxMaxRows {
+			return nil, fmt.Errorf("row number %d exceeds the maximum of %d rows", row.Number, xlsxMaxRows)
+		}
+		// Rows may be omitted when empty, keep the line numbers intact
+		for row.Number > len(records)+1 {
+			records = append(records, nil)
+		}
+
+		record := []string{}
+		column := -1
+		for _, cell := range row.Cells {
+			// Cells without a reference follow the previous cell
+			column++
+			if cell.Reference != "" {
+				if column, err = xlsxColumnIndex(cell.Reference); err != nil {
+					return nil, err
+				}
+			}
+			for len(record) <= column {
+				record = append(record, "")
+			}
+
+			switch cell.Type {
+			case "s":
+				idx, err := strconv.Atoi(cell.Value)
+				if err != nil || idx < 0 || idx >= len(sharedStrings.Items) {
+					return nil, fmt.Errorf("cell %s refers to unknown shared string %q", cell.Reference, cell.Value)
+				}
+				record[column] = sharedStrings.Items[idx].String()
+			case "inlineStr":
+				record[column] = cell.Inline.String()
+			default:
+				record[column] = cell.Value
+			}
+		}
+		records = append(records, record)
+		width = max(width, len(record))
+	}
+
+	// Drop trailing empty rows and pad the others to the same width
+	for len(records) > 0 && strings.Join(records[len(records)-1], "") == "" {
+		records = records[:len(records)-1]
+	}
+	for i := range records {
+		for len(records[i]) < width {
+			records[i] = append(records[i], "")
+		}
+	}
+	return records, nil
+}
+
+// xlsxColumnIndex converts a cell reference such as "AB12" into the zero
+// based index of its column. References that are malformed or lie beyond the
+// last column of a worksheet, XFD, are rejected.
+func xlsxColumnIndex(reference string) (int, error) {
+	letters := strings.IndexFunc(reference, func(r rune) bool { return r < 'A' || r > 'Z' })
+	if letters <= 0 {
+		return 0, fmt.Errorf("invalid cell reference %q", reference)
+	}
+	if row, err := strconv.Atoi(reference[letters:]); err != nil || row < 1 {
+		return 0, fmt.Errorf("invalid cell reference %q", reference)
+	}
+
+	column := 0
+	for _, r := range reference[:letters] {
+		column = column*26 + int(r-'A'+1)
+		if column > xlsxMaxColumns {
+			return 0, fmt.Errorf("cell reference %q lies beyond the last column XFD", reference)
+		}
+	}
+	return column - 1, nil
+}
@@ -0,0 +1,377 @@
+package graph
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/LarsDepuydt/masterthesis-api-aggregation/service-FMS/graph/model"
+)
+
+// csvHeader is the header of the FMS export.
+const csvHeader = "Gruppe,Undergruppe,Bygning,Etage,Rumnummer,Areal,Omkreds,Ejendom,Bynavn"
+
+// csvRecords splits CSV lines into records.
+func csvRecords(lines ...string) [][]string {
+	records := make([][]string, len(lines))
+	for i, line := range lines {
+		records[i] = strings.Split(line, ",")
+	}
+	return records
+}
+
+// issueKey identifies an import issue by its severity, row and column.
+type issueKey struct {
+	severity model.ImportIssueSeverity
+	row      int32
+	column   string
+}
+
+func issueKeys(report *model.ImportReport) []issueKey {
+	var keys []issueKey
+	for _, issue := range report.Issues {
+		key := issueKey{severity: issue.Severity}
+		if issue.Row != nil {
+			key.row = *issue.Row
+		}
+		if issue.Column != nil {
+			key.column = *issue.Column
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func TestImportTable(t *testing.T) {
+	const valid = "LAGER,,Main Street 25,Stue,A.001,6,10,Main Street,Aalborg"
+	errorAt := func(row int32, column string) issueKey {
+		return issueKey{model.ImportIssueSeverityError, row, column}
+	}
+	warningAt := func(row int32, column string) issueKey {
+		return issueKey{model.ImportIssueSeverityWarning, row, column}
+	}
+
+	tests := []struct {
+		name         string
+		records      [][]string
+		wantErr      bool
+		wantImported int32
+		wantIssues   []issueKey
+	}{
+		{
+			name: "valid rows",
+			records: csvRecords(csvHeader, valid,
+				"KONTOR,,Main Street 25,1. Sal,B.101,12.5,14.2,Main Street,Aalborg",
+				"KONTOR,,Main Street 25,Kælder,K.01,8,12,Main Street,Aalborg"),
+			wantImported: 3,
+		},
+		{
+			name:       "missing columns",
+			records:    csvRecords("Gruppe,Bygning,Etage,Rumnummer,Areal,Ejendom,Bynavn", "LAGER,Main Street 25,Stue,A.001,6,Main Street,Aalborg"),
+			wantErr:    true,
+			wantIssues: []issueKey{errorAt(1, "Omkreds")},
+		},
+		{
+			name:         "wrong number of fields",
+			records:      csvRecords(csvHeader, valid, "LAGER,,Main Street 25,Stue,A.002,6,10"),
+			wantImported: 1,
+			wantIssues:   []issueKey{errorAt(3, "")},
+		},
+		{
+			name:         "empty values",
+			records:      csvRecords(csvHeader, valid, "LAGER,,Main Street 25, ,,6,10,Main Street,Aalborg"),
+			wantImported: 1,
+			wantIssues:   []issueKey{errorAt(3, "Etage"), errorAt(3, "Rumnummer")},
+		},
+		{
+			name:         "invalid numbers",
+			records:      csvRecords(csvHeader, valid, "LAGER,,Main Street 25,Stue,A.002,6m2,-1,Main Street,Aalborg"),
+			wantImported: 1,
+			wantIssues:   []issueKey{errorAt(3, "Areal"), errorAt(3, "Omkreds")},
+		},
+		{
+			name:         "unknown floor",
+			records:      csvRecords(csvHeader, valid, "LAGER,,Main Street 25,Loft,A.002,6,10,Main Street,Aalborg"),
+			wantImported: 1,
+			wantIssues:   []issueKey{errorAt(3, "Etage")},
+		},
+		{
+			name:         "duplicate room",
+			records:      csvRecords(csvHeader, valid, valid),
+			wantImported: 1,
+			wantIssues:   []issueKey{errorAt(3, "Rumnummer")},
+		},
+		{
+			name:         "other building",
+			records:      csvRecords(csvHeader, valid, "LAGER,,Main Street 27,Stue,A.002,6,10,Main Street,Aalborg"),
+			wantImported: 1,
+			wantIssues:   []issueKey{errorAt(3, "Bygning")},
+		},
+		{
+			name:         "warnings",
+			records:      csvRecords(csvHeader, valid, ",,Main Street 25,Stue,A.002,6,10,Main Street,Aarhus"),
+			wantImported: 2,
+			wantIssues:   []issueKey{warningAt(3, "Gruppe"), warningAt(3, "")},
+		},
+		{
+			name:       "no valid rows",
+			records:    csvRecords(csvHeader, "LAGER,,Main Street 25,Stue,A.001,0,10,Main Street,Aalborg"),
+			wantErr:    true,
+			wantIssues: []issueKey{errorAt(2, "Areal")},
+		},
+		{
+			name:    "empty file",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := newImportReport("MS25", "csv", "test.csv")
+			building, err := importTable(tt.records, SpaceSource{BuildingID: "MS25"}, report)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+
+			got := issueKeys(report)
+			if len(got) != len(tt.wantIssues) {
+				t.Fatalf("got issues %v, want %v", got, tt.wantIssues)
+			}
+			for i := range got {
+				if got[i] != tt.wantIssues[i] {
+					t.Errorf("issue %d: got %v, want %v", i, got[i], tt.wantIssues[i])
+				}
+			}
+			var errors, warnings int32
+			for _, key := range got {
+				if key.severity == model.ImportIssueSeverityError {
+					errors++
+				} else {
+					warnings++
+				}
+			}
+			if report.ErrorCount != errors || report.WarningCount != warnings {
+				t.Errorf("got %d errors and %d warnings, counted %d and %d", report.ErrorCount, report.WarningCount, errors, warnings)
+			}
+			if report.ImportedRowCount != tt.wantImported {
+				t.Errorf("got %d imported rows, want %d", report.ImportedRowCount, tt.wantImported)
+			}
+			if err != nil {
+				return
+			}
+
+			rooms := int32(0)
+			for _, floor := range building.Floors {
+				for _, room := range floor.Rooms {
+					if room.ID != floor.ID+"-"+room.RoomNumber || floor.ID != "MS25-"+floor.Name {
+						t.Errorf("room %s on floor %s has an unexpected ID", room.ID, floor.ID)
+					}
+					rooms++
+				}
+			}
+			if rooms != tt.wantImported {
+				t.Errorf("got %d rooms, want %d", rooms, tt.wantImported)
+			}
+		})
+	}
+}
+
+func TestCSVImporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "export.csv")
+	content := csvHeader + "\n" + `LAGER,,Main Street 25,Stue,A.001,6,10,Main Street,"Aalborg, Denmark"` + "\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	report := newImportReport("MS25", "csv", path)
+	building, err := csvImporter{}.Import(SpaceSource{BuildingID: "MS25", Path: path}, report)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if building.City != "Aalborg, Denmark" || report.RowCount != 1 || report.ImportedRowCount != 1 {
+		t.Errorf("got building %+v and report %+v", building, report)
+	}
+
+	if _, err := (csvImporter{}).Import(SpaceSource{BuildingID: "MS25", Path: path + ".missing"}, report); err == nil {
+		t.Error("missing file: expected an error")
+	}
+}
+
+// writeXLSX writes a workbook with a single worksheet of the given rows and
+// shared strings.
+func writeXLSX(t *testing.T, sharedStrings []string, rows string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "export.xlsx")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var items strings.Builder
+	for _, s := range sharedStrings {
+		items.WriteString("<si><t>" + s + "</t></si>")
+	}
+	parts := map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Rooms" sheetId="1" r:id="rId1"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Target="worksheets/rooms.xml"/></Relationships>`,
+		"xl/sharedStrings.xml":    `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` + items.String() + `</sst>`,
+		"xl/worksheets/rooms.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` + rows + `</sheetData></worksheet>`,
+	}
+	archive := zip.NewWriter(f)
+	for name, content := range parts {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadXLSXSheet(t *testing.T) {
+	tests := []struct {
+		name    string
+		rows    string
+		want    [][]string
+		wantErr bool
+	}{
+		{
+			name: "shared, inline and numeric values",
+			rows: `<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="inlineStr"><is><r><t>Are</t></r><r><t>al</t></r></is></c></row>
+<row r="2"><c r="A2" t="s"><v>1</v></c><c r="B2"><v>12.5</v></c></row>`,
+			want: [][]string{{"Rumnummer", "Areal"}, {"A.001", "12.5"}},
+		},
+		{
+			name: "omitted cells and rows",
+			rows: `<row r="1"><c r="A1"><v>1</v></c><c r="C1"><v>3</v></c></row>
+<row r="3"><c r="B3"><v>2</v></c></row>`,
+			want: [][]string{{"1", "", "3"}, {"", "", ""}, {"", "2", ""}},
+		},
+		{
+			name: "cells without reference",
+			rows: `<row r="1"><c r="B1"><v>2</v></c><c><v>3</v></c></row>`,
+			want: [][]string{{"", "2", "3"}},
+		},
+		{
+			name: "trailing empty rows",
+			rows: `<row r="1"><c r="A1"><v>1</v></c></row><row r="2"><c r="A2"><v></v></c></row>`,
+			want: [][]string{{"1"}},
+		},
+		{
+			name:    "unknown shared string",
+			rows:    `<row r="1"><c r="A1" t="s"><v>7</v></c></row>`,
+			wantErr: true,
+		},
+		{
+			name:    "reference without column",
+			rows:    `<row r="1"><c r="12"><v>1</v></c></row>`,
+			wantErr: true,
+		},
+		{
+			name:    "reference without row",
+			rows:    `<row r="1"><c r="A"><v>1</v></c></row>`,
+			wantErr: true,
+		},
+		{
+			name:    "reference beyond XFD",
+			rows:    `<row r="1"><c r="XFE1"><v>1</v></c></row>`,
+			wantErr: true,
+		},
+		{
+			name:    "very long reference",
+			rows:    `<row r="1"><c r="` + strings.Repeat("Z", 40) + `1"><v>1</v></c></row>`,
+			wantErr: true,
+		},
+		{
+			name:    "row beyond the last row",
+			rows:    `<row r="2000000"><c r="A2000000"><v>1</v></c></row>`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeXLSX(t, []string{"Rumnummer", "A.001"}, tt.rows)
+			got, err := readXLSXSheet(path)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if !slices.Equal(got[i], tt.want[i]) {
+					t.Errorf("row %d: got %q, want %q", i+1, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestXLSXColumnIndex(t *testing.T) {
+	tests := []struct {
+		reference string
+		want      int
+		wantErr   bool
+	}{
+		{reference: "A1", want: 0},
+		{reference: "Z9", want: 25},
+		{reference: "AA10", want: 26},
+		{reference: "XFD1048576", want: 16383},
+		{reference: "XFE1", wantErr: true},
+		{reference: "12", wantErr: true},
+		{reference: "a1", wantErr: true},
+		{reference: "B", wantErr: true},
+		{reference: "B0", wantErr: true},
+		{reference: "B1C", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := xlsxColumnIndex(tt.reference)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %d", tt.reference, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s: got %d, %v, want %d", tt.reference, got, err, tt.want)
+		}
+	}
+}
+
+func TestXLSXImporterReportsMalformedReferences(t *testing.T) {
+	path := writeXLSX(t, nil, `<row r="1"><c r="1"><v>1</v></c></row>`)
+	reports := mustLoadReports(t, SpaceSource{BuildingID: "MS25", Format: "xlsx", Path: path})
+	if reports[0].ErrorCount != 1 || !strings.Contains(reports[0].Issues[0].Message, `invalid cell reference "1"`) {
+		t.Errorf("got issues %+v, want the malformed reference", reports[0].Issues)
+	}
+}
+
+// mustLoadReports imports the given sources, which are expected to fail, and
+// returns their import reports.
+func mustLoadReports(t *testing.T, sources ...SpaceSource) []*model.ImportReport {
+	t.Helper()
+	_, _, reports, err := LoadBuildingData(sources)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	return reports
+}
@@ -0,0 +1,248 @@
+package graph
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FloorplanPathPrefix is the HTTP path under which floorplan files are served.
+const FloorplanPathPrefix = "/floorplans/"
+
+// maxFloorplanSize limits the size of an uploaded floorplan file.
+const maxFloorplanSize = 32 << 20
+
+// floorplanContentTypes lists the supported floorplan formats by file extension.
+var floorplanContentTypes = map[string]string{
+	".pdf": "application/pdf",
+	".svg": "image/svg+xml",
+}
+
+// floorplanFile describes the floorplan currently stored for a floor.
+type floorplanFile struct {
+	name    string
+	ext     string
+	modTime time.Time
+}
+
+// floorplanRecord is the state of a floorplan recorded in the inventory
+// change log.
+type floorplanRecord struct {
+	FloorID string `json:"floorId"`
+	File    string `json:"file"`
+}
+
+// FloorplanStore manages the floorplan files of all floors. Files are stored
+// in a single directory as "<floor ID>.pdf" or "<floor ID>.svg", with the
+// floor ID escaped as in a URL path, and served over HTTP by the store itself.
+type FloorplanStore struct {
+	dir     string
+	baseURL string
+
+	mu    sync.RWMutex
+	files map[string]floorplanFile // keyed by floor ID
+}
+
+// NewFloorplanStore creates the floorplan directory if needed and indexes the
+// floorplan files already present in it. baseURL is the externally reachable
+// address of this service and is used to build floorplan URLs.
+func NewFloorplanStore(dir, baseURL string) (*FloorplanStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create floorplan directory: %w", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read floorplan directory: %w", err)
+	}
+
+	s := &FloorplanStore{
+		dir:     dir,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		files:   make(map[string]floorplanFile),
+	}
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || floorplanContentTypes[ext] == "" {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat floorplan %s: %w", entry.Name(), err)
+		}
+		floorID, err := url.PathUnescape(strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name())))
+		if err != nil {
+			log.Printf("Ignoring floorplan %s, its name is not an escaped floor ID", entry.Name())
+			continue
+		}
+		s.files[floorID] = floorplanFile{name: entry.Name(), ext: ext, modTime: info.ModTime()}
+	}
+	log.Printf("Loaded %d floorplans from %s", len(s.files), dir)
+
+	return s, nil
+}
+
+// URL returns the URL of the floorplan of the given floor, or an empty string
+// if no floorplan is stored. The modification time is included so that
+// clients fetch the new file after a floorplan is replaced.
+func (s *FloorplanStore) URL(floorID string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	file, ok := s.files[floorID]
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("%s%s%s%s?v=%d", s.baseURL, FloorplanPathPrefix, url.PathEscape(floorID), file.ext, file.modTime.Unix())
+}
+
+// record returns the state of the floorplan of the given floor for the
+// change log, or nil if no floorplan is stored.
+func (s *FloorplanStore) record(floorID string) any {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	file, ok := s.files[floorID]
+	if !ok {
+		return nil
+	}
+	return floorplanRecord{FloorID: floorID, File: file.name}
+}
+
+// Save stores the floorplan of the given floor, replacing any existing one.
+// The format is detected from the file contents; only pdf and svg documents
+// are accepted.
+func (s *FloorplanStore) Save(floorID string, r io.Reader) error {
+	content, err := io.ReadAll(io.LimitReader(r, maxFloorplanSize+1))
+	if err != nil {
+		return fmt.Errorf("failed to read floorplan: %w", err)
+	}
+	if len(content) > maxFloorplanSize {
+		return fmt.Errorf("floorplan exceeds the maximum size of %d bytes", maxFloorplanSize)
+	}
+
+	ext, err := detectFloorplanFormat(content)
+	if err != nil {
+		return err
+	}
+	name, err := floorplanFileName(floorID, ext)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so readers never see a partial floorplan
+	tmp, err := os.CreateTemp(s.dir, ".upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to create floorplan file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write floorplan file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write floorplan file: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.Rename(tmp.Name(), filepath.Join(s.dir, name)); err != nil {
+		return fmt.Errorf("failed to store floorplan file: %w", err)
+	}
+	// Remove a previous floorplan stored in the other format
+	if previous, ok := s.files[floorID]; ok && previous.name != name {
+		if err := os.Remove(filepath.Join(s.dir, previous.name)); err != nil && !os.IsNotExist(err) {
+			log.Printf("Error removing previous floorplan %s: %v", previous.name, err)
+		}
+	}
+	s.files[floorID] = floorplanFile{name: name, ext: ext, modTime: time.Now()}
+
+	log.Printf("Stored floorplan for floor %s (%d bytes)", floorID, len(content))
+	return nil
+}
+
+// ServeHTTP serves the floorplan files with their content type and caching
+// headers. Only files known to the store are served.
+func (s *FloorplanStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, FloorplanPathPrefix)
+	ext := strings.ToLower(filepath.Ext(name))
+	floorID := strings.TrimSuffix(name, filepath.Ext(name))
+
+	s.mu.RLock()
+	file, ok := s.files[floorID]
+	s.mu.RUnlock()
+	if !ok || file.ext != ext {
+		http.NotFound(w, r)
+		return
+	}
+
+	f, err := os.Open(filepath.Join(s.dir, file.name))
+	if err != nil {
+		log.Printf("Error opening floorplan %s: %v", file.name, err)
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		log.Printf("Error reading floorplan %s: %v", file.name, err)
+		http.Error(w, "failed to read floorplan", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", floorplanContentTypes[file.ext])
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()))
+	// An svg may contain scripts, never let browsers execute it in our origin
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	http.ServeContent(w, r, file.name, info.ModTime(), f)
+}
+
+// floorplanFileName returns the name of the floorplan file of a floor. The
+// floor ID is escaped, so that the file stays within the floorplan directory
+// whatever characters the ID contains.
+func floorplanFileName(floorID, ext string) (string, error) {
+	name := url.PathEscape(floorID) + ext
+	if floorID == "" || !filepath.IsLocal(name) || filepath.Base(name) != name {
+		return "", fmt.Errorf("floor ID %q cannot be used as a floorplan file name", floorID)
+	}
+	return name, nil
+}
+
+// detectFloorplanFormat returns the file extension matching the content of a
+// floorplan, or an error if it is neither a pdf nor an svg document.
+func detectFloorplanFormat(content []byte) (string, error) {
+	if bytes.HasPrefix(content, []byte("%PDF-")) {
+		return ".pdf", nil
+	}
+
+	// svg documents may start with an xml declaration, comments or a doctype
+	head := content
+	if len(head) > 4096 {
+		head = head[:4096]
+	}
+	if bytes.Contains(bytes.ToLower(head), []byte("<svg")) {
+		return ".svg", nil
+	}
+
+	return "", fmt.Errorf("unsupported floorplan format, expected a pdf or svg document")
+}
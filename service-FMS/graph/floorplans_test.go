@@ -0,0 +1,135 @@
+package graph
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/LarsDepuydt/masterthesis-api-aggregation/service-FMS/graph/model"
+)
+
+const testSVG = `<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg"></svg>`
+
+func TestFloorplanStoreSave(t *testing.T) {
+	tests := []struct {
+		name    string
+		floorID string
+		content string
+		wantErr bool
+	}{
+		{name: "plain ID", floorID: "TMV25-Stue", content: "%PDF-1.7"},
+		{name: "spaces and dots", floorID: "TMV25-1. Sal", content: testSVG},
+		{name: "parent directory", floorID: "TMV25-../../escaped", content: testSVG},
+		{name: "only dots", floorID: "..", content: "%PDF-1.7"},
+		{name: "backslashes", floorID: `TMV25-..\..\escaped`, content: "%PDF-1.7"},
+		{name: "empty ID", floorID: "", content: "%PDF-1.7", wantErr: true},
+		{name: "unsupported format", floorID: "TMV25-Stue", content: "GIF89a", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The store lives in a subdirectory, so files escaping it show up
+			// in the parent
+			parent := t.TempDir()
+			dir := filepath.Join(parent, "floorplans")
+			store, err := NewFloorplanStore(dir, "http://fms")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = store.Save(tt.floorID, strings.NewReader(tt.content))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			entries, _ := os.ReadDir(parent)
+			if len(entries) != 1 {
+				t.Errorf("expected only the floorplan directory in its parent, found %d entries", len(entries))
+			}
+			files, _ := os.ReadDir(dir)
+			if len(files) != 1 {
+				t.Fatalf("expected one file in the floorplan directory, found %d", len(files))
+			}
+
+			// The floorplan is served under its URL, also after a restart
+			reloaded, err := NewFloorplanStore(dir, "http://fms")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, s := range []*FloorplanStore{store, reloaded} {
+				location, err := url.Parse(s.URL(tt.floorID))
+				if err != nil || location.Path == "" {
+					t.Fatalf("invalid floorplan URL %q", s.URL(tt.floorID))
+				}
+				recorder := httptest.NewRecorder()
+				s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, location.RequestURI(), nil))
+				body, _ := io.ReadAll(recorder.Body)
+				if recorder.Code != http.StatusOK || string(body) != tt.content {
+					t.Errorf("GET %s: got %d %q, want the floorplan", location.RequestURI(), recorder.Code, body)
+				}
+			}
+		})
+	}
+}
+
+func TestUploadFloorplanAudit(t *testing.T) {
+	baseline := map[string]*model.Building{"TMV25": {ID: "TMV25", Address: "Main Street 25"}}
+	baseline["TMV25"].Floors = []*model.Floor{{ID: "TMV25-Stue", Name: "Stue", Building: baseline["TMV25"]}}
+	inventory, err := NewInventory(baseline, nil, filepath.Join(t.TempDir(), "inventory-changes.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewFloorplanStore(t.TempDir(), "http://fms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mutation := &mutationResolver{&Resolver{Inventory: inventory, Floorplans: store}}
+	upload := func(ctx context.Context, content string) error {
+		_, err := mutation.UploadFloorplan(ctx, "TMV25-Stue", graphql.Upload{File: strings.NewReader(content), Filename: "floorplan"})
+		return err
+	}
+
+	if err := upload(context.Background(), "%PDF-1.7"); err == nil {
+		t.Fatal("expected an error without an actor")
+	}
+	if store.URL("TMV25-Stue") != "" {
+		t.Fatal("floorplan stored without an actor")
+	}
+
+	for _, content := range []string{"%PDF-1.7", testSVG} {
+		if err := upload(asActor("alice"), content); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	changes := inventory.Changes()
+	want := []struct {
+		operation     model.InventoryOperation
+		before, after string
+	}{
+		{model.InventoryOperationCreate, "", `{"floorId":"TMV25-Stue","file":"TMV25-Stue.pdf"}`},
+		{model.InventoryOperationUpdate, `{"floorId":"TMV25-Stue","file":"TMV25-Stue.pdf"}`, `{"floorId":"TMV25-Stue","file":"TMV25-Stue.svg"}`},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("got %d changes, want %d", len(changes), len(want))
+	}
+	for i, change := range changes {
+		if change.EntityType != model.InventoryEntityTypeFloorplan || change.EntityID != "TMV25-Stue" || change.Actor != "alice" ||
+			change.Operation != want[i].operation || string(change.Before) != want[i].before || string(change.After) != want[i].after {
+			t.Errorf("change %d: got %+v", i, change)
+		}
+	}
+}
@@ -0,0 +1,380 @@
+package graph
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/LarsDepuydt/masterthesis-api-aggregation/service-FMS/graph/model"
+)
+
+const (
+	// wallTolerance is the maximum distance, in meters, between two parallel
+	// room edges for them to be considered opposite sides of the same wall.
+	wallTolerance = 0.5
+	// minSharedWallLength is the minimum length, in meters, two rooms need to
+	// share along a wall to be considered neighbors. This prevents rooms that
+	// only touch at a corner from being reported as neighbors.
+	minSharedWallLength = 0.3
+	// parallelTolerance is the maximum sine of the angle between two edges for
+	// them to be considered parallel.
+	parallelTolerance = 0.05
+)
+
+// RoomGeometry holds the outline of a room and the data derived from it.
+// Coordinates are in meters, in the coordinate system of the room's floor.
+type RoomGeometry struct {
+	Polygon   []*model.Point
+	Centroid  *model.Point
+	Neighbors []string // IDs of the rooms sharing a wall with this room
+}
+
+// GeometryIndex provides the geometry of all rooms, keyed by room ID.
+type GeometryIndex struct {
+	rooms map[string]*RoomGeometry
+}
+
+// Room returns the geometry of the room with the given ID, or nil if no
+// geometry has been imported for it.
+func (g *GeometryIndex) Room(id string) *RoomGeometry {
+	if g == nil {
+		return nil
+	}
+	return g.rooms[id]
+}
+
+// LoadGeometryData imports the room outlines found in dir and computes the
+// centroid and neighbors of every room. Two source formats are supported:
+//
+//   - GeoJSON (*.geojson, *.json): a FeatureCollection of Polygon features with
+//     either a "roomId" property, or "floorId" and "roomNumber" properties.
+//   - SVG (*.svg): one file per floor named "<floor ID>.svg", containing a
+//     <polygon> or <rect> element per room whose id is the room number. The
+//     user units of the document are interpreted as meters.
+//
+// Outlines referring to rooms that do not exist in buildingsData are skipped.
+// An error is returned if the directory exists but cannot be read.
+func LoadGeometryData(dir string, buildingsData map[string]*model.Building) (*GeometryIndex, error) {
+	index := &GeometryIndex{rooms: make(map[string]*RoomGeometry)}
+
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Printf("No geometry directory found at %s, rooms will have no geometry", dir)
+		return index, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read geometry directory: %w", err)
+	}
+
+	rooms := make(map[string]*model.Room)
+	for _, building := range buildingsData {
+		for _, floor := range building.Floors {
+			for _, room := range floor.Rooms {
+				rooms[room.ID] = room
+			}
+		}
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+
+		var polygons map[string][]*model.Point
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".geojson", ".json":
+			polygons, err = readGeoJSONPolygons(path)
+		case ".svg":
+			floorID := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+			polygons, err = readSVGPolygons(path, floorID)
+		default:
+			continue
+		}
+		if err != nil {
+			log.Printf("Error importing geometry from %s: %v", path, err)
+			continue
+		}
+
+		for roomID, polygon := range polygons {
+			if _, ok := rooms[roomID]; !ok {
+				log.Printf("Skipping geometry for unknown room %s in %s", roomID, path)
+				continue
+			}
+			if len(polygon) < 3 {
+				log.Printf("Skipping geometry for room %s in %s: polygon has fewer than 3 points", roomID, path)
+				continue
+			}
+			index.rooms[roomID] = &RoomGeometry{
+				Polygon:  polygon,
+				Centroid: polygonCentroid(polygon),
+			}
+		}
+	}
+
+	// Rooms can only share a wall with rooms on the same floor
+	for _, building := range buildingsData {
+		for _, floor := range building.Floors {
+			for i, a := range floor.Rooms {
+				geomA := index.rooms[a.ID]
+				if geomA == nil {
+					continue
+				}
+				for _, b := range floor.Rooms[i+1:] {
+					geomB := index.rooms[b.ID]
+					if geomB == nil || !sharesWall(geomA.Polygon, geomB.Polygon) {
+						continue
+					}
+					geomA.Neighbors = append(geomA.Neighbors, b.ID)
+					geomB.Neighbors = append(geomB.Neighbors, a.ID)
+				}
+			}
+		}
+	}
+
+	log.Printf("Loaded geometry for %d of %d rooms", len(index.rooms), len(rooms))
+	return index, nil
+}
+
+// geoJSONFeatureCollection is the subset of a GeoJSON document used for
+// importing room outlines.
+type geoJSONFeatureCollection struct {
+	Type     string `json:"type"`
+	Features []struct {
+		Properties struct {
+			RoomID     string `json:"roomId"`
+			FloorID    string `json:"floorId"`
+			RoomNumber string `json:"roomNumber"`
+		} `json:"properties"`
+		Geometry struct {
+			Type        string         `json:"type"`
+			Coordinates [][][2]float64 `json:"coordinates"`
+		} `json:"geometry"`
+	} `json:"features"`
+}
+
+// readGeoJSONPolygons reads the outer ring of every Polygon feature in a
+// GeoJSON FeatureCollection, keyed by room ID.
+func readGeoJSONPolygons(path string) (map[string][]*model.Point, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var collection geoJSONFeatureCollection
+	if err := json.Unmarshal(content, &collection); err != nil {
+		return nil, fmt.Errorf("invalid GeoJSON: %w", err)
+	}
+	if collection.Type != "FeatureCollection" {
+		return nil, fmt.Errorf("expected a FeatureCollection, got %q", collection.Type)
+	}
+
+	polygons := make(map[string][]*model.Point)
+	for i, feature := range collection.Features {
+		roomID := feature.Properties.RoomID
+		if roomID == "" && feature.Properties.FloorID != "" && feature.Properties.RoomNumber != "" {
+			roomID = fmt.Sprintf("%s-%s", feature.Properties.FloorID, feature.Properties.RoomNumber)
+		}
+		if roomID == "" {
+			log.Printf("Skipping feature %d in %s: no roomId or floorId/roomNumber properties", i, path)
+			continue
+		}
+		if feature.Geometry.Type != "Polygon" || len(feature.Geometry.Coordinates) == 0 {
+			log.Printf("Skipping feature %d in %s: geometry is not a Polygon", i, path)
+			continue
+		}
+
+		var polygon []*model.Point
+		for _, coordinate := range feature.Geometry.Coordinates[0] {
+			polygon = append(polygon, &model.Point{X: coordinate[0], Y: coordinate[1]})
+		}
+		polygons[roomID] = openRing(polygon)
+	}
+	return polygons, nil
+}
+
+// readSVGPolygons reads every <polygon> and <rect> element with an id from
+// an SVG floorplan, keyed by the ID of the room on the given floor.
+func readSVGPolygons(path string, floorID string) (map[string][]*model.Point, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	polygons := make(map[string][]*model.Point)
+	decoder := xml.NewDecoder(f)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid SVG: %w", err)
+		}
+
+		element, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		attrs := make(map[string]string)
+		for _, attr := range element.Attr {
+			attrs[attr.Name.Local] = attr.Value
+		}
+		roomNumber := attrs["id"]
+		if roomNumber == "" {
+			continue
+		}
+
+		var polygon []*model.Point
+		switch element.Name.Local {
+		case "polygon":
+			polygon, err = parseSVGPoints(attrs["points"])
+		case "rect":
+			polygon, err = parseSVGRect(attrs)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("element %q: %w", roomNumber, err)
+		}
+		polygons[fmt.Sprintf("%s-%s", floorID, roomNumber)] = openRing(polygon)
+	}
+	return polygons, nil
+}
+
+// parseSVGPoints parses the points attribute of an SVG polygon.
+func parseSVGPoints(points string) ([]*model.Point, error) {
+	fields := strings.FieldsFunc(points, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	})
+	if len(fields)%2 != 0 {
+		return nil, fmt.Errorf("odd number of coordinates in points %q", points)
+	}
+
+	var polygon []*model.Point
+	for i := 0; i < len(fields); i += 2 {
+		x, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid coordinate %q: %w", fields[i], err)
+		}
+		y, err := strconv.ParseFloat(fields[i+1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid coordinate %q: %w", fields[i+1], err)
+		}
+		polygon = append(polygon, &model.Point{X: x, Y: y})
+	}
+	return polygon, nil
+}
+
+// parseSVGRect converts an SVG rect element into a polygon.
+func parseSVGRect(attrs map[string]string) ([]*model.Point, error) {
+	var values [4]float64
+	for i, name := range []string{"x", "y", "width", "height"} {
+		raw := attrs[name]
+		if raw == "" && (name == "x" || name == "y") {
+			continue // x and y default to 0
+		}
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rect %s %q: %w", name, raw, err)
+		}
+		values[i] = value
+	}
+	x, y, width, height := values[0], values[1], values[2], values[3]
+	return []*model.Point{
+		{X: x, Y: y},
+		{X: x + width, Y: y},
+		{X: x + width, Y: y + height},
+		{X: x, Y: y + height},
+	}, nil
+}
+
+// openRing removes the closing point of a ring, if the first point is repeated
+// at the end, so every polygon is stored in the same form.
+func openRing(polygon []*model.Point) []*model.Point {
+	if n := len(polygon); n > 1 && polygon[0].X == polygon[n-1].X && polygon[0].Y == polygon[n-1].Y {
+		return polygon[:n-1]
+	}
+	return polygon
+}
+
+// polygonCentroid returns the area centroid of a simple polygon. For
+// degenerate polygons without area the average of the points is returned.
+func polygonCentroid(polygon []*model.Point) *model.Point {
+	var area, cx, cy float64
+	for i, p := range polygon {
+		q := polygon[(i+1)%len(polygon)]
+		cross := p.X*q.Y - q.X*p.Y
+		area += cross
+		cx += (p.X + q.X) * cross
+		cy += (p.Y + q.Y) * cross
+	}
+
+	if math.Abs(area) < 1e-9 {
+		var sx, sy float64
+		for _, p := range polygon {
+			sx += p.X
+			sy += p.Y
+		}
+		return &model.Point{X: sx / float64(len(polygon)), Y: sy / float64(len(polygon))}
+	}
+
+	area /= 2
+	return &model.Point{X: cx / (6 * area), Y: cy / (6 * area)}
+}
+
+// sharesWall reports whether two polygons have a pair of parallel edges that
+// lie within wallTolerance of each other and overlap for at least
+// minSharedWallLength.
+func sharesWall(a, b []*model.Point) bool {
+	for i := range a {
+		a1, a2 := a[i], a[(i+1)%len(a)]
+		for j := range b {
+			b1, b2 := b[j], b[(j+1)%len(b)]
+			if edgeOverlap(a1, a2, b1, b2) >= minSharedWallLength {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// edgeOverlap returns the length over which edge b runs along edge a, or 0 if
+// the edges are not parallel or are further than wallTolerance apart.
+func edgeOverlap(a1, a2, b1, b2 *model.Point) float64 {
+	ax, ay := a2.X-a1.X, a2.Y-a1.Y
+	lengthA := math.Hypot(ax, ay)
+	bx, by := b2.X-b1.X, b2.Y-b1.Y
+	lengthB := math.Hypot(bx, by)
+	if lengthA == 0 || lengthB == 0 {
+		return 0
+	}
+	ux, uy := ax/lengthA, ay/lengthA
+
+	// The edges must be parallel ...
+	if math.Abs(ux*by-uy*bx)/lengthB > parallelTolerance {
+		return 0
+	}
+	// ... and close to each other
+	distance := math.Abs(ux*(b1.Y-a1.Y) - uy*(b1.X-a1.X))
+	if distance > wallTolerance {
+		return 0
+	}
+
+	// Project b onto a and measure the overlap of both intervals
+	t1 := (b1.X-a1.X)*ux + (b1.Y-a1.Y)*uy
+	t2 := (b2.X-a1.X)*ux + (b2.Y-a1.Y)*uy
+	if t1 > t2 {
+		t1, t2 = t2, t1
+	}
+	return math.Max(0, math.Min(lengthA, t2)-math.Max(0, t1))
+}
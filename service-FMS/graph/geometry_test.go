@@ -0,0 +1,206 @@
+package graph
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/LarsDepuydt/masterthesis-api-aggregation/service-FMS/graph/model"
+)
+
+// rect returns the outline of an axis-aligned rectangle.
+func rect(x, y, width, height float64) []*model.Point {
+	return []*model.Point{{X: x, Y: y}, {X: x + width, Y: y}, {X: x + width, Y: y + height}, {X: x, Y: y + height}}
+}
+
+func TestSharesWall(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []*model.Point
+		want bool
+	}{
+		{name: "same wall", a: rect(0, 0, 4, 3), b: rect(4, 0, 4, 3), want: true},
+		{name: "partly shared wall", a: rect(0, 0, 4, 3), b: rect(4, 2, 4, 3), want: true},
+		{name: "wall thickness within tolerance", a: rect(0, 0, 4, 3), b: rect(4.4, 0, 4, 3), want: true},
+		{name: "gap beyond tolerance", a: rect(0, 0, 4, 3), b: rect(4.6, 0, 4, 3)},
+		{name: "touching at a corner", a: rect(0, 0, 4, 3), b: rect(4, 3, 4, 3)},
+		{name: "overlap shorter than minimum", a: rect(0, 0, 4, 3), b: rect(4, 2.8, 4, 3)},
+		{
+			name: "not parallel",
+			a:    rect(0, 0, 4, 3),
+			b:    []*model.Point{{X: 4, Y: 0}, {X: 8, Y: 0}, {X: 5, Y: 3}},
+		},
+		{name: "same row, far apart", a: rect(0, 0, 4, 3), b: rect(10, 0, 4, 3)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sharesWall(tt.a, tt.b); got != tt.want {
+				t.Errorf("sharesWall(a, b) = %v, want %v", got, tt.want)
+			}
+			if got := sharesWall(tt.b, tt.a); got != tt.want {
+				t.Errorf("sharesWall(b, a) = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolygonCentroid(t *testing.T) {
+	tests := []struct {
+		name    string
+		polygon []*model.Point
+		want    model.Point
+	}{
+		{name: "rectangle", polygon: rect(2, 1, 4, 2), want: model.Point{X: 4, Y: 2}},
+		{
+			name:    "clockwise",
+			polygon: []*model.Point{{X: 0, Y: 0}, {X: 0, Y: 2}, {X: 2, Y: 2}, {X: 2, Y: 0}},
+			want:    model.Point{X: 1, Y: 1},
+		},
+		{
+			// The centroid of an L-shape lies closer to its larger part
+			name:    "L-shape",
+			polygon: []*model.Point{{X: 0, Y: 0}, {X: 4, Y: 0}, {X: 4, Y: 2}, {X: 2, Y: 2}, {X: 2, Y: 4}, {X: 0, Y: 4}},
+			want:    model.Point{X: 5.0 / 3, Y: 5.0 / 3},
+		},
+		{
+			name:    "without area",
+			polygon: []*model.Point{{X: 0, Y: 0}, {X: 2, Y: 0}, {X: 4, Y: 0}},
+			want:    model.Point{X: 2, Y: 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := polygonCentroid(tt.polygon)
+			if math.Abs(got.X-tt.want.X) > 1e-9 || math.Abs(got.Y-tt.want.Y) > 1e-9 {
+				t.Errorf("got (%g, %g), want (%g, %g)", got.X, got.Y, tt.want.X, tt.want.Y)
+			}
+		})
+	}
+}
+
+func TestParseSVGPoints(t *testing.T) {
+	tests := []struct {
+		name    string
+		points  string
+		want    []model.Point
+		wantErr bool
+	}{
+		{name: "comma separated pairs", points: "0,0 4,0 4,3", want: []model.Point{{X: 0, Y: 0}, {X: 4, Y: 0}, {X: 4, Y: 3}}},
+		{name: "whitespace only", points: "0 0\n4.5 0\t4.5 -3", want: []model.Point{{X: 0, Y: 0}, {X: 4.5, Y: 0}, {X: 4.5, Y: -3}}},
+		{name: "odd number of coordinates", points: "0,0 4,0 4", wantErr: true},
+		{name: "invalid coordinate", points: "0,0 4,x", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSVGPoints(tt.points)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d points, want %d", len(got), len(tt.want))
+			}
+			for i, p := range got {
+				if *p != tt.want[i] {
+					t.Errorf("point %d: got %+v, want %+v", i, *p, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLoadGeometryData(t *testing.T) {
+	dir := t.TempDir()
+	svg := `<svg xmlns="http://www.w3.org/2000/svg">
+	<rect id="A1" width="4" height="3"/>
+	<polygon id="A2" points="4,0 8,0 8,3 4,3 4,0"/>
+	<rect id="A9" x="20" width="4" height="3"/>
+	<rect id="A3" x="8.2" y="3" width="4" height="3"/>
+</svg>`
+	geoJSON := `{"type": "FeatureCollection", "features": [
+	{"properties": {"floorId": "B-1", "roomNumber": "101"},
+	 "geometry": {"type": "Polygon", "coordinates": [[[0, 0], [5, 0], [5, 5], [0, 5], [0, 0]]]}},
+	{"properties": {"roomId": "B-1-102"},
+	 "geometry": {"type": "Polygon", "coordinates": [[[5, 0], [9, 0], [9, 5], [5, 5]]]}}
+]}`
+	for name, content := range map[string]string{"A-0.svg": svg, "B-1.geojson": geoJSON, "notes.txt": "ignored"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	floor := func(id string, roomNumbers ...string) *model.Floor {
+		f := &model.Floor{ID: id}
+		for _, number := range roomNumbers {
+			f.Rooms = append(f.Rooms, &model.Room{ID: id + "-" + number, RoomNumber: number})
+		}
+		return f
+	}
+	buildings := map[string]*model.Building{
+		"A": {ID: "A", Floors: []*model.Floor{floor("A-0", "A1", "A2", "A3", "A4")}},
+		"B": {ID: "B", Floors: []*model.Floor{floor("B-1", "101", "102")}},
+	}
+
+	index, err := LoadGeometryData(dir, buildings)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		roomID        string
+		wantPoints    int
+		wantNeighbors []string
+	}{
+		{roomID: "A-0-A1", wantPoints: 4, wantNeighbors: []string{"A-0-A2"}},
+		{roomID: "A-0-A2", wantPoints: 4, wantNeighbors: []string{"A-0-A1"}},
+		// A3 only touches A2 at a corner
+		{roomID: "A-0-A3", wantPoints: 4},
+		{roomID: "B-1-101", wantPoints: 4, wantNeighbors: []string{"B-1-102"}},
+		{roomID: "B-1-102", wantPoints: 4, wantNeighbors: []string{"B-1-101"}},
+	}
+	for _, tt := range tests {
+		geometry := index.Room(tt.roomID)
+		if geometry == nil {
+			t.Errorf("%s: no geometry", tt.roomID)
+			continue
+		}
+		if len(geometry.Polygon) != tt.wantPoints {
+			t.Errorf("%s: got %d points, want %d", tt.roomID, len(geometry.Polygon), tt.wantPoints)
+		}
+		if !slices.Equal(geometry.Neighbors, tt.wantNeighbors) {
+			t.Errorf("%s: got neighbors %v, want %v", tt.roomID, geometry.Neighbors, tt.wantNeighbors)
+		}
+	}
+
+	// Outlines of unknown rooms are skipped and rooms without one get none
+	for _, roomID := range []string{"A-0-A9", "A-0-A4"} {
+		if index.Room(roomID) != nil {
+			t.Errorf("%s: unexpected geometry", roomID)
+		}
+	}
+}
+
+func TestLoadGeometryDataDirectory(t *testing.T) {
+	index, err := LoadGeometryData(filepath.Join(t.TempDir(), "missing"), nil)
+	if err != nil || index == nil {
+		t.Errorf("missing directory: got %v, %v, want an empty index", index, err)
+	}
+
+	file := filepath.Join(t.TempDir(), "geometry")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadGeometryData(file, nil); err == nil {
+		t.Error("unreadable directory: expected an error")
+	}
+}
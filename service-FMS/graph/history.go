@@ -0,0 +1,239 @@
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/LarsDepuydt/masterthesis-api-aggregation/service-FMS/graph/model"
+)
+
+// At reconstructs the space inventory as it was at the given moment. Every
+// building is taken from its latest version valid at that moment. Changes
+// made through mutations up to then are replayed on the buildings whose
+// current version was valid, as those changes were made to that version.
+// Buildings without a version valid at that moment are left out, unless they
+// were created through a mutation before it. The returned data must not be
+// modified.
+func (inv *Inventory) At(t time.Time) map[string]*model.Building {
+	buildings := make(map[string]*model.Building)
+	historical := make(map[string]bool) // buildings not at their current version
+	for id, versions := range inv.versions {
+		current := -1
+		for i, version := range versions {
+			if !version.ValidFrom.After(t) {
+				current = i
+			}
+		}
+		if current == -1 {
+			historical[id] = true
+			continue
+		}
+		buildings[id] = versions[current].Building
+		historical[id] = current < len(versions)-1
+	}
+	buildings = cloneBuildings(buildings)
+
+	for _, change := range inv.Changes() {
+		if change.Timestamp.After(t) {
+			break
+		}
+		if historical[changeBuildingID(buildings, change)] {
+			continue
+		}
+		// As on startup, changes that no longer apply are ignored
+		_ = applyChange(buildings, change)
+	}
+	return buildings
+}
+
+// changeBuildingID returns the ID of the building affected by a change, or
+// an empty string if it cannot be determined.
+func changeBuildingID(buildings map[string]*model.Building, change *inventoryChange) string {
+	state := change.After
+	if len(state) == 0 {
+		state = change.Before
+	}
+
+	switch change.EntityType {
+	case model.InventoryEntityTypeBuilding:
+		return change.EntityID
+	case model.InventoryEntityTypeFloor:
+		var record floorRecord
+		if err := json.Unmarshal(state, &record); err != nil {
+			return ""
+		}
+		return record.BuildingID
+	case model.InventoryEntityTypeRoom:
+		var record roomRecord
+		if err := json.Unmarshal(state, &record); err != nil {
+			return ""
+		}
+		if floor := findFloor(buildings, record.FloorID); floor != nil {
+			return floor.Building.ID
+		}
+	}
+	return ""
+}
+
+// inventoryEntity is the persisted state of a building, floor or room, used to
+// compare versions of the inventory.
+type inventoryEntity struct {
+	entityType model.InventoryEntityType
+	id         string
+	state      any
+}
+
+// inventoryEntities lists the buildings, floors and rooms of the given
+// buildings, ordered by entity type and ID. If buildingIDs is not empty, only
+// entities within these buildings are listed.
+func inventoryEntities(buildings map[string]*model.Building, buildingIDs []string) []inventoryEntity {
+	var entities []inventoryEntity
+	for _, building := range buildings {
+		if len(buildingIDs) > 0 && !slices.Contains(buildingIDs, building.ID) {
+			continue
+		}
+		entities = append(entities, inventoryEntity{model.InventoryEntityTypeBuilding, building.ID, newBuildingRecord(building)})
+		for _, floor := range building.Floors {
+			entities = append(entities, inventoryEntity{model.InventoryEntityTypeFloor, floor.ID, newFloorRecord(floor)})
+			for _, room := range floor.Rooms {
+				entities = append(entities, inventoryEntity{model.InventoryEntityTypeRoom, room.ID, newRoomRecord(room)})
+			}
+		}
+	}
+
+	sort.Slice(entities, func(i, j int) bool {
+		if entities[i].entityType != entities[j].entityType {
+			return entityTypeOrder(entities[i].entityType) < entityTypeOrder(entities[j].entityType)
+		}
+		return entities[i].id < entities[j].id
+	})
+	return entities
+}
+
+// entityTypeOrder orders entity types from buildings down to rooms.
+func entityTypeOrder(entityType model.InventoryEntityType) int {
+	switch entityType {
+	case model.InventoryEntityTypeBuilding:
+		return 0
+	case model.InventoryEntityTypeFloor:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// diffInventories lists the differences between two versions of the space
+// inventory, ordered by entity type and ID.
+func diffInventories(from, to map[string]*model.Building, buildingIDs []string) ([]*model.InventoryDifference, error) {
+	type entityKey struct {
+		entityType model.InventoryEntityType
+		id         string
+	}
+	fromEntities := inventoryEntities(from, buildingIDs)
+	before := make(map[entityKey]inventoryEntity, len(fromEntities))
+	for _, entity := range fromEntities {
+		before[entityKey{entity.entityType, entity.id}] = entity
+	}
+	after := inventoryEntities(to, buildingIDs)
+
+	differences := []*model.InventoryDifference{}
+	for _, entity := range after {
+		key := entityKey{entity.entityType, entity.id}
+		afterState, err := json.Marshal(entity.state)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s %s: %w", entity.entityType, entity.id, err)
+		}
+		afterJSON := string(afterState)
+
+		previous, existed := before[key]
+		delete(before, key)
+		if !existed {
+			differences = append(differences, &model.InventoryDifference{
+				EntityType:    entity.entityType,
+				EntityID:      entity.id,
+				Kind:          model.InventoryDifferenceKindAdded,
+				ChangedFields: []string{},
+				After:         &afterJSON,
+			})
+			continue
+		}
+
+		beforeState, err := json.Marshal(previous.state)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s %s: %w", entity.entityType, entity.id, err)
+		}
+		changedFields, err := changedJSONFields(beforeState, afterState)
+		if err != nil {
+			return nil, err
+		}
+		if len(changedFields) == 0 {
+			continue
+		}
+		beforeJSON := string(beforeState)
+		differences = append(differences, &model.InventoryDifference{
+			EntityType:    entity.entityType,
+			EntityID:      entity.id,
+			Kind:          model.InventoryDifferenceKindModified,
+			ChangedFields: changedFields,
+			Before:        &beforeJSON,
+			After:         &afterJSON,
+		})
+	}
+
+	// Whatever is left of the earlier version was removed
+	for _, entity := range fromEntities {
+		if _, removed := before[entityKey{entity.entityType, entity.id}]; !removed {
+			continue
+		}
+		beforeState, err := json.Marshal(entity.state)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s %s: %w", entity.entityType, entity.id, err)
+		}
+		beforeJSON := string(beforeState)
+		differences = append(differences, &model.InventoryDifference{
+			EntityType:    entity.entityType,
+			EntityID:      entity.id,
+			Kind:          model.InventoryDifferenceKindRemoved,
+			ChangedFields: []string{},
+			Before:        &beforeJSON,
+		})
+	}
+
+	sort.SliceStable(differences, func(i, j int) bool {
+		a, b := differences[i], differences[j]
+		if a.EntityType != b.EntityType {
+			return entityTypeOrder(a.EntityType) < entityTypeOrder(b.EntityType)
+		}
+		return a.EntityID < b.EntityID
+	})
+	return differences, nil
+}
+
+// changedJSONFields returns the names of the fields that differ between two
+// JSON objects, in alphabetical order.
+func changedJSONFields(before, after []byte) ([]string, error) {
+	var a, b map[string]any
+	if err := json.Unmarshal(before, &a); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(after, &b); err != nil {
+		return nil, err
+	}
+
+	var fields []string
+	for field, value := range b {
+		if previous, ok := a[field]; !ok || fmt.Sprint(previous) != fmt.Sprint(value) {
+			fields = append(fields, field)
+		}
+	}
+	for field := range a {
+		if _, ok := b[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+	return fields, nil
+}
@@ -0,0 +1,199 @@
+package graph
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LarsDepuydt/masterthesis-api-aggregation/service-FMS/graph/model"
+)
+
+func date(value string) time.Time {
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// newTestHistory creates an inventory in which TMV25 was rebuilt at the start
+// of 2025, when TMV27 was also added, and replays the given change log
+// entries on it.
+func newTestHistory(t *testing.T, entries ...string) *Inventory {
+	t.Helper()
+	original := &model.Building{ID: "TMV25", Address: "Old Street 25", Floors: []*model.Floor{}}
+	addImportedRoom(original, "Stue", 0, &model.Room{RoomNumber: "A.001", Type: "office", Area: 10, Circumference: 13})
+	rebuilt := &model.Building{ID: "TMV25", Address: "Main Street 25", Floors: []*model.Floor{}}
+	addImportedRoom(rebuilt, "Stue", 0, &model.Room{RoomNumber: "A.001", Type: "office", Area: 12, Circumference: 14})
+	addImportedRoom(rebuilt, "Stue", 0, &model.Room{RoomNumber: "A.002", Type: "kitchen", Area: 8, Circumference: 12})
+	added := &model.Building{ID: "TMV27", Address: "Main Street 27", Floors: []*model.Floor{}}
+	addImportedRoom(added, "Stue", 0, &model.Room{RoomNumber: "A.001", Type: "office", Area: 10, Circumference: 13})
+
+	versions := map[string][]BuildingVersion{
+		"TMV25": {{ValidFrom: date("2024-01-01"), Building: original}, {ValidFrom: date("2025-01-01"), Building: rebuilt}},
+		"TMV27": {{ValidFrom: date("2025-01-01"), Building: added}},
+	}
+	baseline := map[string]*model.Building{"TMV25": rebuilt, "TMV27": added}
+
+	logPath := filepath.Join(t.TempDir(), "inventory-changes.jsonl")
+	if err := os.WriteFile(logPath, []byte(strings.Join(entries, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	inv, err := NewInventory(baseline, versions, logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return inv
+}
+
+func TestInventoryAt(t *testing.T) {
+	inv := newTestHistory(t,
+		// Made to the rebuilt TMV25 before it became valid
+		`{"sequence":1,"timestamp":"2024-06-01T00:00:00Z","actor":"alice","operation":"UPDATE","entityType":"ROOM","entityId":"TMV25-Stue-A.002",`+
+			`"before":{"id":"TMV25-Stue-A.002","floorId":"TMV25-Stue","roomNumber":"A.002","type":"kitchen","area":8,"circumference":12},`+
+			`"after":{"id":"TMV25-Stue-A.002","floorId":"TMV25-Stue","roomNumber":"A.002","type":"kitchen","area":9,"circumference":12}}`,
+		`{"sequence":2,"timestamp":"2025-03-01T00:00:00Z","actor":"alice","operation":"CREATE","entityType":"BUILDING","entityId":"TMV29",`+
+			`"after":{"id":"TMV29","address":"Main Street 29","city":"","property":""}}`,
+		`{"sequence":3,"timestamp":"2025-06-01T00:00:00Z","actor":"bob","operation":"DELETE","entityType":"ROOM","entityId":"TMV27-Stue-A.001",`+
+			`"before":{"id":"TMV27-Stue-A.001","floorId":"TMV27-Stue","roomNumber":"A.001","type":"office","area":10,"circumference":13}}`,
+	)
+
+	tests := []struct {
+		at            string
+		wantBuildings []string
+		wantAddress   string  // of TMV25
+		wantArea      float64 // of TMV25-Stue-A.002, 0 if it does not exist
+		wantTMV27Room bool
+	}{
+		{at: "2023-06-01"},
+		{at: "2024-06-01", wantBuildings: []string{"TMV25"}, wantAddress: "Old Street 25"},
+		{at: "2025-02-01", wantBuildings: []string{"TMV25", "TMV27"}, wantAddress: "Main Street 25", wantArea: 9, wantTMV27Room: true},
+		{at: "2025-03-01", wantBuildings: []string{"TMV25", "TMV27", "TMV29"}, wantAddress: "Main Street 25", wantArea: 9, wantTMV27Room: true},
+		{at: "2026-01-01", wantBuildings: []string{"TMV25", "TMV27", "TMV29"}, wantAddress: "Main Street 25", wantArea: 9},
+	}
+
+	for _, tt := range tests {
+		buildings := inv.At(date(tt.at))
+		var ids []string
+		for id := range buildings {
+			ids = append(ids, id)
+		}
+		slices.Sort(ids)
+		if !slices.Equal(ids, tt.wantBuildings) {
+			t.Errorf("%s: got buildings %v, want %v", tt.at, ids, tt.wantBuildings)
+			continue
+		}
+		if building := buildings["TMV25"]; building != nil && building.Address != tt.wantAddress {
+			t.Errorf("%s: got address %q, want %q", tt.at, building.Address, tt.wantAddress)
+		}
+		var area float64
+		if room := findRoom(buildings, "TMV25-Stue-A.002"); room != nil {
+			area = room.Area
+		}
+		if area != tt.wantArea {
+			t.Errorf("%s: got area %v for A.002, want %v", tt.at, area, tt.wantArea)
+		}
+		if got := findRoom(buildings, "TMV27-Stue-A.001") != nil; got != tt.wantTMV27Room {
+			t.Errorf("%s: got TMV27 room %v, want %v", tt.at, got, tt.wantTMV27Room)
+		}
+	}
+
+	// Reconstructing a moment leaves the current inventory untouched
+	if room := findRoom(inv.Buildings(), "TMV27-Stue-A.001"); room != nil {
+		t.Error("the deleted room is back in the current inventory")
+	}
+	if building := inv.Buildings()["TMV25"]; building.Address != "Main Street 25" || len(building.Floors[0].Rooms) != 2 {
+		t.Errorf("got current TMV25 %+v, want the rebuilt building", building)
+	}
+}
+
+func TestDiffInventories(t *testing.T) {
+	inv := newTestHistory(t,
+		`{"sequence":1,"timestamp":"2025-03-01T00:00:00Z","actor":"alice","operation":"CREATE","entityType":"BUILDING","entityId":"TMV29",`+
+			`"after":{"id":"TMV29","address":"Main Street 29","city":"","property":""}}`,
+	)
+
+	tests := []struct {
+		name        string
+		from, to    string
+		buildingIDs []string
+		want        []string // entity type, ID, kind and changed fields of every difference
+	}{
+		{
+			name: "rebuilt and added buildings",
+			from: "2024-06-01",
+			to:   "2025-06-01",
+			want: []string{
+				"BUILDING TMV25 MODIFIED address",
+				"BUILDING TMV27 ADDED",
+				"BUILDING TMV29 ADDED",
+				"FLOOR TMV27-Stue ADDED",
+				"ROOM TMV25-Stue-A.001 MODIFIED area,circumference",
+				"ROOM TMV25-Stue-A.002 ADDED",
+				"ROOM TMV27-Stue-A.001 ADDED",
+			},
+		},
+		{
+			name:        "within a building",
+			from:        "2024-06-01",
+			to:          "2025-06-01",
+			buildingIDs: []string{"TMV27"},
+			want:        []string{"BUILDING TMV27 ADDED", "FLOOR TMV27-Stue ADDED", "ROOM TMV27-Stue-A.001 ADDED"},
+		},
+		{
+			name: "backwards in time",
+			from: "2025-02-01",
+			to:   "2024-06-01",
+			want: []string{
+				"BUILDING TMV25 MODIFIED address",
+				"BUILDING TMV27 REMOVED",
+				"FLOOR TMV27-Stue REMOVED",
+				"ROOM TMV25-Stue-A.001 MODIFIED area,circumference",
+				"ROOM TMV25-Stue-A.002 REMOVED",
+				"ROOM TMV27-Stue-A.001 REMOVED",
+			},
+		},
+		{name: "unchanged", from: "2025-01-01", to: "2025-02-01"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			differences, err := diffInventories(inv.At(date(tt.from)), inv.At(date(tt.to)), tt.buildingIDs)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var got []string
+			for _, d := range differences {
+				key := strings.Join([]string{string(d.EntityType), d.EntityID, string(d.Kind)}, " ")
+				if len(d.ChangedFields) > 0 {
+					key += " " + strings.Join(d.ChangedFields, ",")
+				}
+				got = append(got, key)
+
+				// Only the states that exist are included
+				if (d.Before == nil) != (d.Kind == model.InventoryDifferenceKindAdded) || (d.After == nil) != (d.Kind == model.InventoryDifferenceKindRemoved) {
+					t.Errorf("%s: got before %v and after %v", key, d.Before, d.After)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got differences\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestChangedJSONFields(t *testing.T) {
+	got, err := changedJSONFields([]byte(`{"a":1,"b":"x","c":true}`), []byte(`{"a":1,"b":"y","d":null}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"b", "c", "d"}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if _, err := changedJSONFields([]byte(`[1]`), []byte(`{}`)); err == nil {
+		t.Error("expected an error for a value that is not an object")
+	}
+}
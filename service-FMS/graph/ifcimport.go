@@ -0,0 +1,690 @@
+package graph
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/LarsDepuydt/masterthesis-api-aggregation/service-FMS/graph/model"
+)
+
+// ifcImporter imports a building from an IFC model in the STEP physical file
+// format (ISO 10303-21). The building is read from the IfcBuilding entity,
+// its floors from the IfcBuildingStorey entities and its rooms from the
+// IfcSpace entities aggregated into the storeys. Areas and perimeters are
+// taken from the base quantities or property sets of the spaces.
+type ifcImporter struct{}
+
+// stepValue is a parsed attribute value of a STEP entity instance. Exactly
+// one of its fields is set, depending on the kind of value; null ($) and
+// derived (*) values have none set.
+type stepValue struct {
+	str   *string
+	ref   int
+	num   *float64
+	enum  string
+	list  []stepValue
+	typed string // type name of a typed value, e.g. IFCAREAMEASURE(12.5)
+}
+
+// stepEntity is a single entity instance of the DATA section.
+type stepEntity struct {
+	id    int
+	name  string
+	attrs []stepValue
+}
+
+// attr returns the attribute at index i, or a null value if it does not exist.
+func (e *stepEntity) attr(i int) stepValue {
+	if i < len(e.attrs) {
+		return e.attrs[i]
+	}
+	return stepValue{}
+}
+
+// text returns the string value, or an empty string for other values.
+func (v stepValue) text() string {
+	if v.str != nil {
+		return *v.str
+	}
+	if len(v.list) == 1 && v.typed != "" {
+		return v.list[0].text()
+	}
+	return ""
+}
+
+// number returns the numeric value, unwrapping typed values such as
+// IFCAREAMEASURE(12.5).
+func (v stepValue) number() (float64, bool) {
+	if v.num != nil {
+		return *v.num, true
+	}
+	if len(v.list) == 1 && v.typed != "" {
+		return v.list[0].number()
+	}
+	return 0, false
+}
+
+// refs returns the entity references of a list value, or of a single
+// reference value.
+func (v stepValue) refs() []int {
+	if v.ref != 0 {
+		return []int{v.ref}
+	}
+	var refs []int
+	for _, item := range v.list {
+		if item.ref != 0 {
+			refs = append(refs, item.ref)
+		}
+	}
+	return refs
+}
+
+func (ifcImporter) Import(source SpaceSource, report *model.ImportReport) (*model.Building, error) {
+	entities, err := readSTEPFile(source.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	byType := make(map[string][]*stepEntity)
+	for _, e := range entities {
+		byType[e.name] = append(byType[e.name], e)
+	}
+	for _, list := range byType {
+		sort.Slice(list, func(i, j int) bool { return list[i].id < list[j].id })
+	}
+
+	buildings := byType["IFCBUILDING"]
+	if len(buildings) == 0 {
+		return nil, fmt.Errorf("file contains no IfcBuilding")
+	}
+	if len(buildings) > 1 {
+		addIssue(report, model.ImportIssueSeverityWarning, buildings[0].id, "",
+			fmt.Sprintf("file contains %d buildings, only the first one is imported", len(buildings)))
+	}
+	ifcBuilding := buildings[0]
+
+	b := &model.Building{
+		ID:       source.BuildingID,
+		Address:  ifcBuilding.attr(2).text(),
+		Property: ifcBuilding.attr(7).text(),
+		Floors:   []*model.Floor{},
+	}
+	// IfcBuilding.BuildingAddress refers to an IfcPostalAddress
+	if address := entities[ifcBuilding.attr(11).ref]; address != nil && address.name == "IFCPOSTALADDRESS" {
+		var lines []string
+		for _, line := range address.attr(4).list {
+			lines = append(lines, line.text())
+		}
+		if len(lines) > 0 {
+			b.Address = strings.Join(lines, ", ")
+		}
+		b.City = address.attr(6).text()
+	}
+
+	lengthScale, areaScale := ifcUnitScales(byType["IFCSIUNIT"])
+	children := ifcDecomposition(byType)
+	properties := ifcProperties(entities, byType["IFCRELDEFINESBYPROPERTIES"])
+
+	// Find the storeys of the building, also through intermediate spatial
+	// elements such as partial buildings
+	var storeys []*stepEntity
+	queue := []int{ifcBuilding.id}
+	visited := map[int]bool{}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if visited[id] {
+			continue
+		}
+		visited[id] = true
+		for _, child := range children[id] {
+			e := entities[child]
+			if e == nil {
+				continue
+			}
+			switch e.name {
+			case "IFCBUILDINGSTOREY":
+				storeys = append(storeys, e)
+			case "IFCBUILDING":
+				queue = append(queue, child)
+			}
+		}
+	}
+	if len(storeys) == 0 {
+		return nil, fmt.Errorf("building has no IfcBuildingStorey")
+	}
+
+	levels := ifcStoreyLevels(storeys, report)
+
+	for _, storey := range storeys {
+		floorName := strings.TrimSpace(storey.attr(2).text())
+		if floorName == "" {
+			floorName = fmt.Sprintf("Storey %d", levels[storey.id])
+			addIssue(report, model.ImportIssueSeverityWarning, storey.id, "Name",
+				fmt.Sprintf("storey has no name, using %q", floorName))
+		}
+
+		// Spaces are aggregated into the storey, possibly nested in other spaces
+		var spaces []*stepEntity
+		stack := append([]int(nil), children[storey.id]...)
+		for len(stack) > 0 {
+			id := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if e := entities[id]; e != nil && e.name == "IFCSPACE" {
+				spaces = append(spaces, e)
+				stack = append(stack, children[id]...)
+			}
+		}
+		sort.Slice(spaces, func(i, j int) bool { return spaces[i].id < spaces[j].id })
+
+		seenRooms := make(map[string]int)
+		for _, space := range spaces {
+			report.RowCount++
+
+			roomNumber := strings.TrimSpace(space.attr(2).text())
+			if roomNumber == "" {
+				addIssue(report, model.ImportIssueSeverityError, space.id, "Name", "space has no name to use as room number")
+				continue
+			}
+			if first, duplicate := seenRooms[roomNumber]; duplicate {
+				addIssue(report, model.ImportIssueSeverityError, space.id, "Name",
+					fmt.Sprintf("room %s on floor %s is a duplicate of #%d", roomNumber, floorName, first))
+				continue
+			}
+
+			props := properties[space.id]
+			room := &model.Room{RoomNumber: roomNumber}
+
+			if longName := strings.TrimSpace(space.attr(7).text()); longName != "" {
+				room.Name = &longName
+			}
+
+			room.Type = strings.TrimSpace(space.attr(4).text()) // ObjectType
+			if room.Type == "" {
+				room.Type = props.text("Category", "OccupancyType", "Reference")
+			}
+			if room.Type == "" && room.Name != nil {
+				room.Type = *room.Name
+			}
+			if room.Type == "" {
+				addIssue(report, model.ImportIssueSeverityWarning, space.id, "ObjectType", "room type is empty")
+			}
+
+			// Rooms need a positive area and perimeter, as in the CSV export
+			valid := true
+			if area, ok := props.number("NetFloorArea", "GrossFloorArea", "NetArea", "GrossArea"); !ok {
+				addIssue(report, model.ImportIssueSeverityError, space.id, "NetFloorArea", "no floor area found")
+				valid = false
+			} else if area <= 0 {
+				addIssue(report, model.ImportIssueSeverityError, space.id, "NetFloorArea", fmt.Sprintf("area must be positive, got %g", area))
+				valid = false
+			} else {
+				room.Area = area * areaScale
+			}
+			if perimeter, ok := props.number("NetPerimeter", "GrossPerimeter", "Perimeter"); !ok {
+				addIssue(report, model.ImportIssueSeverityError, space.id, "NetPerimeter", "no perimeter found")
+				valid = false
+			} else if perimeter <= 0 {
+				addIssue(report, model.ImportIssueSeverityError, space.id, "NetPerimeter", fmt.Sprintf("perimeter must be positive, got %g", perimeter))
+				valid = false
+			} else {
+				room.Circumference = perimeter * lengthScale
+			}
+			if !valid {
+				continue
+			}
+			seenRooms[roomNumber] = space.id
+
+			addImportedRoom(b, floorName, levels[storey.id], room)
+			report.ImportedRowCount++
+		}
+	}
+
+	return b, nil
+}
+
+// ifcPropertyValues holds the quantities and single value properties of an
+// object, keyed by name.
+type ifcPropertyValues map[string]stepValue
+
+// text returns the first of the named properties that has a text value.
+func (p ifcPropertyValues) text(names ...string) string {
+	for _, name := range names {
+		if value := strings.TrimSpace(p[name].text()); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// number returns the first of the named properties that has a numeric value.
+func (p ifcPropertyValues) number(names ...string) (float64, bool) {
+	for _, name := range names {
+		if value, ok := p[name].number(); ok {
+			return value, true
+		}
+	}
+	return 0, false
+}
+
+// ifcDecomposition maps the ID of every spatial element to the IDs of the
+// elements aggregated into or contained in it.
+func ifcDecomposition(byType map[string][]*stepEntity) map[int][]int {
+	children := make(map[int][]int)
+	// IfcRelAggregates(GlobalId, OwnerHistory, Name, Description, RelatingObject, RelatedObjects)
+	for _, rel := range byType["IFCRELAGGREGATES"] {
+		parent := rel.attr(4).ref
+		children[parent] = append(children[parent], rel.attr(5).refs()...)
+	}
+	// IfcRelContainedInSpatialStructure(GlobalId, OwnerHistory, Name, Description, RelatedElements, RelatingStructure)
+	for _, rel := range byType["IFCRELCONTAINEDINSPATIALSTRUCTURE"] {
+		parent := rel.attr(5).ref
+		children[parent] = append(children[parent], rel.attr(4).refs()...)
+	}
+	return children
+}
+
+// ifcProperties collects the quantities and single value properties of every
+// object, keyed by object ID. Quantities take precedence over properties of
+// the same name.
+func ifcProperties(entities map[int]*stepEntity, rels []*stepEntity) map[int]ifcPropertyValues {
+	result := make(map[int]ifcPropertyValues)
+	set := func(objects []int, name string, value stepValue, override bool) {
+		for _, object := range objects {
+			if result[object] == nil {
+				result[object] = make(ifcPropertyValues)
+			}
+			if _, exists := result[object][name]; !exists || override {
+				result[object][name] = value
+			}
+		}
+	}
+
+	// IfcRelDefinesByProperties(GlobalId, OwnerHistory, Name, Description, RelatedObjects, RelatingPropertyDefinition)
+	for _, rel := range rels {
+		objects := rel.attr(4).refs()
+		definition := entities[rel.attr(5).ref]
+		if definition == nil {
+			continue
+		}
+
+		switch definition.name {
+		case "IFCELEMENTQUANTITY":
+			// IfcElementQuantity(..., MethodOfMeasurement, Quantities)
+			for _, ref := range definition.attr(5).refs() {
+				quantity := entities[ref]
+				if quantity == nil || !strings.HasPrefix(quantity.name, "IFCQUANTITY") {
+					continue
+				}
+				// IfcQuantityArea/Length(Name, Description, Unit, Value, ...)
+				set(objects, quantity.attr(0).text(), quantity.attr(3), true)
+			}
+		case "IFCPROPERTYSET":
+			// IfcPropertySet(GlobalId, OwnerHistory, Name, Description, HasProperties)
+			for _, ref := range definition.attr(4).refs() {
+				property := entities[ref]
+				if property == nil || property.name != "IFCPROPERTYSINGLEVALUE" {
+					continue
+				}
+				// IfcPropertySingleValue(Name, Description, NominalValue, Unit)
+				set(objects, property.attr(0).text(), property.attr(2), false)
+			}
+		}
+	}
+	return result
+}
+
+// ifcUnitScales returns the factors converting the project's length and area
+// units into meters and square meters.
+func ifcUnitScales(units []*stepEntity) (lengthScale, areaScale float64) {
+	prefixes := map[string]float64{
+		"": 1, "KILO": 1e3, "HECTO": 1e2, "DECA": 1e1,
+		"DECI": 1e-1, "CENTI": 1e-2, "MILLI": 1e-3, "MICRO": 1e-6,
+	}
+
+	lengthScale, areaScale = 1, 1
+	// IfcSIUnit(Dimensions, UnitType, Prefix, Name)
+	for _, unit := range units {
+		prefix, ok := prefixes[unit.attr(2).enum]
+		if !ok {
+			continue
+		}
+		switch unit.attr(1).enum {
+		case "LENGTHUNIT":
+			lengthScale = prefix
+		case "AREAUNIT":
+			areaScale = prefix * prefix
+		}
+	}
+	return lengthScale, areaScale
+}
+
+// ifcStoreyLevels assigns a level to every storey. Levels are parsed from the
+// storey names where possible; otherwise they are derived from the storey
+// elevations, counting from the storey closest to elevation zero.
+func ifcStoreyLevels(storeys []*stepEntity, report *model.ImportReport) map[int]int32 {
+	levels := make(map[int]int32)
+
+	parsed := true
+	for _, storey := range storeys {
+		level, err := parseFloorLevel(storey.attr(2).text())
+		if err != nil {
+			parsed = false
+			break
+		}
+		levels[storey.id] = level
+	}
+	if parsed {
+		return levels
+	}
+
+	// IfcBuildingStorey(..., CompositionType, Elevation)
+	ordered := append([]*stepEntity(nil), storeys...)
+	elevation := func(e *stepEntity) float64 {
+		value, _ := e.attr(9).number()
+		return value
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return elevation(ordered[i]) < elevation(ordered[j])
+	})
+	ground := 0
+	for i, storey := range ordered {
+		if math.Abs(elevation(storey)) < math.Abs(elevation(ordered[ground])) {
+			ground = i
+		}
+	}
+	for i, storey := range ordered {
+		levels[storey.id] = int32(i - ground)
+	}
+
+	addIssue(report, model.ImportIssueSeverityWarning, 0, "Elevation",
+		"not all storey names are known floor designations, levels are derived from the storey elevations")
+	return levels
+}
+
+// readSTEPFile parses the DATA section of a STEP physical file into its
+// entity instances, keyed by instance number.
+func readSTEPFile(filename string) (map[int]*stepEntity, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error opening IFC file: %w", err)
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	entities := make(map[int]*stepEntity)
+	inData := false
+	for {
+		statement, err := readSTEPStatement(reader)
+		if statement == "" && err != nil {
+			break
+		}
+
+		switch {
+		case statement == "DATA":
+			inData = true
+		case statement == "ENDSEC":
+			inData = false
+		case inData && strings.HasPrefix(statement, "#"):
+			entity, err := parseSTEPEntity(statement)
+			if err != nil {
+				return nil, fmt.Errorf("invalid IFC file: %w", err)
+			}
+			entities[entity.id] = entity
+		}
+	}
+
+	if len(entities) == 0 {
+		return nil, fmt.Errorf("invalid IFC file: no entity instances found")
+	}
+	return entities, nil
+}
+
+// readSTEPStatement reads the next statement terminated by a semicolon,
+// skipping comments and keeping semicolons inside strings.
+func readSTEPStatement(r *bufio.Reader) (string, error) {
+	var b strings.Builder
+	inString := false
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return strings.TrimSpace(b.String()), err
+		}
+
+		switch {
+		case inString:
+			b.WriteByte(c)
+			if c == '\'' {
+				// A doubled quote is an escaped quote, not the end of the string
+				if next, err := r.Peek(1); err == nil && next[0] == '\'' {
+					r.ReadByte()
+					b.WriteByte('\'')
+				} else {
+					inString = false
+				}
+			}
+		case c == '\'':
+			inString = true
+			b.WriteByte(c)
+		case c == '/':
+			if next, err := r.Peek(1); err == nil && next[0] == '*' {
+				r.ReadByte()
+				// Skip the comment
+				var prev byte
+				for {
+					c, err := r.ReadByte()
+					if err != nil {
+						return strings.TrimSpace(b.String()), err
+					}
+					if prev == '*' && c == '/' {
+						break
+					}
+					prev = c
+				}
+			} else {
+				b.WriteByte(c)
+			}
+		case c == ';':
+			return strings.TrimSpace(b.String()), nil
+		case c == '\n' || c == '\r':
+			// Statements may span lines
+		default:
+			b.WriteByte(c)
+		}
+	}
+}
+
+// parseSTEPEntity parses an entity instance such as "#12=IFCSPACE('x',$,...)".
+func parseSTEPEntity(statement string) (*stepEntity, error) {
+	idPart, rest, found := strings.Cut(statement, "=")
+	if !found {
+		return nil, fmt.Errorf("malformed entity instance %q", statement)
+	}
+	id, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(idPart, "#")))
+	if err != nil {
+		return nil, fmt.Errorf("malformed entity instance number %q", idPart)
+	}
+
+	rest = strings.TrimSpace(rest)
+	open := strings.IndexByte(rest, '(')
+	if open == -1 {
+		return nil, fmt.Errorf("malformed entity instance #%d", id)
+	}
+	entity := &stepEntity{id: id, name: strings.ToUpper(strings.TrimSpace(rest[:open]))}
+
+	p := &stepParser{input: rest, pos: open}
+	list, err := p.parseValue()
+	if err != nil {
+		return nil, fmt.Errorf("entity instance #%d: %w", id, err)
+	}
+	entity.attrs = list.list
+	return entity, nil
+}
+
+// stepParser parses the attribute values of an entity instance.
+type stepParser struct {
+	input string
+	pos   int
+}
+
+func (p *stepParser) skipSpace() {
+	for p.pos < len(p.input) && (p.input[p.pos] == ' ' || p.input[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *stepParser) parseValue() (stepValue, error) {
+	p.skipSpace()
+	if p.pos >= len(p.input) {
+		return stepValue{}, fmt.Errorf("unexpected end of input")
+	}
+
+	switch c := p.input[p.pos]; {
+	case c == '(':
+		p.pos++
+		var value stepValue
+		for {
+			p.skipSpace()
+			if p.pos < len(p.input) && p.input[p.pos] == ')' {
+				p.pos++
+				return value, nil
+			}
+			item, err := p.parseValue()
+			if err != nil {
+				return stepValue{}, err
+			}
+			value.list = append(value.list, item)
+			p.skipSpace()
+			if p.pos < len(p.input) && p.input[p.pos] == ',' {
+				p.pos++
+			}
+		}
+	case c == '\'':
+		return p.parseString()
+	case c == '#':
+		start := p.pos + 1
+		p.pos++
+		for p.pos < len(p.input) && p.input[p.pos] >= '0' && p.input[p.pos] <= '9' {
+			p.pos++
+		}
+		ref, err := strconv.Atoi(p.input[start:p.pos])
+		if err != nil {
+			return stepValue{}, fmt.Errorf("malformed reference at %d", start)
+		}
+		return stepValue{ref: ref}, nil
+	case c == '.':
+		end := strings.IndexByte(p.input[p.pos+1:], '.')
+		if end == -1 {
+			return stepValue{}, fmt.Errorf("unterminated enumeration at %d", p.pos)
+		}
+		value := stepValue{enum: p.input[p.pos+1 : p.pos+1+end]}
+		p.pos += end + 2
+		return value, nil
+	case c == '$' || c == '*':
+		p.pos++
+		return stepValue{}, nil
+	case c == '-' || c == '+' || (c >= '0' && c <= '9'):
+		start := p.pos
+		for p.pos < len(p.input) && strings.IndexByte("+-.0123456789Ee", p.input[p.pos]) != -1 {
+			p.pos++
+		}
+		num, err := strconv.ParseFloat(p.input[start:p.pos], 64)
+		if err != nil {
+			return stepValue{}, fmt.Errorf("malformed number %q", p.input[start:p.pos])
+		}
+		return stepValue{num: &num}, nil
+	case (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z'):
+		// A typed value such as IFCAREAMEASURE(12.5)
+		start := p.pos
+		for p.pos < len(p.input) && p.input[p.pos] != '(' {
+			p.pos++
+		}
+		typed := strings.ToUpper(strings.TrimSpace(p.input[start:p.pos]))
+		value, err := p.parseValue()
+		if err != nil {
+			return stepValue{}, err
+		}
+		value.typed = typed
+		return value, nil
+	default:
+		return stepValue{}, fmt.Errorf("unexpected character %q at %d", c, p.pos)
+	}
+}
+
+// parseString parses a quoted string, decoding the STEP escape sequences for
+// non-ASCII characters.
+func (p *stepParser) parseString() (stepValue, error) {
+	p.pos++ // opening quote
+	var raw strings.Builder
+	for {
+		if p.pos >= len(p.input) {
+			return stepValue{}, fmt.Errorf("unterminated string")
+		}
+		c := p.input[p.pos]
+		p.pos++
+		if c == '\'' {
+			if p.pos < len(p.input) && p.input[p.pos] == '\'' {
+				raw.WriteByte('\'')
+				p.pos++
+				continue
+			}
+			break
+		}
+		raw.WriteByte(c)
+	}
+	decoded := decodeSTEPString(raw.String())
+	return stepValue{str: &decoded}, nil
+}
+
+// decodeSTEPString decodes the \X\hh (ISO 8859-1) and \X2\...\X0\ (UTF-16)
+// escape sequences of STEP strings.
+func decodeSTEPString(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		switch {
+		case strings.HasPrefix(s[i:], `\X2\`):
+			end := strings.Index(s[i+4:], `\X0\`)
+			if end == -1 {
+				b.WriteString(s[i:])
+				return b.String()
+			}
+			hex := s[i+4 : i+4+end]
+			var units []uint16
+			for j := 0; j+4 <= len(hex); j += 4 {
+				unit, err := strconv.ParseUint(hex[j:j+4], 16, 16)
+				if err != nil {
+					break
+				}
+				units = append(units, uint16(unit))
+			}
+			b.WriteString(string(utf16.Decode(units)))
+			i += 4 + end + 4
+		case strings.HasPrefix(s[i:], `\X\`) && i+5 <= len(s):
+			code, err := strconv.ParseUint(s[i+3:i+5], 16, 8)
+			if err != nil {
+				b.WriteByte(s[i])
+				i++
+				continue
+			}
+			b.WriteRune(rune(code))
+			i += 5
+		case strings.HasPrefix(s[i:], `\\`):
+			b.WriteByte('\\')
+			i += 2
+		default:
+			b.WriteByte(s[i])
+			i++
+		}
+	}
+	return b.String()
+}
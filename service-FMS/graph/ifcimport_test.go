@@ -0,0 +1,236 @@
+package graph
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/LarsDepuydt/masterthesis-api-aggregation/service-FMS/graph/model"
+)
+
+// writeIFC writes an IFC file with the given entity instances in its DATA
+// section.
+func writeIFC(t *testing.T, data ...string) string {
+	t.Helper()
+	content := "ISO-10303-21;\nHEADER;\nFILE_DESCRIPTION(('ViewDefinition [CoordinationView]'),'2;1');\nFILE_SCHEMA(('IFC4'));\nENDSEC;\nDATA;\n" +
+		strings.Join(data, "\n") + "\nENDSEC;\nEND-ISO-10303-21;\n"
+	path := filepath.Join(t.TempDir(), "model.ifc")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestIFCImporter(t *testing.T) {
+	path := writeIFC(t,
+		"/* lengths in millimeters; areas in square meters */",
+		"#5=IFCSIUNIT(*,.LENGTHUNIT.,.MILLI.,.METRE.);",
+		"#6=IFCSIUNIT(*,.AREAUNIT.,$,.SQUARE_METRE.);",
+		"#10=IFCPOSTALADDRESS($,$,$,$,('Main Street 25'),$,'Aalborg',$,'9000',$);",
+		"#11=IFCBUILDING('b',$,'Building',$,$,$,$,'Main Street',.ELEMENT.,$,$,#10);",
+		"#20=IFCBUILDINGSTOREY('s0',$,'Stue',$,$,$,$,$,.ELEMENT.,0.);",
+		"#21=IFCBUILDINGSTOREY('s1',$,'1. Sal',$,$,$,$,$,.ELEMENT.,3500.);",
+		"#30=IFCRELAGGREGATES('r1',$,$,$,#11,(#20,#21));",
+		"#40=IFCSPACE('sp1',$,'A.001','Corner; by the ''stairs''','Office',$,$,'Kontor \\X2\\00E6\\X0\\ 1',.ELEMENT.,.INTERNAL.,$);",
+		"#41=IFCSPACE('sp2',$,'A.002',$,$,$,$,$,.ELEMENT.,.INTERNAL.,$);",
+		"#42=IFCSPACE('sp3',$,'A.003',$,'Office',$,$,$,.ELEMENT.,.INTERNAL.,$);",
+		"#43=IFCSPACE('sp4',$,'A.001',$,'Office',$,$,$,.ELEMENT.,.INTERNAL.,$);",
+		"#44=IFCSPACE('sp5',$,'B.101',$,'Meeting',$,$,$,.ELEMENT.,.INTERNAL.,$);",
+		// A space nested in another space of the storey
+		"#45=IFCSPACE('sp6',$,'B.101a',$,'Storage',$,$,$,.ELEMENT.,.INTERNAL.,$);",
+		"#31=IFCRELAGGREGATES('r2',$,$,$,#20,(#40,#41,#42,#43));",
+		"#32=IFCRELAGGREGATES('r3',$,$,$,#21,(#44));",
+		"#33=IFCRELAGGREGATES('r4',$,$,$,#44,(#45));",
+		"#50=IFCQUANTITYAREA('NetFloorArea',$,$,12.5,$);",
+		"#51=IFCQUANTITYLENGTH('NetPerimeter',$,$,14200.,$);",
+		"#52=IFCELEMENTQUANTITY('q',$,'BaseQuantities',$,$,(#50,#51));",
+		"#53=IFCRELDEFINESBYPROPERTIES('d1',$,$,$,(#40,#41,#43,#44,#45),#52);",
+		"#60=IFCPROPERTYSINGLEVALUE('Category',$,IFCLABEL('Storage'),$);",
+		"#61=IFCPROPERTYSINGLEVALUE('NetFloorArea',$,IFCAREAMEASURE(99.),$);",
+		"#62=IFCPROPERTYSET('p',$,'Pset_SpaceCommon',$,(#60,#61));",
+		"#63=IFCRELDEFINESBYPROPERTIES('d2',$,$,$,(#41),#62);",
+	)
+
+	report := newImportReport("MS25", "ifc", path)
+	building, err := ifcImporter{}.Import(SpaceSource{BuildingID: "MS25", Path: path}, report)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if building.ID != "MS25" || building.Address != "Main Street 25" || building.City != "Aalborg" || building.Property != "Main Street" {
+		t.Errorf("got building %+v", building)
+	}
+
+	type room struct {
+		floor         string
+		level         int32
+		name          string
+		roomType      string
+		area, outline float64
+	}
+	want := map[string]room{
+		"MS25-Stue-A.001":    {"Stue", 0, "Kontor æ 1", "Office", 12.5, 14.2},
+		"MS25-Stue-A.002":    {"Stue", 0, "", "Storage", 12.5, 14.2},
+		"MS25-1. Sal-B.101":  {"1. Sal", 1, "", "Meeting", 12.5, 14.2},
+		"MS25-1. Sal-B.101a": {"1. Sal", 1, "", "Storage", 12.5, 14.2},
+	}
+	got := make(map[string]room)
+	for _, floor := range building.Floors {
+		for _, r := range floor.Rooms {
+			name := ""
+			if r.Name != nil {
+				name = *r.Name
+			}
+			got[r.ID] = room{floor.Name, floor.Level, name, r.Type, r.Area, r.Circumference}
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("got rooms %v, want %v", got, want)
+	}
+	for id, w := range want {
+		g := got[id]
+		if g.floor != w.floor || g.level != w.level || g.name != w.name || g.roomType != w.roomType ||
+			math.Abs(g.area-w.area) > 1e-9 || math.Abs(g.outline-w.outline) > 1e-9 {
+			t.Errorf("room %s: got %+v, want %+v", id, g, w)
+		}
+	}
+
+	// A.003 has neither area nor perimeter and the second A.001 is a duplicate
+	wantIssues := []issueKey{
+		{model.ImportIssueSeverityError, 42, "NetFloorArea"},
+		{model.ImportIssueSeverityError, 42, "NetPerimeter"},
+		{model.ImportIssueSeverityError, 43, "Name"},
+	}
+	gotIssues := issueKeys(report)
+	if len(gotIssues) != len(wantIssues) {
+		t.Fatalf("got issues %v, want %v", gotIssues, wantIssues)
+	}
+	for i := range gotIssues {
+		if gotIssues[i] != wantIssues[i] {
+			t.Errorf("issue %d: got %v, want %v", i, gotIssues[i], wantIssues[i])
+		}
+	}
+	if report.RowCount != 6 || report.ImportedRowCount != 4 {
+		t.Errorf("got %d of %d spaces imported, want 4 of 6", report.ImportedRowCount, report.RowCount)
+	}
+}
+
+func TestIFCStoreyLevelsFromElevations(t *testing.T) {
+	path := writeIFC(t,
+		"#11=IFCBUILDING('b',$,'Main Street 25',$,$,$,$,$,.ELEMENT.,$,$,$);",
+		"#20=IFCBUILDINGSTOREY('s0',$,'Ground',$,$,$,$,$,.ELEMENT.,0.1);",
+		"#21=IFCBUILDINGSTOREY('s1',$,'Upper',$,$,$,$,$,.ELEMENT.,3.2);",
+		"#22=IFCBUILDINGSTOREY('s2',$,'Basement',$,$,$,$,$,.ELEMENT.,-2.9);",
+		"#30=IFCRELAGGREGATES('r1',$,$,$,#11,(#20,#21,#22));",
+		"#40=IFCSPACE('sp1',$,'G1',$,'Office',$,$,$,.ELEMENT.,.INTERNAL.,$);",
+		"#41=IFCSPACE('sp2',$,'U1',$,'Office',$,$,$,.ELEMENT.,.INTERNAL.,$);",
+		"#42=IFCSPACE('sp3',$,'B1',$,'Storage',$,$,$,.ELEMENT.,.INTERNAL.,$);",
+		"#31=IFCRELCONTAINEDINSPATIALSTRUCTURE('r2',$,$,$,(#40),#20);",
+		"#32=IFCRELAGGREGATES('r3',$,$,$,#21,(#41));",
+		"#33=IFCRELAGGREGATES('r4',$,$,$,#22,(#42));",
+		"#50=IFCPROPERTYSINGLEVALUE('GrossFloorArea',$,IFCAREAMEASURE(10.),$);",
+		"#51=IFCPROPERTYSINGLEVALUE('Perimeter',$,IFCLENGTHMEASURE(13.),$);",
+		"#52=IFCPROPERTYSET('p',$,'Pset',$,(#50,#51));",
+		"#53=IFCRELDEFINESBYPROPERTIES('d',$,$,$,(#40,#41,#42),#52);",
+	)
+
+	report := newImportReport("MS25", "ifc", path)
+	building, err := ifcImporter{}.Import(SpaceSource{BuildingID: "MS25", Path: path}, report)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	levels := make(map[string]int32)
+	for _, floor := range building.Floors {
+		levels[floor.Name] = floor.Level
+	}
+	for name, want := range map[string]int32{"Basement": -1, "Ground": 0, "Upper": 1} {
+		if levels[name] != want {
+			t.Errorf("floor %s: got level %d, want %d", name, levels[name], want)
+		}
+	}
+	if report.WarningCount != 1 || report.ImportedRowCount != 3 {
+		t.Errorf("got report %+v, want one warning and three imported rooms", report)
+	}
+}
+
+func TestIFCImporterErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []string
+	}{
+		{name: "no entities"},
+		{name: "no building", data: []string{"#20=IFCBUILDINGSTOREY('s0',$,'Stue',$,$,$,$,$,.ELEMENT.,0.);"}},
+		{name: "no storeys", data: []string{"#11=IFCBUILDING('b',$,'Main Street 25',$,$,$,$,$,.ELEMENT.,$,$,$);"}},
+		{name: "malformed entity", data: []string{"#11=IFCBUILDING('b',$,'Main Street 25';"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeIFC(t, tt.data...)
+			if _, err := (ifcImporter{}).Import(SpaceSource{BuildingID: "MS25", Path: path}, newImportReport("MS25", "ifc", path)); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestParseSTEPEntity(t *testing.T) {
+	entity, err := parseSTEPEntity(`#12= IfcSpace('it''s',$,*,.INTERNAL.,(#1, #2),IFCAREAMEASURE(12.5),-1.5E-2,())`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if entity.id != 12 || entity.name != "IFCSPACE" || len(entity.attrs) != 8 {
+		t.Fatalf("got entity #%d %s with %d attributes", entity.id, entity.name, len(entity.attrs))
+	}
+
+	if got := entity.attr(0).text(); got != "it's" {
+		t.Errorf("string: got %q", got)
+	}
+	if got := entity.attr(1); got.str != nil || got.num != nil || got.ref != 0 {
+		t.Errorf("null: got %+v", got)
+	}
+	if got := entity.attr(3).enum; got != "INTERNAL" {
+		t.Errorf("enumeration: got %q", got)
+	}
+	if got := entity.attr(4).refs(); len(got) != 2 || got[0] != 1 || got[1] != 2 {
+		t.Errorf("references: got %v", got)
+	}
+	if got, ok := entity.attr(5).number(); !ok || got != 12.5 || entity.attr(5).typed != "IFCAREAMEASURE" {
+		t.Errorf("typed value: got %g, %v", got, ok)
+	}
+	if got, ok := entity.attr(6).number(); !ok || got != -0.015 {
+		t.Errorf("number: got %g, %v", got, ok)
+	}
+	if got := entity.attr(7).list; len(got) != 0 {
+		t.Errorf("empty list: got %v", got)
+	}
+	if got := entity.attr(20); got.str != nil || got.list != nil {
+		t.Errorf("missing attribute: got %+v", got)
+	}
+
+	for _, statement := range []string{"IFCSPACE('x')", "#x=IFCSPACE('x')", "#1=IFCSPACE", "#1=IFCSPACE('x", "#1=IFCSPACE(.X)", "#1=IFCSPACE(1.2.3)"} {
+		if _, err := parseSTEPEntity(statement); err == nil {
+			t.Errorf("%s: expected an error", statement)
+		}
+	}
+}
+
+func TestDecodeSTEPString(t *testing.T) {
+	tests := map[string]string{
+		"Kontor":                 "Kontor",
+		`K\X\E6lder`:             "Kælder",
+		`K\X2\00E6\X0\lder`:      "Kælder",
+		`\X2\00C600D8\X0\`:       "ÆØ",
+		`C:\\plans`:              `C:\plans`,
+		`unterminated \X2\00E6`:  `unterminated \X2\00E6`,
+		`invalid \X\ZZ sequence`: `invalid \X\ZZ sequence`,
+	}
+	for input, want := range tests {
+		if got := decodeSTEPString(input); got != want {
+			t.Errorf("decodeSTEPString(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
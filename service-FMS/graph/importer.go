@@ -0,0 +1,183 @@
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/LarsDepuydt/masterthesis-api-aggregation/service-FMS/graph/model"
+)
+
+// SpaceSource describes where the space data of a single building is
+// imported from.
+type SpaceSource struct {
+	// BuildingID is the ID given to the imported building (e.g., 'TMV25').
+	BuildingID string `json:"buildingId"`
+	// Format selects the importer: "csv", "xlsx" or "ifc".
+	Format string `json:"format"`
+	// Path is the location of the source file.
+	Path string `json:"path"`
+	// Address, City and Property override the building metadata found in the
+	// source, or fill it in when the source does not contain it.
+	Address  string `json:"address,omitempty"`
+	City     string `json:"city,omitempty"`
+	Property string `json:"property,omitempty"`
+	// ValidFrom is the moment from which the source describes the building.
+	// Several sources with different dates may be given for a building to
+	// record how its layout changed; the latest one is its current layout.
+	// Sources without a date describe the building since the beginning.
+	ValidFrom *time.Time `json:"validFrom,omitempty"`
+}
+
+// BuildingVersion is the layout of a building from a given moment on, as
+// imported from a space source.
+type BuildingVersion struct {
+	ValidFrom time.Time
+	Building  *model.Building
+}
+
+// Importer reads the space inventory of a single building from a source.
+// Problems with individual rooms are recorded in the report and the rooms
+// skipped; an error is returned only if the source cannot be read at all.
+type Importer interface {
+	Import(source SpaceSource, report *model.ImportReport) (*model.Building, error)
+}
+
+// importers maps the supported source formats to their importer.
+var importers = map[string]Importer{
+	"csv":  csvImporter{},
+	"xlsx": xlsxImporter{},
+	"ifc":  ifcImporter{},
+}
+
+// LoadSpaceSources reads the list of space sources from a JSON file.
+func LoadSpaceSources(path string) ([]SpaceSource, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read space sources: %w", err)
+	}
+
+	var sources []SpaceSource
+	if err := json.Unmarshal(content, &sources); err != nil {
+		return nil, fmt.Errorf("invalid space sources file %s: %w", path, err)
+	}
+	for i, source := range sources {
+		if source.BuildingID == "" || source.Path == "" {
+			return nil, fmt.Errorf("space source %d in %s needs a buildingId and a path", i, path)
+		}
+		if _, ok := importers[strings.ToLower(source.Format)]; !ok {
+			return nil, fmt.Errorf("space source %d in %s has unsupported format %q", i, path, source.Format)
+		}
+	}
+	return sources, nil
+}
+
+// LoadBuildingData imports the space inventory from all sources, producing an
+// import report per source. It returns the current version of every building
+// along with all versions of every building, oldest first. Sources that
+// cannot be read, or that import a building already imported from an earlier
+// source with the same date, are reported as errors, and make LoadBuildingData
+// return an error naming them along with the reports. Errors in single rows
+// only appear in the reports.
+func LoadBuildingData(sources []SpaceSource) (map[string]*model.Building, map[string][]BuildingVersion, []*model.ImportReport, error) {
+	versions := make(map[string][]BuildingVersion)
+	reports := make([]*model.ImportReport, 0, len(sources))
+	var failed []string
+
+	for _, source := range sources {
+		format := strings.ToLower(source.Format)
+		report := newImportReport(source.BuildingID, format, source.Path)
+		reports = append(reports, report)
+
+		importer, ok := importers[format]
+		if !ok {
+			addIssue(report, model.ImportIssueSeverityError, 0, "", fmt.Sprintf("unsupported format %q", source.Format))
+			failed = append(failed, fmt.Sprintf("%s: unsupported format %q", source.Path, source.Format))
+			continue
+		}
+		var validFrom time.Time
+		if source.ValidFrom != nil {
+			validFrom = source.ValidFrom.UTC()
+		}
+		duplicate := false
+		for _, version := range versions[source.BuildingID] {
+			duplicate = duplicate || version.ValidFrom.Equal(validFrom)
+		}
+		if duplicate {
+			addIssue(report, model.ImportIssueSeverityError, 0, "", fmt.Sprintf("building %s is already imported from another source with the same validFrom", source.BuildingID))
+			failed = append(failed, fmt.Sprintf("%s: building %s is already imported with the same validFrom", source.Path, source.BuildingID))
+			continue
+		}
+
+		building, err := importer.Import(source, report)
+		if err != nil {
+			addIssue(report, model.ImportIssueSeverityError, 0, "", err.Error())
+			failed = append(failed, fmt.Sprintf("%s: %v", source.Path, err))
+			continue
+		}
+
+		// Metadata configured for the source takes precedence
+		if source.Address != "" {
+			building.Address = source.Address
+		}
+		if source.City != "" {
+			building.City = source.City
+		}
+		if source.Property != "" {
+			building.Property = source.Property
+		}
+
+		// Order floors bottom-up so clients can rely on the list order
+		sortFloors(building)
+		versions[building.ID] = append(versions[building.ID], BuildingVersion{ValidFrom: validFrom, Building: building})
+
+		log.Printf("Imported %d of %d rooms for building %s from %s with %d errors and %d warnings",
+			report.ImportedRowCount, report.RowCount, building.ID, source.Path, report.ErrorCount, report.WarningCount)
+	}
+
+	buildingsData := make(map[string]*model.Building, len(versions))
+	for id, buildingVersions := range versions {
+		sort.Slice(buildingVersions, func(i, j int) bool {
+			return buildingVersions[i].ValidFrom.Before(buildingVersions[j].ValidFrom)
+		})
+		buildingsData[id] = buildingVersions[len(buildingVersions)-1].Building
+	}
+
+	switch {
+	case len(failed) > 0:
+		return buildingsData, versions, reports, fmt.Errorf("%d of %d space data sources could not be imported: %s", len(failed), len(sources), strings.Join(failed, "; "))
+	case len(buildingsData) == 0:
+		return buildingsData, versions, reports, fmt.Errorf("no space data source produced a building")
+	}
+	return buildingsData, versions, reports, nil
+}
+
+// addImportedRoom adds a room to the given floor of a building, creating the
+// floor if it does not exist yet.
+func addImportedRoom(b *model.Building, floorName string, level int32, room *model.Room) {
+	var floor *model.Floor
+	for _, f := range b.Floors {
+		if f.Name == floorName {
+			floor = f
+			break
+		}
+	}
+	if floor == nil {
+		floor = &model.Floor{
+			ID:       fmt.Sprintf("%s-%s", b.ID, floorName),
+			Name:     floorName,
+			Level:    level,
+			Building: b,
+			Rooms:    []*model.Room{},
+		}
+		b.Floors = append(b.Floors, floor)
+	}
+
+	room.ID = fmt.Sprintf("%s-%s", floor.ID, room.RoomNumber)
+	room.Floor = floor
+	floor.Rooms = append(floor.Rooms, room)
+}
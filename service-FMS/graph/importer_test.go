@@ -0,0 +1,108 @@
+package graph
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadBuildingData(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	before := write("before.csv", csvHeader+"\nLAGER,,Main Street 25,Stue,A.001,6,10,Main Street,Aalborg\n")
+	after := write("after.csv", csvHeader+"\nLAGER,,Main Street 25,Stue,A.001,6,10,Main Street,Aalborg\nKONTOR,,Main Street 25,1. Sal,B.101,12,14,Main Street,Aalborg\n")
+	renovation := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		sources      []SpaceSource
+		wantErr      bool
+		wantVersions int
+		wantFloors   int
+		wantAddress  string
+	}{
+		{
+			name:         "single source",
+			sources:      []SpaceSource{{BuildingID: "MS25", Format: "csv", Path: before}},
+			wantVersions: 1,
+			wantFloors:   1,
+			wantAddress:  "Main Street 25",
+		},
+		{
+			name: "versions given out of order",
+			sources: []SpaceSource{
+				{BuildingID: "MS25", Format: "csv", Path: after, ValidFrom: &renovation},
+				{BuildingID: "MS25", Format: "CSV", Path: before},
+			},
+			wantVersions: 2,
+			wantFloors:   2,
+			wantAddress:  "Main Street 25",
+		},
+		{
+			name:         "address configured for the source",
+			sources:      []SpaceSource{{BuildingID: "MS25", Format: "csv", Path: before, Address: "Main Street 25, 9000 Aalborg"}},
+			wantVersions: 1,
+			wantFloors:   1,
+			wantAddress:  "Main Street 25, 9000 Aalborg",
+		},
+		{
+			name: "same validFrom twice",
+			sources: []SpaceSource{
+				{BuildingID: "MS25", Format: "csv", Path: before},
+				{BuildingID: "MS25", Format: "csv", Path: after},
+			},
+			wantErr:      true,
+			wantVersions: 1,
+			wantFloors:   1,
+			wantAddress:  "Main Street 25",
+		},
+		{
+			name:    "unreadable source",
+			sources: []SpaceSource{{BuildingID: "MS25", Format: "csv", Path: filepath.Join(dir, "missing.csv")}},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported format",
+			sources: []SpaceSource{{BuildingID: "MS25", Format: "dwg", Path: before}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buildings, versions, reports, err := LoadBuildingData(tt.sources)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if len(reports) != len(tt.sources) {
+				t.Errorf("got %d reports, want one per source", len(reports))
+			}
+			if len(versions["MS25"]) != tt.wantVersions {
+				t.Fatalf("got %d versions, want %d", len(versions["MS25"]), tt.wantVersions)
+			}
+			if tt.wantVersions == 0 {
+				return
+			}
+
+			building := buildings["MS25"]
+			if building != versions["MS25"][tt.wantVersions-1].Building {
+				t.Error("the current building is not the latest version")
+			}
+			if len(building.Floors) != tt.wantFloors || building.Address != tt.wantAddress {
+				t.Errorf("got %d floors at %q, want %d at %q", len(building.Floors), building.Address, tt.wantFloors, tt.wantAddress)
+			}
+			for i := 1; i < len(building.Floors); i++ {
+				if building.Floors[i].Level < building.Floors[i-1].Level {
+					t.Error("floors are not ordered bottom-up")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package graph
+
+import (
+	"log"
+
+	"github.com/LarsDepuydt/masterthesis-api-aggregation/service-FMS/graph/model"
+)
+
+// newImportReport creates an empty import report for the given source.
+func newImportReport(buildingID, format, source string) *model.ImportReport {
+	return &model.ImportReport{
+		BuildingID: buildingID,
+		Format:     format,
+		Source:     source,
+		Issues:     []*model.ImportIssue{},
+	}
+}
+
+// addIssue records a problem found while importing. A row of 0 marks a
+// problem concerning the whole file, an empty column one concerning the
+// whole row.
+func addIssue(report *model.ImportReport, severity model.ImportIssueSeverity, row int, column string, message string) {
+	issue := &model.ImportIssue{
+		Severity: severity,
+		Message:  message,
+	}
+	if row > 0 {
+		r := int32(row)
+		issue.Row = &r
+	}
+	if column != "" {
+		issue.Column = &column
+	}
+	report.Issues = append(report.Issues, issue)
+
+	switch severity {
+	case model.ImportIssueSeverityError:
+		report.ErrorCount++
+		log.Printf("Import error in %s (row %d, column %q): %s", report.Source, row, column, message)
+	case model.ImportIssueSeverityWarning:
+		report.WarningCount++
+		log.Printf("Import warning in %s (row %d, column %q): %s", report.Source, row, column, message)
+	}
+}
@@ -0,0 +1,655 @@
+package graph
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"github.com/LarsDepuydt/masterthesis-api-aggregation/service-FMS/graph/model"
+)
+
+// buildingRecord, floorRecord and roomRecord are the persisted states of the
+// inventory entities, as stored in the change log.
+type buildingRecord struct {
+	ID       string `json:"id"`
+	Address  string `json:"address"`
+	City     string `json:"city"`
+	Property string `json:"property"`
+}
+
+type floorRecord struct {
+	ID         string `json:"id"`
+	BuildingID string `json:"buildingId"`
+	Name       string `json:"name"`
+	Level      int32  `json:"level"`
+}
+
+type roomRecord struct {
+	ID            string  `json:"id"`
+	FloorID       string  `json:"floorId"`
+	RoomNumber    string  `json:"roomNumber"`
+	Type          string  `json:"type"`
+	Area          float64 `json:"area"`
+	Circumference float64 `json:"circumference"`
+}
+
+// inventoryChange is a single entry of the change log.
+type inventoryChange struct {
+	Sequence   int32                     `json:"sequence"`
+	Timestamp  time.Time                 `json:"timestamp"`
+	Actor      string                    `json:"actor"`
+	Operation  model.InventoryOperation  `json:"operation"`
+	EntityType model.InventoryEntityType `json:"entityType"`
+	EntityID   string                    `json:"entityId"`
+	Before     json.RawMessage           `json:"before,omitempty"`
+	After      json.RawMessage           `json:"after,omitempty"`
+}
+
+// toModel converts the change log entry into its GraphQL representation.
+func (c *inventoryChange) toModel() *model.InventoryChange {
+	result := &model.InventoryChange{
+		Sequence:   c.Sequence,
+		Timestamp:  c.Timestamp,
+		Actor:      c.Actor,
+		Operation:  c.Operation,
+		EntityType: c.EntityType,
+		EntityID:   c.EntityID,
+	}
+	if len(c.Before) > 0 {
+		before := string(c.Before)
+		result.Before = &before
+	}
+	if len(c.After) > 0 {
+		after := string(c.After)
+		result.After = &after
+	}
+	return result
+}
+
+// Inventory holds the space inventory and applies changes to it. The current
+// versions of the imported buildings are the baseline; changes made through
+// mutations are appended to a change log on disk and replayed on startup.
+// Earlier versions of the buildings are kept to reconstruct the inventory at
+// past moments.
+//
+// Every change is applied to a copy of the current inventory, which then
+// replaces it. Readers therefore always see a consistent inventory without
+// having to take a lock.
+type Inventory struct {
+	mu        sync.Mutex // serialises writers
+	buildings atomic.Pointer[map[string]*model.Building]
+	changes   []*inventoryChange
+	logPath   string
+	versions  map[string][]BuildingVersion // imported versions of every building, oldest first
+}
+
+// NewInventory creates an inventory from the baseline buildings and replays
+// the change log at logPath on top of it. The versions are the imported
+// versions of every building, oldest first, the last being the baseline.
+func NewInventory(baseline map[string]*model.Building, versions map[string][]BuildingVersion, logPath string) (*Inventory, error) {
+	buildings := cloneBuildings(baseline)
+
+	inv := &Inventory{logPath: logPath, versions: versions}
+	f, err := os.Open(logPath)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		log.Printf("No inventory change log found at %s, starting from the baseline", logPath)
+	case err != nil:
+		return nil, fmt.Errorf("failed to open inventory change log: %w", err)
+	default:
+		defer f.Close()
+
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for line := 1; scanner.Scan(); line++ {
+			var change inventoryChange
+			if err := json.Unmarshal(scanner.Bytes(), &change); err != nil {
+				return nil, fmt.Errorf("invalid entry on line %d of inventory change log: %w", line, err)
+			}
+			// A change that no longer applies, e.g. because the baseline was
+			// updated, is kept in the audit trail but otherwise ignored.
+			if err := applyChange(buildings, &change); err != nil {
+				log.Printf("Skipping inventory change %d: %v", change.Sequence, err)
+			}
+			inv.changes = append(inv.changes, &change)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read inventory change log: %w", err)
+		}
+		log.Printf("Replayed %d inventory changes from %s", len(inv.changes), logPath)
+	}
+
+	inv.buildings.Store(&buildings)
+	return inv, nil
+}
+
+// Buildings returns the current space inventory. The returned data must not
+// be modified.
+func (inv *Inventory) Buildings() map[string]*model.Building {
+	return *inv.buildings.Load()
+}
+
+// Changes returns the audit trail of all changes, oldest first.
+func (inv *Inventory) Changes() []*inventoryChange {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	return inv.changes
+}
+
+// commit applies a change to a copy of the inventory, appends it to the change
+// log and makes the result the current inventory. The before and after
+// states are computed by the given function from the copy.
+func (inv *Inventory) commit(ctx context.Context, operation model.InventoryOperation, entityType model.InventoryEntityType, entityID string, states func(buildings map[string]*model.Building) (before, after any, err error)) (map[string]*model.Building, error) {
+	actor, err := actorFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	buildings := cloneBuildings(inv.Buildings())
+	before, after, err := states(buildings)
+	if err != nil {
+		return nil, err
+	}
+
+	change := &inventoryChange{
+		Sequence:   int32(len(inv.changes) + 1),
+		Timestamp:  time.Now().UTC(),
+		Actor:      actor,
+		Operation:  operation,
+		EntityType: entityType,
+		EntityID:   entityID,
+	}
+	if before != nil {
+		if change.Before, err = json.Marshal(before); err != nil {
+			return nil, fmt.Errorf("failed to encode change: %w", err)
+		}
+	}
+	if after != nil {
+		if change.After, err = json.Marshal(after); err != nil {
+			return nil, fmt.Errorf("failed to encode change: %w", err)
+		}
+	}
+
+	if err := applyChange(buildings, change); err != nil {
+		return nil, err
+	}
+	if err := inv.appendToLog(change); err != nil {
+		log.Printf("Error persisting inventory change on %s: %v", entityID, err)
+		return nil, fmt.Errorf("failed to persist change: %w", err)
+	}
+
+	inv.changes = append(inv.changes, change)
+	inv.buildings.Store(&buildings)
+	log.Printf("Inventory change %d by %s: %s %s %s", change.Sequence, actor, operation, entityType, entityID)
+	return buildings, nil
+}
+
+// record appends a change to the change log that does not affect the
+// buildings, such as a change to the space aliases.
+func (inv *Inventory) record(ctx context.Context, operation model.InventoryOperation, entityType model.InventoryEntityType, entityID string, before, after any) error {
+	_, err := inv.commit(ctx, operation, entityType, entityID, func(map[string]*model.Building) (any, any, error) {
+		return before, after, nil
+	})
+	return err
+}
+
+// appendToLog durably appends a change to the change log.
+func (inv *Inventory) appendToLog(change *inventoryChange) error {
+	line, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(inv.logPath), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(inv.logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// CreateBuilding adds a new building to the inventory.
+func (inv *Inventory) CreateBuilding(ctx context.Context, record buildingRecord) (*model.Building, error) {
+	buildings, err := inv.commit(ctx, model.InventoryOperationCreate, model.InventoryEntityTypeBuilding, record.ID,
+		func(map[string]*model.Building) (any, any, error) {
+			return nil, record, nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	return buildings[record.ID], nil
+}
+
+// UpdateBuilding changes the fields of a building using the given function.
+func (inv *Inventory) UpdateBuilding(ctx context.Context, id string, update func(*buildingRecord)) (*model.Building, error) {
+	buildings, err := inv.commit(ctx, model.InventoryOperationUpdate, model.InventoryEntityTypeBuilding, id,
+		func(buildings map[string]*model.Building) (any, any, error) {
+			building := buildings[id]
+			if building == nil {
+				return nil, nil, fmt.Errorf("building with ID %s not found", id)
+			}
+			before := newBuildingRecord(building)
+			after := before
+			update(&after)
+			return before, after, nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	return buildings[id], nil
+}
+
+// DeleteBuilding removes a building without floors from the inventory.
+func (inv *Inventory) DeleteBuilding(ctx context.Context, id string) error {
+	_, err := inv.commit(ctx, model.InventoryOperationDelete, model.InventoryEntityTypeBuilding, id,
+		func(buildings map[string]*model.Building) (any, any, error) {
+			building := buildings[id]
+			if building == nil {
+				return nil, nil, fmt.Errorf("building with ID %s not found", id)
+			}
+			return newBuildingRecord(building), nil, nil
+		})
+	return err
+}
+
+// CreateFloor adds a new floor to a building.
+func (inv *Inventory) CreateFloor(ctx context.Context, record floorRecord) (*model.Floor, error) {
+	buildings, err := inv.commit(ctx, model.InventoryOperationCreate, model.InventoryEntityTypeFloor, record.ID,
+		func(map[string]*model.Building) (any, any, error) {
+			return nil, record, nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	return findFloor(buildings, record.ID), nil
+}
+
+// UpdateFloor changes the fields of a floor using the given function.
+func (inv *Inventory) UpdateFloor(ctx context.Context, id string, update func(*floorRecord)) (*model.Floor, error) {
+	buildings, err := inv.commit(ctx, model.InventoryOperationUpdate, model.InventoryEntityTypeFloor, id,
+		func(buildings map[string]*model.Building) (any, any, error) {
+			floor := findFloor(buildings, id)
+			if floor == nil {
+				return nil, nil, fmt.Errorf("floor with ID %s not found", id)
+			}
+			before := newFloorRecord(floor)
+			after := before
+			update(&after)
+			return before, after, nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	return findFloor(buildings, id), nil
+}
+
+// DeleteFloor removes a floor without rooms from its building.
+func (inv *Inventory) DeleteFloor(ctx context.Context, id string) error {
+	_, err := inv.commit(ctx, model.InventoryOperationDelete, model.InventoryEntityTypeFloor, id,
+		func(buildings map[string]*model.Building) (any, any, error) {
+			floor := findFloor(buildings, id)
+			if floor == nil {
+				return nil, nil, fmt.Errorf("floor with ID %s not found", id)
+			}
+			return newFloorRecord(floor), nil, nil
+		})
+	return err
+}
+
+// CreateRoom adds a new room to a floor.
+func (inv *Inventory) CreateRoom(ctx context.Context, record roomRecord) (*model.Room, error) {
+	buildings, err := inv.commit(ctx, model.InventoryOperationCreate, model.InventoryEntityTypeRoom, record.ID,
+		func(map[string]*model.Building) (any, any, error) {
+			return nil, record, nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	return findRoom(buildings, record.ID), nil
+}
+
+// UpdateRoom changes the fields of a room using the given function.
+func (inv *Inventory) UpdateRoom(ctx context.Context, id string, update func(*roomRecord)) (*model.Room, error) {
+	buildings, err := inv.commit(ctx, model.InventoryOperationUpdate, model.InventoryEntityTypeRoom, id,
+		func(buildings map[string]*model.Building) (any, any, error) {
+			room := findRoom(buildings, id)
+			if room == nil {
+				return nil, nil, fmt.Errorf("room with ID %s not found", id)
+			}
+			before := newRoomRecord(room)
+			after := before
+			update(&after)
+			return before, after, nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	return findRoom(buildings, id), nil
+}
+
+// DeleteRoom removes a room from its floor.
+func (inv *Inventory) DeleteRoom(ctx context.Context, id string) error {
+	_, err := inv.commit(ctx, model.InventoryOperationDelete, model.InventoryEntityTypeRoom, id,
+		func(buildings map[string]*model.Building) (any, any, error) {
+			room := findRoom(buildings, id)
+			if room == nil {
+				return nil, nil, fmt.Errorf("room with ID %s not found", id)
+			}
+			return newRoomRecord(room), nil, nil
+		})
+	return err
+}
+
+// applyChange validates a change and applies it to the given buildings.
+func applyChange(buildings map[string]*model.Building, change *inventoryChange) error {
+	switch change.EntityType {
+	case model.InventoryEntityTypeBuilding:
+		return applyBuildingChange(buildings, change)
+	case model.InventoryEntityTypeFloor:
+		return applyFloorChange(buildings, change)
+	case model.InventoryEntityTypeRoom:
+		return applyRoomChange(buildings, change)
+	case model.InventoryEntityTypeAlias, model.InventoryEntityTypeFloorplan:
+		// Aliases and floorplans are kept by the alias registry and floorplan
+		// store, the change log only records changes to them for the audit
+		// trail
+		return nil
+	default:
+		return fmt.Errorf("unknown entity type %q", change.EntityType)
+	}
+}
+
+func applyBuildingChange(buildings map[string]*model.Building, change *inventoryChange) error {
+	var record buildingRecord
+	if change.Operation != model.InventoryOperationDelete {
+		if err := json.Unmarshal(change.After, &record); err != nil {
+			return fmt.Errorf("invalid building state: %w", err)
+		}
+		if strings.TrimSpace(record.Address) == "" {
+			return fmt.Errorf("building address must not be empty")
+		}
+	}
+
+	switch change.Operation {
+	case model.InventoryOperationCreate:
+		if strings.TrimSpace(record.ID) == "" {
+			return fmt.Errorf("building ID must not be empty")
+		}
+		if err := validateIDPart("building ID", record.ID); err != nil {
+			return err
+		}
+		if _, exists := buildings[record.ID]; exists {
+			return fmt.Errorf("building with ID %s already exists", record.ID)
+		}
+		buildings[record.ID] = &model.Building{
+			ID:       record.ID,
+			Address:  record.Address,
+			City:     record.City,
+			Property: record.Property,
+			Floors:   []*model.Floor{},
+		}
+	case model.InventoryOperationUpdate:
+		building := buildings[change.EntityID]
+		if building == nil {
+			return fmt.Errorf("building with ID %s not found", change.EntityID)
+		}
+		building.Address = record.Address
+		building.City = record.City
+		building.Property = record.Property
+	case model.InventoryOperationDelete:
+		building := buildings[change.EntityID]
+		if building == nil {
+			return fmt.Errorf("building with ID %s not found", change.EntityID)
+		}
+		if len(building.Floors) > 0 {
+			return fmt.Errorf("building %s still has %d floors, delete them first", building.ID, len(building.Floors))
+		}
+		delete(buildings, change.EntityID)
+	default:
+		return fmt.Errorf("unknown operation %q", change.Operation)
+	}
+	return nil
+}
+
+func applyFloorChange(buildings map[string]*model.Building, change *inventoryChange) error {
+	var record floorRecord
+	if change.Operation != model.InventoryOperationDelete {
+		if err := json.Unmarshal(change.After, &record); err != nil {
+			return fmt.Errorf("invalid floor state: %w", err)
+		}
+	}
+
+	switch change.Operation {
+	case model.InventoryOperationCreate:
+		building := buildings[record.BuildingID]
+		if building == nil {
+			return fmt.Errorf("building with ID %s not found", record.BuildingID)
+		}
+		if strings.TrimSpace(record.Name) == "" {
+			return fmt.Errorf("floor name must not be empty")
+		}
+		if err := validateIDPart("floor name", record.Name); err != nil {
+			return err
+		}
+		for _, floor := range building.Floors {
+			if floor.Name == record.Name || floor.ID == record.ID {
+				return fmt.Errorf("floor %q already exists in building %s", record.Name, building.ID)
+			}
+		}
+		building.Floors = append(building.Floors, &model.Floor{
+			ID:       record.ID,
+			Name:     record.Name,
+			Level:    record.Level,
+			Building: building,
+			Rooms:    []*model.Room{},
+		})
+		sortFloors(building)
+	case model.InventoryOperationUpdate:
+		floor := findFloor(buildings, change.EntityID)
+		if floor == nil {
+			return fmt.Errorf("floor with ID %s not found", change.EntityID)
+		}
+		floor.Level = record.Level
+		sortFloors(floor.Building)
+	case model.InventoryOperationDelete:
+		floor := findFloor(buildings, change.EntityID)
+		if floor == nil {
+			return fmt.Errorf("floor with ID %s not found", change.EntityID)
+		}
+		if len(floor.Rooms) > 0 {
+			return fmt.Errorf("floor %s still has %d rooms, delete them first", floor.ID, len(floor.Rooms))
+		}
+		building := floor.Building
+		for i, f := range building.Floors {
+			if f == floor {
+				building.Floors = append(building.Floors[:i], building.Floors[i+1:]...)
+				break
+			}
+		}
+	default:
+		return fmt.Errorf("unknown operation %q", change.Operation)
+	}
+	return nil
+}
+
+func applyRoomChange(buildings map[string]*model.Building, change *inventoryChange) error {
+	var record roomRecord
+	if change.Operation != model.InventoryOperationDelete {
+		if err := json.Unmarshal(change.After, &record); err != nil {
+			return fmt.Errorf("invalid room state: %w", err)
+		}
+		if record.Area <= 0 {
+			return fmt.Errorf("room area must be positive, got %g", record.Area)
+		}
+		if record.Circumference <= 0 {
+			return fmt.Errorf("room circumference must be positive, got %g", record.Circumference)
+		}
+		if strings.TrimSpace(record.Type) == "" {
+			return fmt.Errorf("room type must not be empty")
+		}
+	}
+
+	switch change.Operation {
+	case model.InventoryOperationCreate:
+		floor := findFloor(buildings, record.FloorID)
+		if floor == nil {
+			return fmt.Errorf("floor with ID %s not found", record.FloorID)
+		}
+		if strings.TrimSpace(record.RoomNumber) == "" {
+			return fmt.Errorf("room number must not be empty")
+		}
+		if err := validateIDPart("room number", record.RoomNumber); err != nil {
+			return err
+		}
+		for _, room := range floor.Rooms {
+			if room.RoomNumber == record.RoomNumber {
+				return fmt.Errorf("room number %s is already in use on floor %s", record.RoomNumber, floor.ID)
+			}
+		}
+		if findRoom(buildings, record.ID) != nil {
+			return fmt.Errorf("room with ID %s already exists", record.ID)
+		}
+		floor.Rooms = append(floor.Rooms, &model.Room{
+			ID:            record.ID,
+			RoomNumber:    record.RoomNumber,
+			Type:          record.Type,
+			Area:          record.Area,
+			Circumference: record.Circumference,
+			Floor:         floor,
+		})
+	case model.InventoryOperationUpdate:
+		room := findRoom(buildings, change.EntityID)
+		if room == nil {
+			return fmt.Errorf("room with ID %s not found", change.EntityID)
+		}
+		room.Type = record.Type
+		room.Area = record.Area
+		room.Circumference = record.Circumference
+	case model.InventoryOperationDelete:
+		room := findRoom(buildings, change.EntityID)
+		if room == nil {
+			return fmt.Errorf("room with ID %s not found", change.EntityID)
+		}
+		floor := room.Floor
+		for i, r := range floor.Rooms {
+			if r == room {
+				floor.Rooms = append(floor.Rooms[:i], floor.Rooms[i+1:]...)
+				break
+			}
+		}
+	default:
+		return fmt.Errorf("unknown operation %q", change.Operation)
+	}
+	return nil
+}
+
+// validateIDPart checks a value that becomes part of the ID of a building,
+// floor or room. IDs end up in file names and URLs, so path separators, ".."
+// and control characters are rejected.
+func validateIDPart(field, value string) error {
+	if strings.ContainsAny(value, `/\`) || strings.Contains(value, "..") {
+		return fmt.Errorf("%s %q must not contain '/', '\\' or '..'", field, value)
+	}
+	if strings.ContainsFunc(value, unicode.IsControl) {
+		return fmt.Errorf("%s %q must not contain control characters", field, value)
+	}
+	return nil
+}
+
+func newBuildingRecord(b *model.Building) buildingRecord {
+	return buildingRecord{ID: b.ID, Address: b.Address, City: b.City, Property: b.Property}
+}
+
+func newFloorRecord(f *model.Floor) floorRecord {
+	return floorRecord{ID: f.ID, BuildingID: f.Building.ID, Name: f.Name, Level: f.Level}
+}
+
+func newRoomRecord(r *model.Room) roomRecord {
+	return roomRecord{
+		ID:            r.ID,
+		FloorID:       r.Floor.ID,
+		RoomNumber:    r.RoomNumber,
+		Type:          r.Type,
+		Area:          r.Area,
+		Circumference: r.Circumference,
+	}
+}
+
+// cloneBuildings returns a deep copy of the buildings, keyed by building ID.
+func cloneBuildings(buildings map[string]*model.Building) map[string]*model.Building {
+	clone := make(map[string]*model.Building, len(buildings))
+	for _, b := range buildings {
+		building := *b
+		building.Floors = make([]*model.Floor, 0, len(b.Floors))
+		for _, f := range b.Floors {
+			floor := *f
+			floor.Building = &building
+			floor.Rooms = make([]*model.Room, 0, len(f.Rooms))
+			for _, r := range f.Rooms {
+				room := *r
+				room.Floor = &floor
+				floor.Rooms = append(floor.Rooms, &room)
+			}
+			building.Floors = append(building.Floors, &floor)
+		}
+		clone[building.ID] = &building
+	}
+	return clone
+}
+
+// sortFloors orders the floors of a building bottom-up.
+func sortFloors(b *model.Building) {
+	sort.SliceStable(b.Floors, func(i, j int) bool {
+		return b.Floors[i].Level < b.Floors[j].Level
+	})
+}
+
+// findFloor returns the floor with the given ID, or nil if it does not exist.
+func findFloor(buildings map[string]*model.Building, id string) *model.Floor {
+	for _, building := range buildings {
+		for _, floor := range building.Floors {
+			if floor.ID == id {
+				return floor
+			}
+		}
+	}
+	return nil
+}
+
+// findRoom returns the room with the given ID, or nil if it does not exist.
+func findRoom(buildings map[string]*model.Building, id string) *model.Room {
+	for _, building := range buildings {
+		for _, floor := range building.Floors {
+			for _, room := range floor.Rooms {
+				if room.ID == id {
+					return room
+				}
+			}
+		}
+	}
+	return nil
+}
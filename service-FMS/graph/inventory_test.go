@@ -0,0 +1,222 @@
+package graph
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/LarsDepuydt/masterthesis-api-aggregation/service-FMS/graph/model"
+)
+
+// asActor returns a context in which the given user makes the request.
+func asActor(actor string) context.Context {
+	return context.WithValue(context.Background(), actorContextKey{}, actor)
+}
+
+func TestValidateIDPart(t *testing.T) {
+	tests := []struct {
+		value   string
+		wantErr bool
+	}{
+		{value: "Stue"},
+		{value: "1. Sal"},
+		{value: "A1.02"},
+		{value: "Kælder"},
+		{value: "../escaped", wantErr: true},
+		{value: "a/b", wantErr: true},
+		{value: `a\b`, wantErr: true},
+		{value: "..", wantErr: true},
+		{value: "Stue\n", wantErr: true},
+		{value: "Stue\x00", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		err := validateIDPart("floor name", tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("validateIDPart(%q): got error %v, want error %v", tt.value, err, tt.wantErr)
+		}
+	}
+}
+
+func TestInventoryChangeLog(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "data", "inventory-changes.jsonl")
+	baseline := map[string]*model.Building{
+		"TMV25": {ID: "TMV25", Address: "Main Street 25", Floors: []*model.Floor{}},
+	}
+
+	inv, err := NewInventory(baseline, nil, logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := asActor("alice")
+
+	steps := []struct {
+		name    string
+		apply   func() error
+		wantErr bool
+	}{
+		{name: "create floor", apply: func() error {
+			_, err := inv.CreateFloor(ctx, floorRecord{ID: "TMV25-Stue", BuildingID: "TMV25", Name: "Stue"})
+			return err
+		}},
+		{name: "create room", apply: func() error {
+			_, err := inv.CreateRoom(ctx, roomRecord{ID: "TMV25-Stue-A1", FloorID: "TMV25-Stue", RoomNumber: "A1", Type: "office", Area: 12, Circumference: 14})
+			return err
+		}},
+		{name: "update room", apply: func() error {
+			_, err := inv.UpdateRoom(ctx, "TMV25-Stue-A1", func(r *roomRecord) { r.Area = 16 })
+			return err
+		}},
+		{name: "floor name with a path", wantErr: true, apply: func() error {
+			_, err := inv.CreateFloor(ctx, floorRecord{ID: "TMV25-../x", BuildingID: "TMV25", Name: "../x"})
+			return err
+		}},
+		{name: "room number with a control character", wantErr: true, apply: func() error {
+			_, err := inv.CreateRoom(ctx, roomRecord{ID: "TMV25-Stue-A2\n", FloorID: "TMV25-Stue", RoomNumber: "A2\n", Type: "office", Area: 12, Circumference: 14})
+			return err
+		}},
+		{name: "duplicate room number", wantErr: true, apply: func() error {
+			_, err := inv.CreateRoom(ctx, roomRecord{ID: "TMV25-Stue-A1", FloorID: "TMV25-Stue", RoomNumber: "A1", Type: "office", Area: 12, Circumference: 14})
+			return err
+		}},
+		{name: "delete floor with rooms", wantErr: true, apply: func() error {
+			return inv.DeleteFloor(ctx, "TMV25-Stue")
+		}},
+		{name: "without an actor", wantErr: true, apply: func() error {
+			_, err := inv.CreateFloor(context.Background(), floorRecord{ID: "TMV25-1. Sal", BuildingID: "TMV25", Name: "1. Sal", Level: 1})
+			return err
+		}},
+	}
+	for _, step := range steps {
+		if err := step.apply(); (err != nil) != step.wantErr {
+			t.Fatalf("%s: got error %v, want error %v", step.name, err, step.wantErr)
+		}
+	}
+
+	// Rejected changes are not logged, so replaying the log on the baseline
+	// restores the inventory
+	replayed, err := NewInventory(baseline, nil, logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, i := range map[string]*Inventory{"current": inv, "replayed": replayed} {
+		changes := i.Changes()
+		if len(changes) != 3 {
+			t.Fatalf("%s: got %d changes, want 3", name, len(changes))
+		}
+		for n, change := range changes {
+			if change.Sequence != int32(n+1) || change.Actor != "alice" {
+				t.Errorf("%s: change %d has sequence %d by %q", name, n, change.Sequence, change.Actor)
+			}
+		}
+		room := findRoom(i.Buildings(), "TMV25-Stue-A1")
+		if room == nil || room.Area != 16 || room.Floor.Building.ID != "TMV25" {
+			t.Errorf("%s: got room %+v, want the updated room", name, room)
+		}
+	}
+	if len(baseline["TMV25"].Floors) != 0 {
+		t.Error("the baseline was modified")
+	}
+}
+
+func TestInventoryReplaySkipsInvalidChanges(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "inventory-changes.jsonl")
+	entries := []string{
+		`{"sequence":1,"actor":"alice","operation":"CREATE","entityType":"FLOOR","entityId":"TMV25-Stue","after":{"id":"TMV25-Stue","buildingId":"TMV25","name":"Stue"}}`,
+		// Written before floor names were checked
+		`{"sequence":2,"actor":"alice","operation":"CREATE","entityType":"FLOOR","entityId":"TMV25-../x","after":{"id":"TMV25-../x","buildingId":"TMV25","name":"../x"}}`,
+		`{"sequence":3,"actor":"alice","operation":"CREATE","entityType":"FLOORPLAN","entityId":"TMV25-Stue","after":{"floorId":"TMV25-Stue","file":"TMV25-Stue.pdf"}}`,
+	}
+	if err := os.WriteFile(logPath, []byte(strings.Join(entries, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	baseline := map[string]*model.Building{"TMV25": {ID: "TMV25", Address: "Main Street 25", Floors: []*model.Floor{}}}
+
+	inv, err := NewInventory(baseline, nil, logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Skipped changes stay in the audit trail
+	if got := len(inv.Changes()); got != 3 {
+		t.Errorf("got %d changes, want 3", got)
+	}
+	floors := inv.Buildings()["TMV25"].Floors
+	if len(floors) != 1 || floors[0].ID != "TMV25-Stue" {
+		t.Errorf("got floors %+v, want only TMV25-Stue", floors)
+	}
+}
+
+func TestWithActor(t *testing.T) {
+	tokens := ActorTokens{
+		"alice": strings.Repeat("a", minActorTokenLength),
+		"bob":   strings.Repeat("b", minActorTokenLength),
+	}
+	tests := []struct {
+		name      string
+		header    map[string]string
+		wantActor string
+	}{
+		{name: "valid token", header: map[string]string{"Authorization": "Bearer " + tokens["bob"]}, wantActor: "bob"},
+		{name: "unknown token", header: map[string]string{"Authorization": "Bearer " + strings.Repeat("c", minActorTokenLength)}},
+		{name: "token without scheme", header: map[string]string{"Authorization": tokens["alice"]}},
+		{name: "empty token", header: map[string]string{"Authorization": "Bearer "}},
+		{name: "actor header only", header: map[string]string{"X-Actor": "alice"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var actor string
+			var actorErr error
+			handler := WithActor(tokens, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				actor, actorErr = actorFromContext(r.Context())
+			}))
+			request := httptest.NewRequest(http.MethodPost, "/query", nil)
+			for name, value := range tt.header {
+				request.Header.Set(name, value)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), request)
+
+			if actor != tt.wantActor {
+				t.Errorf("got actor %q, want %q", actor, tt.wantActor)
+			}
+			if (actorErr == nil) != (tt.wantActor != "") {
+				t.Errorf("got error %v", actorErr)
+			}
+		})
+	}
+}
+
+func TestLoadActorTokens(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{name: "valid", content: `{"alice": "` + strings.Repeat("a", minActorTokenLength) + `"}`},
+		{name: "short token", content: `{"alice": "secret"}`, wantErr: true},
+		{name: "without user", content: `{" ": "` + strings.Repeat("a", minActorTokenLength) + `"}`, wantErr: true},
+		{name: "not an object", content: `["alice"]`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "actor-tokens.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := LoadActorTokens(path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	tokens, err := LoadActorTokens(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil || len(tokens) != 0 {
+		t.Errorf("missing file: got %v, %v, want no tokens", tokens, err)
+	}
+}
@@ -2,34 +2,637 @@
 
 package model
 
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Represents a building, containing multiple floors. This type is part
+// of a federated schema, indicated by the @key directive.
+// Currently, this API only provides data for the TMV25 building at AAU Innovate.
 type Building struct {
-	ID       string   `json:"id"`
-	Address  string   `json:"address"`
-	City     string   `json:"city"`
-	Property string   `json:"property"`
-	Floors   []*Floor `json:"floors"`
+	// The unique identifier of the building.
+	ID string `json:"id"`
+	// The street address of the building.
+	Address string `json:"address"`
+	// The city where the building is located.
+	City string `json:"city"`
+	// The property identifier or name associated with the building within
+	// the organization's property management system.
+	Property string `json:"property"`
+	// A list of floors within this building, ordered by level.
+	Floors []*Floor `json:"floors"`
+	// The sum of the areas of all rooms in this building, in square meters.
+	TotalArea float64 `json:"totalArea"`
+	// The number of rooms in this building.
+	RoomCount int32 `json:"roomCount"`
+	// The total room area in this building, broken down by room type.
+	AreaByRoomType []*RoomTypeArea `json:"areaByRoomType"`
+	// The identifiers other systems use for this building.
+	Aliases []*SpaceAlias `json:"aliases"`
 }
 
 func (Building) IsEntity() {}
 
+// The fields of a new building.
+type CreateBuildingInput struct {
+	// The unique identifier of the building (e.g., 'TMV25').
+	ID       string `json:"id"`
+	Address  string `json:"address"`
+	City     string `json:"city"`
+	Property string `json:"property"`
+}
+
+// The fields of a new floor. The floor ID is derived from the building ID and
+// the floor name (e.g., 'TMV25-1. Sal').
+type CreateFloorInput struct {
+	// The ID of the building the floor belongs to.
+	BuildingID string `json:"buildingId"`
+	// The name of the floor, unique within the building (e.g., '4. Sal').
+	Name string `json:"name"`
+	// The level of the floor relative to the ground floor. If omitted, the
+	// level is derived from the floor name.
+	Level *int32 `json:"level,omitempty"`
+}
+
+// The fields of a new room. The room ID is derived from the floor ID and the
+// room number (e.g., 'TMV25-1. Sal-A.111').
+type CreateRoomInput struct {
+	// The ID of the floor the room is located on.
+	FloorID string `json:"floorId"`
+	// The room number, unique within the floor.
+	RoomNumber string `json:"roomNumber"`
+	Type       string `json:"type"`
+	// The area of the room, in square meters. Must be positive.
+	Area float64 `json:"area"`
+	// The circumference of the room, in meters. Must be positive.
+	Circumference float64 `json:"circumference"`
+}
+
+// Represents a floor within a building. This type is part of a federated
+// schema, indicated by the @key directive.
 type Floor struct {
-	ID           string  `json:"id"`
-	Name         string  `json:"name"`
-	Rooms        []*Room `json:"rooms"`
-	FloorplanURL string  `json:"floorplanUrl"`
+	// The unique identifier of the floor.
+	ID string `json:"id"`
+	// The name or designation of the floor (e.g., 'Ground Floor', '1st Floor').
+	Name string `json:"name"`
+	// The level of the floor relative to the ground floor (e.g., 'Kælder' is -1,
+	// 'Stue' is 0, '1. Sal' is 1). Floors within a building are ordered by level.
+	Level int32 `json:"level"`
+	// The building this floor belongs to.
+	Building *Building `json:"building"`
+	// A list of rooms located on this floor.
+	Rooms []*Room `json:"rooms"`
+	// The URL pointing to a pdf or svg representing the floorplan
+	// of this floor. The file is served by this service. Empty when no
+	// floorplan has been uploaded for the floor.
+	FloorplanURL string `json:"floorplanUrl"`
+	// The sum of the areas of all rooms on this floor, in square meters.
+	TotalArea float64 `json:"totalArea"`
+	// The number of rooms located on this floor.
+	RoomCount int32 `json:"roomCount"`
+	// The identifiers other systems use for this floor.
+	Aliases []*SpaceAlias `json:"aliases"`
 }
 
 func (Floor) IsEntity() {}
 
+// A single problem found while importing space data.
+type ImportIssue struct {
+	// The severity of the problem.
+	Severity ImportIssueSeverity `json:"severity"`
+	// The location of the problem in the source file: the line number for csv
+	// and xlsx files, counting the header as line 1, or the entity instance
+	// number for ifc files. Null for problems concerning the whole file.
+	Row *int32 `json:"row,omitempty"`
+	// The column the problem was found in, if it concerns a single column.
+	Column *string `json:"column,omitempty"`
+	// A description of the problem.
+	Message string `json:"message"`
+}
+
+// The result of validating and importing a space data source.
+type ImportReport struct {
+	// The ID of the building imported from the source. Empty for room attribute
+	// files that cover several buildings.
+	BuildingID string `json:"buildingId"`
+	// The format of the source (e.g., 'csv', 'xlsx', 'ifc', or 'attributes' for
+	// room attribute files).
+	Format string `json:"format"`
+	// The file the space data was imported from.
+	Source string `json:"source"`
+	// The number of rooms in the source; for csv and xlsx files the number of
+	// data rows, excluding the header.
+	RowCount int32 `json:"rowCount"`
+	// The number of rooms that were imported into the inventory, or whose
+	// attributes were imported.
+	ImportedRowCount int32 `json:"importedRowCount"`
+	// The number of issues with severity ERROR.
+	ErrorCount int32 `json:"errorCount"`
+	// The number of issues with severity WARNING.
+	WarningCount int32 `json:"warningCount"`
+	// All problems found, in the order they were encountered.
+	Issues []*ImportIssue `json:"issues"`
+}
+
+// A single change made to the space inventory through a mutation, as recorded
+// in the audit trail.
+type InventoryChange struct {
+	// The sequence number of the change. Changes are applied in this order.
+	Sequence int32 `json:"sequence"`
+	// The time at which the change was made.
+	Timestamp time.Time `json:"timestamp"`
+	// The user who made the change, as identified by their API token.
+	Actor string `json:"actor"`
+	// The kind of modification.
+	Operation InventoryOperation `json:"operation"`
+	// The kind of entity that was modified.
+	EntityType InventoryEntityType `json:"entityType"`
+	// The ID of the entity that was modified.
+	EntityID string `json:"entityId"`
+	// The state of the entity before the change, as a JSON document.
+	// Null for CREATE operations.
+	Before *string `json:"before,omitempty"`
+	// The state of the entity after the change, as a JSON document.
+	// Null for DELETE operations.
+	After *string `json:"after,omitempty"`
+}
+
+// A difference between two versions of the space inventory.
+type InventoryDifference struct {
+	// The kind of entity that differs.
+	EntityType InventoryEntityType `json:"entityType"`
+	// The ID of the entity that differs.
+	EntityID string `json:"entityId"`
+	// How the entity differs.
+	Kind InventoryDifferenceKind `json:"kind"`
+	// The names of the properties that differ (e.g., 'area'). Empty for added
+	// and removed entities.
+	ChangedFields []string `json:"changedFields"`
+	// The state of the entity in the earlier version, as a JSON object. Null for
+	// added entities.
+	Before *string `json:"before,omitempty"`
+	// The state of the entity in the later version, as a JSON object. Null for
+	// removed entities.
+	After *string `json:"after,omitempty"`
+}
+
+// Provides the root fields for modifying facility data.
+//
+// Changes to the space inventory are persisted and recorded in the audit
+// trail together with the user making them. These mutations require the API
+// token of that user in an 'Authorization: Bearer <token>' request header.
+type Mutation struct {
+}
+
+// A point in the two-dimensional coordinate system of a floor, in meters.
+type Point struct {
+	// The horizontal coordinate, in meters.
+	X float64 `json:"x"`
+	// The vertical coordinate, in meters.
+	Y float64 `json:"y"`
+}
+
+// Provides the root fields for querying building, floor, and room data.
+// Note that this API currently only provides data for the TMV25 building
+// at AAU Innovate.
 type Query struct {
 }
 
+// Represents a specific room within a floor and building. This type is
+// part of a federated schema, indicated by the @key directive.
 type Room struct {
-	ID            string  `json:"id"`
-	RoomNumber    string  `json:"roomNumber"`
-	Type          string  `json:"type"`
-	Area          float64 `json:"area"`
+	// The unique identifier of the room.
+	ID string `json:"id"`
+	// The identifier assigned to the room.
+	RoomNumber string `json:"roomNumber"`
+	// The descriptive name of the room (e.g., 'Meeting room'), if provided by
+	// the data source the room was imported from.
+	Name *string `json:"name,omitempty"`
+	// The type or category of the room (e.g., 'classroom', 'office', 'meeting room').
+	Type string `json:"type"`
+	// The area of the room, in square meters.
+	Area float64 `json:"area"`
+	// The circumference of the room, in meters.
 	Circumference float64 `json:"circumference"`
+	// The floor this room is located on.
+	Floor *Floor `json:"floor"`
+	// The outline of the room as a closed polygon, in meters, in the coordinate
+	// system of its floor. Null when no geometry has been imported for the room.
+	Geometry []*Point `json:"geometry,omitempty"`
+	// The centroid of the room's outline, in meters, in the coordinate system of
+	// its floor. Null when no geometry has been imported for the room.
+	Centroid *Point `json:"centroid,omitempty"`
+	// The rooms on the same floor that share a wall with this room. Empty when
+	// no geometry has been imported for the room.
+	Neighbors []*Room `json:"neighbors"`
+	// The identifiers other systems use for this room.
+	Aliases []*SpaceAlias `json:"aliases"`
+	// The maximum number of people allowed in the room. Null when unknown.
+	Capacity *int32 `json:"capacity,omitempty"`
+	// The number of seats furnished in the room. Null when unknown.
+	SeatCount *int32 `json:"seatCount,omitempty"`
+	// The audiovisual equipment available in the room. Empty when none is
+	// installed or when unknown.
+	AvEquipment []AVEquipment `json:"avEquipment"`
+	// Whether the room is accessible by wheelchair. Null when unknown.
+	WheelchairAccessible *bool `json:"wheelchairAccessible,omitempty"`
+	// Whether the room can be booked. Null when unknown.
+	Bookable *bool `json:"bookable,omitempty"`
 }
 
 func (Room) IsEntity() {}
+
+// A room together with its distance to a reference room.
+type RoomDistance struct {
+	// The room found near the reference room.
+	Room *Room `json:"room"`
+	// The distance between the centroids of both rooms, in meters.
+	Distance float64 `json:"distance"`
+}
+
+// Criteria rooms must match. Every criterion that is provided must be met;
+// rooms for which an attribute is unknown do not match criteria on that
+// attribute.
+type RoomFilter struct {
+	// Only rooms in one of these buildings.
+	BuildingIds []string `json:"buildingIds,omitempty"`
+	// Only rooms on one of these floors.
+	FloorIds []string `json:"floorIds,omitempty"`
+	// Only rooms on floors with this level (e.g., 2 for '2. Sal').
+	FloorLevel *int32 `json:"floorLevel,omitempty"`
+	// Only rooms of one of these types, compared case-insensitively
+	// (e.g., 'MØDE').
+	Types []string `json:"types,omitempty"`
+	// Only rooms with at least this capacity.
+	MinCapacity *int32 `json:"minCapacity,omitempty"`
+	// Only rooms with at least this number of seats.
+	MinSeatCount *int32 `json:"minSeatCount,omitempty"`
+	// Only rooms having all of this equipment.
+	AvEquipment []AVEquipment `json:"avEquipment,omitempty"`
+	// Only rooms that are, or are not, accessible by wheelchair.
+	WheelchairAccessible *bool `json:"wheelchairAccessible,omitempty"`
+	// Only rooms that are, or are not, bookable.
+	Bookable *bool `json:"bookable,omitempty"`
+}
+
+// The aggregated area of all rooms of a single type within a building.
+type RoomTypeArea struct {
+	// The type or category of the rooms (e.g., 'KONTOR', 'MØDE').
+	Type string `json:"type"`
+	// The number of rooms of this type.
+	RoomCount int32 `json:"roomCount"`
+	// The sum of the areas of all rooms of this type, in square meters.
+	TotalArea float64 `json:"totalArea"`
+}
+
+// An identifier an external system uses for a building, floor or room.
+type SpaceAlias struct {
+	// The system using the identifier.
+	System ExternalSystem `json:"system"`
+	// The identifier used by the system.
+	ExternalID string `json:"externalId"`
+}
+
+// The building, floor or room an external identifier refers to.
+type SpaceResolution struct {
+	// The system the identifier was resolved for.
+	System ExternalSystem `json:"system"`
+	// The identifier that was resolved.
+	ExternalID string `json:"externalId"`
+	// The canonical ID of the building, floor or room the identifier refers to.
+	SpaceID string `json:"spaceId"`
+	// The building the identifier refers to, or the building containing the
+	// floor or room it refers to.
+	Building *Building `json:"building"`
+	// The floor the identifier refers to, or the floor containing the room it
+	// refers to. Null when the identifier refers to a building.
+	Floor *Floor `json:"floor,omitempty"`
+	// The room the identifier refers to. Null when the identifier refers to a
+	// building or floor.
+	Room *Room `json:"room,omitempty"`
+}
+
+// The fields of a building that can be updated. Omitted fields are left unchanged.
+type UpdateBuildingInput struct {
+	Address  *string `json:"address,omitempty"`
+	City     *string `json:"city,omitempty"`
+	Property *string `json:"property,omitempty"`
+}
+
+// The fields of a floor that can be updated. The name of a floor is part of
+// its ID and cannot be changed.
+type UpdateFloorInput struct {
+	Level *int32 `json:"level,omitempty"`
+}
+
+// The fields of a room that can be updated. Omitted fields are left unchanged.
+// The room number is part of the room's ID and cannot be changed; delete the
+// room and create a new one instead.
+type UpdateRoomInput struct {
+	Type *string `json:"type,omitempty"`
+	// The area of the room, in square meters. Must be positive.
+	Area *float64 `json:"area,omitempty"`
+	// The circumference of the room, in meters. Must be positive.
+	Circumference *float64 `json:"circumference,omitempty"`
+}
+
+// Audiovisual equipment installed in a room.
+type AVEquipment string
+
+const (
+	// A screen or TV that laptops can be connected to.
+	AVEquipmentDisplay AVEquipment = "DISPLAY"
+	// A projector and projection screen.
+	AVEquipmentProjector AVEquipment = "PROJECTOR"
+	// A video conferencing system with camera.
+	AVEquipmentVideoConference AVEquipment = "VIDEO_CONFERENCE"
+	// Ceiling or wall mounted speakers.
+	AVEquipmentSpeakers AVEquipment = "SPEAKERS"
+	// Microphones connected to the room's sound system.
+	AVEquipmentMicrophone AVEquipment = "MICROPHONE"
+	// A whiteboard or interactive board.
+	AVEquipmentWhiteboard AVEquipment = "WHITEBOARD"
+)
+
+var AllAVEquipment = []AVEquipment{
+	AVEquipmentDisplay,
+	AVEquipmentProjector,
+	AVEquipmentVideoConference,
+	AVEquipmentSpeakers,
+	AVEquipmentMicrophone,
+	AVEquipmentWhiteboard,
+}
+
+func (e AVEquipment) IsValid() bool {
+	switch e {
+	case AVEquipmentDisplay, AVEquipmentProjector, AVEquipmentVideoConference, AVEquipmentSpeakers, AVEquipmentMicrophone, AVEquipmentWhiteboard:
+		return true
+	}
+	return false
+}
+
+func (e AVEquipment) String() string {
+	return string(e)
+}
+
+func (e *AVEquipment) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = AVEquipment(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid AVEquipment", str)
+	}
+	return nil
+}
+
+func (e AVEquipment) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+// An external system that refers to buildings, floors or rooms using its own
+// identifiers.
+type ExternalSystem string
+
+const (
+	// The Building Management System. Rooms are identified by the room token in
+	// the sensor source paths (e.g., 'A.001e').
+	ExternalSystemBms ExternalSystem = "BMS"
+	// Outlook room booking. Rooms are identified by their mailbox
+	// (e.g., 'tmv25-a.111@adm.aau.dk').
+	ExternalSystemOutlook ExternalSystem = "OUTLOOK"
+	// The entrance door counters. Counters are identified by their device ID.
+	ExternalSystemDoorcounters ExternalSystem = "DOORCOUNTERS"
+	// The coffee machine data. Locations are identified by the floor ID stored
+	// with the machines, which is the ID of the floor in this service, so they
+	// only need to be registered when they differ.
+	ExternalSystemCoffee ExternalSystem = "COFFEE"
+)
+
+var AllExternalSystem = []ExternalSystem{
+	ExternalSystemBms,
+	ExternalSystemOutlook,
+	ExternalSystemDoorcounters,
+	ExternalSystemCoffee,
+}
+
+func (e ExternalSystem) IsValid() bool {
+	switch e {
+	case ExternalSystemBms, ExternalSystemOutlook, ExternalSystemDoorcounters, ExternalSystemCoffee:
+		return true
+	}
+	return false
+}
+
+func (e ExternalSystem) String() string {
+	return string(e)
+}
+
+func (e *ExternalSystem) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ExternalSystem(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ExternalSystem", str)
+	}
+	return nil
+}
+
+func (e ExternalSystem) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+// The severity of a problem found while importing space data.
+type ImportIssueSeverity string
+
+const (
+	// The row, or the whole file, could not be imported.
+	ImportIssueSeverityError ImportIssueSeverity = "ERROR"
+	// The row was imported, but its data is suspicious or incomplete.
+	ImportIssueSeverityWarning ImportIssueSeverity = "WARNING"
+)
+
+var AllImportIssueSeverity = []ImportIssueSeverity{
+	ImportIssueSeverityError,
+	ImportIssueSeverityWarning,
+}
+
+func (e ImportIssueSeverity) IsValid() bool {
+	switch e {
+	case ImportIssueSeverityError, ImportIssueSeverityWarning:
+		return true
+	}
+	return false
+}
+
+func (e ImportIssueSeverity) String() string {
+	return string(e)
+}
+
+func (e *ImportIssueSeverity) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ImportIssueSeverity(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ImportIssueSeverity", str)
+	}
+	return nil
+}
+
+func (e ImportIssueSeverity) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+// How an entity differs between two versions of the space inventory.
+type InventoryDifferenceKind string
+
+const (
+	// The entity only exists in the later version.
+	InventoryDifferenceKindAdded InventoryDifferenceKind = "ADDED"
+	// The entity only exists in the earlier version.
+	InventoryDifferenceKindRemoved InventoryDifferenceKind = "REMOVED"
+	// The entity exists in both versions, with different properties.
+	InventoryDifferenceKindModified InventoryDifferenceKind = "MODIFIED"
+)
+
+var AllInventoryDifferenceKind = []InventoryDifferenceKind{
+	InventoryDifferenceKindAdded,
+	InventoryDifferenceKindRemoved,
+	InventoryDifferenceKindModified,
+}
+
+func (e InventoryDifferenceKind) IsValid() bool {
+	switch e {
+	case InventoryDifferenceKindAdded, InventoryDifferenceKindRemoved, InventoryDifferenceKindModified:
+		return true
+	}
+	return false
+}
+
+func (e InventoryDifferenceKind) String() string {
+	return string(e)
+}
+
+func (e *InventoryDifferenceKind) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = InventoryDifferenceKind(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid InventoryDifferenceKind", str)
+	}
+	return nil
+}
+
+func (e InventoryDifferenceKind) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+// The kind of entity in the space inventory affected by a change.
+type InventoryEntityType string
+
+const (
+	InventoryEntityTypeBuilding InventoryEntityType = "BUILDING"
+	InventoryEntityTypeFloor    InventoryEntityType = "FLOOR"
+	InventoryEntityTypeRoom     InventoryEntityType = "ROOM"
+	// The registration of an identifier an external system uses for a space.
+	// Its entity ID is the system and the identifier, as 'SYSTEM:identifier'.
+	InventoryEntityTypeAlias InventoryEntityType = "ALIAS"
+	// The floorplan of a floor. Its entity ID is the floor ID and its states
+	// name the stored floorplan file.
+	InventoryEntityTypeFloorplan InventoryEntityType = "FLOORPLAN"
+)
+
+var AllInventoryEntityType = []InventoryEntityType{
+	InventoryEntityTypeBuilding,
+	InventoryEntityTypeFloor,
+	InventoryEntityTypeRoom,
+	InventoryEntityTypeAlias,
+	InventoryEntityTypeFloorplan,
+}
+
+func (e InventoryEntityType) IsValid() bool {
+	switch e {
+	case InventoryEntityTypeBuilding, InventoryEntityTypeFloor, InventoryEntityTypeRoom, InventoryEntityTypeAlias, InventoryEntityTypeFloorplan:
+		return true
+	}
+	return false
+}
+
+func (e InventoryEntityType) String() string {
+	return string(e)
+}
+
+func (e *InventoryEntityType) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = InventoryEntityType(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid InventoryEntityType", str)
+	}
+	return nil
+}
+
+func (e InventoryEntityType) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+// The kind of modification made to the space inventory.
+type InventoryOperation string
+
+const (
+	InventoryOperationCreate InventoryOperation = "CREATE"
+	InventoryOperationUpdate InventoryOperation = "UPDATE"
+	InventoryOperationDelete InventoryOperation = "DELETE"
+)
+
+var AllInventoryOperation = []InventoryOperation{
+	InventoryOperationCreate,
+	InventoryOperationUpdate,
+	InventoryOperationDelete,
+}
+
+func (e InventoryOperation) IsValid() bool {
+	switch e {
+	case InventoryOperationCreate, InventoryOperationUpdate, InventoryOperationDelete:
+		return true
+	}
+	return false
+}
+
+func (e InventoryOperation) String() string {
+	return string(e)
+}
+
+func (e *InventoryOperation) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = InventoryOperation(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid InventoryOperation", str)
+	}
+	return nil
+}
+
+func (e InventoryOperation) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
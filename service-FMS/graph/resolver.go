@@ -1,11 +1,10 @@
 package graph
 
 import (
-	"encoding/csv"
 	"fmt"
-	"log"
-	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/LarsDepuydt/masterthesis-api-aggregation/service-FMS/graph/model"
 )
@@ -17,109 +16,115 @@ import (
 // It serves as dependency injection for your app, add any dependencies you require here.
 
 type Resolver struct {
-	BuildingsData map[string]*model.Building
+	Inventory     *Inventory
+	Floorplans    *FloorplanStore
+	GeometryIndex *GeometryIndex
+	ImportReports []*model.ImportReport
+	Aliases       *AliasRegistry
+	Attributes    *RoomAttributeIndex
 }
 
-func LoadBuildingData() map[string]*model.Building {
-	// Open the CSV file
-	f, err := os.Open("./TMV25.csv")
-	if err != nil {
-		log.Fatalf("Error opening CSV file: %v", err)
+// buildings returns the current space inventory.
+func (r *Resolver) buildings() map[string]*model.Building {
+	return r.Inventory.Buildings()
+}
+
+// buildingsAt returns the space inventory as it was at the given moment, or
+// the current inventory if asOf is nil.
+func (r *Resolver) buildingsAt(asOf *time.Time) map[string]*model.Building {
+	if asOf == nil {
+		return r.buildings()
 	}
-	defer f.Close()
+	return r.Inventory.At(*asOf)
+}
 
-	reader := csv.NewReader(f)
-	records, err := reader.ReadAll()
-	if err != nil {
-		log.Fatalf("Error reading CSV file: %v", err)
+// findFloor returns the floor with the given ID, or nil if it does not exist.
+func (r *Resolver) findFloor(id string) *model.Floor {
+	return findFloor(r.buildings(), id)
+}
+
+// findRoom returns the room with the given ID, or nil if it does not exist.
+func (r *Resolver) findRoom(id string) *model.Room {
+	return findRoom(r.buildings(), id)
+}
+
+// resolveSpace resolves an external identifier to the space it refers to, or
+// returns nil if it is unknown. BMS room tokens that are not registered are
+// matched against the room numbers, as long as the room number is unique, and
+// coffee locations that are not registered are taken as space IDs.
+func (r *Resolver) resolveSpace(system model.ExternalSystem, externalID string) *model.SpaceResolution {
+	buildings := r.buildings()
+
+	var building *model.Building
+	var floor *model.Floor
+	var room *model.Room
+	if alias, ok := r.Aliases.Lookup(system, externalID); ok {
+		building, floor, room = findSpace(buildings, alias.SpaceID)
+	} else if system == model.ExternalSystemBms {
+		if rooms := findRoomsByNumber(buildings, externalID); len(rooms) == 1 {
+			room = rooms[0]
+			floor = room.Floor
+			building = floor.Building
+		}
+	} else if system == model.ExternalSystemCoffee {
+		building, floor, room = findSpace(buildings, strings.TrimSpace(externalID))
 	}
-	if len(records) < 1 {
-		log.Println("CSV file is empty")
+	if building == nil {
 		return nil
 	}
 
-	// Get header indices
-	header := records[0]
-	idxGruppe := indexOf(header, "Gruppe")
-	idxBygning := indexOf(header, "Bygning")
-	idxEtage := indexOf(header, "Etage")
-	idxRumnummer := indexOf(header, "Rumnummer")
-	idxAreal := indexOf(header, "Areal")
-	idxOmkreds := indexOf(header, "Omkreds")
-	idxEjendom := indexOf(header, "Ejendom")
-	idxBynavn := indexOf(header, "Bynavn")
-
-	buildingsData := make(map[string]*model.Building)
-
-	// Process each CSV row (skip header)
-	for i, row := range records[1:] {
-		buildingAddress := row[idxBygning]
-		floorName := row[idxEtage]
-		roomNumber := row[idxRumnummer]
-
-		// Convert area and circumference values
-		area, err := strconv.ParseFloat(row[idxAreal], 64)
-		if err != nil {
-			log.Printf("Error parsing area on row %d: %v", i+2, err)
-			continue
-		}
-		circumference, err := strconv.ParseFloat(row[idxOmkreds], 64)
-		if err != nil {
-			log.Printf("Error parsing circumference on row %d: %v", i+2, err)
-			continue
-		}
-
-		// Create or retrieve the Building
-		b, ok := buildingsData[buildingAddress]
-		if !ok {
-			b = &model.Building{
-				ID:       "TMV25", // Change when FMS is more then TMV25!
-				Address:  buildingAddress,
-				City:     row[idxBynavn],
-				Property: row[idxEjendom],
-				Floors:   []*model.Floor{},
-			}
-			buildingsData[buildingAddress] = b
-		}
+	resolution := &model.SpaceResolution{
+		System:     system,
+		ExternalID: externalID,
+		SpaceID:    building.ID,
+		Building:   building,
+		Floor:      floor,
+		Room:       room,
+	}
+	if room != nil {
+		resolution.SpaceID = room.ID
+	} else if floor != nil {
+		resolution.SpaceID = floor.ID
+	}
+	return resolution
+}
 
-		// Create or retrieve the Floor within the Building
-		var floor *model.Floor
-		for _, f := range b.Floors {
-			if f.Name == floorName {
-				floor = f
-				break
-			}
-		}
-		if floor == nil {
-			floor = &model.Floor{
-				ID:           fmt.Sprintf("%s-%s", b.ID, floorName),
-				Name:         floorName,
-				FloorplanURL: "", // Placeholder URL; modify if needed
-				Rooms:        []*model.Room{},
-			}
-			b.Floors = append(b.Floors, floor)
-		}
+// spaceAliases returns the identifiers other systems use for a building,
+// floor or room.
+func (r *Resolver) spaceAliases(spaceID string) []*model.SpaceAlias {
+	aliases := []*model.SpaceAlias{}
+	for _, alias := range r.Aliases.ForSpace(spaceID) {
+		aliases = append(aliases, &model.SpaceAlias{System: alias.System, ExternalID: alias.ExternalID})
+	}
+	return aliases
+}
 
-		// Create the Room
-		room := &model.Room{
-			ID:            fmt.Sprintf("%s-%s", floor.ID, roomNumber),
-			RoomNumber:    roomNumber,
-			Type:          row[idxGruppe],
-			Area:          area,
-			Circumference: circumference,
-		}
-		floor.Rooms = append(floor.Rooms, room)
+// parseFloorLevel converts a Danish floor designation into a level number
+// relative to the ground floor: "Kælder" is -1, "Stue" is 0 and "N. Sal" is N.
+func parseFloorLevel(name string) (int32, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "kælder":
+		return -1, nil
+	case "stue":
+		return 0, nil
 	}
 
-	return buildingsData
+	number, suffix, found := strings.Cut(name, ".")
+	if !found || strings.ToLower(strings.TrimSpace(suffix)) != "sal" {
+		return 0, fmt.Errorf("unknown floor designation %q", name)
+	}
+	level, err := strconv.ParseInt(strings.TrimSpace(number), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("unknown floor designation %q: %w", name, err)
+	}
+	return int32(level), nil
 }
 
-// indexOf returns the index of target in slice or -1 if not found.
-func indexOf(slice []string, target string) int {
-	for i, v := range slice {
-		if v == target {
-			return i
-		}
+// floorArea returns the summed area of all rooms on the floor.
+func floorArea(floor *model.Floor) float64 {
+	var total float64
+	for _, room := range floor.Rooms {
+		total += room.Area
 	}
-	return -1
+	return total
 }
@@ -0,0 +1,83 @@
+package graph
+
+import (
+	"context"
+	"testing"
+
+	"github.com/LarsDepuydt/masterthesis-api-aggregation/service-FMS/graph/model"
+)
+
+func TestParseFloorLevel(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    int32
+		wantErr bool
+	}{
+		{name: "Kælder", want: -1},
+		{name: " stue ", want: 0},
+		{name: "1. Sal", want: 1},
+		{name: "12.sal", want: 12},
+		{name: "-2. Sal", want: -2},
+		{name: "Tag", wantErr: true},
+		{name: "1. Etage", wantErr: true},
+		{name: "Første. Sal", wantErr: true},
+		{name: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseFloorLevel(tt.name)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseFloorLevel(%q): got error %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseFloorLevel(%q): got %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAreaAggregates(t *testing.T) {
+	building := &model.Building{ID: "TMV25", Floors: []*model.Floor{}}
+	addImportedRoom(building, "Stue", 0, &model.Room{RoomNumber: "A.001", Type: "office", Area: 12.5})
+	addImportedRoom(building, "Stue", 0, &model.Room{RoomNumber: "A.002", Type: "kitchen", Area: 8})
+	addImportedRoom(building, "1. Sal", 1, &model.Room{RoomNumber: "B.101", Type: "office", Area: 10})
+	addImportedRoom(building, "1. Sal", 1, &model.Room{RoomNumber: "B.102", Type: "toilet", Area: 8})
+	building.Floors = append(building.Floors, &model.Floor{ID: "TMV25-Kælder", Name: "Kælder", Level: -1, Building: building, Rooms: []*model.Room{}})
+
+	r := &Resolver{}
+	ctx := context.Background()
+
+	totalArea, _ := r.Building().TotalArea(ctx, building)
+	roomCount, _ := r.Building().RoomCount(ctx, building)
+	if totalArea != 38.5 || roomCount != 4 {
+		t.Errorf("building: got area %v in %d rooms, want 38.5 in 4", totalArea, roomCount)
+	}
+
+	wantFloors := []struct {
+		area  float64
+		rooms int32
+	}{{20.5, 2}, {18, 2}, {0, 0}}
+	for i, floor := range building.Floors {
+		area, _ := r.Floor().TotalArea(ctx, floor)
+		rooms, _ := r.Floor().RoomCount(ctx, floor)
+		if area != wantFloors[i].area || rooms != wantFloors[i].rooms {
+			t.Errorf("floor %s: got area %v in %d rooms, want %v in %d", floor.Name, area, rooms, wantFloors[i].area, wantFloors[i].rooms)
+		}
+	}
+
+	// Largest area first, ties ordered by type
+	byType, _ := r.Building().AreaByRoomType(ctx, building)
+	want := []model.RoomTypeArea{
+		{Type: "office", TotalArea: 22.5, RoomCount: 2},
+		{Type: "kitchen", TotalArea: 8, RoomCount: 1},
+		{Type: "toilet", TotalArea: 8, RoomCount: 1},
+	}
+	if len(byType) != len(want) {
+		t.Fatalf("got %d room types, want %d", len(byType), len(want))
+	}
+	for i, entry := range byType {
+		if *entry != want[i] {
+			t.Errorf("room type %d: got %+v, want %+v", i, *entry, want[i])
+		}
+	}
+}
@@ -6,15 +6,245 @@ package graph
 
 import (
 	"context"
+	"fmt"
+	"log"
+	"math"
 	"slices"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/99designs/gqlgen/graphql"
 	"github.com/LarsDepuydt/masterthesis-api-aggregation/service-FMS/graph/model"
 )
 
+// TotalArea is the resolver for the totalArea field.
+func (r *buildingResolver) TotalArea(ctx context.Context, obj *model.Building) (float64, error) {
+	var total float64
+	for _, floor := range obj.Floors {
+		total += floorArea(floor)
+	}
+	return total, nil
+}
+
+// RoomCount is the resolver for the roomCount field.
+func (r *buildingResolver) RoomCount(ctx context.Context, obj *model.Building) (int32, error) {
+	var count int32
+	for _, floor := range obj.Floors {
+		count += int32(len(floor.Rooms))
+	}
+	return count, nil
+}
+
+// AreaByRoomType is the resolver for the areaByRoomType field.
+func (r *buildingResolver) AreaByRoomType(ctx context.Context, obj *model.Building) ([]*model.RoomTypeArea, error) {
+	byType := make(map[string]*model.RoomTypeArea)
+	for _, floor := range obj.Floors {
+		for _, room := range floor.Rooms {
+			entry, ok := byType[room.Type]
+			if !ok {
+				entry = &model.RoomTypeArea{Type: room.Type}
+				byType[room.Type] = entry
+			}
+			entry.RoomCount++
+			entry.TotalArea += room.Area
+		}
+	}
+
+	result := make([]*model.RoomTypeArea, 0, len(byType))
+	for _, entry := range byType {
+		result = append(result, entry)
+	}
+	// Largest area first, so the dominant room types are listed at the top
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].TotalArea != result[j].TotalArea {
+			return result[i].TotalArea > result[j].TotalArea
+		}
+		return result[i].Type < result[j].Type
+	})
+	return result, nil
+}
+
+// Aliases is the resolver for the aliases field.
+func (r *buildingResolver) Aliases(ctx context.Context, obj *model.Building) ([]*model.SpaceAlias, error) {
+	return r.spaceAliases(obj.ID), nil
+}
+
+// FloorplanURL is the resolver for the floorplanUrl field.
+func (r *floorResolver) FloorplanURL(ctx context.Context, obj *model.Floor) (string, error) {
+	return r.Floorplans.URL(obj.ID), nil
+}
+
+// TotalArea is the resolver for the totalArea field.
+func (r *floorResolver) TotalArea(ctx context.Context, obj *model.Floor) (float64, error) {
+	return floorArea(obj), nil
+}
+
+// RoomCount is the resolver for the roomCount field.
+func (r *floorResolver) RoomCount(ctx context.Context, obj *model.Floor) (int32, error) {
+	return int32(len(obj.Rooms)), nil
+}
+
+// Aliases is the resolver for the aliases field.
+func (r *floorResolver) Aliases(ctx context.Context, obj *model.Floor) ([]*model.SpaceAlias, error) {
+	return r.spaceAliases(obj.ID), nil
+}
+
+// UploadFloorplan is the resolver for the uploadFloorplan field.
+func (r *mutationResolver) UploadFloorplan(ctx context.Context, floorID string, file graphql.Upload) (*model.Floor, error) {
+	if _, err := actorFromContext(ctx); err != nil {
+		return nil, err
+	}
+	floor := r.findFloor(floorID)
+	if floor == nil {
+		return nil, fmt.Errorf("floor with ID %s not found", floorID)
+	}
+
+	before := r.Floorplans.record(floor.ID)
+	if err := r.Floorplans.Save(floor.ID, file.File); err != nil {
+		log.Printf("Error storing floorplan %q for floor %s: %v", file.Filename, floorID, err)
+		return nil, err
+	}
+
+	operation := model.InventoryOperationUpdate
+	if before == nil {
+		operation = model.InventoryOperationCreate
+	}
+	if err := r.Inventory.record(ctx, operation, model.InventoryEntityTypeFloorplan, floor.ID, before, r.Floorplans.record(floor.ID)); err != nil {
+		return nil, err
+	}
+
+	return floor, nil
+}
+
+// CreateBuilding is the resolver for the createBuilding field.
+func (r *mutationResolver) CreateBuilding(ctx context.Context, input model.CreateBuildingInput) (*model.Building, error) {
+	return r.Inventory.CreateBuilding(ctx, buildingRecord{
+		ID:       strings.TrimSpace(input.ID),
+		Address:  input.Address,
+		City:     input.City,
+		Property: input.Property,
+	})
+}
+
+// UpdateBuilding is the resolver for the updateBuilding field.
+func (r *mutationResolver) UpdateBuilding(ctx context.Context, id string, input model.UpdateBuildingInput) (*model.Building, error) {
+	return r.Inventory.UpdateBuilding(ctx, id, func(record *buildingRecord) {
+		if input.Address != nil {
+			record.Address = *input.Address
+		}
+		if input.City != nil {
+			record.City = *input.City
+		}
+		if input.Property != nil {
+			record.Property = *input.Property
+		}
+	})
+}
+
+// DeleteBuilding is the resolver for the deleteBuilding field.
+func (r *mutationResolver) DeleteBuilding(ctx context.Context, id string) (string, error) {
+	if err := r.Inventory.DeleteBuilding(ctx, id); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// CreateFloor is the resolver for the createFloor field.
+func (r *mutationResolver) CreateFloor(ctx context.Context, input model.CreateFloorInput) (*model.Floor, error) {
+	name := strings.TrimSpace(input.Name)
+	var level int32
+	if input.Level != nil {
+		level = *input.Level
+	} else {
+		parsed, err := parseFloorLevel(name)
+		if err != nil {
+			return nil, fmt.Errorf("cannot derive the level from the floor name, provide it explicitly: %w", err)
+		}
+		level = parsed
+	}
+
+	return r.Inventory.CreateFloor(ctx, floorRecord{
+		ID:         fmt.Sprintf("%s-%s", input.BuildingID, name),
+		BuildingID: input.BuildingID,
+		Name:       name,
+		Level:      level,
+	})
+}
+
+// UpdateFloor is the resolver for the updateFloor field.
+func (r *mutationResolver) UpdateFloor(ctx context.Context, id string, input model.UpdateFloorInput) (*model.Floor, error) {
+	return r.Inventory.UpdateFloor(ctx, id, func(record *floorRecord) {
+		if input.Level != nil {
+			record.Level = *input.Level
+		}
+	})
+}
+
+// DeleteFloor is the resolver for the deleteFloor field.
+func (r *mutationResolver) DeleteFloor(ctx context.Context, id string) (string, error) {
+	if err := r.Inventory.DeleteFloor(ctx, id); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// CreateRoom is the resolver for the createRoom field.
+func (r *mutationResolver) CreateRoom(ctx context.Context, input model.CreateRoomInput) (*model.Room, error) {
+	roomNumber := strings.TrimSpace(input.RoomNumber)
+	return r.Inventory.CreateRoom(ctx, roomRecord{
+		ID:            fmt.Sprintf("%s-%s", input.FloorID, roomNumber),
+		FloorID:       input.FloorID,
+		RoomNumber:    roomNumber,
+		Type:          input.Type,
+		Area:          input.Area,
+		Circumference: input.Circumference,
+	})
+}
+
+// UpdateRoom is the resolver for the updateRoom field.
+func (r *mutationResolver) UpdateRoom(ctx context.Context, id string, input model.UpdateRoomInput) (*model.Room, error) {
+	return r.Inventory.UpdateRoom(ctx, id, func(record *roomRecord) {
+		if input.Type != nil {
+			record.Type = *input.Type
+		}
+		if input.Area != nil {
+			record.Area = *input.Area
+		}
+		if input.Circumference != nil {
+			record.Circumference = *input.Circumference
+		}
+	})
+}
+
+// DeleteRoom is the resolver for the deleteRoom field.
+func (r *mutationResolver) DeleteRoom(ctx context.Context, id string) (string, error) {
+	if err := r.Inventory.DeleteRoom(ctx, id); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// RegisterSpaceAlias is the resolver for the registerSpaceAlias field.
+func (r *mutationResolver) RegisterSpaceAlias(ctx context.Context, system model.ExternalSystem, externalID string, spaceID string) (*model.SpaceResolution, error) {
+	if b, _, _ := findSpace(r.buildings(), spaceID); b == nil {
+		return nil, fmt.Errorf("space with ID %s not found", spaceID)
+	}
+	if err := r.Aliases.Register(ctx, spaceAlias{System: system, ExternalID: externalID, SpaceID: spaceID}); err != nil {
+		return nil, err
+	}
+	return r.resolveSpace(system, externalID), nil
+}
+
+// RemoveSpaceAlias is the resolver for the removeSpaceAlias field.
+func (r *mutationResolver) RemoveSpaceAlias(ctx context.Context, system model.ExternalSystem, externalID string) (bool, error) {
+	return r.Aliases.Remove(ctx, system, externalID)
+}
+
 // Buildings is the resolver for the buildings field.
-func (r *queryResolver) Buildings(ctx context.Context, ids []string) ([]*model.Building, error) {
+func (r *queryResolver) Buildings(ctx context.Context, ids []string, asOf *time.Time) ([]*model.Building, error) {
 	var result []*model.Building
-	for _, building := range r.BuildingsData {
+	for _, building := range r.buildingsAt(asOf) {
 		if len(ids) == 0 || slices.Contains(ids, building.ID) {
 			result = append(result, building)
 		}
@@ -23,9 +253,9 @@ func (r *queryResolver) Buildings(ctx context.Context, ids []string) ([]*model.B
 }
 
 // Floors is the resolver for the floors field.
-func (r *queryResolver) Floors(ctx context.Context, ids []string) ([]*model.Floor, error) {
+func (r *queryResolver) Floors(ctx context.Context, ids []string, asOf *time.Time) ([]*model.Floor, error) {
 	var result []*model.Floor
-	for _, building := range r.BuildingsData {
+	for _, building := range r.buildingsAt(asOf) {
 		for _, floor := range building.Floors {
 			if len(ids) == 0 || slices.Contains(ids, floor.ID) {
 				result = append(result, floor)
@@ -36,12 +266,12 @@ func (r *queryResolver) Floors(ctx context.Context, ids []string) ([]*model.Floo
 }
 
 // Rooms is the resolver for the rooms field.
-func (r *queryResolver) Rooms(ctx context.Context, ids []string) ([]*model.Room, error) {
+func (r *queryResolver) Rooms(ctx context.Context, ids []string, filter *model.RoomFilter, asOf *time.Time) ([]*model.Room, error) {
 	var result []*model.Room
-	for _, building := range r.BuildingsData {
+	for _, building := range r.buildingsAt(asOf) {
 		for _, floor := range building.Floors {
 			for _, room := range floor.Rooms {
-				if len(ids) == 0 || slices.Contains(ids, room.ID) {
+				if (len(ids) == 0 || slices.Contains(ids, room.ID)) && matchesRoomFilter(room, r.Attributes.Room(room), filter) {
 					result = append(result, room)
 				}
 			}
@@ -50,7 +280,174 @@ func (r *queryResolver) Rooms(ctx context.Context, ids []string) ([]*model.Room,
 	return result, nil
 }
 
+// RoomsNear is the resolver for the roomsNear field.
+func (r *queryResolver) RoomsNear(ctx context.Context, roomID string, maxDistance float64) ([]*model.RoomDistance, error) {
+	if maxDistance < 0 {
+		return nil, fmt.Errorf("maxDistance must not be negative")
+	}
+
+	room := r.findRoom(roomID)
+	if room == nil {
+		return nil, fmt.Errorf("room with ID %s not found", roomID)
+	}
+	geometry := r.GeometryIndex.Room(room.ID)
+	if geometry == nil {
+		return nil, fmt.Errorf("no geometry available for room %s", roomID)
+	}
+
+	result := []*model.RoomDistance{}
+	for _, other := range room.Floor.Rooms {
+		otherGeometry := r.GeometryIndex.Room(other.ID)
+		if other.ID == room.ID || otherGeometry == nil {
+			continue
+		}
+		distance := math.Hypot(otherGeometry.Centroid.X-geometry.Centroid.X, otherGeometry.Centroid.Y-geometry.Centroid.Y)
+		if distance <= maxDistance {
+			result = append(result, &model.RoomDistance{Room: other, Distance: distance})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Distance < result[j].Distance
+	})
+	return result, nil
+}
+
+// InventoryChanges is the resolver for the inventoryChanges field.
+func (r *queryResolver) InventoryChanges(ctx context.Context, entityID *string, since *time.Time) ([]*model.InventoryChange, error) {
+	result := []*model.InventoryChange{}
+	for _, change := range r.Inventory.Changes() {
+		if entityID != nil && change.EntityID != *entityID {
+			continue
+		}
+		if since != nil && change.Timestamp.Before(*since) {
+			continue
+		}
+		result = append(result, change.toModel())
+	}
+	return result, nil
+}
+
+// InventoryDiff is the resolver for the inventoryDiff field.
+func (r *queryResolver) InventoryDiff(ctx context.Context, from time.Time, to time.Time, buildingIds []string) ([]*model.InventoryDifference, error) {
+	if to.Before(from) {
+		return nil, fmt.Errorf("from must not be after to")
+	}
+	return diffInventories(r.Inventory.At(from), r.Inventory.At(to), buildingIds)
+}
+
+// ResolveSpace is the resolver for the resolveSpace field.
+func (r *queryResolver) ResolveSpace(ctx context.Context, system model.ExternalSystem, externalID string) (*model.SpaceResolution, error) {
+	return r.resolveSpace(system, externalID), nil
+}
+
+// ImportReport is the resolver for the importReport field.
+func (r *queryResolver) ImportReport(ctx context.Context) (*model.ImportReport, error) {
+	if len(r.Resolver.ImportReports) == 0 {
+		return nil, fmt.Errorf("no space data sources are configured")
+	}
+	return r.Resolver.ImportReports[0], nil
+}
+
+// ImportReports is the resolver for the importReports field.
+func (r *queryResolver) ImportReports(ctx context.Context) ([]*model.ImportReport, error) {
+	return r.Resolver.ImportReports, nil
+}
+
+// Geometry is the resolver for the geometry field.
+func (r *roomResolver) Geometry(ctx context.Context, obj *model.Room) ([]*model.Point, error) {
+	if geometry := r.GeometryIndex.Room(obj.ID); geometry != nil {
+		return geometry.Polygon, nil
+	}
+	return nil, nil
+}
+
+// Centroid is the resolver for the centroid field.
+func (r *roomResolver) Centroid(ctx context.Context, obj *model.Room) (*model.Point, error) {
+	if geometry := r.GeometryIndex.Room(obj.ID); geometry != nil {
+		return geometry.Centroid, nil
+	}
+	return nil, nil
+}
+
+// Neighbors is the resolver for the neighbors field.
+func (r *roomResolver) Neighbors(ctx context.Context, obj *model.Room) ([]*model.Room, error) {
+	neighbors := []*model.Room{}
+	if geometry := r.GeometryIndex.Room(obj.ID); geometry != nil {
+		// Neighbors are taken from the same version of the building as the
+		// room, so rooms queried with asOf get neighbors as of then
+		building := obj.Floor.Building
+		for _, id := range geometry.Neighbors {
+			if neighbor := findRoom(map[string]*model.Building{building.ID: building}, id); neighbor != nil {
+				neighbors = append(neighbors, neighbor)
+			}
+		}
+	}
+	return neighbors, nil
+}
+
+// Aliases is the resolver for the aliases field.
+func (r *roomResolver) Aliases(ctx context.Context, obj *model.Room) ([]*model.SpaceAlias, error) {
+	aliases := r.spaceAliases(obj.ID)
+
+	// The BMS refers to rooms by their room number unless registered otherwise
+	hasBMSAlias := false
+	for _, alias := range aliases {
+		hasBMSAlias = hasBMSAlias || alias.System == model.ExternalSystemBms
+	}
+	if !hasBMSAlias {
+		if resolution := r.resolveSpace(model.ExternalSystemBms, obj.RoomNumber); resolution != nil && resolution.SpaceID == obj.ID {
+			aliases = append([]*model.SpaceAlias{{System: model.ExternalSystemBms, ExternalID: obj.RoomNumber}}, aliases...)
+		}
+	}
+	return aliases, nil
+}
+
+// Capacity is the resolver for the capacity field.
+func (r *roomResolver) Capacity(ctx context.Context, obj *model.Room) (*int32, error) {
+	return r.Attributes.Room(obj).Capacity, nil
+}
+
+// SeatCount is the resolver for the seatCount field.
+func (r *roomResolver) SeatCount(ctx context.Context, obj *model.Room) (*int32, error) {
+	return r.Attributes.Room(obj).SeatCount, nil
+}
+
+// AvEquipment is the resolver for the avEquipment field.
+func (r *roomResolver) AvEquipment(ctx context.Context, obj *model.Room) ([]model.AVEquipment, error) {
+	equipment := r.Attributes.Room(obj).AVEquipment
+	if equipment == nil {
+		return []model.AVEquipment{}, nil
+	}
+	return equipment, nil
+}
+
+// WheelchairAccessible is the resolver for the wheelchairAccessible field.
+func (r *roomResolver) WheelchairAccessible(ctx context.Context, obj *model.Room) (*bool, error) {
+	return r.Attributes.Room(obj).WheelchairAccessible, nil
+}
+
+// Bookable is the resolver for the bookable field.
+func (r *roomResolver) Bookable(ctx context.Context, obj *model.Room) (*bool, error) {
+	return r.Attributes.Room(obj).Bookable, nil
+}
+
+// Building returns BuildingResolver implementation.
+func (r *Resolver) Building() BuildingResolver { return &buildingResolver{r} }
+
+// Floor returns FloorResolver implementation.
+func (r *Resolver) Floor() FloorResolver { return &floorResolver{r} }
+
+// Mutation returns MutationResolver implementation.
+func (r *Resolver) Mutation() MutationResolver { return &mutationResolver{r} }
+
 // Query returns QueryResolver implementation.
 func (r *Resolver) Query() QueryResolver { return &queryResolver{r} }
 
+// Room returns RoomResolver implementation.
+func (r *Resolver) Room() RoomResolver { return &roomResolver{r} }
+
+type buildingResolver struct{ *Resolver }
+type floorResolver struct{ *Resolver }
+type mutationResolver struct{ *Resolver }
 type queryResolver struct{ *Resolver }
+type roomResolver struct{ *Resolver }
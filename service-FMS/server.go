@@ -1,6 +1,8 @@
 package main
 
 import (
+	"encoding/json"
+	"flag"
 	"log"
 	"net/http"
 	"os"
@@ -15,19 +17,140 @@ import (
 )
 
 func main() {
+	sourcesPath := flag.String("sources", os.Getenv("FMS_SOURCES"), "path of a JSON file listing the space data source of every building")
+	csvPath := flag.String("csv", "./TMV25.csv", "path of the FMS CSV export of TMV25, used when no sources file is given")
+	validateOnly := flag.Bool("validate", false, "validate the space data sources, print the import reports as JSON and exit")
+	strict := flag.Bool("strict", os.Getenv("FMS_STRICT_IMPORT") == "true", "refuse to start when the space data sources contain errors")
+	flag.Parse()
+
+	sources := []graph.SpaceSource{{BuildingID: "TMV25", Format: "csv", Path: *csvPath}}
+	if *sourcesPath != "" {
+		var err error
+		if sources, err = graph.LoadSpaceSources(*sourcesPath); err != nil {
+			log.Fatalf("Error loading space sources: %v", err)
+		}
+	}
+
+	// Load data once at startup
+	buildingsData, buildingVersions, importReports, loadErr := graph.LoadBuildingData(sources)
+
+	// Changes made through mutations are replayed on top of the imported data
+	changeLogPath := os.Getenv("INVENTORY_CHANGELOG")
+	if changeLogPath == "" {
+		changeLogPath = "./data/inventory-changes.jsonl"
+	}
+	inventory, err := graph.NewInventory(buildingsData, buildingVersions, changeLogPath)
+	if err != nil {
+		log.Fatalf("Error loading inventory changes: %v", err)
+	}
+
+	// Capacity, furniture and other attributes missing from the FMS export.
+	// They are matched against the inventory after the change log is replayed,
+	// so rooms added through mutations get their attributes as well
+	attributesDir := os.Getenv("ROOM_ATTRIBUTES_DIR")
+	if attributesDir == "" {
+		attributesDir = "./attributes"
+	}
+	attributes, attributeReports, err := graph.LoadRoomAttributes(attributesDir, inventory.Buildings())
+	if err != nil {
+		log.Fatalf("Error loading room attributes: %v", err)
+	}
+	importReports = append(importReports, attributeReports...)
+
+	var errorCount int32
+	for _, report := range importReports {
+		errorCount += report.ErrorCount
+	}
+
+	if *validateOnly {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(importReports); err != nil {
+			log.Fatalf("Error writing import reports: %v", err)
+		}
+		if errorCount > 0 || loadErr != nil {
+			os.Exit(1)
+		}
+		return
+	}
+	// Without its sources the service would answer every query with nothing,
+	// so a source that cannot be read stops startup even without -strict
+	if loadErr != nil {
+		log.Fatalf("Error loading space data: %v", loadErr)
+	}
+	if *strict && errorCount > 0 {
+		log.Fatalf("Refusing to start in strict mode: the space data sources contain %d errors", errorCount)
+	}
+
 	port := os.Getenv("APP_LISTEN_PORT")
 	if port == "" {
 		log.Fatal("Could not find env variable that defined PORT")
 	}
 
-	// Load data once at startup
-	buildingsData := graph.LoadBuildingData()
+	// Floorplans are stored on disk and served by this service
+	floorplanDir := os.Getenv("FLOORPLAN_DIR")
+	if floorplanDir == "" {
+		floorplanDir = "./floorplans"
+	}
+	floorplanBaseURL := os.Getenv("FLOORPLAN_BASE_URL")
+	if floorplanBaseURL == "" {
+		floorplanBaseURL = "http://localhost:" + port
+	}
+	floorplans, err := graph.NewFloorplanStore(floorplanDir, floorplanBaseURL)
+	if err != nil {
+		log.Fatalf("Error initialising floorplan store: %v", err)
+	}
+
+	geometryDir := os.Getenv("GEOMETRY_DIR")
+	if geometryDir == "" {
+		geometryDir = "./geometry"
+	}
+	geometry, err := graph.LoadGeometryData(geometryDir, inventory.Buildings())
+	if err != nil {
+		log.Fatalf("Error loading room geometry: %v", err)
+	}
 
-	srv := handler.New(graph.NewExecutableSchema(graph.Config{Resolvers: &graph.Resolver{BuildingsData: buildingsData}}))
+	// Aliases registered at runtime are stored next to the inventory changes,
+	// the aliases shipped with the service are used until then
+	aliasesPath := os.Getenv("SPACE_ALIASES")
+	if aliasesPath == "" {
+		aliasesPath = "./data/aliases.json"
+	}
+	aliasesSeedPath := os.Getenv("SPACE_ALIASES_SEED")
+	if aliasesSeedPath == "" {
+		aliasesSeedPath = "./aliases.json"
+	}
+	aliases, err := graph.NewAliasRegistry(aliasesPath, aliasesSeedPath, inventory)
+	if err != nil {
+		log.Fatalf("Error loading space aliases: %v", err)
+	}
+
+	// Users modifying the inventory authenticate with an API token
+	actorTokensPath := os.Getenv("ACTOR_TOKENS")
+	if actorTokensPath == "" {
+		actorTokensPath = "./data/actor-tokens.json"
+	}
+	actorTokens, err := graph.LoadActorTokens(actorTokensPath)
+	if err != nil {
+		log.Fatalf("Error loading API tokens: %v", err)
+	}
+
+	srv := handler.New(graph.NewExecutableSchema(graph.Config{Resolvers: &graph.Resolver{
+		Inventory:     inventory,
+		Floorplans:    floorplans,
+		GeometryIndex: geometry,
+		ImportReports: importReports,
+		Aliases:       aliases,
+		Attributes:    attributes,
+	}}))
 
 	srv.AddTransport(transport.Options{})
 	srv.AddTransport(transport.GET{})
 	srv.AddTransport(transport.POST{})
+	srv.AddTransport(transport.MultipartForm{
+		MaxUploadSize: 64 << 20,
+		MaxMemory:     32 << 20,
+	})
 
 	srv.SetQueryCache(lru.New[*ast.QueryDocument](1000))
 
@@ -37,7 +160,8 @@ func main() {
 	})
 
 	http.Handle("/", playground.Handler("GraphQL playground", "/query"))
-	http.Handle("/query", srv)
+	http.Handle("/query", graph.WithActor(actorTokens, srv))
+	http.Handle(graph.FloorplanPathPrefix, floorplans)
 
 	log.Printf("connect to http://localhost:%s/ for GraphQL playground", port)
 	log.Fatal(http.ListenAndServe(":"+port, nil))
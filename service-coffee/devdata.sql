@@ -0,0 +1,25 @@
+-- Sample data loaded into the embedded development database when it is
+-- empty. It is not used with any other database.
+
+INSERT INTO machines (machine_id, machine_name, floor_id) VALUES
+    ('dev-machine-1', 'Development machine, ground floor', 'TMV25-Stue'),
+    ('dev-machine-2', 'Development machine, 1st floor', 'TMV25-1. Sal');
+
+INSERT INTO beverage_counts (machine_id, total_beverages, timestamp) VALUES
+    ('dev-machine-1', 1200, '2025-03-03T08:00:00+01:00'),
+    ('dev-machine-1', 1450, '2025-03-07T16:00:00+01:00'),
+    ('dev-machine-1', 1710, '2025-03-14T15:30:00+01:00'),
+    ('dev-machine-2', 800, '2025-03-03T08:15:00+01:00'),
+    ('dev-machine-2', 955, '2025-03-10T09:00:00+01:00'),
+    ('dev-machine-2', 40, '2025-03-17T12:00:00+01:00');
+
+INSERT INTO beverage_details (machine_id, beverage_name, count, timestamp) VALUES
+    ('dev-machine-1', 'Coffee', 900, '2025-03-03T08:00:00+01:00'),
+    ('dev-machine-1', 'Tea', 300, '2025-03-03T08:00:00+01:00'),
+    ('dev-machine-1', 'Coffee', 1080, '2025-03-07T16:00:00+01:00'),
+    ('dev-machine-1', 'Tea', 370, '2025-03-07T16:00:00+01:00'),
+    ('dev-machine-1', 'Coffee', 1270, '2025-03-14T15:30:00+01:00'),
+    ('dev-machine-1', 'Tea', 440, '2025-03-14T15:30:00+01:00'),
+    ('dev-machine-2', 'Espresso', 800, '2025-03-03T08:15:00+01:00'),
+    ('dev-machine-2', 'Espresso', 955, '2025-03-10T09:00:00+01:00'),
+    ('dev-machine-2', 'Espresso', 40, '2025-03-17T12:00:00+01:00');
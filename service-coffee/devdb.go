@@ -0,0 +1,76 @@
+package main
+
+import (
+	"database/sql"
+	_ "embed"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	embeddedpostgres "github.com/fergusstrange/embedded-postgres"
+)
+
+// devData is loaded into the development database when it is empty.
+//
+//go:embed devdata.sql
+var devData string
+
+// startDevDatabase starts an embedded Postgres server for local development,
+// storing its data in dataDir, and points the COFFEE_DB_* variables at it.
+// The Postgres binaries are downloaded on first use. Postgres refuses to run
+// as root, so the service has to run as a regular user in this mode.
+func startDevDatabase(dataDir string) (stop func(), err error) {
+	const (
+		port     = 54329
+		user     = "coffee"
+		password = "coffee"
+		database = "coffee"
+	)
+
+	dataDir, err = filepath.Abs(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	db := embeddedpostgres.NewDatabase(embeddedpostgres.DefaultConfig().
+		Port(port).
+		Username(user).
+		Password(password).
+		Database(database).
+		DataPath(filepath.Join(dataDir, "data")).
+		RuntimePath(filepath.Join(dataDir, "runtime")).
+		BinariesPath(filepath.Join(dataDir, "binaries")))
+	if err := db.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start embedded database: %w", err)
+	}
+
+	os.Setenv("COFFEE_DB_HOST", "localhost")
+	os.Setenv("COFFEE_DB_PORT", strconv.Itoa(port))
+	os.Setenv("COFFEE_DB_NAME", database)
+	os.Setenv("COFFEE_DB_USER", user)
+	os.Setenv("COFFEE_DB_PASSWORD", password)
+	log.Printf("Started embedded development database on port %d with data in %s", port, dataDir)
+
+	return func() {
+		if err := db.Stop(); err != nil {
+			log.Printf("Error stopping embedded database: %v", err)
+		}
+	}, nil
+}
+
+// loadDevData fills an empty development database with sample data.
+func loadDevData(db *sql.DB) error {
+	var machines int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM machines`).Scan(&machines); err != nil {
+		return err
+	}
+	if machines > 0 {
+		return nil
+	}
+	if _, err := db.Exec(devData); err != nil {
+		return err
+	}
+	log.Printf("Loaded sample data into the development database")
+	return nil
+}
@@ -0,0 +1,400 @@
+package graph
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LarsDepuydt/masterthesis-api-aggregation/service-coffee/graph/model"
+	"github.com/lib/pq"
+)
+
+// maxProfileWindow limits the window of a consumption profile, as the
+// consumption is spread over every hour within it.
+const maxProfileWindow = 3 * 366 * 24 * time.Hour
+
+// consumedBeveragesSQL returns the common table expressions selecting the
+// beverages consumed within every window, as rows of (period, machine_id,
+// floor_id, beverage_name, from_ts, to_ts, amount, count) in "consumed". The
+// increase of a counter between two readings is spread evenly over the time
+// between them, and count is the share of it within the window; a decreasing
+// count is taken as a counter reset, as in distributeConsumption. Only the
+// readings within a window and the last reading before and first reading after
+// it are read, so the history outside the windows is not scanned.
+//
+// The machine and floor IDs to include are $1 and $2, where an empty array
+// includes all. Window n spans from $(2n+1) up to $(2n+2).
+func consumedBeveragesSQL(windows int) string {
+	values := make([]string, windows)
+	for i := range values {
+		values[i] = fmt.Sprintf("(%d, $%d::timestamptz, $%d::timestamptz)", i+1, 2*i+3, 2*i+4)
+	}
+	return `
+		WITH windows (period, start_ts, end_ts) AS (
+			VALUES ` + strings.Join(values, ", ") + `
+		),
+		increments AS (
+			SELECT d.machine_id, m.floor_id, d.beverage_name,
+			       LAG(d.timestamp) OVER w AS from_ts,
+			       d.timestamp AS to_ts,
+			       CASE WHEN d.count < LAG(d.count) OVER w THEN d.count
+			            ELSE d.count - LAG(d.count) OVER w
+			       END AS amount
+			FROM beverage_details d
+			JOIN machines m ON m.machine_id = d.machine_id
+			WHERE (cardinality($1::text[]) = 0 OR d.machine_id = ANY($1::text[]))
+			  AND (cardinality($2::text[]) = 0 OR m.floor_id = ANY($2::text[]))
+			  AND EXISTS (
+				SELECT 1 FROM windows v
+				WHERE d.timestamp >= COALESCE((SELECT MAX(timestamp) FROM beverage_details WHERE machine_id = d.machine_id AND beverage_name = d.beverage_name AND timestamp <= v.start_ts), v.start_ts)
+				  AND d.timestamp <= COALESCE((SELECT MIN(timestamp) FROM beverage_details WHERE machine_id = d.machine_id AND beverage_name = d.beverage_name AND timestamp >= v.end_ts), v.end_ts)
+			  )
+			WINDOW w AS (PARTITION BY d.machine_id, d.beverage_name ORDER BY d.timestamp)
+		),
+		consumed AS (
+			SELECT w.period, w.start_ts, w.end_ts, i.machine_id, i.floor_id, i.beverage_name, i.from_ts, i.to_ts, i.amount,
+			       i.amount * EXTRACT(EPOCH FROM LEAST(i.to_ts, w.end_ts) - GREATEST(i.from_ts, w.start_ts))::float8
+			                / EXTRACT(EPOCH FROM i.to_ts - i.from_ts)::float8 AS count
+			FROM increments i
+			JOIN windows w ON i.from_ts < w.end_ts AND i.to_ts > w.start_ts
+			WHERE i.to_ts > i.from_ts
+		)`
+}
+
+// analyticsArgs returns the query arguments of consumedBeveragesSQL.
+func analyticsArgs(filter *model.BeverageAnalyticsFilter, windows ...model.TimeWindow) ([]interface{}, error) {
+	machineIDs, floorIDs := []string{}, []string{}
+	if filter != nil {
+		machineIDs = append(machineIDs, filter.MachineIds...)
+		floorIDs = append(floorIDs, filter.FloorIds...)
+	}
+	args := []interface{}{pq.Array(machineIDs), pq.Array(floorIDs)}
+	for _, window := range windows {
+		if !window.StartTime.Before(window.EndTime) {
+			return nil, fmt.Errorf("startTime must be before endTime")
+		}
+		args = append(args, window.StartTime, window.EndTime)
+	}
+	return args, nil
+}
+
+// beverageRanking ranks the beverage types by the number consumed within the
+// window.
+func (r *Resolver) beverageRanking(ctx context.Context, window model.TimeWindow, filter *model.BeverageAnalyticsFilter, limit *int32) ([]*model.BeverageRank, error) {
+	args, err := analyticsArgs(filter, window)
+	if err != nil {
+		return nil, err
+	}
+	query := consumedBeveragesSQL(1) + `
+		SELECT beverage_name, count,
+		       RANK() OVER (ORDER BY count DESC),
+		       COALESCE(count / NULLIF(SUM(count) OVER (), 0), 0)
+		FROM (SELECT beverage_name, SUM(count) AS count FROM consumed GROUP BY beverage_name) totals
+		ORDER BY count DESC, beverage_name`
+	if limit != nil {
+		if *limit < 0 {
+			return nil, fmt.Errorf("limit must not be negative")
+		}
+		query += ` LIMIT ` + strconv.Itoa(int(*limit))
+	}
+
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("database error ranking beverages: %w", err)
+	}
+	defer rows.Close()
+
+	ranking := []*model.BeverageRank{}
+	for rows.Next() {
+		var rank model.BeverageRank
+		if err := rows.Scan(&rank.BeverageName, &rank.Count, &rank.Rank, &rank.Share); err != nil {
+			return nil, fmt.Errorf("database error scanning beverage ranking: %w", err)
+		}
+		ranking = append(ranking, &rank)
+	}
+	return ranking, rows.Err()
+}
+
+// beverageTotal is the consumption of a machine or floor within a window.
+type beverageTotal struct {
+	id        string
+	total     float64
+	share     float64
+	beverages []*model.BeverageConsumption
+}
+
+// beverageTotals sums the beverages consumed within the window per value of
+// column, which is either machine_id or floor_id, busiest first.
+func (r *Resolver) beverageTotals(ctx context.Context, column string, window model.TimeWindow, filter *model.BeverageAnalyticsFilter) ([]*beverageTotal, error) {
+	args, err := analyticsArgs(filter, window)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.DB.QueryContext(ctx, consumedBeveragesSQL(1)+`
+		SELECT `+column+`, beverage_name, SUM(count) AS count,
+		       SUM(SUM(count)) OVER (PARTITION BY `+column+`) AS group_total,
+		       COALESCE(SUM(SUM(count)) OVER (PARTITION BY `+column+`) / NULLIF(SUM(SUM(count)) OVER (), 0), 0)
+		FROM consumed
+		GROUP BY `+column+`, beverage_name
+		ORDER BY group_total DESC, `+column+`, count DESC, beverage_name`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("database error summing beverages: %w", err)
+	}
+	defer rows.Close()
+
+	var totals []*beverageTotal
+	for rows.Next() {
+		var id string
+		var beverage model.BeverageConsumption
+		var total, share float64
+		if err := rows.Scan(&id, &beverage.BeverageName, &beverage.Count, &total, &share); err != nil {
+			return nil, fmt.Errorf("database error scanning beverage totals: %w", err)
+		}
+		// Rows are ordered by group, so a new ID starts a new group
+		if len(totals) == 0 || totals[len(totals)-1].id != id {
+			totals = append(totals, &beverageTotal{id: id, total: total, share: share})
+		}
+		current := totals[len(totals)-1]
+		current.beverages = append(current.beverages, &beverage)
+	}
+	return totals, rows.Err()
+}
+
+// machineBeverageTotals sums the beverages consumed within the window per
+// machine.
+func (r *Resolver) machineBeverageTotals(ctx context.Context, window model.TimeWindow, filter *model.BeverageAnalyticsFilter) ([]*model.MachineBeverageTotal, error) {
+	totals, err := r.beverageTotals(ctx, "machine_id", window, filter)
+	if err != nil {
+		return nil, err
+	}
+	machineIDs := make([]string, len(totals))
+	for i, total := range totals {
+		machineIDs[i] = total.id
+	}
+	machines, err := r.machinesByID(ctx, machineIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*model.MachineBeverageTotal, len(totals))
+	for i, total := range totals {
+		result[i] = &model.MachineBeverageTotal{
+			Machine:   machines[total.id],
+			Total:     total.total,
+			Share:     total.share,
+			Beverages: total.beverages,
+		}
+	}
+	return result, nil
+}
+
+// floorBeverageTotals sums the beverages consumed within the window per floor.
+func (r *Resolver) floorBeverageTotals(ctx context.Context, window model.TimeWindow, filter *model.BeverageAnalyticsFilter) ([]*model.FloorBeverageTotal, error) {
+	totals, err := r.beverageTotals(ctx, "floor_id", window, filter)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*model.FloorBeverageTotal, len(totals))
+	for i, total := range totals {
+		result[i] = &model.FloorBeverageTotal{
+			Floor:     &model.Floor{ID: total.id},
+			Total:     total.total,
+			Share:     total.share,
+			Beverages: total.beverages,
+		}
+	}
+	return result, nil
+}
+
+// machinesByID fetches machines with a single query, by ID.
+func (r *Resolver) machinesByID(ctx context.Context, machineIDs []string) (map[string]*model.BeverageMachine, error) {
+	machines, err := r.loadersFor(ctx).machinesWhere(ctx, "machine_id", machineIDs)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*model.BeverageMachine, len(machines))
+	for _, machine := range machines {
+		byID[machine.ID] = machine
+	}
+	return byID, nil
+}
+
+// beverageProfile computes the consumption per weekday or hour of the week in
+// loc. The consumption between two readings is spread over the hours between
+// them, which are then grouped into buckets by their local time. Hours are
+// generated in UTC, as local hours are skipped or repeated at daylight saving
+// time changes. Every bucket occurring within the window is returned, also if
+// nothing was consumed during it.
+func (r *Resolver) beverageProfile(ctx context.Context, window model.TimeWindow, granularity model.BeverageProfileGranularity, loc *time.Location, filter *model.BeverageAnalyticsFilter, perMachine bool) ([]*model.BeverageProfileBucket, error) {
+	args, err := analyticsArgs(filter, window)
+	if err != nil {
+		return nil, err
+	}
+	if window.EndTime.Sub(window.StartTime) > maxProfileWindow {
+		return nil, fmt.Errorf("the window of a profile may span at most %d days", int(maxProfileWindow.Hours()/24))
+	}
+
+	var hour, occurrence string
+	switch granularity {
+	case model.BeverageProfileGranularityWeekday:
+		hour, occurrence = `NULL::int`, `date_trunc('day', local_hour)`
+	case model.BeverageProfileGranularityHourOfWeek:
+		hour, occurrence = `EXTRACT(HOUR FROM local_hour)::int`, `utc_hour`
+	default:
+		return nil, fmt.Errorf("unsupported granularity %q", granularity)
+	}
+	groups := `SELECT NULL::text AS machine_id`
+	machine := `NULL::text`
+	if perMachine {
+		groups = `SELECT DISTINCT machine_id FROM slices`
+		machine = `machine_id`
+	}
+
+	args = append(args, loc.String())
+	rows, err := r.DB.QueryContext(ctx, consumedBeveragesSQL(1)+`,
+		slices AS (
+			SELECT c.machine_id, h.utc_hour AT TIME ZONE $5 AS local_hour,
+			       c.amount * EXTRACT(EPOCH FROM
+			           LEAST(c.to_ts, c.end_ts, h.utc_hour + interval '1 hour')
+			         - GREATEST(c.from_ts, c.start_ts, h.utc_hour))::float8
+			         / EXTRACT(EPOCH FROM c.to_ts - c.from_ts)::float8 AS count
+			FROM consumed c
+			CROSS JOIN LATERAL generate_series(
+				date_trunc('hour', GREATEST(c.from_ts, c.start_ts) AT TIME ZONE 'UTC') AT TIME ZONE 'UTC',
+				LEAST(c.to_ts, c.end_ts) - interval '1 microsecond',
+				interval '1 hour'
+			) AS h (utc_hour)
+		),
+		buckets AS (
+			SELECT EXTRACT(ISODOW FROM local_hour)::int AS weekday, `+hour+` AS hour,
+			       COUNT(DISTINCT `+occurrence+`) AS occurrences
+			FROM (
+				SELECT h.utc_hour, h.utc_hour AT TIME ZONE $5 AS local_hour
+				FROM generate_series(
+					date_trunc('hour', $3::timestamptz AT TIME ZONE 'UTC') AT TIME ZONE 'UTC',
+					$4::timestamptz - interval '1 microsecond',
+					interval '1 hour'
+				) AS h (utc_hour)
+			) hours
+			GROUP BY 1, 2
+		),
+		groups AS (`+groups+`),
+		totals AS (
+			SELECT `+machine+` AS machine_id, EXTRACT(ISODOW FROM local_hour)::int AS weekday, `+hour+` AS hour,
+			       SUM(count) AS total
+			FROM slices
+			GROUP BY 1, 2, 3
+		)
+		SELECT g.machine_id, b.weekday, b.hour, b.occurrences,
+		       COALESCE(t.total, 0),
+		       COALESCE(t.total, 0) / b.occurrences,
+		       COALESCE(t.total / NULLIF(SUM(t.total) OVER (PARTITION BY g.machine_id), 0), 0)
+		FROM groups g
+		CROSS JOIN buckets b
+		LEFT JOIN totals t
+		       ON t.machine_id IS NOT DISTINCT FROM g.machine_id
+		      AND t.weekday = b.weekday
+		      AND t.hour IS NOT DISTINCT FROM b.hour
+		ORDER BY g.machine_id, b.weekday, b.hour`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("database error computing profile: %w", err)
+	}
+	defer rows.Close()
+
+	profile := []*model.BeverageProfileBucket{}
+	var machineIDs []string
+	bucketMachines := []string{} // the machine of every bucket of profile
+	for rows.Next() {
+		var bucket model.BeverageProfileBucket
+		var machineID sql.NullString
+		if err := rows.Scan(&machineID, &bucket.Weekday, &bucket.Hour, &bucket.Occurrences, &bucket.Total, &bucket.Average, &bucket.Share); err != nil {
+			return nil, fmt.Errorf("database error scanning profile: %w", err)
+		}
+		if machineID.Valid && (len(machineIDs) == 0 || machineIDs[len(machineIDs)-1] != machineID.String) {
+			machineIDs = append(machineIDs, machineID.String)
+		}
+		bucketMachines = append(bucketMachines, machineID.String)
+		profile = append(profile, &bucket)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("database error scanning profile: %w", err)
+	}
+
+	if len(machineIDs) > 0 {
+		machines, err := r.machinesByID(ctx, machineIDs)
+		if err != nil {
+			return nil, err
+		}
+		for i, bucket := range profile {
+			bucket.Machine = machines[bucketMachines[i]]
+		}
+	}
+	return profile, nil
+}
+
+// beverageComparison compares the beverages consumed within two windows. The
+// relative changes are computed per day, so windows of different lengths can
+// be compared.
+func (r *Resolver) beverageComparison(ctx context.Context, first, second model.TimeWindow, filter *model.BeverageAnalyticsFilter) (*model.BeverageComparison, error) {
+	args, err := analyticsArgs(filter, first, second)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.DB.QueryContext(ctx, consumedBeveragesSQL(2)+`
+		SELECT beverage_name, first_count, second_count,
+		       COALESCE(first_count / NULLIF(SUM(first_count) OVER (), 0), 0),
+		       COALESCE(second_count / NULLIF(SUM(second_count) OVER (), 0), 0)
+		FROM (
+			SELECT beverage_name,
+			       COALESCE(SUM(count) FILTER (WHERE period = 1), 0) AS first_count,
+			       COALESCE(SUM(count) FILTER (WHERE period = 2), 0) AS second_count
+			FROM consumed
+			GROUP BY beverage_name
+		) totals
+		ORDER BY second_count DESC, first_count DESC, beverage_name`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("database error comparing windows: %w", err)
+	}
+	defer rows.Close()
+
+	firstDays := first.EndTime.Sub(first.StartTime).Hours() / 24
+	secondDays := second.EndTime.Sub(second.StartTime).Hours() / 24
+	comparison := &model.BeverageComparison{
+		First:     &model.ComparedPeriod{StartTime: first.StartTime, EndTime: first.EndTime},
+		Second:    &model.ComparedPeriod{StartTime: second.StartTime, EndTime: second.EndTime},
+		Beverages: []*model.BeverageChange{},
+	}
+	for rows.Next() {
+		var change model.BeverageChange
+		if err := rows.Scan(&change.BeverageName, &change.FirstCount, &change.SecondCount, &change.FirstShare, &change.SecondShare); err != nil {
+			return nil, fmt.Errorf("database error scanning comparison: %w", err)
+		}
+		change.Change = change.SecondCount - change.FirstCount
+		change.RelativeChange = relativeChange(change.FirstCount/firstDays, change.SecondCount/secondDays)
+		comparison.First.Total += change.FirstCount
+		comparison.Second.Total += change.SecondCount
+		comparison.Beverages = append(comparison.Beverages, &change)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("database error scanning comparison: %w", err)
+	}
+
+	comparison.First.DailyAverage = comparison.First.Total / firstDays
+	comparison.Second.DailyAverage = comparison.Second.Total / secondDays
+	comparison.Change = comparison.Second.Total - comparison.First.Total
+	comparison.RelativeChange = relativeChange(comparison.First.DailyAverage, comparison.Second.DailyAverage)
+	return comparison, nil
+}
+
+// relativeChange returns the change from before to after relative to before,
+// or nil if before is zero.
+func relativeChange(before, after float64) *float64 {
+	if before == 0 {
+		return nil
+	}
+	change := after/before - 1
+	return &change
+}
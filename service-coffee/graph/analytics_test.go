@@ -0,0 +1,96 @@
+package graph
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LarsDepuydt/masterthesis-api-aggregation/service-coffee/graph/model"
+	"github.com/lib/pq"
+)
+
+func TestConsumedBeveragesSQL(t *testing.T) {
+	// Every window takes the two placeholders after the machine and floor IDs
+	query := consumedBeveragesSQL(2)
+	for _, window := range []string{"(1, $3::timestamptz, $4::timestamptz)", "(2, $5::timestamptz, $6::timestamptz)"} {
+		if !strings.Contains(query, window) {
+			t.Errorf("the query does not contain the window %s", window)
+		}
+	}
+	if strings.Contains(query, "$7") {
+		t.Error("the query refers to more placeholders than there are arguments")
+	}
+}
+
+func TestAnalyticsArgs(t *testing.T) {
+	start := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	first := model.TimeWindow{StartTime: start, EndTime: start.AddDate(0, 0, 7)}
+	second := model.TimeWindow{StartTime: start.AddDate(0, 0, 7), EndTime: start.AddDate(0, 0, 14)}
+
+	args, err := analyticsArgs(&model.BeverageAnalyticsFilter{FloorIds: []string{"TMV25-Stue"}}, first, second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(args) != 6 || args[2] != first.StartTime || args[5] != second.EndTime {
+		t.Fatalf("got arguments %v", args)
+	}
+	// Filters that are not given match every machine and floor
+	machines, floors := args[0].(*pq.StringArray), args[1].(*pq.StringArray)
+	if len(*machines) != 0 || len(*floors) != 1 || (*floors)[0] != "TMV25-Stue" {
+		t.Errorf("got machine IDs %v and floor IDs %v", *machines, *floors)
+	}
+	if args, err := analyticsArgs(nil, first); err != nil || len(*args[0].(*pq.StringArray)) != 0 {
+		t.Errorf("got %v, %v, want empty filters", args, err)
+	}
+
+	for _, window := range []model.TimeWindow{{StartTime: start, EndTime: start}, {StartTime: second.EndTime, EndTime: start}} {
+		if _, err := analyticsArgs(nil, first, window); err == nil {
+			t.Errorf("window %s to %s: expected an error", window.StartTime, window.EndTime)
+		}
+	}
+}
+
+func TestRelativeChange(t *testing.T) {
+	tests := []struct {
+		before, after float64
+		want          *float64
+	}{
+		{before: 10, after: 15, want: ptr(0.5)},
+		{before: 10, after: 5, want: ptr(-0.5)},
+		{before: 10, after: 0, want: ptr(-1.0)},
+		{before: 4, after: 4, want: ptr(0.0)},
+		{before: 0, after: 5},
+	}
+
+	for _, tt := range tests {
+		got := relativeChange(tt.before, tt.after)
+		if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+			t.Errorf("relativeChange(%g, %g): got %v, want %v", tt.before, tt.after, got, tt.want)
+		}
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
+
+func TestBeverageProfileRejectsInvalidArguments(t *testing.T) {
+	start := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		window      model.TimeWindow
+		granularity model.BeverageProfileGranularity
+	}{
+		{name: "empty window", window: model.TimeWindow{StartTime: start, EndTime: start}, granularity: model.BeverageProfileGranularityWeekday},
+		{name: "window too long", window: model.TimeWindow{StartTime: start, EndTime: start.AddDate(4, 0, 0)}, granularity: model.BeverageProfileGranularityWeekday},
+		{name: "unsupported granularity", window: model.TimeWindow{StartTime: start, EndTime: start.AddDate(0, 0, 7)}, granularity: "MINUTE"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The arguments are rejected before the database is queried
+			if _, err := (&Resolver{}).beverageProfile(context.Background(), tt.window, tt.granularity, time.UTC, nil, false); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
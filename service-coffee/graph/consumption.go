@@ -0,0 +1,303 @@
+package graph
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/LarsDepuydt/masterthesis-api-aggregation/service-coffee/graph/model"
+	"github.com/lib/pq"
+)
+
+// maxConsumptionPeriods limits the number of intervals a single consumption
+// query may return.
+const maxConsumptionPeriods = 10000
+
+// counterReading is a reading of a cumulative counter.
+type counterReading struct {
+	Timestamp time.Time
+	Count     int64
+}
+
+// consumptionPeriods splits the time between start and end into intervals
+// aligned to the given interval in loc. The first and last intervals are cut
+// off at start and end.
+func consumptionPeriods(start, end time.Time, interval model.ConsumptionInterval, loc *time.Location) ([]*model.ConsumptionPeriod, error) {
+	if !start.Before(end) {
+		return nil, fmt.Errorf("startTime must be before endTime")
+	}
+
+	boundary, err := startOfInterval(start, interval, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	var periods []*model.ConsumptionPeriod
+	for periodStart := boundary; periodStart.Before(end); periodStart = nextInterval(periodStart, interval) {
+		if len(periods) == maxConsumptionPeriods {
+			return nil, fmt.Errorf("the time window contains more than %d intervals, use a longer interval", maxConsumptionPeriods)
+		}
+		periodEnd := nextInterval(periodStart, interval)
+		if periodEnd.After(end) {
+			periodEnd = end
+		}
+		periods = append(periods, &model.ConsumptionPeriod{
+			StartTime: maxTime(periodStart, start),
+			EndTime:   periodEnd,
+			Beverages: []*model.BeverageConsumption{},
+		})
+	}
+	return periods, nil
+}
+
+// startOfInterval returns the start of the interval containing t in loc.
+func startOfInterval(t time.Time, interval model.ConsumptionInterval, loc *time.Location) (time.Time, error) {
+	local := t.In(loc)
+	switch interval {
+	case model.ConsumptionIntervalHour:
+		return time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), 0, 0, 0, loc), nil
+	case model.ConsumptionIntervalDay:
+		return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc), nil
+	case model.ConsumptionIntervalWeek:
+		daysSinceMonday := (int(local.Weekday()) + 6) % 7
+		return time.Date(local.Year(), local.Month(), local.Day()-daysSinceMonday, 0, 0, 0, 0, loc), nil
+	case model.ConsumptionIntervalMonth:
+		return time.Date(local.Year(), local.Month(), 1, 0, 0, 0, 0, loc), nil
+	default:
+		return time.Time{}, fmt.Errorf("unsupported interval %q", interval)
+	}
+}
+
+// nextInterval returns the start of the interval after the one starting at t.
+func nextInterval(t time.Time, interval model.ConsumptionInterval) time.Time {
+	switch interval {
+	case model.ConsumptionIntervalHour:
+		return t.Add(time.Hour)
+	case model.ConsumptionIntervalDay:
+		return t.AddDate(0, 0, 1)
+	case model.ConsumptionIntervalWeek:
+		return t.AddDate(0, 0, 7)
+	default:
+		return t.AddDate(0, 1, 0)
+	}
+}
+
+// parseTimezone returns the IANA time zone named by timezone, or UTC if it is
+// not given.
+func parseTimezone(timezone *string) (*time.Location, error) {
+	if timezone == nil || *timezone == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(*timezone)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q", *timezone)
+	}
+	return loc, nil
+}
+
+// distributeConsumption spreads the increase of a counter between every two
+// consecutive readings over the time between them, and adds the share falling
+// within each period to add, along with the time of the period it covers and
+// the time between the readings. Without weights the increase is spread evenly;
+// otherwise the time within period p counts weight(p) times, and time outside
+// the periods once, so the periods should cover the readings. A decreasing
+// count is taken as a counter reset, in which case the new count is the
+// increase since the reset. Readings must be ordered by time. It returns the
+// number of resets per period.
+func distributeConsumption(readings []counterReading, periods []*model.ConsumptionPeriod, weight func(period int) float64, add func(period int, amount float64, covered, span time.Duration)) []int32 {
+	resets := make([]int32, len(periods))
+	overlaps := make([]time.Duration, len(periods))
+	for i := 1; i < len(readings); i++ {
+		from, to := readings[i-1], readings[i]
+		increase := to.Count - from.Count
+		reset := increase < 0
+		if reset {
+			increase = to.Count
+		}
+
+		span := to.Timestamp.Sub(from.Timestamp)
+		if span <= 0 {
+			// Readings at the same moment, attribute the increase to the
+			// period containing it
+			for p, period := range periods {
+				if !from.Timestamp.Before(period.StartTime) && from.Timestamp.Before(period.EndTime) {
+					add(p, float64(increase), 0, 0)
+					if reset {
+						resets[p]++
+					}
+				}
+			}
+			continue
+		}
+
+		// Weigh the time within every period, the remaining time counts once
+		weighted, total := 0.0, 0.0
+		outside := span
+		for p, period := range periods {
+			overlaps[p] = max(minTime(to.Timestamp, period.EndTime).Sub(maxTime(from.Timestamp, period.StartTime)), 0)
+			outside -= overlaps[p]
+			if overlaps[p] > 0 && weight != nil {
+				weighted += float64(overlaps[p]) * weight(p)
+			}
+		}
+		if weight != nil && weighted > 0 {
+			total = weighted + float64(max(outside, 0))
+		}
+
+		for p := range periods {
+			if overlaps[p] <= 0 {
+				continue
+			}
+			share := float64(overlaps[p]) / float64(span)
+			if total > 0 {
+				share = float64(overlaps[p]) * weight(p) / total
+			}
+			add(p, float64(increase)*share, overlaps[p], span)
+			if reset {
+				resets[p]++
+			}
+		}
+	}
+	return resets
+}
+
+// machinesConsumption computes the consumption of machines per period from
+// their total and per-beverage counts. The periods of every machine must cover
+// the same window.
+func machinesConsumption(ctx context.Context, db *sql.DB, periodsByMachine map[string][]*model.ConsumptionPeriod) error {
+	var machineIDs []string
+	var start, end time.Time
+	for machineID, periods := range periodsByMachine {
+		machineIDs = append(machineIDs, machineID)
+		start, end = periods[0].StartTime, periods[len(periods)-1].EndTime
+	}
+	if len(machineIDs) == 0 {
+		return nil
+	}
+
+	totals, details, err := fetchCounterReadings(ctx, db, machineIDs, start, end)
+	if err != nil {
+		return err
+	}
+
+	for machineID, periods := range periodsByMachine {
+		resets := distributeConsumption(totals[readingKey{machineID: machineID}], periods, nil, func(p int, amount float64, covered, _ time.Duration) {
+			periods[p].TotalBeverages += amount
+			periods[p].Coverage += float64(covered)
+		})
+		for p, period := range periods {
+			period.CounterResets = resets[p]
+			// Coverage was summed in nanoseconds, convert it into a fraction
+			period.Coverage = min(period.Coverage/float64(period.EndTime.Sub(period.StartTime)), 1)
+		}
+	}
+
+	for _, key := range sortedReadingKeys(details) {
+		periods := periodsByMachine[key.machineID]
+		counts := make([]float64, len(periods))
+		distributeConsumption(details[key], periods, nil, func(p int, amount float64, _, _ time.Duration) {
+			counts[p] += amount
+		})
+		for p, period := range periods {
+			period.Beverages = append(period.Beverages, &model.BeverageConsumption{BeverageName: key.beverageName, Count: counts[p]})
+		}
+	}
+	return nil
+}
+
+// fetchCounterReadings fetches the total and per-beverage readings of machines
+// within a window. The last reading before and the first reading after the
+// window are included, so the consumption at its edges can be prorated.
+func fetchCounterReadings(ctx context.Context, db *sql.DB, machineIDs []string, start, end time.Time) (totals, details map[readingKey][]counterReading, err error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT c.machine_id, c.total_beverages, c.timestamp
+		FROM beverage_counts c
+		WHERE c.machine_id = ANY($1)
+		  AND c.timestamp >= COALESCE((SELECT MAX(timestamp) FROM beverage_counts WHERE machine_id = c.machine_id AND timestamp <= $2), $2)
+		  AND c.timestamp <= COALESCE((SELECT MIN(timestamp) FROM beverage_counts WHERE machine_id = c.machine_id AND timestamp >= $3), $3)
+		ORDER BY c.machine_id, c.timestamp ASC
+	`, pq.Array(machineIDs), start, end)
+	if err != nil {
+		return nil, nil, fmt.Errorf("database error fetching beverage counts: %w", err)
+	}
+	if totals, err = scanCounterReadings(rows, false); err != nil {
+		return nil, nil, fmt.Errorf("database error scanning beverage counts: %w", err)
+	}
+
+	rows, err = db.QueryContext(ctx, `
+		SELECT d.machine_id, d.beverage_name, d.count, d.timestamp
+		FROM beverage_details d
+		WHERE d.machine_id = ANY($1)
+		  AND d.timestamp >= COALESCE((SELECT MAX(timestamp) FROM beverage_details WHERE machine_id = d.machine_id AND beverage_name = d.beverage_name AND timestamp <= $2), $2)
+		  AND d.timestamp <= COALESCE((SELECT MIN(timestamp) FROM beverage_details WHERE machine_id = d.machine_id AND beverage_name = d.beverage_name AND timestamp >= $3), $3)
+		ORDER BY d.machine_id, d.beverage_name, d.timestamp ASC
+	`, pq.Array(machineIDs), start, end)
+	if err != nil {
+		return nil, nil, fmt.Errorf("database error fetching beverage details: %w", err)
+	}
+	if details, err = scanCounterReadings(rows, true); err != nil {
+		return nil, nil, fmt.Errorf("database error scanning beverage details: %w", err)
+	}
+	return totals, details, nil
+}
+
+// sortedReadingKeys returns the keys of readings ordered by beverage name.
+func sortedReadingKeys(readings map[readingKey][]counterReading) []readingKey {
+	keys := make([]readingKey, 0, len(readings))
+	for key := range readings {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].beverageName != keys[j].beverageName {
+			return keys[i].beverageName < keys[j].beverageName
+		}
+		return keys[i].machineID < keys[j].machineID
+	})
+	return keys
+}
+
+// readingKey identifies the counter of a machine, or of one of its beverages.
+type readingKey struct {
+	machineID    string
+	beverageName string
+}
+
+// scanCounterReadings reads counter readings from rows of (machine, count,
+// timestamp), or of (machine, name, count, timestamp) if named is set, grouped
+// by counter.
+func scanCounterReadings(rows *sql.Rows, named bool) (map[readingKey][]counterReading, error) {
+	defer rows.Close()
+
+	readings := make(map[readingKey][]counterReading)
+	for rows.Next() {
+		var reading counterReading
+		var key readingKey
+		var err error
+		if named {
+			err = rows.Scan(&key.machineID, &key.beverageName, &reading.Count, &reading.Timestamp)
+		} else {
+			err = rows.Scan(&key.machineID, &reading.Count, &reading.Timestamp)
+		}
+		if err != nil {
+			return nil, err
+		}
+		readings[key] = append(readings[key], reading)
+	}
+	return readings, rows.Err()
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,243 @@
+package graph
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/LarsDepuydt/masterthesis-api-aggregation/service-coffee/graph/model"
+)
+
+func TestDistributeConsumption(t *testing.T) {
+	day := time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC)
+	at := func(hours float64) time.Time { return day.Add(time.Duration(hours * float64(time.Hour))) }
+
+	tests := []struct {
+		name       string
+		readings   []counterReading
+		weights    []float64 // per day, nil to spread evenly
+		want       []float64 // per day
+		wantResets []int32
+	}{
+		{
+			name:       "evenly",
+			readings:   []counterReading{{at(0), 0}, {at(48), 24}},
+			want:       []float64{12, 12},
+			wantResets: []int32{0, 0},
+		},
+		{
+			name:       "weighted",
+			readings:   []counterReading{{at(0), 0}, {at(48), 24}},
+			weights:    []float64{1, 3},
+			want:       []float64{6, 18},
+			wantResets: []int32{0, 0},
+		},
+		{
+			// Half of each day lies between the readings, so the days weigh
+			// 0.5*2 and 0.5*1
+			name:       "weighted within days",
+			readings:   []counterReading{{at(12), 0}, {at(36), 30}},
+			weights:    []float64{2, 1},
+			want:       []float64{20, 10},
+			wantResets: []int32{0, 0},
+		},
+		{
+			name:       "zero weight",
+			readings:   []counterReading{{at(0), 0}, {at(48), 24}},
+			weights:    []float64{0, 1},
+			want:       []float64{0, 24},
+			wantResets: []int32{0, 0},
+		},
+		{
+			// A decreasing count restarts from zero, so the increase is the
+			// new count
+			name:       "counter reset",
+			readings:   []counterReading{{at(0), 10}, {at(24), 20}, {at(48), 8}},
+			weights:    []float64{1, 1},
+			want:       []float64{10, 8},
+			wantResets: []int32{0, 1},
+		},
+		{
+			name:       "readings at the same moment",
+			readings:   []counterReading{{at(30), 5}, {at(30), 9}},
+			want:       []float64{0, 4},
+			wantResets: []int32{0, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			periods, err := consumptionPeriods(day, day.AddDate(0, 0, 2), model.ConsumptionIntervalDay, time.UTC)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var weight func(int) float64
+			if tt.weights != nil {
+				weight = func(p int) float64 { return tt.weights[p] }
+			}
+
+			got := make([]float64, len(periods))
+			resets := distributeConsumption(tt.readings, periods, weight, func(p int, amount float64, _, _ time.Duration) {
+				got[p] += amount
+			})
+
+			total := 0.0
+			for p := range periods {
+				if math.Abs(got[p]-tt.want[p]) > 1e-9 {
+					t.Errorf("period %d: got %g, want %g", p, got[p], tt.want[p])
+				}
+				if resets[p] != tt.wantResets[p] {
+					t.Errorf("period %d: got %d resets, want %d", p, resets[p], tt.wantResets[p])
+				}
+				total += got[p]
+			}
+
+			// The readings lie within the periods, so the periods sum up to
+			// the increase between the readings
+			increase := 0.0
+			for i := 1; i < len(tt.readings); i++ {
+				if difference := tt.readings[i].Count - tt.readings[i-1].Count; difference >= 0 {
+					increase += float64(difference)
+				} else {
+					increase += float64(tt.readings[i].Count)
+				}
+			}
+			if math.Abs(total-increase) > 1e-9 {
+				t.Errorf("got a total of %g, want the increase of %g", total, increase)
+			}
+		})
+	}
+}
+
+func TestDistributeConsumptionOutsidePeriods(t *testing.T) {
+	// Time outside the periods counts once, so the periods get their weighted
+	// share of the increase and the rest is left out
+	day := time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC)
+	periods := []*model.ConsumptionPeriod{{StartTime: day, EndTime: day.AddDate(0, 0, 1)}}
+	readings := []counterReading{{day, 0}, {day.AddDate(0, 0, 2), 30}}
+
+	var got float64
+	distributeConsumption(readings, periods, func(int) float64 { return 2 }, func(_ int, amount float64, _, _ time.Duration) {
+		got += amount
+	})
+	if want := 20.0; math.Abs(got-want) > 1e-9 {
+		t.Errorf("got %g, want %g", got, want)
+	}
+}
+
+func TestConsumptionPeriods(t *testing.T) {
+	copenhagen, err := time.LoadLocation("Europe/Copenhagen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := func(month time.Month, day, hour int) time.Time {
+		return time.Date(2025, month, day, hour, 0, 0, 0, copenhagen)
+	}
+	utc := func(month time.Month, day, hour int) time.Time {
+		return time.Date(2025, month, day, hour, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name       string
+		start, end time.Time
+		interval   model.ConsumptionInterval
+		loc        *time.Location
+		want       []time.Time // boundaries of the periods
+		wantErr    bool
+	}{
+		{
+			// The clocks are put forward on 30 March, so that day is 23 hours
+			name:     "days around the start of summer time",
+			start:    local(time.March, 29, 0),
+			end:      local(time.April, 1, 0),
+			interval: model.ConsumptionIntervalDay,
+			loc:      copenhagen,
+			want:     []time.Time{local(time.March, 29, 0), local(time.March, 30, 0), local(time.March, 31, 0), local(time.April, 1, 0)},
+		},
+		{
+			// The clocks are put back on 26 October, so 2:00 occurs twice
+			name:     "hours around the end of summer time",
+			start:    local(time.October, 26, 1),
+			end:      local(time.October, 26, 4),
+			interval: model.ConsumptionIntervalHour,
+			loc:      copenhagen,
+			want: []time.Time{
+				utc(time.October, 25, 23), utc(time.October, 26, 0), utc(time.October, 26, 1),
+				utc(time.October, 26, 2), utc(time.October, 26, 3),
+			},
+		},
+		{
+			name:     "weeks cut off at both ends",
+			start:    utc(time.March, 5, 12),
+			end:      utc(time.March, 20, 0),
+			interval: model.ConsumptionIntervalWeek,
+			loc:      time.UTC,
+			want:     []time.Time{utc(time.March, 5, 12), utc(time.March, 10, 0), utc(time.March, 17, 0), utc(time.March, 20, 0)},
+		},
+		{
+			name:     "months of different lengths",
+			start:    utc(time.January, 31, 0),
+			end:      utc(time.March, 15, 0),
+			interval: model.ConsumptionIntervalMonth,
+			loc:      time.UTC,
+			want:     []time.Time{utc(time.January, 31, 0), utc(time.February, 1, 0), utc(time.March, 1, 0), utc(time.March, 15, 0)},
+		},
+		{
+			// Midnight in Copenhagen is 23:00 UTC in winter
+			name:     "days in another time zone",
+			start:    utc(time.January, 1, 12),
+			end:      utc(time.January, 2, 12),
+			interval: model.ConsumptionIntervalDay,
+			loc:      copenhagen,
+			want:     []time.Time{utc(time.January, 1, 12), utc(time.January, 1, 23), utc(time.January, 2, 12)},
+		},
+		{name: "empty window", start: utc(time.March, 5, 0), end: utc(time.March, 5, 0), interval: model.ConsumptionIntervalDay, loc: time.UTC, wantErr: true},
+		{name: "unsupported interval", start: utc(time.March, 5, 0), end: utc(time.March, 6, 0), interval: "QUARTER", loc: time.UTC, wantErr: true},
+		{name: "too many intervals", start: utc(time.January, 1, 0), end: utc(time.January, 1, 0).AddDate(2, 0, 0), interval: model.ConsumptionIntervalHour, loc: time.UTC, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			periods, err := consumptionPeriods(tt.start, tt.end, tt.interval, tt.loc)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(periods) != len(tt.want)-1 {
+				t.Fatalf("got %d periods, want %d", len(periods), len(tt.want)-1)
+			}
+			for i, period := range periods {
+				if !period.StartTime.Equal(tt.want[i]) || !period.EndTime.Equal(tt.want[i+1]) {
+					t.Errorf("period %d: got %s to %s, want %s to %s", i, period.StartTime, period.EndTime, tt.want[i], tt.want[i+1])
+				}
+			}
+		})
+	}
+}
+
+func TestParseTimezone(t *testing.T) {
+	name := func(s string) *string { return &s }
+	tests := []struct {
+		timezone *string
+		want     string
+		wantErr  bool
+	}{
+		{timezone: nil, want: "UTC"},
+		{timezone: name(""), want: "UTC"},
+		{timezone: name("Europe/Copenhagen"), want: "Europe/Copenhagen"},
+		{timezone: name("Mars/Olympus"), want: "Mars/Olympus", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		loc, err := parseTimezone(tt.timezone)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: got error %v, want error %v", tt.want, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && loc.String() != tt.want {
+			t.Errorf("got %s, want %s", loc, tt.want)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package graph
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// DBConfig configures the connection pool of the coffee database.
+type DBConfig struct {
+	Host     string
+	Port     string
+	Name     string
+	User     string
+	Password string
+	// SSLMode is the libpq sslmode (e.g., 'disable', 'require', 'verify-full').
+	SSLMode string
+
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	// ConnectTimeout limits establishing a single connection.
+	ConnectTimeout time.Duration
+	// StatementTimeout makes the server cancel statements running longer.
+	StatementTimeout time.Duration
+}
+
+// LoadDBConfig reads the database configuration from the COFFEE_DB_*
+// environment variables, using defaults for the pool settings.
+func LoadDBConfig() (DBConfig, error) {
+	cfg := DBConfig{
+		Host:     os.Getenv("COFFEE_DB_HOST"),
+		Port:     os.Getenv("COFFEE_DB_PORT"),
+		Name:     os.Getenv("COFFEE_DB_NAME"),
+		User:     os.Getenv("COFFEE_DB_USER"),
+		Password: os.Getenv("COFFEE_DB_PASSWORD"),
+		SSLMode:  os.Getenv("COFFEE_DB_SSLMODE"),
+	}
+	if cfg.Port == "" {
+		cfg.Port = "5432"
+	}
+	if cfg.SSLMode == "" {
+		cfg.SSLMode = "disable"
+	}
+
+	var err error
+	ints := []struct {
+		env    string
+		target *int
+		def    int
+	}{
+		{"COFFEE_DB_MAX_OPEN_CONNS", &cfg.MaxOpenConns, 10},
+		{"COFFEE_DB_MAX_IDLE_CONNS", &cfg.MaxIdleConns, 5},
+	}
+	for _, setting := range ints {
+		*setting.target = setting.def
+		if value := os.Getenv(setting.env); value != "" {
+			if *setting.target, err = strconv.Atoi(value); err != nil || *setting.target < 0 {
+				return cfg, fmt.Errorf("%s must be a non-negative number, got %q", setting.env, value)
+			}
+		}
+	}
+
+	durations := []struct {
+		env    string
+		target *time.Duration
+		def    time.Duration
+	}{
+		{"COFFEE_DB_CONN_MAX_LIFETIME", &cfg.ConnMaxLifetime, 30 * time.Minute},
+		{"COFFEE_DB_CONN_MAX_IDLE_TIME", &cfg.ConnMaxIdleTime, 5 * time.Minute},
+		{"COFFEE_DB_CONNECT_TIMEOUT", &cfg.ConnectTimeout, 5 * time.Second},
+		{"COFFEE_DB_STATEMENT_TIMEOUT", &cfg.StatementTimeout, 30 * time.Second},
+	}
+	for _, setting := range durations {
+		*setting.target = setting.def
+		if value := os.Getenv(setting.env); value != "" {
+			if *setting.target, err = time.ParseDuration(value); err != nil || *setting.target < 0 {
+				return cfg, fmt.Errorf("%s must be a duration such as '10s', got %q", setting.env, value)
+			}
+		}
+	}
+	return cfg, nil
+}
+
+// connectionString builds the libpq connection string for the configuration.
+func (cfg DBConfig) connectionString() string {
+	params := url.Values{}
+	params.Set("sslmode", cfg.SSLMode)
+	if cfg.ConnectTimeout > 0 {
+		// libpq only supports whole seconds, and at least 2
+		params.Set("connect_timeout", strconv.Itoa(max(int(cfg.ConnectTimeout.Seconds()), 2)))
+	}
+	if cfg.StatementTimeout > 0 {
+		params.Set("statement_timeout", strconv.FormatInt(cfg.StatementTimeout.Milliseconds(), 10))
+	}
+
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(cfg.User, cfg.Password),
+		Host:     cfg.Host + ":" + cfg.Port,
+		Path:     "/" + cfg.Name,
+		RawQuery: params.Encode(),
+	}
+	return u.String()
+}
+
+// OpenDB creates the connection pool of the coffee database. Connections are
+// opened on demand, so the database does not need to be reachable yet; broken
+// connections are discarded and replaced by the pool.
+func OpenDB(cfg DBConfig) (*sql.DB, error) {
+	db, err := sql.Open("postgres", cfg.connectionString())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+	return db, nil
+}
+
+// WaitForDB pings the database until it responds or ctx is done, backing off
+// between attempts.
+func WaitForDB(ctx context.Context, db *sql.DB) error {
+	delay := 500 * time.Millisecond
+	for {
+		err := db.PingContext(ctx)
+		if err == nil {
+			log.Println("Successfully connected to the database")
+			return nil
+		}
+		log.Printf("Database not reachable yet, retrying in %s: %v", delay, err)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("database not reachable: %w", err)
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, 10*time.Second)
+	}
+}
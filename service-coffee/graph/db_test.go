@@ -0,0 +1,92 @@
+package graph
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadDBConfig(t *testing.T) {
+	t.Setenv("COFFEE_DB_HOST", "db")
+	t.Setenv("COFFEE_DB_NAME", "coffee")
+	t.Setenv("COFFEE_DB_USER", "coffee")
+	t.Setenv("COFFEE_DB_PASSWORD", "p@ss word")
+	t.Setenv("COFFEE_DB_MAX_OPEN_CONNS", "20")
+	t.Setenv("COFFEE_DB_STATEMENT_TIMEOUT", "1m")
+	for _, env := range []string{"COFFEE_DB_PORT", "COFFEE_DB_SSLMODE", "COFFEE_DB_MAX_IDLE_CONNS", "COFFEE_DB_CONNECT_TIMEOUT"} {
+		t.Setenv(env, "")
+	}
+
+	cfg, err := LoadDBConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Settings that are not given fall back to their defaults
+	if cfg.Port != "5432" || cfg.SSLMode != "disable" || cfg.MaxOpenConns != 20 || cfg.MaxIdleConns != 5 ||
+		cfg.StatementTimeout != time.Minute || cfg.ConnectTimeout != 5*time.Second {
+		t.Errorf("got %+v", cfg)
+	}
+
+	want := "postgres://coffee:p%40ss%20word@db:5432/coffee?connect_timeout=5&sslmode=disable&statement_timeout=60000"
+	if got := cfg.connectionString(); got != want {
+		t.Errorf("got connection string %s, want %s", got, want)
+	}
+
+	// libpq takes whole seconds of at least 2 to connect
+	cfg.ConnectTimeout = 500 * time.Millisecond
+	cfg.StatementTimeout = 0
+	if got := cfg.connectionString(); !strings.Contains(got, "connect_timeout=2") || strings.Contains(got, "statement_timeout") {
+		t.Errorf("got connection string %s", got)
+	}
+}
+
+func TestLoadDBConfigRejectsInvalidSettings(t *testing.T) {
+	tests := []struct {
+		env   string
+		value string
+	}{
+		{env: "COFFEE_DB_MAX_OPEN_CONNS", value: "many"},
+		{env: "COFFEE_DB_MAX_IDLE_CONNS", value: "-1"},
+		{env: "COFFEE_DB_CONN_MAX_LIFETIME", value: "30"},
+		{env: "COFFEE_DB_STATEMENT_TIMEOUT", value: "-5s"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.env, func(t *testing.T) {
+			t.Setenv(tt.env, tt.value)
+			if _, err := LoadDBConfig(); err == nil || !strings.Contains(err.Error(), tt.env) {
+				t.Errorf("got error %v, want one naming %s", err, tt.env)
+			}
+		})
+	}
+}
+
+func TestHealthHandlerWithoutDatabase(t *testing.T) {
+	// Nothing listens on port 1, so connections are refused right away
+	db, err := OpenDB(DBConfig{Host: "127.0.0.1", Port: "1", Name: "coffee", User: "secret-user", SSLMode: "disable", ConnectTimeout: 2 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	recorder := httptest.NewRecorder()
+	HealthHandler(db).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("got status %d, want %d", recorder.Code, http.StatusServiceUnavailable)
+	}
+	var status healthStatus
+	if err := json.Unmarshal(recorder.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Status != "unavailable" || status.Database.Status != "unavailable" {
+		t.Errorf("got %+v", status)
+	}
+	// The driver error is logged, not returned
+	if body := recorder.Body.String(); strings.Contains(body, "127.0.0.1") || strings.Contains(body, "secret-user") {
+		t.Errorf("the response reveals connection details: %s", body)
+	}
+}
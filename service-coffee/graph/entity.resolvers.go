@@ -13,19 +13,15 @@ import (
 
 // FindBeverageMachineByID is the resolver for the findBeverageMachineByID field.
 func (r *entityResolver) FindBeverageMachineByID(ctx context.Context, id string) (*model.BeverageMachine, error) {
-	row := r.DB.QueryRowContext(ctx, `
-		SELECT machine_id, machine_name, floor_id
-		FROM machines
-		WHERE machine_id = $1
-	`, id)
-
-	var machine model.BeverageMachine
-	var floorID string
-	if err := row.Scan(&machine.ID, &machine.Name, &floorID); err != nil {
+	machine, err := r.loadersFor(ctx).MachinesByID.Load(ctx, id)
+	if err != nil {
 		return nil, fmt.Errorf("could not find machine with ID %s: %w", id, err)
 	}
+	if machine == nil {
+		return nil, fmt.Errorf("could not find machine with ID %s", id)
+	}
 
-	return &machine, nil
+	return machine, nil
 }
 
 // FindFloorByID is the resolver for the findFloorByID field.
@@ -33,6 +29,11 @@ func (r *entityResolver) FindFloorByID(ctx context.Context, id string) (*model.F
 	return &model.Floor{ID: id}, nil
 }
 
+// FindRoomByID is the resolver for the findRoomByID field.
+func (r *entityResolver) FindRoomByID(ctx context.Context, id string) (*model.Room, error) {
+	return &model.Room{ID: id}, nil
+}
+
 // Entity returns EntityResolver implementation.
 func (r *Resolver) Entity() EntityResolver { return &entityResolver{r} }
 
@@ -0,0 +1,363 @@
+package graph
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LarsDepuydt/masterthesis-api-aggregation/service-coffee/graph/model"
+	"github.com/lib/pq"
+)
+
+// WeekdayWeights is the relative activity on every weekday, from Monday to
+// Sunday, by which consumption between readings is distributed.
+type WeekdayWeights [7]float64
+
+// DefaultWeekdayWeights describes an office building, which is mostly empty
+// during weekends.
+var DefaultWeekdayWeights = WeekdayWeights{1, 1, 1, 1, 1, 0.1, 0.1}
+
+// ParseWeekdayWeights parses a comma-separated list of seven non-negative
+// weights, from Monday to Sunday.
+func ParseWeekdayWeights(value string) (WeekdayWeights, error) {
+	var weights WeekdayWeights
+	fields := strings.Split(value, ",")
+	if len(fields) != len(weights) {
+		return weights, fmt.Errorf("expected 7 weights from Monday to Sunday, got %d", len(fields))
+	}
+	total := 0.0
+	for i, field := range fields {
+		weight, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil || weight < 0 || math.IsInf(weight, 0) || math.IsNaN(weight) {
+			return weights, fmt.Errorf("invalid weight %q, expected a non-negative number", field)
+		}
+		weights[i] = weight
+		total += weight
+	}
+	if total == 0 {
+		return weights, fmt.Errorf("at least one weight must be positive")
+	}
+	return weights, nil
+}
+
+// of returns the weight of the weekday of t.
+func (w WeekdayWeights) of(t time.Time) float64 {
+	return w[(int(t.Weekday())+6)%7]
+}
+
+// Columns of a floor occupancy CSV file.
+const (
+	occupancyColumnFloor     = "floorId"
+	occupancyColumnDate      = "date"
+	occupancyColumnOccupancy = "occupancy"
+)
+
+// dateFormat is the format of days, as in the database.
+const dateFormat = "2006-01-02"
+
+// floorOccupancy is the occupancy of a floor on a day.
+type floorOccupancy struct {
+	FloorID   string
+	Day       string
+	Occupancy float64
+	Row       int
+}
+
+// ImportFloorOccupancy imports the daily occupancy of floors from a CSV file.
+// As with readings, nothing is stored if any row is invalid.
+func (r *Resolver) ImportFloorOccupancy(ctx context.Context, file io.Reader, dryRun bool) (*model.FloorOccupancyImport, error) {
+	result := &model.FloorOccupancyImport{DryRun: dryRun, Errors: []*model.ImportError{}}
+	addError := func(row int, format string, args ...any) {
+		result.Errors = append(result.Errors, &model.ImportError{Row: int32(row), Message: fmt.Sprintf(format, args...)})
+	}
+
+	days, err := parseOccupancyCSV(file, addError)
+	if err != nil {
+		addError(0, "%v", err)
+		return result, nil
+	}
+	result.RowCount = int32(len(days))
+	if len(result.Errors) > 0 || dryRun {
+		return result, nil
+	}
+
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("database error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, day := range days {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO floor_occupancy (floor_id, day, occupancy)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (floor_id, day) DO UPDATE SET occupancy = EXCLUDED.occupancy
+		`, day.FloorID, day.Day, day.Occupancy); err != nil {
+			return nil, fmt.Errorf("database error storing occupancy of row %d: %w", day.Row, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("database error committing occupancy: %w", err)
+	}
+	result.ImportedCount = result.RowCount
+	log.Printf("Imported %d days of floor occupancy", result.ImportedCount)
+	return result, nil
+}
+
+// parseOccupancyCSV reads the occupancy of floors from a CSV file. Rows that
+// cannot be parsed are reported through addError and skipped.
+func parseOccupancyCSV(file io.Reader, addError func(row int, format string, args ...any)) ([]*floorOccupancy, error) {
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1 // Rows with a wrong number of fields are reported below
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("error reading CSV file: %w", err)
+	}
+	if len(records) < 1 {
+		return nil, fmt.Errorf("file is empty")
+	}
+
+	header := records[0]
+	columns := make(map[string]int)
+	for i, column := range header {
+		columns[strings.TrimSpace(column)] = i
+	}
+	for _, column := range []string{occupancyColumnFloor, occupancyColumnDate, occupancyColumnOccupancy} {
+		if _, ok := columns[column]; !ok {
+			return nil, fmt.Errorf("required column %q is missing", column)
+		}
+	}
+
+	var days []*floorOccupancy
+	seen := make(map[[2]string]int)
+	for i, row := range records[1:] {
+		line := i + 2
+		if len(row) != len(header) {
+			addError(line, "row has %d fields, expected %d", len(row), len(header))
+			continue
+		}
+
+		day := &floorOccupancy{FloorID: strings.TrimSpace(row[columns[occupancyColumnFloor]]), Row: line}
+		if day.FloorID == "" {
+			addError(line, "floor ID must not be empty")
+			continue
+		}
+		date, err := time.Parse(dateFormat, strings.TrimSpace(row[columns[occupancyColumnDate]]))
+		if err != nil {
+			addError(line, "invalid date %q, expected YYYY-MM-DD", row[columns[occupancyColumnDate]])
+			continue
+		}
+		day.Day = date.Format(dateFormat)
+		day.Occupancy, err = strconv.ParseFloat(strings.TrimSpace(row[columns[occupancyColumnOccupancy]]), 64)
+		if err != nil || day.Occupancy < 0 || math.IsInf(day.Occupancy, 0) || math.IsNaN(day.Occupancy) {
+			addError(line, "invalid occupancy %q, expected a non-negative number", row[columns[occupancyColumnOccupancy]])
+			continue
+		}
+
+		key := [2]string{day.FloorID, day.Day}
+		if previous, duplicate := seen[key]; duplicate {
+			addError(line, "floor %s on %s is already listed in row %d", day.FloorID, day.Day, previous)
+			continue
+		}
+		seen[key] = line
+		days = append(days, day)
+	}
+	return days, nil
+}
+
+// fetchFloorOccupancy fetches the occupancy of floors between two days, by
+// floor and day.
+func fetchFloorOccupancy(ctx context.Context, db *sql.DB, floorIDs []string, from, to time.Time) (map[string]map[string]float64, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT floor_id, to_char(day, 'YYYY-MM-DD'), occupancy
+		FROM floor_occupancy
+		WHERE floor_id = ANY($1) AND day BETWEEN $2 AND $3
+	`, pq.Array(floorIDs), from.Format(dateFormat), to.Format(dateFormat))
+	if err != nil {
+		return nil, fmt.Errorf("database error fetching floor occupancy: %w", err)
+	}
+	defer rows.Close()
+
+	occupancy := make(map[string]map[string]float64)
+	for rows.Next() {
+		var floorID, day string
+		var value float64
+		if err := rows.Scan(&floorID, &day, &value); err != nil {
+			return nil, fmt.Errorf("database error scanning floor occupancy: %w", err)
+		}
+		if occupancy[floorID] == nil {
+			occupancy[floorID] = make(map[string]float64)
+		}
+		occupancy[floorID][day] = value
+	}
+	return occupancy, rows.Err()
+}
+
+// placedMachine identifies a machine along with its floor, whose occupancy
+// weighs its consumption.
+type placedMachine struct {
+	machineID string
+	floorID   string
+}
+
+// dailyWeights returns the weight and weighting of every day. Occupancy is
+// used where available; other days are weighted by the weekday weights, scaled
+// by the average ratio between occupancy and weekday weight on the days with
+// occupancy.
+func dailyWeights(days []*model.ConsumptionPeriod, loc *time.Location, weighting model.ConsumptionWeighting, weekdays WeekdayWeights, occupancy map[string]float64) ([]float64, []model.ConsumptionWeighting) {
+	weights := make([]float64, len(days))
+	used := make([]model.ConsumptionWeighting, len(days))
+	for d, day := range days {
+		switch weighting {
+		case model.ConsumptionWeightingEven:
+			weights[d], used[d] = 1, model.ConsumptionWeightingEven
+		default:
+			weights[d], used[d] = weekdays.of(day.StartTime.In(loc)), model.ConsumptionWeightingWeekday
+		}
+	}
+	if weighting != model.ConsumptionWeightingOccupancy {
+		return weights, used
+	}
+
+	occupied, expected := 0.0, 0.0
+	for d, day := range days {
+		if value, ok := occupancy[day.StartTime.In(loc).Format(dateFormat)]; ok {
+			occupied += value
+			expected += weights[d]
+		}
+	}
+	scale := 1.0
+	if occupied > 0 && expected > 0 {
+		scale = occupied / expected
+	}
+	for d, day := range days {
+		if value, ok := occupancy[day.StartTime.In(loc).Format(dateFormat)]; ok {
+			weights[d], used[d] = value, model.ConsumptionWeightingOccupancy
+		} else {
+			weights[d] *= scale
+		}
+	}
+	return weights, used
+}
+
+// machinesDailyConsumption estimates the consumption of machines per day of
+// the window in loc. The consumption between two readings is distributed over
+// the days between them by their weights, so the days of every machine span
+// from its first to its last reading, and are cut to the window afterwards.
+func machinesDailyConsumption(ctx context.Context, db *sql.DB, machines []placedMachine, start, end time.Time, loc *time.Location, weighting model.ConsumptionWeighting, weekdays WeekdayWeights) (map[placedMachine][]*model.DailyConsumption, error) {
+	windowStart, windowEnd := wholeDays(start, end, loc)
+
+	machineIDs := make([]string, len(machines))
+	for i, machine := range machines {
+		machineIDs[i] = machine.machineID
+	}
+	totals, details, err := fetchCounterReadings(ctx, db, machineIDs, windowStart, windowEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	// The days between readings of every machine, which are weighed together
+	spans := make(map[string][]*model.ConsumptionPeriod, len(machines))
+	spanStart, spanEnd := windowStart, windowEnd
+	for _, machine := range machines {
+		machineStart, machineEnd := windowStart, windowEnd
+		for key, readings := range details {
+			if key.machineID == machine.machineID && len(readings) > 0 {
+				machineStart = minTime(machineStart, readings[0].Timestamp)
+				machineEnd = maxTime(machineEnd, readings[len(readings)-1].Timestamp)
+			}
+		}
+		if readings := totals[readingKey{machineID: machine.machineID}]; len(readings) > 0 {
+			machineStart = minTime(machineStart, readings[0].Timestamp)
+			machineEnd = maxTime(machineEnd, readings[len(readings)-1].Timestamp)
+		}
+		machineStart, machineEnd = wholeDays(machineStart, machineEnd, loc)
+		if spans[machine.machineID], err = consumptionPeriods(machineStart, machineEnd, model.ConsumptionIntervalDay, loc); err != nil {
+			return nil, fmt.Errorf("the readings of machine %s span too long: %w", machine.machineID, err)
+		}
+		spanStart, spanEnd = minTime(spanStart, machineStart), maxTime(spanEnd, machineEnd)
+	}
+
+	var occupancy map[string]map[string]float64
+	if weighting == model.ConsumptionWeightingOccupancy {
+		floorIDs := make([]string, len(machines))
+		for i, machine := range machines {
+			floorIDs[i] = machine.floorID
+		}
+		if occupancy, err = fetchFloorOccupancy(ctx, db, floorIDs, spanStart.In(loc), spanEnd.Add(-time.Nanosecond).In(loc)); err != nil {
+			return nil, err
+		}
+	}
+
+	result := make(map[placedMachine][]*model.DailyConsumption, len(machines))
+	for _, machine := range machines {
+		days := spans[machine.machineID]
+		weights, used := dailyWeights(days, loc, weighting, weekdays, occupancy[machine.floorID])
+		weight := func(d int) float64 { return weights[d] }
+
+		measured := make([]float64, len(days))
+		distributeConsumption(totals[readingKey{machineID: machine.machineID}], days, weight, func(d int, amount float64, covered, span time.Duration) {
+			days[d].TotalBeverages += amount
+			days[d].Coverage += float64(covered)
+			if span > 0 {
+				// Time between readings counts as measured in proportion to
+				// how much of it lies within the day
+				measured[d] += float64(covered) * float64(covered) / float64(span)
+			}
+		})
+		for _, key := range sortedReadingKeys(details) {
+			if key.machineID != machine.machineID {
+				continue
+			}
+			counts := make([]float64, len(days))
+			distributeConsumption(details[key], days, weight, func(d int, amount float64, _, _ time.Duration) {
+				counts[d] += amount
+			})
+			for d, day := range days {
+				day.Beverages = append(day.Beverages, &model.BeverageConsumption{BeverageName: key.beverageName, Count: counts[d]})
+			}
+		}
+
+		daily := []*model.DailyConsumption{}
+		for d, day := range days {
+			if day.StartTime.Before(windowStart) || !day.StartTime.Before(windowEnd) {
+				continue
+			}
+			length := float64(day.EndTime.Sub(day.StartTime))
+			confidence := min(measured[d]/length, 1)
+			daily = append(daily, &model.DailyConsumption{
+				Date:           day.StartTime.In(loc).Format(dateFormat),
+				StartTime:      day.StartTime,
+				EndTime:        day.EndTime,
+				TotalBeverages: day.TotalBeverages,
+				Beverages:      day.Beverages,
+				// Allow for rounding in the sums of durations
+				Estimated:  confidence < 1-1e-9,
+				Confidence: confidence,
+				Coverage:   min(day.Coverage/length, 1),
+				Weighting:  used[d],
+			})
+		}
+		result[machine] = daily
+	}
+	return result, nil
+}
+
+// wholeDays extends a window to the start of its first and the end of its last
+// day in loc.
+func wholeDays(start, end time.Time, loc *time.Location) (time.Time, time.Time) {
+	// A day is a supported interval, so no errors can occur
+	first, _ := startOfInterval(start, model.ConsumptionIntervalDay, loc)
+	last, _ := startOfInterval(end, model.ConsumptionIntervalDay, loc)
+	if last.Before(end) {
+		last = nextInterval(last, model.ConsumptionIntervalDay)
+	}
+	return first, last
+}
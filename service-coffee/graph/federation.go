@@ -189,6 +189,25 @@ func (ec *executionContext) resolveEntity(
 				return nil, fmt.Errorf(`resolving Entity "Floor": %w`, err)
 			}
 
+			return entity, nil
+		}
+	case "Room":
+		resolverName, err := entityResolverNameForRoom(ctx, rep)
+		if err != nil {
+			return nil, fmt.Errorf(`finding resolver for Entity "Room": %w`, err)
+		}
+		switch resolverName {
+
+		case "findRoomByID":
+			id0, err := ec.unmarshalNID2string(ctx, rep["id"])
+			if err != nil {
+				return nil, fmt.Errorf(`unmarshalling param 0 for findRoomByID(): %w`, err)
+			}
+			entity, err := ec.resolvers.Entity().FindRoomByID(ctx, id0)
+			if err != nil {
+				return nil, fmt.Errorf(`resolving Entity "Room": %w`, err)
+			}
+
 			return entity, nil
 		}
 
@@ -286,3 +305,38 @@ func entityResolverNameForFloor(ctx context.Context, rep EntityRepresentation) (
 	return "", fmt.Errorf("%w for Floor due to %v", ErrTypeNotFound,
 		errors.Join(entityResolverErrs...).Error())
 }
+
+func entityResolverNameForRoom(ctx context.Context, rep EntityRepresentation) (string, error) {
+	// we collect errors because a later entity resolver may work fine
+	// when an entity has multiple keys
+	entityResolverErrs := []error{}
+	for {
+		var (
+			m   EntityRepresentation
+			val any
+			ok  bool
+		)
+		_ = val
+		// if all of the KeyFields values for this resolver are null,
+		// we shouldn't use use it
+		allNull := true
+		m = rep
+		val, ok = m["id"]
+		if !ok {
+			entityResolverErrs = append(entityResolverErrs,
+				fmt.Errorf("%w due to missing Key Field \"id\" for Room", ErrTypeNotFound))
+			break
+		}
+		if allNull {
+			allNull = val == nil
+		}
+		if allNull {
+			entityResolverErrs = append(entityResolverErrs,
+				fmt.Errorf("%w due to all null value KeyFields for Room", ErrTypeNotFound))
+			break
+		}
+		return "findRoomByID", nil
+	}
+	return "", fmt.Errorf("%w for Room due to %v", ErrTypeNotFound,
+		errors.Join(entityResolverErrs...).Error())
+}
@@ -0,0 +1,339 @@
+package graph
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/LarsDepuydt/masterthesis-api-aggregation/service-coffee/graph/model"
+)
+
+// maxForecastDays limits the number of days a forecast may span.
+const maxForecastDays = 365
+
+// minFittedDays is the number of measured days a forecast needs.
+const minFittedDays = 7
+
+// minFittedConfidence is the confidence from which the consumption of a day
+// counts as measured. The consumption of other days mostly follows from the
+// weights it was distributed by, which the model would then only reproduce.
+const minFittedConfidence = 0.9
+
+// predictionZ is the quantile of the normal distribution for 95% prediction
+// intervals.
+const predictionZ = 1.96
+
+// forecastModel models the daily consumption of a machine as a linear trend
+// plus an effect per weekday.
+type forecastModel struct {
+	origin time.Time // the start of day 0
+	loc    *time.Location
+
+	intercept, slope float64
+	effects          [7]float64 // from Monday to Sunday
+	sigma            float64    // the standard deviation of the residuals
+	n                int
+	meanDay, sxx     float64
+	// shares is the fraction of every beverage type of the consumption
+	shares map[string]float64
+}
+
+// dayIndex returns the number of days between the origin and the day of t.
+func (m *forecastModel) dayIndex(t time.Time) float64 {
+	day, _ := startOfInterval(t, model.ConsumptionIntervalDay, m.loc)
+	// Days differ in length at daylight saving time changes
+	return math.Round(day.Sub(m.origin).Hours() / 24)
+}
+
+// fitForecastModel fits a model to days of consumption. Only measured days are
+// used, as the consumption of other days is estimated from weekday weights and
+// would leave the residuals too narrow. The trend and weekday effects are
+// fitted alternately until they settle.
+func fitForecastModel(days []*model.DailyConsumption, origin time.Time, loc *time.Location) (*forecastModel, error) {
+	m := &forecastModel{origin: origin, loc: loc, shares: make(map[string]float64)}
+	var t, y []float64
+	var weekdays []int
+	beverages := make(map[string]float64)
+	for _, day := range days {
+		if day.Confidence < minFittedConfidence {
+			continue
+		}
+		t = append(t, m.dayIndex(day.StartTime))
+		y = append(y, day.TotalBeverages)
+		weekdays = append(weekdays, (int(day.StartTime.In(loc).Weekday())+6)%7)
+		for _, beverage := range day.Beverages {
+			beverages[beverage.BeverageName] += beverage.Count
+		}
+	}
+	m.n = len(y)
+	if m.n < minFittedDays {
+		return nil, fmt.Errorf("at least %d days measured by readings are needed to forecast, found %d", minFittedDays, m.n)
+	}
+
+	for _, value := range t {
+		m.meanDay += value
+	}
+	m.meanDay /= float64(m.n)
+	for _, value := range t {
+		m.sxx += (value - m.meanDay) * (value - m.meanDay)
+	}
+
+	for iteration := 0; iteration < 20; iteration++ {
+		// Fit the trend to the consumption without the weekday effects
+		mean, sxy := 0.0, 0.0
+		for i := range y {
+			mean += y[i] - m.effects[weekdays[i]]
+		}
+		mean /= float64(m.n)
+		for i := range y {
+			sxy += (t[i] - m.meanDay) * (y[i] - m.effects[weekdays[i]] - mean)
+		}
+		m.slope = 0
+		if m.sxx > 0 {
+			m.slope = sxy / m.sxx
+		}
+		m.intercept = mean - m.slope*m.meanDay
+
+		// Fit the weekday effects to what the trend leaves
+		var sums [7]float64
+		var counts [7]int
+		for i := range y {
+			sums[weekdays[i]] += y[i] - m.intercept - m.slope*t[i]
+			counts[weekdays[i]]++
+		}
+		for w := range m.effects {
+			m.effects[w] = 0
+			if counts[w] > 0 {
+				m.effects[w] = sums[w] / float64(counts[w])
+			}
+		}
+	}
+
+	fittedWeekdays := 0
+	var seen [7]bool
+	squares := 0.0
+	for i := range y {
+		residual := y[i] - m.intercept - m.slope*t[i] - m.effects[weekdays[i]]
+		squares += residual * residual
+		if !seen[weekdays[i]] {
+			seen[weekdays[i]] = true
+			fittedWeekdays++
+		}
+	}
+	// The trend takes two parameters, the weekdays one each but one
+	m.sigma = math.Sqrt(squares / float64(max(m.n-1-fittedWeekdays, 1)))
+
+	total := 0.0
+	for _, count := range beverages {
+		total += count
+	}
+	for name, count := range beverages {
+		if total > 0 {
+			m.shares[name] = count / total
+		}
+	}
+	return m, nil
+}
+
+// predict returns the predicted consumption on the day starting at dayStart,
+// along with its 95% prediction interval.
+func (m *forecastModel) predict(dayStart time.Time) (mean, lower, upper float64) {
+	t := m.dayIndex(dayStart)
+	weekday := (int(dayStart.In(m.loc).Weekday()) + 6) % 7
+	mean = m.intercept + m.slope*t + m.effects[weekday]
+
+	spread := 1 + 1/float64(m.n)
+	if m.sxx > 0 {
+		spread += (t - m.meanDay) * (t - m.meanDay) / m.sxx
+	}
+	margin := predictionZ * m.sigma * math.Sqrt(spread)
+	return max(mean, 0), max(mean-margin, 0), max(mean+margin, 0)
+}
+
+// predictBetween returns the predicted consumption between two moments, and
+// its upper bound, taking the share of every day within them.
+func (m *forecastModel) predictBetween(from, to time.Time) (mean, upper float64) {
+	day, _ := startOfInterval(from, model.ConsumptionIntervalDay, m.loc)
+	for ; day.Before(to); day = nextInterval(day, model.ConsumptionIntervalDay) {
+		end := nextInterval(day, model.ConsumptionIntervalDay)
+		fraction := float64(minTime(end, to).Sub(maxTime(day, from))) / float64(end.Sub(day))
+		if fraction <= 0 {
+			continue
+		}
+		dayMean, _, dayUpper := m.predict(day)
+		mean += fraction * dayMean
+		upper += fraction * dayUpper
+	}
+	return mean, upper
+}
+
+// usagePerBeverage returns the amount of an ingredient used per beverage,
+// given the shares of the beverage types.
+func (m *forecastModel) usagePerBeverage(ingredient Ingredient) float64 {
+	usage := 0.0
+	for name, share := range m.shares {
+		usage += share * ingredient.Usage[name]
+	}
+	return usage
+}
+
+// forecastResult is the forecast of a machine, or why it cannot be made.
+type forecastResult struct {
+	forecast *model.BeverageForecast
+	err      error
+}
+
+// machinesForecast forecasts the consumption of machines per day, starting
+// today, and projects their supply levels.
+func machinesForecast(ctx context.Context, db *sql.DB, machines []placedMachine, days, historyDays int, loc *time.Location, weekdays WeekdayWeights, ingredients []Ingredient) (map[placedMachine]forecastResult, error) {
+	now := time.Now()
+	today, _ := startOfInterval(now, model.ConsumptionIntervalDay, loc)
+	origin := today.AddDate(0, 0, -historyDays)
+
+	history, err := machinesDailyConsumption(ctx, db, machines, origin, now, loc, model.ConsumptionWeightingWeekday, weekdays)
+	if err != nil {
+		return nil, err
+	}
+
+	machineIDs := make([]string, len(machines))
+	for i, machine := range machines {
+		machineIDs[i] = machine.machineID
+	}
+	refills, err := fetchLatestRefills(ctx, db, machineIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	// The beverages dispensed since the earliest refill, to derive the levels
+	var details map[readingKey][]counterReading
+	earliest := now
+	for _, machineRefills := range refills {
+		for _, refill := range machineRefills {
+			earliest = minTime(earliest, refill.Timestamp)
+		}
+	}
+	if earliest.Before(now) {
+		if _, details, err = fetchCounterReadings(ctx, db, machineIDs, earliest, now); err != nil {
+			return nil, err
+		}
+	}
+
+	results := make(map[placedMachine]forecastResult, len(machines))
+	for _, machine := range machines {
+		m, err := fitForecastModel(history[machine], origin, loc)
+		if err != nil {
+			results[machine] = forecastResult{err: fmt.Errorf("cannot forecast machine %s: %w", machine.machineID, err)}
+			continue
+		}
+
+		forecast := &model.BeverageForecast{
+			Days:           []*model.ForecastDay{},
+			FittedDays:     int32(m.n),
+			TrendPerDay:    m.slope,
+			WeekdayEffects: m.effects[:],
+			Supplies:       []*model.SupplyProjection{},
+		}
+		names := make([]string, 0, len(m.shares))
+		for name := range m.shares {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for day := today; len(forecast.Days) < days; day = nextInterval(day, model.ConsumptionIntervalDay) {
+			mean, lower, upper := m.predict(day)
+			forecastDay := &model.ForecastDay{
+				Date:           day.Format(dateFormat),
+				StartTime:      day,
+				EndTime:        nextInterval(day, model.ConsumptionIntervalDay),
+				TotalBeverages: mean,
+				Lower:          lower,
+				Upper:          upper,
+				Beverages:      []*model.BeverageConsumption{},
+			}
+			for _, name := range names {
+				forecastDay.Beverages = append(forecastDay.Beverages, &model.BeverageConsumption{BeverageName: name, Count: mean * m.shares[name]})
+			}
+			forecast.Days = append(forecast.Days, forecastDay)
+		}
+
+		for _, ingredient := range ingredients {
+			forecast.Supplies = append(forecast.Supplies, projectSupply(m, ingredient, refills[machine.machineID][ingredient.Name], details, machine.machineID, now, forecast.Days))
+		}
+		results[machine] = forecastResult{forecast: forecast}
+	}
+	return results, nil
+}
+
+// projectSupply projects the level of a supply of a machine. The level now is
+// the level at the last refill minus the usage of the beverages dispensed
+// since, as measured up to the last reading and predicted after it. From now
+// on, the predicted usage is subtracted until the threshold is reached.
+func projectSupply(m *forecastModel, ingredient Ingredient, refill *model.SupplyRefill, details map[readingKey][]counterReading, machineID string, now time.Time, days []*model.ForecastDay) *model.SupplyProjection {
+	usage := m.usagePerBeverage(ingredient)
+	projection := &model.SupplyProjection{
+		Ingredient: ingredient.Name,
+		Unit:       ingredient.Unit,
+		Threshold:  ingredient.Threshold,
+		LastRefill: refill,
+	}
+	if len(days) > 0 {
+		total := 0.0
+		for _, day := range days {
+			total += day.TotalBeverages
+		}
+		projection.DailyUsage = total * usage / float64(len(days))
+	}
+	if refill == nil {
+		return projection
+	}
+
+	// Usage measured between the refill and the last reading
+	level, measuredUntil := refill.Level, refill.Timestamp
+	for key, readings := range details {
+		if key.machineID != machineID || len(readings) == 0 {
+			continue
+		}
+		last := readings[len(readings)-1].Timestamp
+		if !last.After(refill.Timestamp) {
+			continue
+		}
+		measuredUntil = maxTime(measuredUntil, last)
+		period := []*model.ConsumptionPeriod{{StartTime: refill.Timestamp, EndTime: last}}
+		distributeConsumption(readings, period, nil, func(_ int, amount float64, _, _ time.Duration) {
+			level -= amount * ingredient.Usage[key.beverageName]
+		})
+	}
+	// Usage predicted since
+	predicted, _ := m.predictBetween(measuredUntil, now)
+	level -= predicted * usage
+	projection.Level = &level
+
+	projection.ThresholdReachedAt = thresholdReached(level, ingredient.Threshold, usage, now, days, func(day *model.ForecastDay) float64 { return day.TotalBeverages })
+	projection.ThresholdReachedEarliest = thresholdReached(level, ingredient.Threshold, usage, now, days, func(day *model.ForecastDay) float64 { return day.Upper })
+	return projection
+}
+
+// thresholdReached returns when a level drops to the threshold, given the
+// beverages dispensed per forecast day and the usage per beverage, or nil if
+// it does not within the forecast.
+func thresholdReached(level, threshold, usage float64, now time.Time, days []*model.ForecastDay, beverages func(day *model.ForecastDay) float64) *time.Time {
+	if level <= threshold {
+		return &now
+	}
+	for _, day := range days {
+		start := maxTime(day.StartTime, now)
+		if !start.Before(day.EndTime) {
+			continue
+		}
+		// Usage is spread evenly over the remainder of the day
+		dayUsage := beverages(day) * usage * float64(day.EndTime.Sub(start)) / float64(day.EndTime.Sub(day.StartTime))
+		if level-dayUsage <= threshold {
+			reached := start.Add(time.Duration(float64(day.EndTime.Sub(start)) * (level - threshold) / dayUsage))
+			return &reached
+		}
+		level -= dayUsage
+	}
+	return nil
+}
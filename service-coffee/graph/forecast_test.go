@@ -0,0 +1,136 @@
+package graph
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/LarsDepuydt/masterthesis-api-aggregation/service-coffee/graph/model"
+)
+
+// weekendDip is the consumption on weekdays from Monday to Sunday relative to
+// the trend of the test data.
+var weekendDip = [7]float64{0, 0, 0, 0, 0, -8, -10}
+
+// trendDays returns measured days of consumption from origin on, following a
+// trend of 20 plus half a beverage per day with fewer beverages at weekends.
+func trendDays(origin time.Time, n int) []*model.DailyConsumption {
+	days := make([]*model.DailyConsumption, n)
+	for i := range days {
+		start := origin.AddDate(0, 0, i)
+		total := 20 + 0.5*float64(i) + weekendDip[(int(start.Weekday())+6)%7]
+		days[i] = &model.DailyConsumption{
+			StartTime:      start,
+			EndTime:        start.AddDate(0, 0, 1),
+			TotalBeverages: total,
+			Beverages:      []*model.BeverageConsumption{{BeverageName: "Latte", Count: total / 4}, {BeverageName: "Espresso", Count: total * 3 / 4}},
+			Confidence:     1,
+		}
+	}
+	return days
+}
+
+func TestFitForecastModel(t *testing.T) {
+	copenhagen, err := time.LoadLocation("Europe/Copenhagen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Four weeks from a Monday, across the start of summer time
+	origin := time.Date(2025, 3, 17, 0, 0, 0, 0, copenhagen)
+	days := trendDays(origin, 28)
+	// Estimated days are left out of the fit
+	days = append(days, &model.DailyConsumption{StartTime: origin.AddDate(0, 0, 28), TotalBeverages: 500, Confidence: 0.5})
+
+	m, err := fitForecastModel(days, origin, copenhagen)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if m.n != 28 || math.Abs(m.slope-0.5) > 1e-6 || m.sigma > 1e-6 {
+		t.Errorf("got %d days, slope %g and deviation %g, want 28 days following the trend", m.n, m.slope, m.sigma)
+	}
+
+	// The trend and weekday effects continue into the following weeks
+	for i := 28; i < 42; i++ {
+		day := origin.AddDate(0, 0, i)
+		want := 20 + 0.5*float64(i) + weekendDip[(int(day.Weekday())+6)%7]
+		mean, lower, upper := m.predict(day)
+		if math.Abs(mean-want) > 1e-6 || math.Abs(lower-want) > 1e-6 || math.Abs(upper-want) > 1e-6 {
+			t.Errorf("%s: got %g (%g to %g), want %g", day.Format(time.DateOnly), mean, lower, upper, want)
+		}
+	}
+
+	// Half of the first day after the data, which is a Monday
+	if mean, _ := m.predictBetween(origin.AddDate(0, 0, 28).Add(12*time.Hour), origin.AddDate(0, 0, 29)); math.Abs(mean-17) > 1e-6 {
+		t.Errorf("got %g for half a day, want 17", mean)
+	}
+
+	ingredient := Ingredient{Name: "Milk", Usage: map[string]float64{"Latte": 200}}
+	if got := m.usagePerBeverage(ingredient); math.Abs(got-50) > 1e-6 {
+		t.Errorf("got %g ml of milk per beverage, want 50", got)
+	}
+}
+
+func TestFitForecastModelUncertainty(t *testing.T) {
+	origin := time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC)
+	days := trendDays(origin, 28)
+	for i, day := range days {
+		day.TotalBeverages += float64(i%2*4 - 2) // alternately 2 more and fewer
+	}
+
+	m, err := fitForecastModel(days, origin, time.UTC)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Predictions further from the data are less certain
+	_, nearLower, nearUpper := m.predict(origin.AddDate(0, 0, 28))
+	_, farLower, farUpper := m.predict(origin.AddDate(0, 0, 56))
+	if nearUpper-nearLower <= 0 || farUpper-farLower <= nearUpper-nearLower {
+		t.Errorf("got intervals of %g and %g, want a wider interval further ahead", nearUpper-nearLower, farUpper-farLower)
+	}
+}
+
+func TestFitForecastModelNeedsMeasuredDays(t *testing.T) {
+	origin := time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC)
+	days := trendDays(origin, 10)
+	for _, day := range days[minFittedDays-1:] {
+		day.Confidence = minFittedConfidence / 2
+	}
+	if _, err := fitForecastModel(days, origin, time.UTC); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestThresholdReached(t *testing.T) {
+	origin := time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC)
+	days := make([]*model.ForecastDay, 3)
+	for i := range days {
+		start := origin.AddDate(0, 0, i)
+		days[i] = &model.ForecastDay{StartTime: start, EndTime: start.AddDate(0, 0, 1), TotalBeverages: 10}
+	}
+	total := func(day *model.ForecastDay) float64 { return day.TotalBeverages }
+	noon := origin.Add(12 * time.Hour)
+
+	tests := []struct {
+		name  string
+		level float64
+		now   time.Time
+		want  *time.Time
+	}{
+		{name: "already below", level: 5, now: noon, want: &noon},
+		// 10 g are used in the rest of the first day, then 20 g per day
+		{name: "during the day", level: 18, now: noon, want: ptr(noon.Add(9*time.Hour + 36*time.Minute))},
+		{name: "on a later day", level: 25, now: noon, want: ptr(origin.AddDate(0, 0, 1).Add(6 * time.Hour))},
+		{name: "from the start of the forecast", level: 30, now: origin, want: ptr(origin.Add(24 * time.Hour))},
+		{name: "after the forecast", level: 100, now: noon},
+		{name: "days before now are skipped", level: 18, now: origin.AddDate(0, 0, 2), want: ptr(origin.AddDate(0, 0, 2).Add(9*time.Hour + 36*time.Minute))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := thresholdReached(tt.level, 10, 2, tt.now, days, total)
+			if (got == nil) != (tt.want == nil) || (got != nil && !got.Equal(*tt.want)) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package graph
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// healthPingTimeout limits how long the health check waits for the database.
+const healthPingTimeout = 2 * time.Second
+
+// healthStatus is the response of the health endpoint.
+type healthStatus struct {
+	Status   string         `json:"status"`
+	Database databaseHealth `json:"database"`
+}
+
+type databaseHealth struct {
+	Status          string `json:"status"`
+	OpenConnections int    `json:"openConnections"`
+	InUse           int    `json:"inUse"`
+	Idle            int    `json:"idle"`
+}
+
+// HealthHandler reports whether the service is ready to serve requests, which
+// is the case when the database responds. It responds with 200 when ready and
+// 503 otherwise, along with the state of the connection pool. Why the database
+// is unavailable is logged rather than exposed, as the driver error may reveal
+// hosts and users.
+func HealthHandler(db *sql.DB) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), healthPingTimeout)
+		defer cancel()
+
+		stats := db.Stats()
+		status := healthStatus{
+			Status: "ok",
+			Database: databaseHealth{
+				Status:          "ok",
+				OpenConnections: stats.OpenConnections,
+				InUse:           stats.InUse,
+				Idle:            stats.Idle,
+			},
+		}
+		code := http.StatusOK
+		if err := db.PingContext(ctx); err != nil {
+			status.Status = "unavailable"
+			status.Database.Status = "unavailable"
+			log.Printf("Health check: database unavailable: %v", err)
+			code = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(status)
+	})
+}
@@ -0,0 +1,351 @@
+package graph
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/LarsDepuydt/masterthesis-api-aggregation/service-coffee/graph/model"
+	"github.com/lib/pq"
+)
+
+// loaderWait is how long a loader collects keys before fetching them. The
+// resolvers of the items of a list run concurrently, so they all request their
+// key within this time.
+const loaderWait = 2 * time.Millisecond
+
+// maxLoaderBatch limits the number of keys fetched in a single query.
+const maxLoaderBatch = 1000
+
+// batchLoader collects the keys requested by concurrently running resolvers
+// and fetches them with a single call. Results are kept for the rest of the
+// request, so every key is fetched once.
+type batchLoader[K comparable, V any] struct {
+	ctx   context.Context
+	fetch func(ctx context.Context, keys []K) (map[K]V, error)
+
+	mu      sync.Mutex
+	pending *loaderBatch[K, V]
+	batches map[K]*loaderBatch[K, V]
+}
+
+// loaderBatch is a set of keys fetched together.
+type loaderBatch[K comparable, V any] struct {
+	keys    []K
+	done    chan struct{}
+	results map[K]V
+	err     error
+}
+
+func newBatchLoader[K comparable, V any](ctx context.Context, fetch func(ctx context.Context, keys []K) (map[K]V, error)) *batchLoader[K, V] {
+	return &batchLoader[K, V]{ctx: ctx, fetch: fetch, batches: make(map[K]*loaderBatch[K, V])}
+}
+
+// Load returns the value for key, or the zero value if the fetch returned
+// none, once the batch containing the key has been fetched.
+func (l *batchLoader[K, V]) Load(ctx context.Context, key K) (V, error) {
+	l.mu.Lock()
+	batch, ok := l.batches[key]
+	if !ok {
+		if l.pending == nil || len(l.pending.keys) >= maxLoaderBatch {
+			l.pending = &loaderBatch[K, V]{done: make(chan struct{})}
+			pending := l.pending
+			time.AfterFunc(loaderWait, func() { l.dispatch(pending) })
+		}
+		batch = l.pending
+		batch.keys = append(batch.keys, key)
+		l.batches[key] = batch
+	}
+	l.mu.Unlock()
+
+	select {
+	case <-batch.done:
+		return batch.results[key], batch.err
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+}
+
+// dispatch fetches a batch, after which no more keys are added to it.
+func (l *batchLoader[K, V]) dispatch(batch *loaderBatch[K, V]) {
+	l.mu.Lock()
+	if l.pending == batch {
+		l.pending = nil
+	}
+	l.mu.Unlock()
+
+	batch.results, batch.err = l.fetch(l.ctx, batch.keys)
+	close(batch.done)
+}
+
+// loaderFor returns the loader for a set of field arguments from loaders,
+// creating it with newLoader if it does not exist yet.
+func loaderFor[A comparable, L any](mu *sync.Mutex, loaders map[A]L, args A, newLoader func() L) L {
+	mu.Lock()
+	defer mu.Unlock()
+	loader, ok := loaders[args]
+	if !ok {
+		loader = newLoader()
+		loaders[args] = loader
+	}
+	return loader
+}
+
+// timeWindow identifies the optional bounds of a time window, for use as a
+// map key.
+type timeWindow struct {
+	start, end string
+}
+
+func newTimeWindow(start, end *time.Time) timeWindow {
+	format := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return strconv.FormatInt(t.UnixNano(), 10)
+	}
+	return timeWindow{format(start), format(end)}
+}
+
+// consumptionArgs identifies the arguments of a consumption field.
+type consumptionArgs struct {
+	start, end int64
+	interval   model.ConsumptionInterval
+	timezone   string
+}
+
+// dailyConsumptionArgs identifies the arguments of a daily consumption field.
+type dailyConsumptionArgs struct {
+	start, end int64
+	timezone   string
+	weighting  model.ConsumptionWeighting
+}
+
+// forecastArgs identifies the arguments of a forecast field.
+type forecastArgs struct {
+	days, historyDays int
+	timezone          string
+}
+
+// Loaders batches the database queries of the resolvers of one request.
+type Loaders struct {
+	ctx context.Context
+	db  *sql.DB
+
+	MachinesByID    *batchLoader[string, *model.BeverageMachine]
+	MachinesByFloor *batchLoader[string, []*model.BeverageMachine]
+	MachinesByRoom  *batchLoader[string, []*model.BeverageMachine]
+
+	mu          sync.Mutex
+	counts      map[timeWindow]*batchLoader[string, []*model.BeverageCount]
+	details     map[timeWindow]*batchLoader[string, []*model.BeverageDetail]
+	consumption map[consumptionArgs]*batchLoader[string, []*model.ConsumptionPeriod]
+	daily       map[dailyConsumptionArgs]*batchLoader[placedMachine, []*model.DailyConsumption]
+	forecasts   map[forecastArgs]*batchLoader[placedMachine, forecastResult]
+}
+
+// NewLoaders creates the loaders for a request. Batches are fetched with ctx,
+// as they are shared by the resolvers of the request.
+func NewLoaders(ctx context.Context, db *sql.DB) *Loaders {
+	l := &Loaders{
+		ctx:         ctx,
+		db:          db,
+		counts:      make(map[timeWindow]*batchLoader[string, []*model.BeverageCount]),
+		details:     make(map[timeWindow]*batchLoader[string, []*model.BeverageDetail]),
+		consumption: make(map[consumptionArgs]*batchLoader[string, []*model.ConsumptionPeriod]),
+		daily:       make(map[dailyConsumptionArgs]*batchLoader[placedMachine, []*model.DailyConsumption]),
+		forecasts:   make(map[forecastArgs]*batchLoader[placedMachine, forecastResult]),
+	}
+	l.MachinesByID = newBatchLoader(ctx, func(ctx context.Context, ids []string) (map[string]*model.BeverageMachine, error) {
+		machines, err := l.machinesWhere(ctx, "machine_id", ids)
+		if err != nil {
+			return nil, err
+		}
+		byID := make(map[string]*model.BeverageMachine, len(machines))
+		for _, machine := range machines {
+			byID[machine.ID] = machine
+		}
+		return byID, nil
+	})
+	l.MachinesByFloor = newBatchLoader(ctx, func(ctx context.Context, floorIDs []string) (map[string][]*model.BeverageMachine, error) {
+		machines, err := l.machinesWhere(ctx, "floor_id", floorIDs)
+		if err != nil {
+			return nil, err
+		}
+		byFloor := make(map[string][]*model.BeverageMachine)
+		for _, machine := range machines {
+			byFloor[machine.Floor.ID] = append(byFloor[machine.Floor.ID], machine)
+		}
+		return byFloor, nil
+	})
+	l.MachinesByRoom = newBatchLoader(ctx, func(ctx context.Context, roomIDs []string) (map[string][]*model.BeverageMachine, error) {
+		machines, err := l.machinesWhere(ctx, "room_id", roomIDs)
+		if err != nil {
+			return nil, err
+		}
+		byRoom := make(map[string][]*model.BeverageMachine)
+		for _, machine := range machines {
+			byRoom[machine.Room.ID] = append(byRoom[machine.Room.ID], machine)
+		}
+		return byRoom, nil
+	})
+	return l
+}
+
+// machinesWhere fetches the machines of which column matches one of values.
+func (l *Loaders) machinesWhere(ctx context.Context, column string, values []string) ([]*model.BeverageMachine, error) {
+	rows, err := l.db.QueryContext(ctx, `
+		SELECT `+machineColumns+`
+		FROM machines
+		WHERE `+column+` = ANY($1)
+		ORDER BY machine_id
+	`, pq.Array(values))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching machines: %w", err)
+	}
+	machines, err := scanMachines(rows)
+	if err != nil {
+		return nil, fmt.Errorf("error scanning machine: %w", err)
+	}
+	return machines, nil
+}
+
+// BeverageCounts returns the loader of the cumulative total counts of machines
+// within a time window.
+func (l *Loaders) BeverageCounts(startTime, endTime *time.Time) *batchLoader[string, []*model.BeverageCount] {
+	return loaderFor(&l.mu, l.counts, newTimeWindow(startTime, endTime), func() *batchLoader[string, []*model.BeverageCount] {
+		return newBatchLoader(l.ctx, func(ctx context.Context, machineIDs []string) (map[string][]*model.BeverageCount, error) {
+			query, args := windowQuery(`SELECT machine_id, id, total_beverages, timestamp FROM beverage_counts`, machineIDs, startTime, endTime)
+			rows, err := l.db.QueryContext(ctx, query, args...)
+			if err != nil {
+				return nil, fmt.Errorf("database error fetching beverage counts: %w", err)
+			}
+			defer rows.Close()
+
+			counts := make(map[string][]*model.BeverageCount)
+			for rows.Next() {
+				var bc model.BeverageCount
+				var machineID string
+				var id int64 // Scan DB id into int64 first
+				if err := rows.Scan(&machineID, &id, &bc.TotalBeverages, &bc.Timestamp); err != nil {
+					return nil, fmt.Errorf("database error scanning beverage count row: %w", err)
+				}
+				bc.ID = strconv.FormatInt(id, 10) // Convert id to string for GraphQL model
+				counts[machineID] = append(counts[machineID], &bc)
+			}
+			if err := rows.Err(); err != nil {
+				return nil, fmt.Errorf("database error iterating beverage counts: %w", err)
+			}
+			return counts, nil
+		})
+	})
+}
+
+// BeverageDetails returns the loader of the cumulative per-beverage counts of
+// machines within a time window.
+func (l *Loaders) BeverageDetails(startTime, endTime *time.Time) *batchLoader[string, []*model.BeverageDetail] {
+	return loaderFor(&l.mu, l.details, newTimeWindow(startTime, endTime), func() *batchLoader[string, []*model.BeverageDetail] {
+		return newBatchLoader(l.ctx, func(ctx context.Context, machineIDs []string) (map[string][]*model.BeverageDetail, error) {
+			query, args := windowQuery(`SELECT machine_id, id, beverage_name, count, timestamp FROM beverage_details`, machineIDs, startTime, endTime)
+			rows, err := l.db.QueryContext(ctx, query, args...)
+			if err != nil {
+				return nil, fmt.Errorf("database error fetching beverage details: %w", err)
+			}
+			defer rows.Close()
+
+			details := make(map[string][]*model.BeverageDetail)
+			for rows.Next() {
+				var bd model.BeverageDetail
+				var machineID string
+				var id int64 // Scan DB id into int64
+				if err := rows.Scan(&machineID, &id, &bd.BeverageName, &bd.Count, &bd.Timestamp); err != nil {
+					return nil, fmt.Errorf("database error scanning beverage detail row: %w", err)
+				}
+				bd.ID = strconv.FormatInt(id, 10) // Convert id to string
+				details[machineID] = append(details[machineID], &bd)
+			}
+			if err := rows.Err(); err != nil {
+				return nil, fmt.Errorf("database error iterating beverage details: %w", err)
+			}
+			return details, nil
+		})
+	})
+}
+
+// windowQuery completes a query of readings to select those of the given
+// machines within a time window, newest first.
+func windowQuery(query string, machineIDs []string, startTime, endTime *time.Time) (string, []interface{}) {
+	query += ` WHERE machine_id = ANY($1) AND timestamp >= $2`
+	args := []interface{}{pq.Array(machineIDs), startTime}
+	if endTime != nil {
+		query += ` AND timestamp <= $3`
+		args = append(args, *endTime)
+	}
+	return query + ` ORDER BY machine_id, timestamp DESC`, args
+}
+
+// Consumption returns the loader of the consumption of machines per period.
+func (l *Loaders) Consumption(startTime, endTime time.Time, interval model.ConsumptionInterval, loc *time.Location) *batchLoader[string, []*model.ConsumptionPeriod] {
+	args := consumptionArgs{startTime.UnixNano(), endTime.UnixNano(), interval, loc.String()}
+	return loaderFor(&l.mu, l.consumption, args, func() *batchLoader[string, []*model.ConsumptionPeriod] {
+		return newBatchLoader(l.ctx, func(ctx context.Context, machineIDs []string) (map[string][]*model.ConsumptionPeriod, error) {
+			periods := make(map[string][]*model.ConsumptionPeriod, len(machineIDs))
+			for _, machineID := range machineIDs {
+				machinePeriods, err := consumptionPeriods(startTime, endTime, interval, loc)
+				if err != nil {
+					return nil, err
+				}
+				periods[machineID] = machinePeriods
+			}
+			if err := machinesConsumption(ctx, l.db, periods); err != nil {
+				return nil, err
+			}
+			return periods, nil
+		})
+	})
+}
+
+// DailyConsumption returns the loader of the estimated consumption of machines
+// per day.
+func (l *Loaders) DailyConsumption(startTime, endTime time.Time, loc *time.Location, weighting model.ConsumptionWeighting, weekdays WeekdayWeights) *batchLoader[placedMachine, []*model.DailyConsumption] {
+	args := dailyConsumptionArgs{startTime.UnixNano(), endTime.UnixNano(), loc.String(), weighting}
+	return loaderFor(&l.mu, l.daily, args, func() *batchLoader[placedMachine, []*model.DailyConsumption] {
+		return newBatchLoader(l.ctx, func(ctx context.Context, machines []placedMachine) (map[placedMachine][]*model.DailyConsumption, error) {
+			return machinesDailyConsumption(ctx, l.db, machines, startTime, endTime, loc, weighting, weekdays)
+		})
+	})
+}
+
+// Forecast returns the loader of the forecasts of machines.
+func (l *Loaders) Forecast(days, historyDays int, loc *time.Location, weekdays WeekdayWeights, ingredients []Ingredient) *batchLoader[placedMachine, forecastResult] {
+	args := forecastArgs{days, historyDays, loc.String()}
+	return loaderFor(&l.mu, l.forecasts, args, func() *batchLoader[placedMachine, forecastResult] {
+		return newBatchLoader(l.ctx, func(ctx context.Context, machines []placedMachine) (map[placedMachine]forecastResult, error) {
+			return machinesForecast(ctx, l.db, machines, days, historyDays, loc, weekdays, ingredients)
+		})
+	})
+}
+
+type loadersKey struct{}
+
+// WithLoaders attaches new loaders to the context of every request.
+func (r *Resolver) WithLoaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := context.WithValue(req.Context(), loadersKey{}, NewLoaders(req.Context(), r.DB))
+		next.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
+
+// loadersFor returns the loaders of the request of ctx. Without them, as when
+// resolving outside of an HTTP request, every call gets its own loaders.
+func (r *Resolver) loadersFor(ctx context.Context) *Loaders {
+	if loaders, ok := ctx.Value(loadersKey{}).(*Loaders); ok {
+		return loaders
+	}
+	return NewLoaders(ctx, r.DB)
+}
@@ -0,0 +1,169 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingFetch returns a fetch that maps every key to its length and records
+// the batches it was called with.
+func countingFetch(err error) (func(ctx context.Context, keys []string) (map[string]int, error), func() [][]string) {
+	var mu sync.Mutex
+	var batches [][]string
+	fetch := func(ctx context.Context, keys []string) (map[string]int, error) {
+		mu.Lock()
+		batches = append(batches, append([]string(nil), keys...))
+		mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		results := make(map[string]int, len(keys))
+		for _, key := range keys {
+			if key != "missing" {
+				results[key] = len(key)
+			}
+		}
+		return results, nil
+	}
+	return fetch, func() [][]string {
+		mu.Lock()
+		defer mu.Unlock()
+		return batches
+	}
+}
+
+// loadConcurrently loads every key from its own goroutine, as the resolvers
+// of the items of a list do, and returns the results and errors in order.
+func loadConcurrently(ctx context.Context, loader *batchLoader[string, int], keys []string) ([]int, []error) {
+	results := make([]int, len(keys))
+	errs := make([]error, len(keys))
+	var wg sync.WaitGroup
+	for i, key := range keys {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = loader.Load(ctx, key)
+		}()
+	}
+	wg.Wait()
+	return results, errs
+}
+
+func TestBatchLoader(t *testing.T) {
+	fetch, batches := countingFetch(nil)
+	loader := newBatchLoader(context.Background(), fetch)
+
+	results, errs := loadConcurrently(context.Background(), loader, []string{"a", "bb", "a", "missing"})
+	for i, want := range []int{1, 2, 1, 0} {
+		if errs[i] != nil || results[i] != want {
+			t.Errorf("key %d: got %d, %v, want %d", i, results[i], errs[i], want)
+		}
+	}
+	if got := batches(); len(got) != 1 || len(got[0]) != 3 {
+		t.Fatalf("got batches %v, want the three distinct keys in one", got)
+	}
+
+	// Keys that were loaded before are not fetched again
+	if got, err := loader.Load(context.Background(), "bb"); err != nil || got != 2 {
+		t.Errorf("got %d, %v, want the cached result", got, err)
+	}
+	if got, err := loader.Load(context.Background(), "ccc"); err != nil || got != 3 {
+		t.Errorf("got %d, %v, want 3", got, err)
+	}
+	if got := batches(); len(got) != 2 || len(got[1]) != 1 || got[1][0] != "ccc" {
+		t.Errorf("got batches %v, want only the new key fetched", got)
+	}
+}
+
+func TestBatchLoaderSplitsLargeBatches(t *testing.T) {
+	fetch, batches := countingFetch(nil)
+	loader := newBatchLoader(context.Background(), fetch)
+
+	keys := make([]string, maxLoaderBatch+1)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", i)
+	}
+	_, errs := loadConcurrently(context.Background(), loader, keys)
+	if err := errors.Join(errs...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := batches()
+	total := 0
+	for _, batch := range got {
+		if len(batch) > maxLoaderBatch {
+			t.Errorf("got a batch of %d keys, want at most %d", len(batch), maxLoaderBatch)
+		}
+		total += len(batch)
+	}
+	if len(got) < 2 || total != len(keys) {
+		t.Errorf("got %d batches of %d keys in total, want every key fetched once", len(got), total)
+	}
+}
+
+func TestBatchLoaderErrors(t *testing.T) {
+	fetchErr := errors.New("database unavailable")
+	fetch, _ := countingFetch(fetchErr)
+	loader := newBatchLoader(context.Background(), fetch)
+
+	// Every key of a failed batch gets its error
+	_, errs := loadConcurrently(context.Background(), loader, []string{"a", "b"})
+	for i, err := range errs {
+		if !errors.Is(err, fetchErr) {
+			t.Errorf("key %d: got error %v, want the fetch error", i, err)
+		}
+	}
+
+	// A resolver whose request is cancelled stops waiting for the batch
+	blocked := make(chan struct{})
+	defer close(blocked)
+	slow := newBatchLoader(context.Background(), func(ctx context.Context, keys []string) (map[string]int, error) {
+		<-blocked
+		return nil, nil
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := slow.Load(ctx, "a"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v, want the deadline of the request", err)
+	}
+}
+
+func TestLoaderFor(t *testing.T) {
+	var mu sync.Mutex
+	loaders := make(map[timeWindow]*int)
+	created := 0
+	newLoader := func() *int { created++; return new(int) }
+
+	start := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	sameStart := start.In(time.FixedZone("CET", 3600))
+	first := loaderFor(&mu, loaders, newTimeWindow(&start, nil), newLoader)
+	second := loaderFor(&mu, loaders, newTimeWindow(&sameStart, nil), newLoader)
+	other := loaderFor(&mu, loaders, newTimeWindow(&start, &start), newLoader)
+
+	// The same moment in another time zone shares the loader
+	if first != second || first == other || created != 2 {
+		t.Errorf("got %d loaders, want one per distinct window", created)
+	}
+}
+
+func TestWindowQuery(t *testing.T) {
+	start := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 7)
+
+	query, args := windowQuery("SELECT * FROM beverage_counts", []string{"m1", "m2"}, &start, nil)
+	if strings.Contains(query, "$3") || len(args) != 2 {
+		t.Errorf("got %s with %d arguments, want no upper bound", query, len(args))
+	}
+	query, args = windowQuery("SELECT * FROM beverage_counts", []string{"m1"}, &start, &end)
+	if !strings.Contains(query, "timestamp <= $3") || len(args) != 3 || args[2] != end {
+		t.Errorf("got %s with arguments %v, want the end as third argument", query, args)
+	}
+	if !strings.HasSuffix(query, "ORDER BY machine_id, timestamp DESC") {
+		t.Errorf("got %s, want the newest readings first", query)
+	}
+}
@@ -0,0 +1,99 @@
+package graph
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/LarsDepuydt/masterthesis-api-aggregation/service-coffee/graph/model"
+)
+
+// machineColumns are the columns of the machines table read by scanMachine.
+const machineColumns = `machine_id, machine_name, floor_id, room_id`
+
+// scanMachine reads a machine from a row of machineColumns. The floor and room
+// are returned as references to the entities of the space inventory.
+func scanMachine(row interface{ Scan(dest ...any) error }) (*model.BeverageMachine, error) {
+	var machine model.BeverageMachine
+	var floorID string
+	var roomID sql.NullString
+	if err := row.Scan(&machine.ID, &machine.Name, &floorID, &roomID); err != nil {
+		return nil, err
+	}
+	machine.Floor = &model.Floor{ID: floorID}
+	if roomID.Valid {
+		machine.Room = &model.Room{ID: roomID.String}
+	}
+	return &machine, nil
+}
+
+// scanMachines reads all machines from rows of machineColumns.
+func scanMachines(rows *sql.Rows) ([]*model.BeverageMachine, error) {
+	defer rows.Close()
+
+	machines := []*model.BeverageMachine{}
+	for rows.Next() {
+		machine, err := scanMachine(rows)
+		if err != nil {
+			return nil, err
+		}
+		machines = append(machines, machine)
+	}
+	return machines, rows.Err()
+}
+
+// placeMachine stores the floor and room of a machine. If floorID is nil the
+// floor is kept. Room IDs of the space inventory start with the ID of their
+// floor, so a room on another floor than the machine is rejected.
+func (r *Resolver) placeMachine(ctx context.Context, machineID string, floorID, roomID *string) (*model.BeverageMachine, error) {
+	if floorID != nil && strings.TrimSpace(*floorID) == "" {
+		return nil, fmt.Errorf("floorId must not be empty")
+	}
+	if roomID != nil && strings.TrimSpace(*roomID) == "" {
+		return nil, fmt.Errorf("roomId must not be empty, use null to clear the room")
+	}
+
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	machine, err := scanMachine(tx.QueryRowContext(ctx, `
+		SELECT `+machineColumns+`
+		FROM machines
+		WHERE machine_id = $1
+		FOR UPDATE
+	`, machineID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("unknown machine %s", machineID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database error fetching machine %s: %w", machineID, err)
+	}
+
+	if floorID != nil {
+		machine.Floor = &model.Floor{ID: *floorID}
+	}
+	machine.Room = nil
+	if roomID != nil {
+		if !strings.HasPrefix(*roomID, machine.Floor.ID+"-") {
+			return nil, fmt.Errorf("room %s is not on floor %s of machine %s", *roomID, machine.Floor.ID, machineID)
+		}
+		machine.Room = &model.Room{ID: *roomID}
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE machines
+		SET floor_id = $2, room_id = $3
+		WHERE machine_id = $1
+	`, machineID, machine.Floor.ID, roomID); err != nil {
+		return nil, fmt.Errorf("database error placing machine %s: %w", machineID, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit placement: %w", err)
+	}
+	return machine, nil
+}
@@ -0,0 +1,118 @@
+package graph
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/99designs/gqlgen/client"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+)
+
+// fakeRow is a database row with a machine ID, name, floor ID and room ID.
+type fakeRow []any
+
+func (row fakeRow) Scan(dest ...any) error {
+	if len(dest) != len(row) {
+		return errors.New("wrong number of columns")
+	}
+	for i, value := range row {
+		switch target := dest[i].(type) {
+		case *string:
+			*target = value.(string)
+		case *sql.NullString:
+			if value != nil {
+				*target = sql.NullString{String: value.(string), Valid: true}
+			} else {
+				*target = sql.NullString{}
+			}
+		}
+	}
+	return nil
+}
+
+func TestScanMachine(t *testing.T) {
+	placed, err := scanMachine(fakeRow{"m1", "Kitchen", "TMV25-Stue", "TMV25-Stue-A.001"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if placed.ID != "m1" || placed.Name != "Kitchen" || placed.Floor.ID != "TMV25-Stue" || placed.Room == nil || placed.Room.ID != "TMV25-Stue-A.001" {
+		t.Errorf("got %+v", placed)
+	}
+
+	// Machines that are not placed in a room have no room reference
+	unplaced, err := scanMachine(fakeRow{"m2", "Hallway", "TMV25-Stue", nil})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if unplaced.Floor.ID != "TMV25-Stue" || unplaced.Room != nil {
+		t.Errorf("got floor %+v and room %+v", unplaced.Floor, unplaced.Room)
+	}
+}
+
+func TestPlaceMachineRejectsEmptyIDs(t *testing.T) {
+	empty := " "
+	tests := []struct {
+		name            string
+		floorID, roomID *string
+	}{
+		{name: "empty floor", floorID: &empty},
+		{name: "empty room", roomID: &empty},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The placement is rejected before the database is used
+			if _, err := (&Resolver{}).placeMachine(context.Background(), "m1", tt.floorID, tt.roomID); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestFloorAndRoomReferences(t *testing.T) {
+	// Floors and rooms are resolved from their ID alone, without the database
+	srv := handler.New(NewExecutableSchema(Config{Resolvers: &Resolver{}}))
+	srv.AddTransport(transport.POST{})
+	srv.Use(extension.Introspection{})
+	c := client.New(srv)
+
+	var response struct {
+		Entities []struct {
+			Typename string `json:"__typename"`
+			ID       string
+		} `json:"_entities"`
+		Service struct {
+			SDL string
+		} `json:"_service"`
+	}
+	err := c.Post(`query($representations: [_Any!]!) {
+		_entities(representations: $representations) {
+			__typename
+			... on Floor { id }
+			... on Room { id }
+		}
+		_service { sdl }
+	}`, &response, client.Var("representations", []map[string]any{
+		{"__typename": "Floor", "id": "TMV25-Stue"},
+		{"__typename": "Room", "id": "TMV25-Stue-A.001"},
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(response.Entities) != 2 ||
+		response.Entities[0].Typename != "Floor" || response.Entities[0].ID != "TMV25-Stue" ||
+		response.Entities[1].Typename != "Room" || response.Entities[1].ID != "TMV25-Stue-A.001" {
+		t.Errorf("got entities %+v", response.Entities)
+	}
+	for _, key := range []string{`extend type Floor @key(fields: "id")`, `extend type Room @key(fields: "id")`} {
+		if !strings.Contains(response.Service.SDL, key) {
+			t.Errorf("the schema does not contain %s", key)
+		}
+	}
+}
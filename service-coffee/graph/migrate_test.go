@@ -0,0 +1,77 @@
+package graph
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadEmbeddedMigrations(t *testing.T) {
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no migrations are embedded")
+	}
+	// Versions are numbered without gaps, so a missing file is noticed
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("migration %s has version %d, want %d", m.Name, m.Version, i+1)
+		}
+		if strings.TrimSpace(m.SQL) == "" {
+			t.Errorf("migration %s is empty", m.Name)
+		}
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	file := func(content string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(content)} }
+
+	tests := []struct {
+		name      string
+		files     fstest.MapFS
+		wantNames []string
+		wantErr   bool
+	}{
+		{
+			name: "ordered by version",
+			files: fstest.MapFS{
+				"migrations/10_add_index.sql":      file("CREATE INDEX"),
+				"migrations/2_add_column.sql":      file("ALTER TABLE"),
+				"migrations/0001_create_table.sql": file("CREATE TABLE"),
+				"migrations/README.md":             file("not a migration"),
+			},
+			wantNames: []string{"0001_create_table", "2_add_column", "10_add_index"},
+		},
+		{name: "no migrations", files: fstest.MapFS{}},
+		{name: "without version", files: fstest.MapFS{"migrations/create_table.sql": file("")}, wantErr: true},
+		{name: "without description", files: fstest.MapFS{"migrations/0001.sql": file("")}, wantErr: true},
+		{name: "version zero", files: fstest.MapFS{"migrations/0000_create_table.sql": file("")}, wantErr: true},
+		{
+			name: "duplicate version",
+			files: fstest.MapFS{
+				"migrations/0001_create_table.sql": file(""),
+				"migrations/1_create_other.sql":    file(""),
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrations, err := loadMigrations(tt.files)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if len(migrations) != len(tt.wantNames) {
+				t.Fatalf("got %d migrations, want %d", len(migrations), len(tt.wantNames))
+			}
+			for i, m := range migrations {
+				if m.Name != tt.wantNames[i] {
+					t.Errorf("migration %d: got %s, want %s", i, m.Name, tt.wantNames[i])
+				}
+			}
+		})
+	}
+}
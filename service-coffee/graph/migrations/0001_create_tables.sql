@@ -0,0 +1,23 @@
+-- Tables of the coffee machine data. They are only created if missing, so
+-- databases that were set up by hand are adopted as they are.
+
+CREATE TABLE IF NOT EXISTS machines (
+    machine_id   TEXT PRIMARY KEY,
+    machine_name TEXT NOT NULL,
+    floor_id     TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS beverage_counts (
+    id              BIGSERIAL PRIMARY KEY,
+    machine_id      TEXT NOT NULL REFERENCES machines (machine_id),
+    total_beverages INTEGER NOT NULL,
+    timestamp       TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS beverage_details (
+    id            BIGSERIAL PRIMARY KEY,
+    machine_id    TEXT NOT NULL REFERENCES machines (machine_id),
+    beverage_name TEXT NOT NULL,
+    count         INTEGER NOT NULL,
+    timestamp     TIMESTAMPTZ NOT NULL
+);
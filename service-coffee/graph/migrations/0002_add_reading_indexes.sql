@@ -0,0 +1,13 @@
+-- Readings are always queried per machine within a time window.
+
+CREATE INDEX IF NOT EXISTS beverage_counts_machine_id_timestamp_idx
+    ON beverage_counts (machine_id, timestamp);
+
+CREATE INDEX IF NOT EXISTS beverage_details_machine_id_timestamp_idx
+    ON beverage_details (machine_id, timestamp);
+
+CREATE INDEX IF NOT EXISTS beverage_details_machine_id_beverage_name_timestamp_idx
+    ON beverage_details (machine_id, beverage_name, timestamp);
+
+CREATE INDEX IF NOT EXISTS machines_floor_id_idx
+    ON machines (floor_id);
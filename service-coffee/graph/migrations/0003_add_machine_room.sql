@@ -0,0 +1,6 @@
+-- Machines can be placed in a room of their floor.
+
+ALTER TABLE machines ADD COLUMN IF NOT EXISTS room_id TEXT;
+
+CREATE INDEX IF NOT EXISTS machines_room_id_idx
+    ON machines (room_id);
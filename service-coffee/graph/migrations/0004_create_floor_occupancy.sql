@@ -0,0 +1,8 @@
+-- Daily occupancy of floors, used to weigh consumption estimates.
+
+CREATE TABLE IF NOT EXISTS floor_occupancy (
+    floor_id  TEXT NOT NULL,
+    day       DATE NOT NULL,
+    occupancy DOUBLE PRECISION NOT NULL CHECK (occupancy >= 0),
+    PRIMARY KEY (floor_id, day)
+);
@@ -0,0 +1,12 @@
+-- Refills of the supplies of machines, from which their level is projected.
+
+CREATE TABLE IF NOT EXISTS supply_refills (
+    id         BIGSERIAL PRIMARY KEY,
+    machine_id TEXT NOT NULL REFERENCES machines (machine_id),
+    ingredient TEXT NOT NULL,
+    level      DOUBLE PRECISION NOT NULL CHECK (level >= 0),
+    timestamp  TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS supply_refills_machine_ingredient_idx
+    ON supply_refills (machine_id, ingredient, timestamp);
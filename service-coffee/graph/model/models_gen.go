@@ -3,9 +3,62 @@
 package model
 
 import (
+	"fmt"
+	"io"
+	"strconv"
 	"time"
 )
 
+// Restricts the readings analytic queries are computed from. Both lists must
+// match if both are given.
+type BeverageAnalyticsFilter struct {
+	// Only include these machines.
+	MachineIds []string `json:"machineIds,omitempty"`
+	// Only include machines on these floors.
+	FloorIds []string `json:"floorIds,omitempty"`
+}
+
+// The consumption of a beverage type within two time windows compared.
+type BeverageChange struct {
+	BeverageName string `json:"beverageName"`
+	// The estimated number dispensed within the first window.
+	FirstCount float64 `json:"firstCount"`
+	// The estimated number dispensed within the second window.
+	SecondCount float64 `json:"secondCount"`
+	// The change in the number dispensed from the first to the second window.
+	Change float64 `json:"change"`
+	// The relative change in the number dispensed per day. Null if none was
+	// dispensed within the first window.
+	RelativeChange *float64 `json:"relativeChange,omitempty"`
+	// The fraction, between 0 and 1, of all beverages within the first window.
+	FirstShare float64 `json:"firstShare"`
+	// The fraction, between 0 and 1, of all beverages within the second window.
+	SecondShare float64 `json:"secondShare"`
+}
+
+// The consumption within two time windows compared.
+type BeverageComparison struct {
+	First  *ComparedPeriod `json:"first"`
+	Second *ComparedPeriod `json:"second"`
+	// The change in the number of beverages from the first to the second window.
+	Change float64 `json:"change"`
+	// The relative change in the number of beverages per day, so windows of
+	// different lengths can be compared. Null if nothing was dispensed within the
+	// first window.
+	RelativeChange *float64 `json:"relativeChange,omitempty"`
+	// The comparison per beverage type, ordered by the number dispensed within the
+	// second window.
+	Beverages []*BeverageChange `json:"beverages"`
+}
+
+// The number of beverages of one type dispensed during an interval.
+type BeverageConsumption struct {
+	// The name of the beverage (e.g., 'Coffee', 'Tea', 'Espresso').
+	BeverageName string `json:"beverageName"`
+	// The estimated number of beverages of this type dispensed.
+	Count float64 `json:"count"`
+}
+
 // Represents a data point for the total cumulative beverage count from a machine.
 //
 // Note on Data:
@@ -23,6 +76,14 @@ type BeverageCount struct {
 	Timestamp time.Time `json:"timestamp"`
 }
 
+// The count of a single beverage type in a reading.
+type BeverageCountInput struct {
+	// The name of the beverage (e.g., 'Coffee', 'Tea', 'Espresso').
+	BeverageName string `json:"beverageName"`
+	// The number of beverages of this type dispensed, as shown by the machine.
+	Count int32 `json:"count"`
+}
+
 // Represents a data point for the cumulative count of a specific beverage type
 // from a machine.
 //
@@ -43,6 +104,26 @@ type BeverageDetail struct {
 	Timestamp time.Time `json:"timestamp"`
 }
 
+// A forecast of the consumption of a machine. Daily consumption is modelled as a
+// linear trend plus an effect per weekday, fitted to the days with a confidence
+// of at least 0.9, whose consumption is measured rather than estimated.
+type BeverageForecast struct {
+	// The predicted consumption per day.
+	Days []*ForecastDay `json:"days"`
+	// The number of measured days the model was fitted to.
+	FittedDays int32 `json:"fittedDays"`
+	// The change in daily consumption per day.
+	TrendPerDay float64 `json:"trendPerDay"`
+	// The effect of every weekday on daily consumption, from Monday to Sunday,
+	// in beverages relative to the trend. The effects are not centred, so they
+	// need not sum to zero: the trend plus the effect of a weekday is its
+	// predicted consumption, and only differences between weekdays are
+	// meaningful on their own.
+	WeekdayEffects []float64 `json:"weekdayEffects"`
+	// The projected supply levels of the machine.
+	Supplies []*SupplyProjection `json:"supplies"`
+}
+
 // Represents a beverage dispensing machine.
 //
 // Note on Data Collection:
@@ -55,6 +136,11 @@ type BeverageMachine struct {
 	ID string `json:"id"`
 	// The name or identifier of the beverage machine.
 	Name string `json:"name"`
+	// The floor the machine is located on.
+	Floor *Floor `json:"floor"`
+	// The room the machine is placed in. Null when the placement within the
+	// floor has not been recorded.
+	Room *Room `json:"room,omitempty"`
 	// Retrieves cumulative total beverage counts for this machine within a
 	// specified time window.
 	//
@@ -71,10 +157,161 @@ type BeverageMachine struct {
 	// cumulative count for a specific beverage type up to the timestamp of
 	// that data point.
 	BeverageDetails []*BeverageDetail `json:"beverageDetails"`
+	// Retrieves the number of beverages dispensed by this machine per interval,
+	// overall and per beverage type, computed from the cumulative counts.
+	//
+	// As the counts are read manually, the beverages dispensed between two
+	// readings are spread evenly over the time between them. Intervals are
+	// therefore estimates, and may contain fractions of beverages. A count
+	// lower than the previous one is taken as a counter reset, e.g. after a
+	// machine was replaced, and the lower count as the number of beverages
+	// dispensed since.
+	Consumption []*ConsumptionPeriod `json:"consumption"`
+	// Estimates the number of beverages dispensed per day. Readings are taken
+	// every few days or weeks, so the consumption between two readings is
+	// distributed over the days between them by a weighting profile. Days are
+	// flagged as estimated unless their consumption was measured by readings
+	// within the day.
+	DailyConsumption []*DailyConsumption `json:"dailyConsumption"`
+	// Forecasts the number of beverages dispensed per day, starting today, from a
+	// trend and weekday profile fitted to the measured daily consumption. Also
+	// projects when the configured supplies reach their restock threshold.
+	Forecast *BeverageForecast `json:"forecast"`
 }
 
 func (BeverageMachine) IsEntity() {}
 
+// The consumption during a weekday, or an hour of a weekday, within the window
+// of a profile.
+type BeverageProfileBucket struct {
+	// The machine the bucket belongs to, if a profile per machine was requested.
+	Machine *BeverageMachine `json:"machine,omitempty"`
+	// The ISO weekday, from 1 (Monday) to 7 (Sunday).
+	Weekday int32 `json:"weekday"`
+	// The hour of the day, from 0 to 23. Null for profiles per weekday.
+	Hour *int32 `json:"hour,omitempty"`
+	// The number of times the weekday or hour occurs within the window.
+	Occurrences int32 `json:"occurrences"`
+	// The estimated number of beverages dispensed during all occurrences.
+	Total float64 `json:"total"`
+	// The estimated number of beverages dispensed per occurrence.
+	Average float64 `json:"average"`
+	// The fraction, between 0 and 1, of the beverages of the profile dispensed
+	// during this bucket.
+	Share float64 `json:"share"`
+}
+
+// The position of a beverage type in a ranking.
+type BeverageRank struct {
+	// The position in the ranking, starting at 1. Beverage types dispensed equally
+	// often share a rank.
+	Rank int32 `json:"rank"`
+	// The name of the beverage.
+	BeverageName string `json:"beverageName"`
+	// The estimated number dispensed within the window.
+	Count float64 `json:"count"`
+	// The fraction, between 0 and 1, of all beverages dispensed within the window.
+	Share float64 `json:"share"`
+}
+
+// A reading stored for a beverage machine.
+type BeverageReading struct {
+	// The ID of the machine that was read.
+	MachineID string `json:"machineId"`
+	// The stored total count.
+	TotalBeverages *BeverageCount `json:"totalBeverages"`
+	// The stored counts per beverage type.
+	Beverages []*BeverageDetail `json:"beverages"`
+}
+
+// The result of importing readings from a CSV file.
+type BeverageReadingImport struct {
+	// Whether the file was only validated, without storing the readings.
+	DryRun bool `json:"dryRun"`
+	// The number of readings in the file.
+	ReadingCount int32 `json:"readingCount"`
+	// The number of readings stored. Zero if the file contains errors, as
+	// readings are only stored if all of them are valid.
+	ImportedCount int32 `json:"importedCount"`
+	// The problems found, ordered by row.
+	Errors []*ImportError `json:"errors"`
+}
+
+// A manual reading of the counters of a beverage machine.
+type BeverageReadingInput struct {
+	// The ID of the machine that was read.
+	MachineID string `json:"machineId"`
+	// The time the counters were read.
+	Timestamp time.Time `json:"timestamp"`
+	// The total number of beverages dispensed, as shown by the machine.
+	TotalBeverages int32 `json:"totalBeverages"`
+	// The number of beverages dispensed per beverage type. If provided, the
+	// counts must add up to the total.
+	Beverages []*BeverageCountInput `json:"beverages,omitempty"`
+	// Set if the counters were reset since the previous reading, e.g. because
+	// the machine was replaced. Counts lower than those of the previous reading
+	// are rejected otherwise.
+	Reset *bool `json:"reset,omitempty"`
+}
+
+// One of the windows of a comparison.
+type ComparedPeriod struct {
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime"`
+	// The estimated number of beverages dispensed.
+	Total float64 `json:"total"`
+	// The estimated number of beverages dispensed per day.
+	DailyAverage float64 `json:"dailyAverage"`
+}
+
+// The number of beverages dispensed by a machine during an interval.
+type ConsumptionPeriod struct {
+	// The start of the interval.
+	StartTime time.Time `json:"startTime"`
+	// The end of the interval.
+	EndTime time.Time `json:"endTime"`
+	// The estimated number of beverages dispensed during the interval.
+	TotalBeverages float64 `json:"totalBeverages"`
+	// The estimated number of beverages dispensed during the interval, per
+	// beverage type.
+	Beverages []*BeverageConsumption `json:"beverages"`
+	// The fraction of the interval, between 0 and 1, that lies between two
+	// readings of the total count. Time before the first or after the last
+	// reading is not covered, so consumption during it is unknown.
+	Coverage float64 `json:"coverage"`
+	// The number of counter resets detected between the readings covering the
+	// interval.
+	CounterResets int32 `json:"counterResets"`
+}
+
+// The estimated number of beverages dispensed by a machine on a day.
+type DailyConsumption struct {
+	// The day in the requested time zone, as YYYY-MM-DD.
+	Date string `json:"date"`
+	// The start of the day.
+	StartTime time.Time `json:"startTime"`
+	// The end of the day.
+	EndTime time.Time `json:"endTime"`
+	// The estimated number of beverages dispensed during the day.
+	TotalBeverages float64 `json:"totalBeverages"`
+	// The estimated number of beverages dispensed during the day, per beverage
+	// type.
+	Beverages []*BeverageConsumption `json:"beverages"`
+	// Whether the consumption is estimated, rather than measured by readings at
+	// the start and end of the day.
+	Estimated bool `json:"estimated"`
+	// How much of the day's consumption is measured, between 0 and 1. The share
+	// of a day in the time between two readings counts as measured in proportion
+	// to how much of that time lies within the day, so one reading a week gives
+	// about 1/7.
+	Confidence float64 `json:"confidence"`
+	// The fraction of the day, between 0 and 1, that lies between two readings.
+	// Consumption before the first or after the last reading is unknown.
+	Coverage float64 `json:"coverage"`
+	// The weighting the consumption of the day was distributed by.
+	Weighting ConsumptionWeighting `json:"weighting"`
+}
+
 type Floor struct {
 	ID string `json:"id"`
 	// The total cumulative number of beverages dispensed by the machine
@@ -84,6 +321,258 @@ type Floor struct {
 
 func (Floor) IsEntity() {}
 
+// The beverages dispensed by the machines on a floor within a time window.
+type FloorBeverageTotal struct {
+	Floor *Floor `json:"floor"`
+	// The estimated number of beverages dispensed.
+	Total float64 `json:"total"`
+	// The fraction, between 0 and 1, of all beverages dispensed within the window.
+	Share float64 `json:"share"`
+	// The estimated number dispensed per beverage type, most popular first.
+	Beverages []*BeverageConsumption `json:"beverages"`
+}
+
+// The result of importing the occupancy of floors.
+type FloorOccupancyImport struct {
+	// Whether the file was only validated, without storing the occupancy.
+	DryRun bool `json:"dryRun"`
+	// The number of days of occupancy in the file.
+	RowCount int32 `json:"rowCount"`
+	// The number of days of occupancy stored. Zero if the file contains errors.
+	ImportedCount int32 `json:"importedCount"`
+	// The problems found, ordered by row.
+	Errors []*ImportError `json:"errors"`
+}
+
+// The predicted consumption of a machine on a day.
+type ForecastDay struct {
+	// The day in the requested time zone, as YYYY-MM-DD.
+	Date      string    `json:"date"`
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime"`
+	// The predicted number of beverages.
+	TotalBeverages float64 `json:"totalBeverages"`
+	// The lower bound of the 95% prediction interval.
+	Lower float64 `json:"lower"`
+	// The upper bound of the 95% prediction interval.
+	Upper float64 `json:"upper"`
+	// The predicted number per beverage type, by its share of the history.
+	Beverages []*BeverageConsumption `json:"beverages"`
+}
+
+// A problem with a row of an imported CSV file.
+type ImportError struct {
+	// The line number of the row in the file, the header being line 1. Zero for
+	// problems concerning the whole file.
+	Row int32 `json:"row"`
+	// A description of the problem.
+	Message string `json:"message"`
+}
+
+// The beverages dispensed by a machine within a time window.
+type MachineBeverageTotal struct {
+	Machine *BeverageMachine `json:"machine"`
+	// The estimated number of beverages dispensed.
+	Total float64 `json:"total"`
+	// The fraction, between 0 and 1, of all beverages dispensed within the window.
+	Share float64 `json:"share"`
+	// The estimated number dispensed per beverage type, most popular first.
+	Beverages []*BeverageConsumption `json:"beverages"`
+}
+
+// Provides the root fields for recording beverage machine data.
+type Mutation struct {
+}
+
 // Provides the root fields for querying beverage machine data.
 type Query struct {
 }
+
+type Room struct {
+	ID string `json:"id"`
+	// The beverage machines placed in this room.
+	BeverageMachines []*BeverageMachine `json:"beverageMachines"`
+}
+
+func (Room) IsEntity() {}
+
+// The projected level of a supply of a machine, such as beans or milk.
+type SupplyProjection struct {
+	// The name of the ingredient, as configured.
+	Ingredient string `json:"ingredient"`
+	// The unit the ingredient is measured in (e.g., 'g', 'ml').
+	Unit string `json:"unit"`
+	// The level at which the supply should be restocked.
+	Threshold float64 `json:"threshold"`
+	// The last recorded refill. Null if none was recorded, in which case the
+	// level is unknown.
+	LastRefill *SupplyRefill `json:"lastRefill,omitempty"`
+	// The estimated level now, from the level at the last refill minus the usage
+	// of the beverages dispensed since.
+	Level *float64 `json:"level,omitempty"`
+	// The predicted usage per day during the forecast.
+	DailyUsage float64 `json:"dailyUsage"`
+	// When the level is predicted to reach the threshold. Null if this is not
+	// within the forecast, or the level is unknown.
+	ThresholdReachedAt *time.Time `json:"thresholdReachedAt,omitempty"`
+	// When the level reaches the threshold at the upper bound of the predicted
+	// consumption, so at the earliest.
+	ThresholdReachedEarliest *time.Time `json:"thresholdReachedEarliest,omitempty"`
+}
+
+// A recorded refill of a supply of a machine.
+type SupplyRefill struct {
+	ID         string `json:"id"`
+	MachineID  string `json:"machineId"`
+	Ingredient string `json:"ingredient"`
+	// The level of the supply after the refill.
+	Level     float64   `json:"level"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// A time window, from its start up to its end.
+type TimeWindow struct {
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime"`
+}
+
+// The buckets a consumption profile is made of.
+type BeverageProfileGranularity string
+
+const (
+	// One bucket per weekday.
+	BeverageProfileGranularityWeekday BeverageProfileGranularity = "WEEKDAY"
+	// One bucket per hour of every weekday.
+	BeverageProfileGranularityHourOfWeek BeverageProfileGranularity = "HOUR_OF_WEEK"
+)
+
+var AllBeverageProfileGranularity = []BeverageProfileGranularity{
+	BeverageProfileGranularityWeekday,
+	BeverageProfileGranularityHourOfWeek,
+}
+
+func (e BeverageProfileGranularity) IsValid() bool {
+	switch e {
+	case BeverageProfileGranularityWeekday, BeverageProfileGranularityHourOfWeek:
+		return true
+	}
+	return false
+}
+
+func (e BeverageProfileGranularity) String() string {
+	return string(e)
+}
+
+func (e *BeverageProfileGranularity) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = BeverageProfileGranularity(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid BeverageProfileGranularity", str)
+	}
+	return nil
+}
+
+func (e BeverageProfileGranularity) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+// The length of the intervals consumption is reported for. Intervals start at
+// the beginning of the hour, day, week (Monday) or month in the requested time
+// zone.
+type ConsumptionInterval string
+
+const (
+	ConsumptionIntervalHour  ConsumptionInterval = "HOUR"
+	ConsumptionIntervalDay   ConsumptionInterval = "DAY"
+	ConsumptionIntervalWeek  ConsumptionInterval = "WEEK"
+	ConsumptionIntervalMonth ConsumptionInterval = "MONTH"
+)
+
+var AllConsumptionInterval = []ConsumptionInterval{
+	ConsumptionIntervalHour,
+	ConsumptionIntervalDay,
+	ConsumptionIntervalWeek,
+	ConsumptionIntervalMonth,
+}
+
+func (e ConsumptionInterval) IsValid() bool {
+	switch e {
+	case ConsumptionIntervalHour, ConsumptionIntervalDay, ConsumptionIntervalWeek, ConsumptionIntervalMonth:
+		return true
+	}
+	return false
+}
+
+func (e ConsumptionInterval) String() string {
+	return string(e)
+}
+
+func (e *ConsumptionInterval) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ConsumptionInterval(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ConsumptionInterval", str)
+	}
+	return nil
+}
+
+func (e ConsumptionInterval) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+// How the consumption between two readings is distributed over the days between
+// them.
+type ConsumptionWeighting string
+
+const (
+	// Evenly over time.
+	ConsumptionWeightingEven ConsumptionWeighting = "EVEN"
+	// By the configured activity per weekday, so e.g. weekends receive less.
+	ConsumptionWeightingWeekday ConsumptionWeighting = "WEEKDAY"
+	// By the uploaded occupancy of the machine's floor. Days without occupancy
+	// data are weighted by the weekday activity, scaled to the occupancy.
+	ConsumptionWeightingOccupancy ConsumptionWeighting = "OCCUPANCY"
+)
+
+var AllConsumptionWeighting = []ConsumptionWeighting{
+	ConsumptionWeightingEven,
+	ConsumptionWeightingWeekday,
+	ConsumptionWeightingOccupancy,
+}
+
+func (e ConsumptionWeighting) IsValid() bool {
+	switch e {
+	case ConsumptionWeightingEven, ConsumptionWeightingWeekday, ConsumptionWeightingOccupancy:
+		return true
+	}
+	return false
+}
+
+func (e ConsumptionWeighting) String() string {
+	return string(e)
+}
+
+func (e *ConsumptionWeighting) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ConsumptionWeighting(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ConsumptionWeighting", str)
+	}
+	return nil
+}
+
+func (e ConsumptionWeighting) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
@@ -0,0 +1,350 @@
+package graph
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LarsDepuydt/masterthesis-api-aggregation/service-coffee/graph/model"
+)
+
+// Columns of a readings CSV file. All other columns hold beverage counts.
+const (
+	readingColumnMachine   = "machineId"
+	readingColumnTimestamp = "timestamp"
+	readingColumnTotal     = "totalBeverages"
+	readingColumnReset     = "reset"
+)
+
+// beverageReading is a manual reading of the counters of a machine.
+type beverageReading struct {
+	MachineID string
+	Timestamp time.Time
+	Total     int32
+	Beverages []*model.BeverageCountInput
+	Reset     bool
+	Row       int // line in the imported file, 0 if not imported
+}
+
+// newBeverageReading converts a reading input into a reading.
+func newBeverageReading(input model.BeverageReadingInput) *beverageReading {
+	reading := &beverageReading{
+		MachineID: input.MachineID,
+		Timestamp: input.Timestamp,
+		Total:     input.TotalBeverages,
+		Beverages: input.Beverages,
+	}
+	if input.Reset != nil {
+		reading.Reset = *input.Reset
+	}
+	return reading
+}
+
+// validate checks a reading on its own, without comparing it to others.
+func (reading *beverageReading) validate() error {
+	if strings.TrimSpace(reading.MachineID) == "" {
+		return fmt.Errorf("machine ID must not be empty")
+	}
+	if reading.Timestamp.IsZero() {
+		return fmt.Errorf("timestamp must be set")
+	}
+	if reading.Timestamp.After(time.Now().Add(time.Minute)) {
+		return fmt.Errorf("timestamp %s lies in the future", reading.Timestamp.Format(time.RFC3339))
+	}
+	if reading.Total < 0 {
+		return fmt.Errorf("total beverages must not be negative, got %d", reading.Total)
+	}
+	if len(reading.Beverages) == 0 {
+		return nil
+	}
+
+	var sum int32
+	seen := make(map[string]bool)
+	for _, beverage := range reading.Beverages {
+		name := strings.TrimSpace(beverage.BeverageName)
+		if name == "" {
+			return fmt.Errorf("beverage name must not be empty")
+		}
+		beverage.BeverageName = name
+		if seen[strings.ToLower(name)] {
+			return fmt.Errorf("beverage %q is listed twice", name)
+		}
+		seen[strings.ToLower(name)] = true
+		if beverage.Count < 0 {
+			return fmt.Errorf("count of %q must not be negative, got %d", name, beverage.Count)
+		}
+		sum += beverage.Count
+	}
+	if sum != reading.Total {
+		return fmt.Errorf("the beverage counts add up to %d, but the total is %d", sum, reading.Total)
+	}
+	return nil
+}
+
+// checkCounter validates a count against the counts of the readings right
+// before and after it. A count may only be lower than the previous one if the
+// counters were reset, and may not be higher than the next one unless the
+// stored readings already show a reset there.
+func checkCounter(ctx context.Context, tx *sql.Tx, table, column, filter string, args []any, timestamp time.Time, count int32, reset bool, label string) error {
+	adjacent := func(comparison, order string) (*int32, error) {
+		query := fmt.Sprintf(`SELECT %s FROM %s WHERE %s AND timestamp %s $%d ORDER BY timestamp %s LIMIT 1`,
+			column, table, filter, comparison, len(args)+1, order)
+		var value int32
+		err := tx.QueryRowContext(ctx, query, append(args, timestamp)...).Scan(&value)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("database error reading adjacent %s: %w", table, err)
+		}
+		return &value, nil
+	}
+
+	previous, err := adjacent("<", "DESC")
+	if err != nil {
+		return err
+	}
+	next, err := adjacent(">", "ASC")
+	if err != nil {
+		return err
+	}
+
+	if previous != nil && count < *previous && !reset {
+		return fmt.Errorf("%s of %d is lower than the %d of the previous reading; mark the reading as a reset if the counters were reset", label, count, *previous)
+	}
+	if next != nil && count > *next && (previous == nil || *next >= *previous) {
+		return fmt.Errorf("%s of %d is higher than the %d of the next reading", label, count, *next)
+	}
+	return nil
+}
+
+// insertReading validates a reading against the stored readings of its
+// machine and stores it within tx.
+func insertReading(ctx context.Context, tx *sql.Tx, reading *beverageReading) (*model.BeverageReading, error) {
+	if err := reading.validate(); err != nil {
+		return nil, err
+	}
+
+	// Lock the machine, so concurrent readings of it are validated in turn
+	var machineID string
+	err := tx.QueryRowContext(ctx, `SELECT machine_id FROM machines WHERE machine_id = $1 FOR UPDATE`, reading.MachineID).Scan(&machineID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("unknown machine %s", reading.MachineID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database error locking machine: %w", err)
+	}
+
+	var exists bool
+	if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM beverage_counts WHERE machine_id = $1 AND timestamp = $2)`,
+		reading.MachineID, reading.Timestamp).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("database error checking for existing readings: %w", err)
+	}
+	if exists {
+		return nil, fmt.Errorf("machine %s already has a reading at %s", reading.MachineID, reading.Timestamp.Format(time.RFC3339))
+	}
+
+	if err := checkCounter(ctx, tx, "beverage_counts", "total_beverages", "machine_id = $1", []any{reading.MachineID},
+		reading.Timestamp, reading.Total, reading.Reset, "total"); err != nil {
+		return nil, err
+	}
+	for _, beverage := range reading.Beverages {
+		if err := checkCounter(ctx, tx, "beverage_details", "count", "machine_id = $1 AND beverage_name = $2", []any{reading.MachineID, beverage.BeverageName},
+			reading.Timestamp, beverage.Count, reading.Reset, fmt.Sprintf("count of %q", beverage.BeverageName)); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &model.BeverageReading{
+		MachineID:      reading.MachineID,
+		TotalBeverages: &model.BeverageCount{TotalBeverages: reading.Total, Timestamp: reading.Timestamp},
+		Beverages:      []*model.BeverageDetail{},
+	}
+	var id int64
+	if err := tx.QueryRowContext(ctx, `INSERT INTO beverage_counts (machine_id, total_beverages, timestamp) VALUES ($1, $2, $3) RETURNING id`,
+		reading.MachineID, reading.Total, reading.Timestamp).Scan(&id); err != nil {
+		return nil, fmt.Errorf("database error storing total count: %w", err)
+	}
+	result.TotalBeverages.ID = strconv.FormatInt(id, 10)
+
+	for _, beverage := range reading.Beverages {
+		if err := tx.QueryRowContext(ctx, `INSERT INTO beverage_details (machine_id, beverage_name, count, timestamp) VALUES ($1, $2, $3, $4) RETURNING id`,
+			reading.MachineID, beverage.BeverageName, beverage.Count, reading.Timestamp).Scan(&id); err != nil {
+			return nil, fmt.Errorf("database error storing count of %q: %w", beverage.BeverageName, err)
+		}
+		result.Beverages = append(result.Beverages, &model.BeverageDetail{
+			ID:           strconv.FormatInt(id, 10),
+			BeverageName: beverage.BeverageName,
+			Count:        beverage.Count,
+			Timestamp:    reading.Timestamp,
+		})
+	}
+	return result, nil
+}
+
+// recordReading validates and stores a single reading in one transaction.
+func (r *Resolver) recordReading(ctx context.Context, reading *beverageReading) (*model.BeverageReading, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("database error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := insertReading(ctx, tx, reading)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("database error committing reading: %w", err)
+	}
+	log.Printf("Recorded reading of machine %s at %s: %d beverages", reading.MachineID, reading.Timestamp.Format(time.RFC3339), reading.Total)
+	return result, nil
+}
+
+// ImportBeverageReadings validates the readings in a CSV file and, unless
+// dryRun is set, stores them in a single transaction if all are valid.
+func (r *Resolver) ImportBeverageReadings(ctx context.Context, file io.Reader, dryRun bool) (*model.BeverageReadingImport, error) {
+	result := &model.BeverageReadingImport{DryRun: dryRun, Errors: []*model.ImportError{}}
+	addError := func(row int, format string, args ...any) {
+		result.Errors = append(result.Errors, &model.ImportError{Row: int32(row), Message: fmt.Sprintf(format, args...)})
+	}
+
+	readings, err := parseReadingsCSV(file, addError)
+	if err != nil {
+		addError(0, "%v", err)
+		return result, nil
+	}
+	result.ReadingCount = int32(len(readings))
+
+	// Validate every machine's readings in chronological order, so each is
+	// compared with the readings imported before it
+	sort.SliceStable(readings, func(i, j int) bool {
+		if readings[i].MachineID != readings[j].MachineID {
+			return readings[i].MachineID < readings[j].MachineID
+		}
+		return readings[i].Timestamp.Before(readings[j].Timestamp)
+	})
+
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("database error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for i, reading := range readings {
+		// A failed statement aborts a Postgres transaction, so every reading
+		// is stored within a savepoint that is rolled back on errors
+		savepoint := fmt.Sprintf("reading_%d", i)
+		if _, err := tx.ExecContext(ctx, "SAVEPOINT "+savepoint); err != nil {
+			return nil, fmt.Errorf("database error creating savepoint: %w", err)
+		}
+		if _, err := insertReading(ctx, tx, reading); err != nil {
+			addError(reading.Row, "%v", err)
+			if _, err := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+savepoint); err != nil {
+				return nil, fmt.Errorf("database error rolling back savepoint: %w", err)
+			}
+		}
+	}
+
+	sort.SliceStable(result.Errors, func(i, j int) bool { return result.Errors[i].Row < result.Errors[j].Row })
+	if len(result.Errors) > 0 || dryRun {
+		return result, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("database error committing readings: %w", err)
+	}
+	result.ImportedCount = result.ReadingCount
+	log.Printf("Imported %d beverage readings", result.ImportedCount)
+	return result, nil
+}
+
+// parseReadingsCSV reads the readings from a CSV file. Rows that cannot be
+// parsed are reported through addError and skipped.
+func parseReadingsCSV(file io.Reader, addError func(row int, format string, args ...any)) ([]*beverageReading, error) {
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1 // Rows with a wrong number of fields are reported below
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("error reading CSV file: %w", err)
+	}
+	if len(records) < 1 {
+		return nil, fmt.Errorf("file is empty")
+	}
+
+	header := records[0]
+	columns := make(map[string]int)
+	var beverageColumns []int
+	for i, column := range header {
+		column = strings.TrimSpace(column)
+		switch column {
+		case readingColumnMachine, readingColumnTimestamp, readingColumnTotal, readingColumnReset:
+			columns[column] = i
+		default:
+			if column != "" {
+				beverageColumns = append(beverageColumns, i)
+			}
+		}
+	}
+	for _, column := range []string{readingColumnMachine, readingColumnTimestamp, readingColumnTotal} {
+		if _, ok := columns[column]; !ok {
+			return nil, fmt.Errorf("required column %q is missing", column)
+		}
+	}
+
+	var readings []*beverageReading
+	for i, row := range records[1:] {
+		line := i + 2
+		if len(row) != len(header) {
+			addError(line, "row has %d fields, expected %d", len(row), len(header))
+			continue
+		}
+
+		reading := &beverageReading{MachineID: strings.TrimSpace(row[columns[readingColumnMachine]]), Row: line}
+		if reading.Timestamp, err = time.Parse(time.RFC3339, strings.TrimSpace(row[columns[readingColumnTimestamp]])); err != nil {
+			addError(line, "invalid timestamp %q, expected RFC 3339 (e.g., 2025-03-01T09:30:00+01:00)", row[columns[readingColumnTimestamp]])
+			continue
+		}
+		total, err := strconv.ParseInt(strings.TrimSpace(row[columns[readingColumnTotal]]), 10, 32)
+		if err != nil {
+			addError(line, "invalid total %q", row[columns[readingColumnTotal]])
+			continue
+		}
+		reading.Total = int32(total)
+		if idx, ok := columns[readingColumnReset]; ok && strings.TrimSpace(row[idx]) != "" {
+			if reading.Reset, err = strconv.ParseBool(strings.TrimSpace(row[idx])); err != nil {
+				addError(line, "invalid reset flag %q", row[idx])
+				continue
+			}
+		}
+
+		valid := true
+		for _, idx := range beverageColumns {
+			raw := strings.TrimSpace(row[idx])
+			if raw == "" {
+				continue // Beverage not read
+			}
+			count, err := strconv.ParseInt(raw, 10, 32)
+			if err != nil {
+				addError(line, "invalid count %q for %q", raw, header[idx])
+				valid = false
+				break
+			}
+			reading.Beverages = append(reading.Beverages, &model.BeverageCountInput{
+				BeverageName: strings.TrimSpace(header[idx]),
+				Count:        int32(count),
+			})
+		}
+		if valid {
+			readings = append(readings, reading)
+		}
+	}
+	return readings, nil
+}
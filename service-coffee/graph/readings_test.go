@@ -0,0 +1,120 @@
+package graph
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LarsDepuydt/masterthesis-api-aggregation/service-coffee/graph/model"
+)
+
+func TestValidateReading(t *testing.T) {
+	timestamp := time.Date(2025, 3, 3, 9, 30, 0, 0, time.UTC)
+	beverages := func(counts ...any) []*model.BeverageCountInput {
+		var result []*model.BeverageCountInput
+		for i := 0; i < len(counts); i += 2 {
+			result = append(result, &model.BeverageCountInput{BeverageName: counts[i].(string), Count: int32(counts[i+1].(int))})
+		}
+		return result
+	}
+
+	tests := []struct {
+		name    string
+		reading beverageReading
+		wantErr string // empty if valid
+	}{
+		{name: "total only", reading: beverageReading{MachineID: "m1", Timestamp: timestamp, Total: 12}},
+		{name: "beverages adding up", reading: beverageReading{MachineID: "m1", Timestamp: timestamp, Total: 12, Beverages: beverages(" Espresso ", 5, "Latte", 7)}},
+		{name: "without machine", reading: beverageReading{MachineID: " ", Timestamp: timestamp}, wantErr: "machine ID"},
+		{name: "without timestamp", reading: beverageReading{MachineID: "m1"}, wantErr: "timestamp must be set"},
+		{name: "in the future", reading: beverageReading{MachineID: "m1", Timestamp: time.Now().Add(time.Hour)}, wantErr: "lies in the future"},
+		{name: "negative total", reading: beverageReading{MachineID: "m1", Timestamp: timestamp, Total: -1}, wantErr: "must not be negative"},
+		{name: "unnamed beverage", reading: beverageReading{MachineID: "m1", Timestamp: timestamp, Total: 1, Beverages: beverages(" ", 1)}, wantErr: "beverage name"},
+		{name: "beverage listed twice", reading: beverageReading{MachineID: "m1", Timestamp: timestamp, Total: 2, Beverages: beverages("Latte", 1, "latte", 1)}, wantErr: "listed twice"},
+		{name: "negative count", reading: beverageReading{MachineID: "m1", Timestamp: timestamp, Total: 0, Beverages: beverages("Latte", -1, "Mocha", 1)}, wantErr: "must not be negative"},
+		{name: "counts not adding up", reading: beverageReading{MachineID: "m1", Timestamp: timestamp, Total: 10, Beverages: beverages("Latte", 4)}, wantErr: "add up to 4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.reading.validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				for _, beverage := range tt.reading.Beverages {
+					if beverage.BeverageName != strings.TrimSpace(beverage.BeverageName) {
+						t.Errorf("beverage name %q was not trimmed", beverage.BeverageName)
+					}
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseReadingsCSV(t *testing.T) {
+	file := "machineId,timestamp,totalBeverages,Espresso,Latte,reset\n" +
+		"m1,2025-03-01T09:30:00+01:00,12,5,7,\n" +
+		"m1,2025-03-02T09:30:00+01:00,3,,3,true\n" +
+		"m2,yesterday,1,1,,\n" +
+		"m2,2025-03-01T09:30:00Z,many,,,\n" +
+		"m2,2025-03-01T09:30:00Z,1,one,,\n" +
+		"m2,2025-03-01T09:30:00Z,1,1,,maybe\n" +
+		"m2,2025-03-01T09:30:00Z\n"
+
+	var errorRows []int
+	readings, err := parseReadingsCSV(strings.NewReader(file), func(row int, format string, args ...any) {
+		errorRows = append(errorRows, row)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []int{4, 5, 6, 7, 8}; !slices.Equal(errorRows, want) {
+		t.Errorf("got errors on rows %v, want %v", errorRows, want)
+	}
+	if len(readings) != 2 {
+		t.Fatalf("got %d readings, want 2", len(readings))
+	}
+
+	first, second := readings[0], readings[1]
+	if first.MachineID != "m1" || first.Row != 2 || first.Total != 12 || first.Reset || len(first.Beverages) != 2 {
+		t.Errorf("got first reading %+v", first)
+	}
+	if !first.Timestamp.Equal(time.Date(2025, 3, 1, 8, 30, 0, 0, time.UTC)) {
+		t.Errorf("got timestamp %s", first.Timestamp)
+	}
+	// Empty counts are beverages that were not read
+	if !second.Reset || len(second.Beverages) != 1 || second.Beverages[0].BeverageName != "Latte" || second.Beverages[0].Count != 3 {
+		t.Errorf("got second reading %+v", second)
+	}
+}
+
+func TestImportBeverageReadingsReportsUnreadableFiles(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+	}{
+		{name: "empty file", file: ""},
+		{name: "missing column", file: "machineId,timestamp,Espresso\nm1,2025-03-01T09:30:00Z,1\n"},
+		{name: "malformed CSV", file: "machineId,timestamp,totalBeverages\n\"m1,2025-03-01T09:30:00Z,1\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The file is rejected before the database is used
+			result, err := (&Resolver{}).ImportBeverageReadings(context.Background(), strings.NewReader(tt.file), false)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(result.Errors) != 1 || result.Errors[0].Row != 0 || result.ImportedCount != 0 {
+				t.Errorf("got %+v, want a single error for the whole file", result)
+			}
+		})
+	}
+}
@@ -3,12 +3,8 @@ package graph
 //go:generate go run github.com/99designs/gqlgen generate
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
-	"log"
-	"os"
-
-	_ "github.com/lib/pq"
 )
 
 // This file will not be regenerated automatically.
@@ -17,28 +13,22 @@ import (
 
 type Resolver struct {
 	DB *sql.DB
+	// WeekdayWeights distribute consumption between readings over weekdays.
+	// DefaultWeekdayWeights are used if none are set.
+	WeekdayWeights WeekdayWeights
+	// Ingredients are the supplies projected by forecasts.
+	Ingredients []Ingredient
 }
 
-// ConnectDB establishes a database connection using environment variables.
-func (r *Resolver) initCofeeDBConnection() error {
-	host := os.Getenv("COFFEE_DB_HOST")
-	dbname := os.Getenv("COFFEE_DB_NAME")
-	user := os.Getenv("COFFEE_DB_USER")
-	password := os.Getenv("COFFEE_DB_PASSWORD")
-	port := os.Getenv("COFFEE_DB_PORT")
-
-	connStr := fmt.Sprintf("host=%s port=%s dbname=%s user=%s password=%s sslmode=disable", host, port, dbname, user, password)
-
-	db, err := sql.Open("postgres", connStr)
-	if err != nil {
-		return fmt.Errorf("failed to connect to database: %w", err)
-	}
+// MigrateDB applies the schema migrations that have not been applied yet.
+func (r *Resolver) MigrateDB(ctx context.Context) error {
+	return migrate(ctx, r.DB)
+}
 
-	if err := db.Ping(); err != nil {
-		return fmt.Errorf("failed to ping database: %w", err)
+// weekdayWeights returns the configured weekday weights, or the defaults.
+func (r *Resolver) weekdayWeights() WeekdayWeights {
+	if r.WeekdayWeights == (WeekdayWeights{}) {
+		return DefaultWeekdayWeights
 	}
-
-	r.DB = db
-	log.Println("Successfully connected to the database")
-	return nil
+	return r.WeekdayWeights
 }
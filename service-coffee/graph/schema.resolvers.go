@@ -8,11 +8,11 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"strconv"
-	"strings"
 	"time"
 
+	"github.com/99designs/gqlgen/graphql"
 	"github.com/LarsDepuydt/masterthesis-api-aggregation/service-coffee/graph/model"
+	"github.com/lib/pq"
 )
 
 // BeverageCounts is the resolver for the beverageCounts field.
@@ -21,46 +21,10 @@ func (r *beverageMachineResolver) BeverageCounts(ctx context.Context, obj *model
 		return nil, fmt.Errorf("cannot fetch beverage counts for a nil machine")
 	}
 
-	log.Printf("Resolving BeverageCounts for Machine ID: %s, Start: %v, End: %v", obj.ID, startTime, endTime)
-
-	// Base query for counts
-	query := `SELECT id, total_beverages, timestamp FROM beverage_counts WHERE machine_id = $1 AND timestamp >= $2`
-	args := []interface{}{obj.ID, startTime}
-	paramIdx := 3 // Start next parameter at $3
-
-	// Add endTime condition if provided
-	if endTime != nil {
-		query += fmt.Sprintf(" AND timestamp <= $%d", paramIdx)
-		args = append(args, *endTime)
-		paramIdx++
-	}
-
-	query += " ORDER BY timestamp DESC"
-
-	rows, err := r.DB.QueryContext(ctx, query, args...)
+	counts, err := r.loadersFor(ctx).BeverageCounts(startTime, endTime).Load(ctx, obj.ID)
 	if err != nil {
 		log.Printf("Error querying beverage counts for machine %s: %v", obj.ID, err)
-		// Return empty list on error? Or the error? Depending on desired behaviour.
-		// Returning error might be better for debugging.
-		return nil, fmt.Errorf("database error fetching beverage counts: %w", err)
-	}
-	defer rows.Close()
-
-	var counts []*model.BeverageCount
-	for rows.Next() {
-		var bc model.BeverageCount
-		var id int64 // Scan DB id into int64 first
-		if err := rows.Scan(&id, &bc.TotalBeverages, &bc.Timestamp); err != nil {
-			log.Printf("Error scanning beverage count row for machine %s: %v", obj.ID, err)
-			return nil, fmt.Errorf("database error scanning beverage count row: %w", err)
-		}
-		bc.ID = strconv.FormatInt(id, 10) // Convert id to string for GraphQL model
-		counts = append(counts, &bc)
-	}
-
-	if err := rows.Err(); err != nil {
-		log.Printf("Error iterating beverage count rows for machine %s: %v", obj.ID, err)
-		return nil, fmt.Errorf("database error iterating beverage counts: %w", err)
+		return nil, err
 	}
 
 	// Return empty slice if no results, not nil, as per GraphQL non-null list [BeverageCount!]!
@@ -77,135 +41,264 @@ func (r *beverageMachineResolver) BeverageDetails(ctx context.Context, obj *mode
 		return nil, fmt.Errorf("cannot fetch beverage details for a nil machine")
 	}
 
-	// Base query for details
-	query := `SELECT id, beverage_name, count, timestamp FROM beverage_details WHERE machine_id = $1 AND timestamp >= $2`
-	args := []interface{}{obj.ID, startTime}
-	paramIdx := 3 // Start next parameter at $3
+	details, err := r.loadersFor(ctx).BeverageDetails(startTime, endTime).Load(ctx, obj.ID)
+	if err != nil {
+		log.Printf("Error querying beverage details for machine %s: %v", obj.ID, err)
+		return nil, err
+	}
 
-	// Add endTime condition if provided
-	if endTime != nil {
-		query += fmt.Sprintf(" AND timestamp <= $%d", paramIdx)
-		args = append(args, *endTime)
-		paramIdx++
+	// Return empty slice if no results, not nil, as per GraphQL non-null list [BeverageDetail!]!
+	if details == nil {
+		details = []*model.BeverageDetail{}
 	}
 
-	query += " ORDER BY timestamp DESC" // Or ASC
+	return details, nil
+}
 
-	rows, err := r.DB.QueryContext(ctx, query, args...)
+// Consumption is the resolver for the consumption field.
+func (r *beverageMachineResolver) Consumption(ctx context.Context, obj *model.BeverageMachine, startTime time.Time, endTime time.Time, interval model.ConsumptionInterval, timezone *string) ([]*model.ConsumptionPeriod, error) {
+	if obj == nil {
+		return nil, fmt.Errorf("cannot fetch consumption for a nil machine")
+	}
+
+	loc, err := parseTimezone(timezone)
 	if err != nil {
-		log.Printf("Error querying beverage details for machine %s: %v", obj.ID, err)
-		return nil, fmt.Errorf("database error fetching beverage details: %w", err)
+		return nil, err
 	}
-	defer rows.Close()
 
-	var details []*model.BeverageDetail
-	for rows.Next() {
-		var bd model.BeverageDetail
-		var id int64 // Scan DB id into int64
-		if err := rows.Scan(&id, &bd.BeverageName, &bd.Count, &bd.Timestamp); err != nil {
-			log.Printf("Error scanning beverage detail row for machine %s: %v", obj.ID, err)
-			return nil, fmt.Errorf("database error scanning beverage detail row: %w", err)
-		}
-		bd.ID = strconv.FormatInt(id, 10) // Convert id to string
-		details = append(details, &bd)
+	// Validate the window before it is batched with other machines
+	if _, err := consumptionPeriods(startTime, endTime, interval, loc); err != nil {
+		return nil, err
+	}
+	periods, err := r.loadersFor(ctx).Consumption(startTime, endTime, interval, loc).Load(ctx, obj.ID)
+	if err != nil {
+		log.Printf("Error computing consumption for machine %s: %v", obj.ID, err)
+		return nil, err
 	}
+	return periods, nil
+}
 
-	if err := rows.Err(); err != nil {
-		log.Printf("Error iterating beverage detail rows for machine %s: %v", obj.ID, err)
-		return nil, fmt.Errorf("database error iterating beverage details: %w", err)
+// DailyConsumption is the resolver for the dailyConsumption field.
+func (r *beverageMachineResolver) DailyConsumption(ctx context.Context, obj *model.BeverageMachine, startTime time.Time, endTime time.Time, weighting *model.ConsumptionWeighting, timezone *string) ([]*model.DailyConsumption, error) {
+	if obj == nil {
+		return nil, fmt.Errorf("cannot fetch daily consumption for a nil machine")
 	}
 
-	// Return empty slice if no results, not nil, as per GraphQL non-null list [BeverageDetail!]!
-	if details == nil {
-		details = []*model.BeverageDetail{}
+	loc, err := parseTimezone(timezone)
+	if err != nil {
+		return nil, err
+	}
+	if !startTime.Before(endTime) {
+		return nil, fmt.Errorf("startTime must be before endTime")
+	}
+	if weighting == nil {
+		defaultWeighting := model.ConsumptionWeightingWeekday
+		weighting = &defaultWeighting
 	}
 
-	return details, nil
+	machine := placedMachine{machineID: obj.ID}
+	if obj.Floor != nil {
+		machine.floorID = obj.Floor.ID
+	}
+	days, err := r.loadersFor(ctx).DailyConsumption(startTime, endTime, loc, *weighting, r.weekdayWeights()).Load(ctx, machine)
+	if err != nil {
+		log.Printf("Error estimating daily consumption for machine %s: %v", obj.ID, err)
+		return nil, err
+	}
+	return days, nil
 }
 
-// BeverageMachines is the resolver for the beverageMachines field.
-func (r *floorResolver) BeverageMachines(ctx context.Context, obj *model.Floor) ([]*model.BeverageMachine, error) {
-	if r.DB == nil {
-		if err := r.initCofeeDBConnection(); err != nil {
-			log.Printf("PostgreSQL init error in Floor.Machines resolver: %v", err)
-			return nil, err
-		}
+// Forecast is the resolver for the forecast field.
+func (r *beverageMachineResolver) Forecast(ctx context.Context, obj *model.BeverageMachine, days int32, historyDays *int32, timezone *string) (*model.BeverageForecast, error) {
+	if obj == nil {
+		return nil, fmt.Errorf("cannot forecast a nil machine")
+	}
+	if days < 1 || days > maxForecastDays {
+		return nil, fmt.Errorf("days must be between 1 and %d", maxForecastDays)
+	}
+	history := int32(56)
+	if historyDays != nil {
+		history = *historyDays
+	}
+	if history < minFittedDays {
+		return nil, fmt.Errorf("historyDays must be at least %d", minFittedDays)
 	}
 
-	query := `
-			SELECT machine_id, machine_name
-			FROM machines
-			WHERE floor_id = $1
-		`
-	rows, err := r.DB.QueryContext(ctx, query, obj.ID)
+	loc, err := parseTimezone(timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	machine := placedMachine{machineID: obj.ID}
+	if obj.Floor != nil {
+		machine.floorID = obj.Floor.ID
+	}
+	result, err := r.loadersFor(ctx).Forecast(int(days), int(history), loc, r.weekdayWeights(), r.Ingredients).Load(ctx, machine)
+	if err == nil {
+		err = result.err
+	}
+	if err != nil {
+		log.Printf("Error forecasting machine %s: %v", obj.ID, err)
+		return nil, err
+	}
+	return result.forecast, nil
+}
+
+// BeverageMachines is the resolver for the beverageMachines field.
+func (r *floorResolver) BeverageMachines(ctx context.Context, obj *model.Floor) ([]*model.BeverageMachine, error) {
+	machines, err := r.loadersFor(ctx).MachinesByFloor.Load(ctx, obj.ID)
 	if err != nil {
 		log.Printf("Error querying machines for floor %s: %v", obj.ID, err)
 		return nil, fmt.Errorf("error fetching machines for floor: %w", err)
 	}
-	defer rows.Close()
+	if machines == nil {
+		machines = []*model.BeverageMachine{}
+	}
+	return machines, nil
+}
 
-	var machines []*model.BeverageMachine
-	for rows.Next() {
-		var m model.BeverageMachine
-		if err := rows.Scan(&m.ID, &m.Name); err != nil {
-			log.Printf("Error scanning machine for floor %s: %v", obj.ID, err)
-			return nil, fmt.Errorf("error scanning machine: %w", err)
-		}
-		machines = append(machines, &m)
+// RecordBeverageReading is the resolver for the recordBeverageReading field.
+func (r *mutationResolver) RecordBeverageReading(ctx context.Context, input model.BeverageReadingInput) (*model.BeverageReading, error) {
+	reading, err := r.recordReading(ctx, newBeverageReading(input))
+	if err != nil {
+		log.Printf("Rejected reading of machine %s: %v", input.MachineID, err)
+		return nil, err
 	}
+	return reading, nil
+}
 
-	return machines, nil
+// ImportBeverageReadings is the resolver for the importBeverageReadings field.
+func (r *mutationResolver) ImportBeverageReadings(ctx context.Context, file graphql.Upload, dryRun *bool) (*model.BeverageReadingImport, error) {
+	result, err := r.Resolver.ImportBeverageReadings(ctx, file.File, dryRun != nil && *dryRun)
+	if err != nil {
+		log.Printf("Error importing beverage readings from %s: %v", file.Filename, err)
+		return nil, err
+	}
+	return result, nil
 }
 
-// BeverageMachines is the resolver for the beverageMachines field.
-func (r *queryResolver) BeverageMachines(ctx context.Context, machineIDs []string) ([]*model.BeverageMachine, error) {
-	// Ensure DB is initialized
-	if r.DB == nil {
-		if err := r.initCofeeDBConnection(); err != nil {
-			log.Printf("PostgreSQL initialization error: %v", err)
-			return nil, err
-		}
+// PlaceBeverageMachine is the resolver for the placeBeverageMachine field.
+func (r *mutationResolver) PlaceBeverageMachine(ctx context.Context, machineID string, floorID *string, roomID *string) (*model.BeverageMachine, error) {
+	machine, err := r.placeMachine(ctx, machineID, floorID, roomID)
+	if err != nil {
+		log.Printf("Error placing machine %s: %v", machineID, err)
+		return nil, err
 	}
+	return machine, nil
+}
 
+// ImportFloorOccupancy is the resolver for the importFloorOccupancy field.
+func (r *mutationResolver) ImportFloorOccupancy(ctx context.Context, file graphql.Upload, dryRun *bool) (*model.FloorOccupancyImport, error) {
+	result, err := r.Resolver.ImportFloorOccupancy(ctx, file.File, dryRun != nil && *dryRun)
+	if err != nil {
+		log.Printf("Error importing floor occupancy from %s: %v", file.Filename, err)
+		return nil, err
+	}
+	return result, nil
+}
+
+// RecordSupplyRefill is the resolver for the recordSupplyRefill field.
+func (r *mutationResolver) RecordSupplyRefill(ctx context.Context, machineID string, ingredient string, level float64, timestamp *time.Time) (*model.SupplyRefill, error) {
+	refill, err := r.recordSupplyRefill(ctx, machineID, ingredient, level, timestamp)
+	if err != nil {
+		log.Printf("Rejected refill of machine %s: %v", machineID, err)
+		return nil, err
+	}
+	return refill, nil
+}
+
+// BeverageMachines is the resolver for the beverageMachines field.
+func (r *queryResolver) BeverageMachines(ctx context.Context, machineIDs []string) ([]*model.BeverageMachine, error) {
 	query := `
-			SELECT machine_id, machine_name, floor_id
+			SELECT ` + machineColumns + `
 			FROM machines
 		`
 	var args []interface{}
 	if len(machineIDs) > 0 {
-		placeholders := make([]string, len(machineIDs))
-		for i, id := range machineIDs {
-			placeholders[i] = "$" + strconv.Itoa(i+1)
-			args = append(args, id)
-		}
-		query += fmt.Sprintf(" WHERE machine_id IN (%s)", strings.Join(placeholders, ", "))
+		query += " WHERE machine_id = ANY($1)"
+		args = append(args, pq.Array(machineIDs))
 	}
+	query += " ORDER BY machine_id"
 
 	rows, err := r.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		log.Printf("Error querying machines: %v", err)
 		return nil, fmt.Errorf("error fetching machines: %w", err)
 	}
-	defer rows.Close()
+	machines, err := scanMachines(rows)
+	if err != nil {
+		log.Printf("Error scanning machine rows: %v", err)
+		return nil, fmt.Errorf("error scanning machine: %w", err)
+	}
+	return machines, nil
+}
+
+// BeverageRanking is the resolver for the beverageRanking field.
+func (r *queryResolver) BeverageRanking(ctx context.Context, startTime time.Time, endTime time.Time, filter *model.BeverageAnalyticsFilter, limit *int32) ([]*model.BeverageRank, error) {
+	ranking, err := r.beverageRanking(ctx, model.TimeWindow{StartTime: startTime, EndTime: endTime}, filter, limit)
+	if err != nil {
+		log.Printf("Error ranking beverages: %v", err)
+		return nil, err
+	}
+	return ranking, nil
+}
+
+// MachineBeverageTotals is the resolver for the machineBeverageTotals field.
+func (r *queryResolver) MachineBeverageTotals(ctx context.Context, startTime time.Time, endTime time.Time, filter *model.BeverageAnalyticsFilter) ([]*model.MachineBeverageTotal, error) {
+	totals, err := r.machineBeverageTotals(ctx, model.TimeWindow{StartTime: startTime, EndTime: endTime}, filter)
+	if err != nil {
+		log.Printf("Error summing beverages per machine: %v", err)
+		return nil, err
+	}
+	return totals, nil
+}
 
-	var machines []*model.BeverageMachine
-	for rows.Next() {
-		var machine model.BeverageMachine
-		var floorID string // Temporary variable to hold floor_id
-		if err := rows.Scan(&machine.ID, &machine.Name, &floorID); err != nil {
-			log.Printf("Error scanning machine row: %v", err)
-			return nil, fmt.Errorf("error scanning machine: %w", err)
-		}
-		// We don't directly set machine.FloorID as it shouldn't be a GraphQL field.
-		// The floorID is implicitly available within the 'machine' variable for federation.
-		machines = append(machines, &machine)
+// FloorBeverageTotals is the resolver for the floorBeverageTotals field.
+func (r *queryResolver) FloorBeverageTotals(ctx context.Context, startTime time.Time, endTime time.Time, filter *model.BeverageAnalyticsFilter) ([]*model.FloorBeverageTotal, error) {
+	totals, err := r.floorBeverageTotals(ctx, model.TimeWindow{StartTime: startTime, EndTime: endTime}, filter)
+	if err != nil {
+		log.Printf("Error summing beverages per floor: %v", err)
+		return nil, err
 	}
+	return totals, nil
+}
 
-	if err := rows.Err(); err != nil {
-		log.Printf("Error iterating over machine rows: %v", err)
-		return nil, fmt.Errorf("error iterating machines: %w", err)
+// BeverageProfile is the resolver for the beverageProfile field.
+func (r *queryResolver) BeverageProfile(ctx context.Context, startTime time.Time, endTime time.Time, granularity model.BeverageProfileGranularity, timezone *string, filter *model.BeverageAnalyticsFilter, perMachine *bool) ([]*model.BeverageProfileBucket, error) {
+	loc, err := parseTimezone(timezone)
+	if err != nil {
+		return nil, err
 	}
 
+	window := model.TimeWindow{StartTime: startTime, EndTime: endTime}
+	profile, err := r.beverageProfile(ctx, window, granularity, loc, filter, perMachine != nil && *perMachine)
+	if err != nil {
+		log.Printf("Error computing beverage profile: %v", err)
+		return nil, err
+	}
+	return profile, nil
+}
+
+// BeverageComparison is the resolver for the beverageComparison field.
+func (r *queryResolver) BeverageComparison(ctx context.Context, first model.TimeWindow, second model.TimeWindow, filter *model.BeverageAnalyticsFilter) (*model.BeverageComparison, error) {
+	comparison, err := r.beverageComparison(ctx, first, second, filter)
+	if err != nil {
+		log.Printf("Error comparing beverage consumption: %v", err)
+		return nil, err
+	}
+	return comparison, nil
+}
+
+// BeverageMachines is the resolver for the beverageMachines field.
+func (r *roomResolver) BeverageMachines(ctx context.Context, obj *model.Room) ([]*model.BeverageMachine, error) {
+	machines, err := r.loadersFor(ctx).MachinesByRoom.Load(ctx, obj.ID)
+	if err != nil {
+		log.Printf("Error querying machines for room %s: %v", obj.ID, err)
+		return nil, fmt.Errorf("error fetching machines for room: %w", err)
+	}
+	if machines == nil {
+		machines = []*model.BeverageMachine{}
+	}
 	return machines, nil
 }
 
@@ -215,9 +308,17 @@ func (r *Resolver) BeverageMachine() BeverageMachineResolver { return &beverageM
 // Floor returns FloorResolver implementation.
 func (r *Resolver) Floor() FloorResolver { return &floorResolver{r} }
 
+// Mutation returns MutationResolver implementation.
+func (r *Resolver) Mutation() MutationResolver { return &mutationResolver{r} }
+
 // Query returns QueryResolver implementation.
 func (r *Resolver) Query() QueryResolver { return &queryResolver{r} }
 
+// Room returns RoomResolver implementation.
+func (r *Resolver) Room() RoomResolver { return &roomResolver{r} }
+
 type beverageMachineResolver struct{ *Resolver }
 type floorResolver struct{ *Resolver }
+type mutationResolver struct{ *Resolver }
 type queryResolver struct{ *Resolver }
+type roomResolver struct{ *Resolver }
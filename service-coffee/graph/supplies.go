@@ -0,0 +1,145 @@
+package graph
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LarsDepuydt/masterthesis-api-aggregation/service-coffee/graph/model"
+	"github.com/lib/pq"
+)
+
+// Ingredient is a supply used by the beverages of a machine, such as beans or
+// milk.
+type Ingredient struct {
+	Name string `json:"name"`
+	// Unit is the unit amounts are given in (e.g., 'g', 'ml').
+	Unit string `json:"unit"`
+	// Threshold is the level at which the supply should be restocked.
+	Threshold float64 `json:"threshold"`
+	// Usage is the amount used per beverage, by beverage name.
+	Usage map[string]float64 `json:"usage"`
+}
+
+// LoadIngredients reads the configured ingredients from a JSON file with an
+// "ingredients" list. A missing file configures no ingredients.
+func LoadIngredients(path string) ([]Ingredient, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read supplies file: %w", err)
+	}
+
+	var config struct {
+		Ingredients []Ingredient `json:"ingredients"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse supplies file: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	for i, ingredient := range config.Ingredients {
+		name := strings.TrimSpace(ingredient.Name)
+		switch {
+		case name == "":
+			return nil, fmt.Errorf("ingredient %d has no name", i+1)
+		case seen[name]:
+			return nil, fmt.Errorf("ingredient %q is configured twice", name)
+		case ingredient.Threshold < 0:
+			return nil, fmt.Errorf("threshold of ingredient %q must not be negative", name)
+		}
+		for beverage, usage := range ingredient.Usage {
+			if usage < 0 || math.IsInf(usage, 0) || math.IsNaN(usage) {
+				return nil, fmt.Errorf("usage of ingredient %q by %q must be a non-negative number", name, beverage)
+			}
+		}
+		seen[name] = true
+		config.Ingredients[i].Name = name
+	}
+	return config.Ingredients, nil
+}
+
+// ingredient returns the configured ingredient with the given name.
+func (r *Resolver) ingredient(name string) (Ingredient, bool) {
+	for _, ingredient := range r.Ingredients {
+		if ingredient.Name == name {
+			return ingredient, true
+		}
+	}
+	return Ingredient{}, false
+}
+
+// recordSupplyRefill stores the level of a supply of a machine after a refill.
+func (r *Resolver) recordSupplyRefill(ctx context.Context, machineID, ingredientName string, level float64, timestamp *time.Time) (*model.SupplyRefill, error) {
+	if _, ok := r.ingredient(ingredientName); !ok {
+		return nil, fmt.Errorf("unknown ingredient %q", ingredientName)
+	}
+	if level < 0 || math.IsInf(level, 0) || math.IsNaN(level) {
+		return nil, fmt.Errorf("level must be a non-negative number")
+	}
+	refill := &model.SupplyRefill{MachineID: machineID, Ingredient: ingredientName, Level: level, Timestamp: time.Now()}
+	if timestamp != nil {
+		if timestamp.After(time.Now().Add(time.Minute)) {
+			return nil, fmt.Errorf("timestamp %s lies in the future", timestamp.Format(time.RFC3339))
+		}
+		refill.Timestamp = *timestamp
+	}
+
+	var exists bool
+	if err := r.DB.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM machines WHERE machine_id = $1)`, machineID).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("database error fetching machine %s: %w", machineID, err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("unknown machine %s", machineID)
+	}
+
+	var id int64
+	if err := r.DB.QueryRowContext(ctx, `
+		INSERT INTO supply_refills (machine_id, ingredient, level, timestamp)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, machineID, ingredientName, level, refill.Timestamp).Scan(&id); err != nil {
+		return nil, fmt.Errorf("database error storing refill: %w", err)
+	}
+	refill.ID = strconv.FormatInt(id, 10)
+	return refill, nil
+}
+
+// fetchLatestRefills fetches the latest refill of every supply of machines, by
+// machine and ingredient.
+func fetchLatestRefills(ctx context.Context, db *sql.DB, machineIDs []string) (map[string]map[string]*model.SupplyRefill, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT DISTINCT ON (machine_id, ingredient) id, machine_id, ingredient, level, timestamp
+		FROM supply_refills
+		WHERE machine_id = ANY($1)
+		ORDER BY machine_id, ingredient, timestamp DESC
+	`, pq.Array(machineIDs))
+	if err != nil {
+		return nil, fmt.Errorf("database error fetching refills: %w", err)
+	}
+	defer rows.Close()
+
+	refills := make(map[string]map[string]*model.SupplyRefill)
+	for rows.Next() {
+		var refill model.SupplyRefill
+		var id int64
+		if err := rows.Scan(&id, &refill.MachineID, &refill.Ingredient, &refill.Level, &refill.Timestamp); err != nil {
+			return nil, fmt.Errorf("database error scanning refill: %w", err)
+		}
+		refill.ID = strconv.FormatInt(id, 10)
+		if refills[refill.MachineID] == nil {
+			refills[refill.MachineID] = make(map[string]*model.SupplyRefill)
+		}
+		refills[refill.MachineID][refill.Ingredient] = &refill
+	}
+	return refills, rows.Err()
+}
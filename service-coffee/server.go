@@ -1,9 +1,19 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	_ "time/tzdata" // Time zones for consumption intervals, the runtime image has none
 
 	"github.com/99designs/gqlgen/graphql/handler"
 	"github.com/99designs/gqlgen/graphql/handler/extension"
@@ -14,17 +24,104 @@ import (
 	"github.com/vektah/gqlparser/v2/ast"
 )
 
+// shutdownTimeout limits how long requests in flight may take to complete at
+// shutdown.
+const shutdownTimeout = 30 * time.Second
+
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "import":
+			// Backfill readings from a CSV file: import [-dry-run] <file>
+			importReadings(os.Args[2:])
+			return
+		case "migrate":
+			// Apply the schema migrations and exit
+			db, err := connectDatabase(true)
+			if err != nil {
+				log.Fatal(err)
+			}
+			resolver := &graph.Resolver{DB: db}
+			if err := resolver.MigrateDB(context.Background()); err != nil {
+				log.Fatalf("Error migrating database: %v", err)
+			}
+			return
+		}
+	}
+
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run starts the server and blocks until it is shut down. Errors are returned
+// rather than ending the process, so the database connections and the
+// embedded development database are always closed.
+func run() error {
+	dev := flag.Bool("dev", os.Getenv("COFFEE_DEV_DB") == "true", "run against an embedded Postgres database with sample data, for local development")
+	devDataDir := flag.String("dev-data", "./data/dev-postgres", "directory of the embedded development database")
+	migrateOnStart := flag.Bool("migrate", os.Getenv("COFFEE_DB_MIGRATE") == "true", "apply the schema migrations at startup")
+	flag.Parse()
+
 	port := os.Getenv("APP_LISTEN_PORT")
 	if port == "" {
-		log.Fatal("Could not find env variable that defined PORT")
+		return errors.New("could not find env variable that defined PORT")
 	}
 
-	srv := handler.New(graph.NewExecutableSchema(graph.Config{Resolvers: &graph.Resolver{}}))
+	if *dev {
+		stop, err := startDevDatabase(*devDataDir)
+		if err != nil {
+			return fmt.Errorf("error starting development database: %w", err)
+		}
+		defer stop()
+		*migrateOnStart = true
+	}
+
+	// The service starts even if the database cannot be reached, as long as no
+	// migrations have to be applied; the health endpoint reports it as not ready
+	db, err := connectDatabase(*migrateOnStart)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	resolver := &graph.Resolver{DB: db, WeekdayWeights: graph.DefaultWeekdayWeights}
+	if value := os.Getenv("COFFEE_WEEKDAY_WEIGHTS"); value != "" {
+		weights, err := graph.ParseWeekdayWeights(value)
+		if err != nil {
+			return fmt.Errorf("invalid COFFEE_WEEKDAY_WEIGHTS: %w", err)
+		}
+		resolver.WeekdayWeights = weights
+	}
+	suppliesPath := os.Getenv("COFFEE_SUPPLIES")
+	if suppliesPath == "" {
+		suppliesPath = "./supplies.json"
+	}
+	ingredients, err := graph.LoadIngredients(suppliesPath)
+	if err != nil {
+		return fmt.Errorf("error loading supplies: %w", err)
+	}
+	resolver.Ingredients = ingredients
+	log.Printf("Loaded %d supply ingredients from %s", len(ingredients), suppliesPath)
+	if *migrateOnStart {
+		if err := resolver.MigrateDB(context.Background()); err != nil {
+			return fmt.Errorf("error migrating database: %w", err)
+		}
+	}
+	if *dev {
+		if err := loadDevData(resolver.DB); err != nil {
+			return fmt.Errorf("error loading development data: %w", err)
+		}
+	}
+
+	srv := handler.New(graph.NewExecutableSchema(graph.Config{Resolvers: resolver}))
 
 	srv.AddTransport(transport.Options{})
 	srv.AddTransport(transport.GET{})
 	srv.AddTransport(transport.POST{})
+	srv.AddTransport(transport.MultipartForm{
+		MaxUploadSize: 32 << 20,
+		MaxMemory:     32 << 20,
+	})
 
 	srv.SetQueryCache(lru.New[*ast.QueryDocument](1000))
 
@@ -34,8 +131,109 @@ func main() {
 	})
 
 	http.Handle("/", playground.Handler("GraphQL playground", "/query"))
-	http.Handle("/query", srv)
+	http.Handle("/query", resolver.WithLoaders(srv))
+	http.Handle("/health", graph.HealthHandler(resolver.DB))
+
+	// Shut down on SIGINT and SIGTERM, so the development database is stopped
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	server := &http.Server{Addr: ":" + port}
+	// ListenAndServe returns as soon as Shutdown starts, so run waits for the
+	// requests in flight to drain before the database is closed
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		<-ctx.Done()
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancelShutdown()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Error shutting down server: %v", err)
+		}
+	}()
 
 	log.Printf("connect to http://localhost:%s/ for GraphQL playground", port)
-	log.Fatal(http.ListenAndServe(":"+port, nil))
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("server error: %w", err)
+	}
+	<-drained
+	return nil
+}
+
+// importReadings imports beverage readings from a CSV file and prints the
+// result as JSON. It exits with status 1 if the file contains errors.
+func importReadings(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "only validate the readings")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		log.Fatal("usage: import [-dry-run] <file>")
+	}
+
+	f, err := os.Open(flags.Arg(0))
+	if err != nil {
+		log.Fatalf("Error opening readings file: %v", err)
+	}
+	defer f.Close()
+
+	db, err := connectDatabase(true)
+	if err != nil {
+		log.Fatal(err)
+	}
+	resolver := &graph.Resolver{DB: db}
+	result, err := resolver.ImportBeverageReadings(context.Background(), f, *dryRun)
+	if err != nil {
+		log.Fatalf("Error importing readings: %v", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(result); err != nil {
+		log.Fatalf("Error writing import result: %v", err)
+	}
+	if len(result.Errors) > 0 {
+		os.Exit(1)
+	}
+}
+
+// connectDatabase opens the database connection pool configured through the
+// COFFEE_DB_* environment variables and waits up to COFFEE_DB_STARTUP_TIMEOUT
+// (default 60s) for the database to respond. If required is set, an error is
+// returned when the database does not respond in time; otherwise the wait runs
+// in the background, so the server starts right away and reports the database
+// as unavailable on /health until it responds.
+func connectDatabase(required bool) (*sql.DB, error) {
+	cfg, err := graph.LoadDBConfig()
+	if err != nil {
+		return nil, fmt.Errorf("invalid database configuration: %w", err)
+	}
+	db, err := graph.OpenDB(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error opening database: %w", err)
+	}
+
+	timeout := 60 * time.Second
+	if value := os.Getenv("COFFEE_DB_STARTUP_TIMEOUT"); value != "" {
+		if timeout, err = time.ParseDuration(value); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("COFFEE_DB_STARTUP_TIMEOUT must be a duration such as '30s', got %q", value)
+		}
+	}
+	wait := func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		return graph.WaitForDB(ctx, db)
+	}
+	if required {
+		if err := wait(); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("error connecting to database: %w", err)
+		}
+		return db, nil
+	}
+	go func() {
+		if err := wait(); err != nil {
+			log.Printf("Database still not reachable, connections will be retried on demand: %v", err)
+		}
+	}()
+	return db, nil
 }
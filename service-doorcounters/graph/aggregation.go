@@ -0,0 +1,205 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/LarsDepuydt/masterthesis-api-aggregation/service-doorcounters/graph/data"
+	"github.com/LarsDepuydt/masterthesis-api-aggregation/service-doorcounters/graph/model"
+)
+
+// maxAggregatedIntervals limits the number of intervals a window may be
+// aggregated into, e.g. a little over a year of hours.
+const maxAggregatedIntervals = 10000
+
+// collectionPeriod is the period a value reports on, ending at its timestamp.
+const collectionPeriod = time.Hour
+
+// startOfInterval returns the start of the interval containing t.
+func startOfInterval(t time.Time, interval model.TelemetryInterval, loc *time.Location) (time.Time, error) {
+	local := t.In(loc)
+	switch interval {
+	case model.TelemetryIntervalHour:
+		return time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), 0, 0, 0, loc), nil
+	case model.TelemetryIntervalDay:
+		return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc), nil
+	case model.TelemetryIntervalWeek:
+		daysSinceMonday := (int(local.Weekday()) + 6) % 7
+		return time.Date(local.Year(), local.Month(), local.Day()-daysSinceMonday, 0, 0, 0, 0, loc), nil
+	default:
+		return time.Time{}, fmt.Errorf("unsupported interval %q", interval)
+	}
+}
+
+// nextInterval returns the start of the interval after the one starting at t.
+func nextInterval(t time.Time, interval model.TelemetryInterval) time.Time {
+	switch interval {
+	case model.TelemetryIntervalHour:
+		return t.Add(time.Hour)
+	case model.TelemetryIntervalDay:
+		return t.AddDate(0, 0, 1)
+	default:
+		return t.AddDate(0, 0, 7)
+	}
+}
+
+// aggregationIntervals returns the intervals covering a window, from the one
+// containing start up to and including the one containing end.
+func aggregationIntervals(start, end time.Time, interval model.TelemetryInterval, loc *time.Location) ([]*model.AggregatedTelemetry, error) {
+	if end.Before(start) {
+		return nil, fmt.Errorf("startTime must not be after endTime")
+	}
+	t, err := startOfInterval(start, interval, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	var intervals []*model.AggregatedTelemetry
+	for !t.After(end) {
+		if len(intervals) == maxAggregatedIntervals {
+			return nil, fmt.Errorf("window spans more than %d intervals, use a longer interval", maxAggregatedIntervals)
+		}
+		next := nextInterval(t, interval)
+		intervals = append(intervals, &model.AggregatedTelemetry{StartTime: t, EndTime: next})
+		t = next
+	}
+	return intervals, nil
+}
+
+// aggregateTelemetry sums the hourly values of entrances per interval. Values
+// are attributed to the interval their collection period started in, and
+// completeness compares the values reported with the hours elapsed.
+func (r *Resolver) aggregateTelemetry(ctx context.Context, entrances []data.Entrance, startTime time.Time, endTime *time.Time, interval model.TelemetryInterval, timezone *string) ([]*model.AggregatedTelemetry, error) {
+	loc := time.UTC
+	if timezone != nil {
+		var err error
+		if loc, err = time.LoadLocation(*timezone); err != nil {
+			return nil, fmt.Errorf("unknown time zone %q", *timezone)
+		}
+	}
+	fetches := r.fetchesFor(ctx)
+	end := fetches.now
+	if endTime != nil {
+		end = *endTime
+	}
+
+	intervals, err := aggregationIntervals(startTime, end, interval, loc)
+	if err != nil {
+		return nil, err
+	}
+	windowStart := intervals[0].StartTime
+	windowEnd := intervals[len(intervals)-1].EndTime
+
+	// Group the entrances by device, to fetch every device once
+	entrancesByDevice := make(map[string][]*data.Entrance)
+	var deviceIDs []string
+	for i := range entrances {
+		entrance := &entrances[i]
+		if entrancesByDevice[entrance.Device] == nil {
+			deviceIDs = append(deviceIDs, entrance.Device)
+		}
+		entrancesByDevice[entrance.Device] = append(entrancesByDevice[entrance.Device], entrance)
+	}
+
+	reported := make([]int32, len(intervals))
+	calibrations := make(calibrationModels)
+	applied := make([]map[*model.Calibration]bool, len(intervals))
+	for i, aggregated := range intervals {
+		aggregated.Calibrations = []*model.Calibration{}
+		applied[i] = make(map[*model.Calibration]bool)
+	}
+	for _, deviceID := range deviceIDs {
+		device, _ := r.Config.Device(deviceID)
+		// Values with a collection period starting within the window
+		telemetry, err := fetches.Fetch(ctx, device, windowStart.Add(collectionPeriod).UnixMilli(), windowEnd.Add(collectionPeriod).UnixMilli()-1)
+		keys := make([]string, 0, len(entrancesByDevice[deviceID]))
+		for _, entrance := range entrancesByDevice[deviceID] {
+			keys = append(keys, entrance.Key)
+		}
+		if err = withPartialData(ctx, err, keys...); err != nil {
+			return nil, err
+		}
+
+		for _, d := range telemetry {
+			periodStart := time.UnixMilli(d.Timestamp).Add(-collectionPeriod)
+			i := sort.Search(len(intervals), func(i int) bool { return intervals[i].EndTime.After(periodStart) })
+			if i == len(intervals) || periodStart.Before(intervals[i].StartTime) {
+				continue
+			}
+			for _, entrance := range entrancesByDevice[deviceID] {
+				value, ok := d.Values[entrance.Key]
+				if !ok {
+					continue
+				}
+				calibration := calibrations.of(entrance, entrance.CalibrationAt(periodStart))
+				intervals[i].Value += value
+				intervals[i].CalibratedValue += float64(value) * calibration.Factor
+				reported[i]++
+				if !applied[i][calibration] {
+					applied[i][calibration] = true
+					intervals[i].Calibrations = append(intervals[i].Calibrations, calibration)
+				}
+			}
+		}
+	}
+
+	for i, aggregated := range intervals {
+		// Only hours that ended by now are expected to be reported
+		elapsed := minTime(aggregated.EndTime, fetches.now).Sub(aggregated.StartTime)
+		expected := int32(max(elapsed, 0)/time.Hour) * int32(len(entrances))
+		aggregated.ReportedHours = reported[i]
+		aggregated.ExpectedHours = expected
+		if expected > 0 {
+			completeness := min(float64(reported[i])/float64(expected), 1)
+			aggregated.Completeness = &completeness
+		}
+	}
+	return intervals, nil
+}
+
+// calibrationKey identifies the calibration of an entrance, nil if its
+// values are not corrected.
+type calibrationKey struct {
+	entranceID  string
+	calibration *data.Calibration
+}
+
+// calibrationModels returns one model per calibration, so results can tell
+// calibrations apart by identity.
+type calibrationModels map[calibrationKey]*model.Calibration
+
+// of returns the model of a calibration of an entrance. Without calibration,
+// the model has a factor of 1 and no validity range.
+func (m calibrationModels) of(entrance *data.Entrance, calibration *data.Calibration) *model.Calibration {
+	key := calibrationKey{entranceID: entrance.ID, calibration: calibration}
+	if c, ok := m[key]; ok {
+		return c
+	}
+	c := &model.Calibration{EntranceID: entrance.ID, Factor: 1}
+	if calibration != nil {
+		c.Factor = calibration.Factor
+		c.ValidFrom = optionalString(calibration.From)
+		c.ValidTo = optionalString(calibration.To)
+		c.Note = optionalString(calibration.Note)
+	}
+	m[key] = c
+	return c
+}
+
+// optionalString returns nil for an empty string.
+func optionalString(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+// minTime returns the earlier of two times.
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,172 @@
+package graph
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	refreshEndpoint = "/api/auth/token"
+
+	// tokenRefreshMargin is how long before expiry a token is refreshed, so
+	// requests never go out with a token that expires on the way.
+	tokenRefreshMargin = time.Minute
+)
+
+// AuthResponse stores the tokens received after login or refresh
+type AuthResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+}
+
+// TokenManager hands out the ThingsBoard JWT, logging in only when no valid
+// token is cached. Refreshes are serialized, so concurrent requests waiting
+// for a new token share the result of a single refresh.
+type TokenManager struct {
+	baseURL  string
+	username string
+	password string
+	client   *http.Client
+
+	// lock guards the fields below. It is a channel rather than a mutex so
+	// that waiting for a refresh can be abandoned when the request is.
+	lock         chan struct{}
+	token        string
+	expiresAt    time.Time
+	refreshToken string
+	refreshUntil time.Time
+}
+
+// NewTokenManager creates a token manager for the given credentials on the
+// ThingsBoard server at baseURL. Telemetry is fetched from the same server.
+func NewTokenManager(baseURL, username, password string) *TokenManager {
+	return &TokenManager{
+		baseURL:  baseURL,
+		username: username,
+		password: password,
+		client:   &http.Client{},
+		lock:     make(chan struct{}, 1),
+	}
+}
+
+// Token returns a token that is valid for at least tokenRefreshMargin,
+// refreshing it if needed.
+func (m *TokenManager) Token(ctx context.Context) (string, error) {
+	select {
+	case m.lock <- struct{}{}:
+	case <-ctx.Done():
+		return "", requestError(ctx.Err())
+	}
+	defer func() { <-m.lock }()
+
+	now := time.Now()
+	if m.token != "" && now.Before(m.expiresAt.Add(-tokenRefreshMargin)) {
+		return m.token, nil
+	}
+
+	// Prefer the refresh token, falling back to logging in when it is
+	// rejected
+	if m.refreshToken != "" && now.Before(m.refreshUntil.Add(-tokenRefreshMargin)) {
+		if err := m.authenticate(ctx, refreshEndpoint, map[string]string{"refreshToken": m.refreshToken}); err == nil {
+			return m.token, nil
+		}
+	}
+	if err := m.authenticate(ctx, authEndpoint, map[string]string{"username": m.username, "password": m.password}); err != nil {
+		return "", err
+	}
+	return m.token, nil
+}
+
+// Invalidate drops a token that upstream rejected, so the next call to Token
+// fetches a new one. A token that was already replaced is left alone.
+func (m *TokenManager) Invalidate(token string) {
+	m.lock <- struct{}{}
+	defer func() { <-m.lock }()
+
+	if m.token == token {
+		m.token = ""
+		m.expiresAt = time.Time{}
+	}
+}
+
+// authenticate posts a payload to an auth endpoint and stores the tokens it
+// returns. The caller must hold m.lock.
+func (m *TokenManager) authenticate(ctx context.Context, endpoint string, payload map[string]string) error {
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, upstreamTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", m.baseURL+endpoint, bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return requestError(err)
+	}
+	defer resp.Body.Close()
+	if err := responseError(resp); err != nil {
+		return err
+	}
+
+	var authResp AuthResponse
+	if err := json.NewDecoder(resp.Body).Decode(&authResp); err != nil {
+		if ctx.Err() != nil {
+			return requestError(ctx.Err())
+		}
+		return &MalformedPayloadError{Err: fmt.Errorf("failed to decode auth response: %w", err)}
+	}
+	if authResp.Token == "" {
+		return &AuthError{StatusCode: resp.StatusCode, Err: fmt.Errorf("no token in auth response")}
+	}
+
+	now := time.Now()
+	m.token = authResp.Token
+	// Without a readable expiry the token is used for this request only
+	m.expiresAt = now
+	if exp, err := tokenExpiry(authResp.Token); err == nil {
+		m.expiresAt = exp
+	}
+	m.refreshToken = ""
+	if authResp.RefreshToken != "" {
+		if exp, err := tokenExpiry(authResp.RefreshToken); err == nil {
+			m.refreshToken = authResp.RefreshToken
+			m.refreshUntil = exp
+		}
+	}
+	return nil
+}
+
+// tokenExpiry reads the expiry from the "exp" claim of a JWT. The signature
+// is not verified, as the token is only passed back to the server issuing it.
+func tokenExpiry(token string) (time.Time, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, fmt.Errorf("token is not a JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to decode token payload: %w", err)
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse token payload: %w", err)
+	}
+	if claims.Exp == 0 {
+		return time.Time{}, fmt.Errorf("token has no expiry")
+	}
+	return time.Unix(claims.Exp, 0), nil
+}
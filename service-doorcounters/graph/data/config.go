@@ -0,0 +1,365 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/LarsDepuydt/masterthesis-api-aggregation/service-doorcounters/graph/model"
+)
+
+// Device is a ThingsBoard entity reporting counter telemetry.
+type Device struct {
+	// ID is the ThingsBoard entity ID of the device.
+	ID string `json:"id"`
+	// EntityType is the ThingsBoard entity type, DEVICE if omitted.
+	EntityType string `json:"entityType"`
+	Name       string `json:"name"`
+}
+
+// Entrance is an entrance counted by a telemetry key of a device.
+type Entrance struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Device is the ID of the device reporting the entrance.
+	Device string `json:"device"`
+	// Key is the telemetry key holding the counts of the entrance (e.g., 'c1').
+	Key string `json:"key"`
+	// Calibrations correct the counts of the entrance over date ranges.
+	// Values outside all ranges are not corrected.
+	Calibrations []Calibration `json:"calibrations"`
+}
+
+// Calibration is a correction factor for the counts of an entrance, such as
+// for the passages a counter misses, valid over a range of dates.
+type Calibration struct {
+	// From and To are the first and last day the factor is valid, as
+	// YYYY-MM-DD in the time zone of the building. Either may be omitted
+	// for a range without start or end.
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Factor is what reported values are multiplied by.
+	Factor float64 `json:"factor"`
+	// Note explains where the factor comes from, e.g. a manual count.
+	Note string `json:"note"`
+
+	// Start and End bound the range of the factor, parsed from From and To.
+	// End is exclusive, and either is zero if omitted.
+	Start time.Time `json:"-"`
+	End   time.Time `json:"-"`
+}
+
+// CalibrationAt returns the calibration of the entrance valid at t, or nil if
+// values at t are not corrected.
+func (e *Entrance) CalibrationAt(t time.Time) *Calibration {
+	for i := range e.Calibrations {
+		calibration := &e.Calibrations[i]
+		if (calibration.Start.IsZero() || !t.Before(calibration.Start)) && (calibration.End.IsZero() || t.Before(calibration.End)) {
+			return calibration
+		}
+	}
+	return nil
+}
+
+// resolveCalibrations parses and validates the calibrations of the entrance,
+// ordering them by start.
+func (e *Entrance) resolveCalibrations(loc *time.Location) error {
+	for i := range e.Calibrations {
+		calibration := &e.Calibrations[i]
+		if calibration.Factor <= 0 || math.IsInf(calibration.Factor, 0) || math.IsNaN(calibration.Factor) {
+			return fmt.Errorf("calibration %d of entrance %q must have a positive factor", i+1, e.ID)
+		}
+		if calibration.From != "" {
+			start, err := time.ParseInLocation("2006-01-02", calibration.From, loc)
+			if err != nil {
+				return fmt.Errorf("calibration %d of entrance %q has an invalid from date, expected YYYY-MM-DD", i+1, e.ID)
+			}
+			calibration.Start = start
+		}
+		if calibration.To != "" {
+			end, err := time.ParseInLocation("2006-01-02", calibration.To, loc)
+			if err != nil {
+				return fmt.Errorf("calibration %d of entrance %q has an invalid to date, expected YYYY-MM-DD", i+1, e.ID)
+			}
+			calibration.End = end.AddDate(0, 0, 1)
+		}
+		if !calibration.Start.IsZero() && !calibration.End.IsZero() && !calibration.Start.Before(calibration.End) {
+			return fmt.Errorf("calibration %d of entrance %q ends before it starts", i+1, e.ID)
+		}
+	}
+
+	sort.Slice(e.Calibrations, func(i, j int) bool {
+		return e.Calibrations[i].Start.Before(e.Calibrations[j].Start)
+	})
+	for i := 1; i < len(e.Calibrations); i++ {
+		previous := e.Calibrations[i-1]
+		if previous.End.IsZero() || previous.End.After(e.Calibrations[i].Start) {
+			return fmt.Errorf("calibrations of entrance %q overlap", e.ID)
+		}
+	}
+	return nil
+}
+
+// Building groups the entrances of a building.
+type Building struct {
+	ID        string     `json:"id"`
+	Entrances []Entrance `json:"entrances"`
+	// Occupancy calibrates the occupancy estimate of the building. Omitted
+	// settings take the values of DefaultOccupancy.
+	Occupancy Occupancy `json:"occupancy"`
+}
+
+// Occupancy calibrates how passages are turned into people present.
+type Occupancy struct {
+	// Timezone is the IANA time zone of the opening hours and days.
+	Timezone string `json:"timezone"`
+	// PassagesPerValue is the number of passages a reported value stands for,
+	// 2 as counters report the passages divided by 2.
+	PassagesPerValue float64 `json:"passagesPerValue"`
+	// PassagesPerVisit is the number of passages per visit, 2 for entering
+	// and leaving through counted entrances.
+	PassagesPerVisit float64 `json:"passagesPerVisit"`
+	// VisitsPerVisitor is the average number of visits of a visitor per day,
+	// above 1 when people leave and return, e.g. for lunch.
+	VisitsPerVisitor float64 `json:"visitsPerVisitor"`
+	// OpensAt and ClosesAt are the local opening hours (e.g., '07:00').
+	OpensAt  string `json:"opensAt"`
+	ClosesAt string `json:"closesAt"`
+	// EntryShareAtOpen is the share of passages that are entries at opening
+	// time. It decreases linearly to the same share of exits at closing time.
+	EntryShareAtOpen float64 `json:"entryShareAtOpen"`
+	// ResetAtEndOfDay is whether the building is assumed empty at the end of
+	// the day, true if omitted. Entries and exits are then balanced over the
+	// day.
+	ResetAtEndOfDay *bool `json:"resetAtEndOfDay"`
+
+	// Location, Opens and Closes are parsed from the settings above, Opens
+	// and Closes as the time since midnight.
+	Location *time.Location `json:"-"`
+	Opens    time.Duration  `json:"-"`
+	Closes   time.Duration  `json:"-"`
+}
+
+// DefaultOccupancy holds the calibration used for omitted settings.
+var DefaultOccupancy = Occupancy{
+	Timezone:         "Europe/Copenhagen",
+	PassagesPerValue: 2,
+	PassagesPerVisit: 2,
+	VisitsPerVisitor: 1.2,
+	OpensAt:          "07:00",
+	ClosesAt:         "18:00",
+	EntryShareAtOpen: 0.9,
+}
+
+// resolve fills in omitted settings and parses and validates the others.
+func (o *Occupancy) resolve() error {
+	if o.Timezone == "" {
+		o.Timezone = DefaultOccupancy.Timezone
+	}
+	if o.PassagesPerValue == 0 {
+		o.PassagesPerValue = DefaultOccupancy.PassagesPerValue
+	}
+	if o.PassagesPerVisit == 0 {
+		o.PassagesPerVisit = DefaultOccupancy.PassagesPerVisit
+	}
+	if o.VisitsPerVisitor == 0 {
+		o.VisitsPerVisitor = DefaultOccupancy.VisitsPerVisitor
+	}
+	if o.OpensAt == "" {
+		o.OpensAt = DefaultOccupancy.OpensAt
+	}
+	if o.ClosesAt == "" {
+		o.ClosesAt = DefaultOccupancy.ClosesAt
+	}
+	if o.EntryShareAtOpen == 0 {
+		o.EntryShareAtOpen = DefaultOccupancy.EntryShareAtOpen
+	}
+	if o.ResetAtEndOfDay == nil {
+		reset := true
+		o.ResetAtEndOfDay = &reset
+	}
+
+	var err error
+	if o.Location, err = time.LoadLocation(o.Timezone); err != nil {
+		return fmt.Errorf("unknown time zone %q", o.Timezone)
+	}
+	if o.Opens, err = parseTimeOfDay(o.OpensAt); err != nil {
+		return fmt.Errorf("invalid opensAt: %w", err)
+	}
+	if o.Closes, err = parseTimeOfDay(o.ClosesAt); err != nil {
+		return fmt.Errorf("invalid closesAt: %w", err)
+	}
+	switch {
+	case o.Closes <= o.Opens:
+		return fmt.Errorf("closesAt must be after opensAt")
+	case o.PassagesPerValue < 0 || o.PassagesPerVisit < 0 || o.VisitsPerVisitor < 0:
+		return fmt.Errorf("passagesPerValue, passagesPerVisit and visitsPerVisitor must be positive")
+	case o.EntryShareAtOpen < 0.5 || o.EntryShareAtOpen > 1:
+		return fmt.Errorf("entryShareAtOpen must be between 0.5 and 1")
+	}
+	return nil
+}
+
+// parseTimeOfDay parses a time of day as 'HH:MM' into the time since
+// midnight.
+func parseTimeOfDay(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a time of day as HH:MM", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Config defines the devices, entrances and buildings served.
+type Config struct {
+	Devices   []Device   `json:"devices"`
+	Buildings []Building `json:"buildings"`
+
+	devices   map[string]*Device
+	buildings map[string]*Building
+	entrances map[string]*Entrance
+	// models holds the entrances as returned to clients, in config order
+	models         []*model.Entrance
+	modelsByID     map[string]*model.Entrance
+	modelsBuilding map[string][]*model.Entrance
+}
+
+// LoadConfig reads and validates the configuration from a JSON file.
+func LoadConfig(path string) (*Config, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var config Config
+	if err := json.Unmarshal(raw, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	if err := config.index(); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// index validates the configuration and builds its lookup maps.
+func (c *Config) index() error {
+	c.devices = make(map[string]*Device)
+	for i := range c.Devices {
+		device := &c.Devices[i]
+		device.ID = strings.TrimSpace(device.ID)
+		switch {
+		case device.ID == "":
+			return fmt.Errorf("device %d has no id", i+1)
+		case c.devices[device.ID] != nil:
+			return fmt.Errorf("device %q is configured twice", device.ID)
+		}
+		if device.EntityType == "" {
+			device.EntityType = "DEVICE"
+		}
+		c.devices[device.ID] = device
+	}
+
+	c.entrances = make(map[string]*Entrance)
+	c.modelsByID = make(map[string]*model.Entrance)
+	c.modelsBuilding = make(map[string][]*model.Entrance)
+	c.buildings = make(map[string]*Building)
+	for i := range c.Buildings {
+		building := &c.Buildings[i]
+		building.ID = strings.TrimSpace(building.ID)
+		switch {
+		case building.ID == "":
+			return fmt.Errorf("building %d has no id", i+1)
+		case c.buildings[building.ID] != nil:
+			return fmt.Errorf("building %q is configured twice", building.ID)
+		}
+		c.buildings[building.ID] = building
+		if err := building.Occupancy.resolve(); err != nil {
+			return fmt.Errorf("occupancy of building %q: %w", building.ID, err)
+		}
+
+		// Entrance IDs are federated keys, so they are unique across buildings
+		for j := range building.Entrances {
+			entrance := &building.Entrances[j]
+			entrance.ID = strings.TrimSpace(entrance.ID)
+			switch {
+			case entrance.ID == "":
+				return fmt.Errorf("entrance %d of building %q has no id", j+1, building.ID)
+			case c.entrances[entrance.ID] != nil:
+				return fmt.Errorf("entrance %q is configured twice", entrance.ID)
+			case c.devices[entrance.Device] == nil:
+				return fmt.Errorf("entrance %q refers to unknown device %q", entrance.ID, entrance.Device)
+			case strings.TrimSpace(entrance.Key) == "":
+				return fmt.Errorf("entrance %q has no telemetry key", entrance.ID)
+			}
+			entrance.Key = strings.TrimSpace(entrance.Key)
+			if err := entrance.resolveCalibrations(building.Occupancy.Location); err != nil {
+				return err
+			}
+			c.entrances[entrance.ID] = entrance
+
+			m := &model.Entrance{ID: entrance.ID, Name: entrance.Name}
+			c.models = append(c.models, m)
+			c.modelsByID[entrance.ID] = m
+			c.modelsBuilding[building.ID] = append(c.modelsBuilding[building.ID], m)
+		}
+	}
+	return nil
+}
+
+// Entrances returns all entrances, in config order.
+func (c *Config) Entrances() []*model.Entrance {
+	return c.models
+}
+
+// BuildingEntrances returns the entrances of a building, or none if the
+// building has no counters.
+func (c *Config) BuildingEntrances(buildingID string) []*model.Entrance {
+	if entrances, ok := c.modelsBuilding[buildingID]; ok {
+		return entrances
+	}
+	return []*model.Entrance{}
+}
+
+// EntranceModel returns the entrance with the given ID as returned to clients.
+func (c *Config) EntranceModel(id string) (*model.Entrance, bool) {
+	m, ok := c.modelsByID[id]
+	return m, ok
+}
+
+// Building returns the definition of the building with the given ID.
+func (c *Config) Building(id string) (*Building, bool) {
+	building, ok := c.buildings[id]
+	return building, ok
+}
+
+// Entrance returns the definition of the entrance with the given ID.
+func (c *Config) Entrance(id string) (*Entrance, bool) {
+	entrance, ok := c.entrances[id]
+	return entrance, ok
+}
+
+// Device returns the device with the given ID.
+func (c *Config) Device(id string) (*Device, bool) {
+	device, ok := c.devices[id]
+	return device, ok
+}
+
+// DeviceKeys returns the telemetry keys of a device used by any entrance, in
+// config order.
+func (c *Config) DeviceKeys(deviceID string) []string {
+	var keys []string
+	seen := make(map[string]bool)
+	for _, building := range c.Buildings {
+		for _, entrance := range building.Entrances {
+			if entrance.Device == deviceID && !seen[entrance.Key] {
+				seen[entrance.Key] = true
+				keys = append(keys, entrance.Key)
+			}
+		}
+	}
+	return keys
+}
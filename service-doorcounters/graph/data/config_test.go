@@ -0,0 +1,113 @@
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResolveCalibrations(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Copenhagen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(value string) time.Time {
+		moment, err := time.ParseInLocation("2006-01-02 15:04", value, loc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return moment
+	}
+
+	tests := []struct {
+		name         string
+		calibrations []Calibration
+		wantErr      bool
+		// want maps moments in the building's time zone to the factor valid
+		// then, 0 for none
+		want map[string]float64
+	}{
+		{
+			name:         "open-ended",
+			calibrations: []Calibration{{From: "2025-04-01", Factor: 1.5}},
+			want:         map[string]float64{"2025-03-31 23:59": 0, "2025-04-01 00:00": 1.5, "2040-01-01 00:00": 1.5},
+		},
+		{
+			name:         "without start",
+			calibrations: []Calibration{{To: "2025-03-31", Factor: 2}},
+			want:         map[string]float64{"2000-01-01 00:00": 2, "2025-03-31 23:59": 2, "2025-04-01 00:00": 0},
+		},
+		{
+			name: "adjacent, given out of order",
+			calibrations: []Calibration{
+				{From: "2025-04-01", Factor: 1.5},
+				{From: "2025-01-01", To: "2025-03-31", Factor: 1.2},
+			},
+			want: map[string]float64{"2024-12-31 12:00": 0, "2025-02-01 12:00": 1.2, "2025-03-31 23:59": 1.2, "2025-04-01 00:00": 1.5},
+		},
+		{
+			name: "overlapping",
+			calibrations: []Calibration{
+				{From: "2025-01-01", To: "2025-04-01", Factor: 1.2},
+				{From: "2025-04-01", Factor: 1.5},
+			},
+			wantErr: true,
+		},
+		{
+			name: "open-ended followed by another",
+			calibrations: []Calibration{
+				{From: "2025-01-01", Factor: 1.2},
+				{From: "2025-04-01", To: "2025-04-30", Factor: 1.5},
+			},
+			wantErr: true,
+		},
+		{
+			name: "both without start",
+			calibrations: []Calibration{
+				{To: "2025-01-31", Factor: 1.2},
+				{To: "2025-03-31", Factor: 1.5},
+			},
+			wantErr: true,
+		},
+		{
+			name:         "ends before it starts",
+			calibrations: []Calibration{{From: "2025-04-01", To: "2025-03-31", Factor: 1.2}},
+			wantErr:      true,
+		},
+		{
+			name:         "factor not positive",
+			calibrations: []Calibration{{From: "2025-04-01", Factor: 0}},
+			wantErr:      true,
+		},
+		{
+			name:         "invalid date",
+			calibrations: []Calibration{{From: "01-04-2025", Factor: 1.2}},
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entrance := &Entrance{ID: "entrance", Calibrations: tt.calibrations}
+			err := entrance.resolveCalibrations(loc)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			for moment, want := range tt.want {
+				got := 0.0
+				if calibration := entrance.CalibrationAt(at(moment)); calibration != nil {
+					got = calibration.Factor
+				}
+				if got != want {
+					t.Errorf("at %s: got factor %g, want %g", moment, got, want)
+				}
+			}
+		})
+	}
+}
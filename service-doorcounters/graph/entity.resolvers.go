@@ -8,7 +8,6 @@ import (
 	"context"
 	"fmt"
 
-	"github.com/LarsDepuydt/masterthesis-api-aggregation/service-doorcounters/graph/data"
 	"github.com/LarsDepuydt/masterthesis-api-aggregation/service-doorcounters/graph/model"
 )
 
@@ -19,7 +18,7 @@ func (r *entityResolver) FindBuildingByID(ctx context.Context, id string) (*mode
 
 // FindEntranceByID is the resolver for the findEntranceByID field.
 func (r *entityResolver) FindEntranceByID(ctx context.Context, id string) (*model.Entrance, error) {
-	if e, exists := data.EntranceMap[id]; exists {
+	if e, exists := r.Config.EntranceModel(id); exists {
 		return e, nil
 	}
 	return nil, fmt.Errorf("entrance with ID %s not found", id)
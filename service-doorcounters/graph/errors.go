@@ -0,0 +1,187 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// Error codes reported in the extensions of GraphQL errors.
+const (
+	CodeAuthFailed          = "AUTH_FAILED"
+	CodeUpstreamUnavailable = "UPSTREAM_UNAVAILABLE"
+	CodeMalformedPayload    = "MALFORMED_PAYLOAD"
+	CodePartialData         = "PARTIAL_DATA"
+)
+
+// extendedError is an error that reports details in the extensions of the
+// GraphQL error it is returned as.
+type extendedError interface {
+	error
+	Extensions() map[string]any
+}
+
+// AuthError reports that ThingsBoard rejected the credentials or the token.
+type AuthError struct {
+	StatusCode int // 0 if no response was received
+	Err        error
+}
+
+func (e *AuthError) Error() string {
+	return fmt.Sprintf("authentication with the door counter server failed: %v", e.Err)
+}
+
+func (e *AuthError) Unwrap() error { return e.Err }
+
+func (e *AuthError) Extensions() map[string]any {
+	return withStatusCode(map[string]any{"code": CodeAuthFailed}, e.StatusCode)
+}
+
+// UnavailableError reports that the door counter server could not be reached,
+// did not respond in time or responded with an error.
+type UnavailableError struct {
+	StatusCode int // 0 if no response was received
+	Err        error
+}
+
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("door counter server unavailable: %v", e.Err)
+}
+
+func (e *UnavailableError) Unwrap() error { return e.Err }
+
+func (e *UnavailableError) Extensions() map[string]any {
+	return withStatusCode(map[string]any{"code": CodeUpstreamUnavailable}, e.StatusCode)
+}
+
+// MalformedPayloadError reports a response of the door counter server that
+// could not be parsed.
+type MalformedPayloadError struct {
+	Err error
+}
+
+func (e *MalformedPayloadError) Error() string {
+	return fmt.Sprintf("malformed response from door counter server: %v", e.Err)
+}
+
+func (e *MalformedPayloadError) Unwrap() error { return e.Err }
+
+func (e *MalformedPayloadError) Extensions() map[string]any {
+	return map[string]any{"code": CodeMalformedPayload}
+}
+
+// PartialDataError reports values of a telemetry key that were left out of a
+// result because they could not be parsed. It is returned along with the
+// remaining data.
+type PartialDataError struct {
+	Key           string
+	SkippedValues int
+	// Examples holds a few of the values skipped, for diagnosis
+	Examples []string
+}
+
+func (e *PartialDataError) Error() string {
+	return fmt.Sprintf("%d values of telemetry key %s could not be parsed and were left out (e.g., %s)", e.SkippedValues, e.Key, strings.Join(e.Examples, ", "))
+}
+
+func (e *PartialDataError) Extensions() map[string]any {
+	return map[string]any{"code": CodePartialData, "key": e.Key, "skippedValues": e.SkippedValues}
+}
+
+// PartialDataErrors holds the PartialDataError of every telemetry key of a
+// fetch that had values left out, by key.
+type PartialDataErrors map[string]*PartialDataError
+
+func (e PartialDataErrors) Error() string {
+	keys := make([]string, 0, len(e))
+	for key := range e {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	messages := make([]string, len(keys))
+	for i, key := range keys {
+		messages[i] = e[key].Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// withStatusCode adds the HTTP status code of an upstream response to
+// extensions, if a response was received.
+func withStatusCode(extensions map[string]any, statusCode int) map[string]any {
+	if statusCode != 0 {
+		extensions["upstreamStatusCode"] = statusCode
+	}
+	return extensions
+}
+
+// requestError classifies an error sending a request upstream. Requests
+// canceled by the client are not the fault of upstream and are returned as is.
+func requestError(err error) error {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return err
+	case errors.Is(err, context.DeadlineExceeded):
+		return &UnavailableError{Err: fmt.Errorf("request timed out: %w", err)}
+	default:
+		return &UnavailableError{Err: err}
+	}
+}
+
+// responseError classifies an unsuccessful upstream response, or returns nil
+// for a successful one.
+func responseError(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	// ThingsBoard explains errors in a JSON body with a message
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	err := errors.New(resp.Status)
+	if message := strings.TrimSpace(string(body)); message != "" {
+		err = fmt.Errorf("%s: %s", resp.Status, message)
+	}
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return &AuthError{StatusCode: resp.StatusCode, Err: err}
+	}
+	return &UnavailableError{StatusCode: resp.StatusCode, Err: err}
+}
+
+// withPartialData reports the PartialDataErrors of the given keys as errors of
+// the field being resolved, so the field still returns the remaining data.
+// Values of other keys are not part of the field and are not reported. Other
+// errors are returned as is.
+func withPartialData(ctx context.Context, err error, keys ...string) error {
+	var partial PartialDataErrors
+	if errors.As(err, &partial) {
+		for _, key := range keys {
+			if keyErr, ok := partial[key]; ok {
+				graphql.AddError(ctx, keyErr)
+			}
+		}
+		return nil
+	}
+	return err
+}
+
+// ErrorPresenter presents errors like the default presenter, adding the
+// extensions of errors that have them.
+func ErrorPresenter(ctx context.Context, err error) *gqlerror.Error {
+	gqlErr := graphql.DefaultErrorPresenter(ctx, err)
+	var extended extendedError
+	if errors.As(err, &extended) {
+		if gqlErr.Extensions == nil {
+			gqlErr.Extensions = make(map[string]any)
+		}
+		for key, value := range extended.Extensions() {
+			gqlErr.Extensions[key] = value
+		}
+	}
+	return gqlErr
+}
@@ -0,0 +1,93 @@
+package graph
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/LarsDepuydt/masterthesis-api-aggregation/service-doorcounters/graph/data"
+)
+
+// telemetryWindow identifies a fetch of the telemetry of a device, for use as
+// a map key.
+type telemetryWindow struct {
+	deviceID       string
+	startTs, endTs int64
+}
+
+// telemetryFetch is a fetch that is running or done. done is closed once
+// telemetry and err are set.
+type telemetryFetch struct {
+	done      chan struct{}
+	telemetry []TelemetryData
+	err       error
+}
+
+// TelemetryFetches shares telemetry fetches within a request, so entrances
+// counted by the same device download its telemetry once per time window.
+type TelemetryFetches struct {
+	tokens *TokenManager
+	config *data.Config
+	// now is the time of the request, used as the end of open time windows so
+	// they are the same for all entrances
+	now time.Time
+
+	mu      sync.Mutex
+	fetches map[telemetryWindow]*telemetryFetch
+}
+
+// NewTelemetryFetches creates the fetches of one request.
+func NewTelemetryFetches(tokens *TokenManager, config *data.Config) *TelemetryFetches {
+	return &TelemetryFetches{
+		tokens:  tokens,
+		config:  config,
+		now:     time.Now(),
+		fetches: make(map[telemetryWindow]*telemetryFetch),
+	}
+}
+
+// Fetch returns the telemetry of all keys of a device in use by entrances,
+// fetching it unless another entrance of the request already did.
+func (f *TelemetryFetches) Fetch(ctx context.Context, device *data.Device, startTs, endTs int64) ([]TelemetryData, error) {
+	window := telemetryWindow{deviceID: device.ID, startTs: startTs, endTs: endTs}
+
+	f.mu.Lock()
+	fetch, ok := f.fetches[window]
+	if !ok {
+		fetch = &telemetryFetch{done: make(chan struct{})}
+		f.fetches[window] = fetch
+	}
+	f.mu.Unlock()
+
+	if !ok {
+		fetch.telemetry, fetch.err = FetchTelemetryData(ctx, f.tokens, device, f.config.DeviceKeys(device.ID), startTs, endTs)
+		close(fetch.done)
+	}
+	select {
+	case <-fetch.done:
+		return fetch.telemetry, fetch.err
+	case <-ctx.Done():
+		return nil, requestError(ctx.Err())
+	}
+}
+
+type fetchesKey struct{}
+
+// WithTelemetryFetches attaches new telemetry fetches to the context of every
+// request.
+func (r *Resolver) WithTelemetryFetches(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := context.WithValue(req.Context(), fetchesKey{}, NewTelemetryFetches(r.Tokens, r.Config))
+		next.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
+
+// fetchesFor returns the telemetry fetches of the request of ctx. Without
+// them, as when resolving outside of an HTTP request, every call gets its own.
+func (r *Resolver) fetchesFor(ctx context.Context) *TelemetryFetches {
+	if fetches, ok := ctx.Value(fetchesKey{}).(*TelemetryFetches); ok {
+		return fetches
+	}
+	return NewTelemetryFetches(r.Tokens, r.Config)
+}
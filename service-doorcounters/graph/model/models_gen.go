@@ -2,14 +2,76 @@
 
 package model
 
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// The telemetry data of one interval, summed over the hourly values reported
+// within it.
+type AggregatedTelemetry struct {
+	// The start of the interval.
+	StartTime time.Time `json:"startTime"`
+	// The end of the interval (exclusive).
+	EndTime time.Time `json:"endTime"`
+	// The sum of the values reported during the interval. As each value is the
+	// number of passages divided by 2, this approximates the number of people
+	// that passed through the entrances.
+	Value int32 `json:"value"`
+	// The sum of the calibrated values, each value multiplied by the calibration
+	// factor of its entrance at its time.
+	CalibratedValue float64 `json:"calibratedValue"`
+	// The calibrations applied to the values of the interval. Values without
+	// calibration are listed with a factor of 1 and no validity range.
+	Calibrations []*Calibration `json:"calibrations"`
+	// The number of hourly values reported during the interval, counted per
+	// entrance.
+	ReportedHours int32 `json:"reportedHours"`
+	// The number of hourly values expected during the interval up to now,
+	// counted per entrance.
+	ExpectedHours int32 `json:"expectedHours"`
+	// The fraction of the expected hourly values that were reported, from 0 to
+	// 1. Values below 1 mean the sum is too low due to missing data. Null when
+	// no values are expected yet, as for intervals in the future.
+	Completeness *float64 `json:"completeness,omitempty"`
+}
+
 type Building struct {
 	ID string `json:"id"`
-	// A list of entrances belonging to this building.
+	// Estimates the number of people in this building per hour of a day, and the
+	// number of visitors, from the passages counted at its entrances. Counters
+	// do not tell entries from exits, so the estimate rests on the calibration
+	// returned with it.
+	EstimatedOccupancy *EstimatedOccupancy `json:"estimatedOccupancy"`
+	// A list of entrances belonging to this building. Buildings without
+	// configured door counters have no entrances.
 	Entrances []*Entrance `json:"entrances"`
+	// The telemetry data of all entrances of this building summed per interval,
+	// such as the number of passages through all entrances per day.
+	AggregatedTelemetry []*AggregatedTelemetry `json:"aggregatedTelemetry"`
 }
 
 func (Building) IsEntity() {}
 
+// A correction factor for the counts of an entrance, configured for a range of
+// days, e.g. after comparing a counter with a manual count.
+type Calibration struct {
+	// The entrance whose counts are corrected.
+	EntranceID string `json:"entranceId"`
+	// The factor reported values are multiplied by.
+	Factor float64 `json:"factor"`
+	// The first day the factor is valid, as YYYY-MM-DD in the time zone of the
+	// building, or null if it is valid from the start.
+	ValidFrom *string `json:"validFrom,omitempty"`
+	// The last day the factor is valid, as YYYY-MM-DD in the time zone of the
+	// building, or null if it is valid until further notice.
+	ValidTo *string `json:"validTo,omitempty"`
+	// Explains where the factor comes from.
+	Note *string `json:"note,omitempty"`
+}
+
 // Represents an entrance of a building, which may have associated telemetry data.
 // This type is part of a federated schema, indicated by the @key directive.
 type Entrance struct {
@@ -18,7 +80,7 @@ type Entrance struct {
 	// The name or designation of the entrance (e.g., 'Main Entrance', 'Service Entrance').
 	Name string `json:"name"`
 	// Retrieves telemetry data recorded at this entrance within a specified
-	// time window.
+	// time window, ordered by timestamp.
 	//
 	// Note on Telemetry Data:
 	// The data is sourced from laser counters. Each passage detected by the counter
@@ -30,11 +92,92 @@ type Entrance struct {
 	// They should not be used as a precise real-time count of people inside
 	// the building or for determining direction of movement.
 	TelemetryData []*TelemetryData `json:"telemetryData"`
+	// Retrieves the telemetry data recorded at this entrance summed per hour,
+	// day or week. Each hourly value is attributed to the interval in which its
+	// collection period started, i.e., the hour before its timestamp.
+	AggregatedTelemetry []*AggregatedTelemetry `json:"aggregatedTelemetry"`
 }
 
 func (Entrance) IsEntity() {}
 
+// The estimated occupancy of a building during a day.
+type EstimatedOccupancy struct {
+	// The day, as YYYY-MM-DD.
+	Date string `json:"date"`
+	// The estimate per hour of the day, starting at midnight.
+	Hours []*OccupancyHour `json:"hours"`
+	// The number of passages through all entrances during the day, from the
+	// calibrated values.
+	Passages float64 `json:"passages"`
+	// The estimated number of visits, i.e., entries into the building.
+	Visits float64 `json:"visits"`
+	// The estimated number of distinct people visiting the building.
+	UniqueVisitors float64 `json:"uniqueVisitors"`
+	// The highest estimated number of people present at the end of an hour.
+	PeakOccupancy float64 `json:"peakOccupancy"`
+	// The end of the hour with the highest occupancy, or null if nobody was
+	// present.
+	PeakTime *time.Time `json:"peakTime,omitempty"`
+	// The number of passages turned from entries into exits (if positive) or
+	// from exits into entries (if negative) to have the building empty at the
+	// end of the day. A large correction means the calibration fits the day
+	// poorly.
+	BalanceCorrection float64 `json:"balanceCorrection"`
+	// The fraction of the expected hourly values that were reported, from 0 to
+	// 1, or null if none are expected yet. The estimate is too low when below 1.
+	Completeness *float64 `json:"completeness,omitempty"`
+	// The calibration the estimate is based on.
+	Assumptions *OccupancyAssumptions `json:"assumptions"`
+	// The calibrations applied to the values of the entrances during the day.
+	Calibrations []*Calibration `json:"calibrations"`
+}
+
+// The calibration of an occupancy estimate, configured per building.
+type OccupancyAssumptions struct {
+	// The IANA time zone of the day and the opening hours.
+	Timezone string `json:"timezone"`
+	// The number of passages a reported value stands for.
+	PassagesPerValue float64 `json:"passagesPerValue"`
+	// The number of passages per visit, 2 for entering and leaving.
+	PassagesPerVisit float64 `json:"passagesPerVisit"`
+	// The average number of visits per visitor and day.
+	VisitsPerVisitor float64 `json:"visitsPerVisitor"`
+	// The opening time, as HH:MM.
+	OpensAt string `json:"opensAt"`
+	// The closing time, as HH:MM.
+	ClosesAt string `json:"closesAt"`
+	// The share of passages that are entries at opening time. It decreases
+	// linearly over the opening hours to the same share of exits at closing
+	// time, and stays constant outside them.
+	EntryShareAtOpen float64 `json:"entryShareAtOpen"`
+	// Whether the building is assumed empty at the start and end of the day.
+	ResetAtEndOfDay bool `json:"resetAtEndOfDay"`
+}
+
+// The estimated occupancy of a building during an hour.
+type OccupancyHour struct {
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime"`
+	// The number of passages through all entrances during the hour, from the
+	// calibrated values.
+	Passages float64 `json:"passages"`
+	// The estimated number of passages that were entries.
+	Entries float64 `json:"entries"`
+	// The estimated number of passages that were exits.
+	Exits float64 `json:"exits"`
+	// The estimated number of people present at the end of the hour.
+	Occupancy float64 `json:"occupancy"`
+}
+
 // Provides the root fields for querying entrance data.
+//
+// Errors fetching telemetry data from the door counter server carry a code in
+// their extensions: AUTH_FAILED when the server rejects the credentials,
+// UPSTREAM_UNAVAILABLE when it cannot be reached, times out or responds with an
+// error, and MALFORMED_PAYLOAD when its response cannot be parsed. PARTIAL_DATA
+// is reported along with the data for every telemetry key of the field that had
+// values left out because they could not be parsed, with the key and the number
+// of values skipped in its extensions.
 type Query struct {
 }
 
@@ -52,5 +195,59 @@ type TelemetryData struct {
 	// The calculated value of passages recorded during the collection period,
 	// divided by 2. Due to the collection method (sum of passages / 2 per hour),
 	// this number is most meaningful when aggregated over longer periods like a full day.
+	// This is the value as reported by the counter, without calibration.
 	Value *int32 `json:"value,omitempty"`
+	// The value corrected by the calibration factor of the entrance, estimating
+	// the value a counter without misses would have reported.
+	CalibratedValue *float64 `json:"calibratedValue,omitempty"`
+	// The factor the value was multiplied by, 1 if no calibration applies.
+	CalibrationFactor float64 `json:"calibrationFactor"`
+	// The calibration applied to the value, or null if none applies.
+	Calibration *Calibration `json:"calibration,omitempty"`
+}
+
+// The length of the intervals telemetry data is aggregated into. Intervals start
+// at the beginning of the hour, day or week (Monday) in the requested time zone,
+// so days are 23 or 25 hours long at daylight saving time changes.
+type TelemetryInterval string
+
+const (
+	TelemetryIntervalHour TelemetryInterval = "HOUR"
+	TelemetryIntervalDay  TelemetryInterval = "DAY"
+	TelemetryIntervalWeek TelemetryInterval = "WEEK"
+)
+
+var AllTelemetryInterval = []TelemetryInterval{
+	TelemetryIntervalHour,
+	TelemetryIntervalDay,
+	TelemetryIntervalWeek,
+}
+
+func (e TelemetryInterval) IsValid() bool {
+	switch e {
+	case TelemetryIntervalHour, TelemetryIntervalDay, TelemetryIntervalWeek:
+		return true
+	}
+	return false
+}
+
+func (e TelemetryInterval) String() string {
+	return string(e)
+}
+
+func (e *TelemetryInterval) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = TelemetryInterval(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid TelemetryInterval", str)
+	}
+	return nil
+}
+
+func (e TelemetryInterval) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
 }
@@ -0,0 +1,155 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/LarsDepuydt/masterthesis-api-aggregation/service-doorcounters/graph/data"
+	"github.com/LarsDepuydt/masterthesis-api-aggregation/service-doorcounters/graph/model"
+)
+
+// dateFormat is the format of dates in arguments and results.
+const dateFormat = "2006-01-02"
+
+// entryShare returns the share of passages that are entries at a time of day.
+// It decreases linearly from the share at opening time to the same share of
+// exits at closing time, and is constant outside the opening hours.
+func entryShare(calibration data.Occupancy, sinceMidnight time.Duration) float64 {
+	switch {
+	case sinceMidnight <= calibration.Opens:
+		return calibration.EntryShareAtOpen
+	case sinceMidnight >= calibration.Closes:
+		return 1 - calibration.EntryShareAtOpen
+	}
+	progress := float64(sinceMidnight-calibration.Opens) / float64(calibration.Closes-calibration.Opens)
+	return calibration.EntryShareAtOpen + (1-2*calibration.EntryShareAtOpen)*progress
+}
+
+// timeOfDay returns the wall clock time of t as the time since midnight.
+func timeOfDay(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+}
+
+// balanceShares shifts the entry shares of hours by the same amount, within 0
+// and 1, so that half of the passages are entries. It returns the shifted
+// shares and the number of passages turned from entries into exits.
+func balanceShares(passages, shares []float64) ([]float64, float64) {
+	total, entries := 0.0, 0.0
+	for i := range passages {
+		total += passages[i]
+		entries += passages[i] * shares[i]
+	}
+	shifted := make([]float64, len(shares))
+	shift := func(delta float64) float64 {
+		sum := 0.0
+		for i := range shares {
+			shifted[i] = math.Min(math.Max(shares[i]-delta, 0), 1)
+			sum += passages[i] * shifted[i]
+		}
+		return sum
+	}
+
+	// The entries decrease with the shift, so it is found by bisection
+	low, high := -1.0, 1.0
+	for iteration := 0; iteration < 60; iteration++ {
+		middle := (low + high) / 2
+		if shift(middle) > total/2 {
+			low = middle
+		} else {
+			high = middle
+		}
+	}
+	balanced := shift((low + high) / 2)
+	return shifted, entries - balanced
+}
+
+// estimateOccupancy estimates the people present in a building per hour of a
+// day. Each hour, passages are split into entries and exits by the entry share
+// at the middle of the hour. When the building is assumed empty at the end of
+// the day, the shares are shifted until entries and exits balance.
+func (r *Resolver) estimateOccupancy(ctx context.Context, building *data.Building, date string) (*model.EstimatedOccupancy, error) {
+	calibration := building.Occupancy
+	day, err := time.ParseInLocation(dateFormat, date, calibration.Location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", date)
+	}
+	// The last moment of the day, as days differ in length at daylight
+	// saving time changes
+	lastMoment := day.AddDate(0, 0, 1).Add(-time.Nanosecond)
+
+	hourly, err := r.aggregateTelemetry(ctx, building.Entrances, day, &lastMoment, model.TelemetryIntervalHour, &calibration.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	estimate := &model.EstimatedOccupancy{
+		Date:         date,
+		Hours:        make([]*model.OccupancyHour, len(hourly)),
+		Calibrations: []*model.Calibration{},
+		Assumptions: &model.OccupancyAssumptions{
+			Timezone:         calibration.Timezone,
+			PassagesPerValue: calibration.PassagesPerValue,
+			PassagesPerVisit: calibration.PassagesPerVisit,
+			VisitsPerVisitor: calibration.VisitsPerVisitor,
+			OpensAt:          calibration.OpensAt,
+			ClosesAt:         calibration.ClosesAt,
+			EntryShareAtOpen: calibration.EntryShareAtOpen,
+			ResetAtEndOfDay:  *calibration.ResetAtEndOfDay,
+		},
+	}
+
+	passages := make([]float64, len(hourly))
+	shares := make([]float64, len(hourly))
+	var reported, expected int32
+	// Calibrations are shared between hours, so they are told apart by identity
+	seen := make(map[*model.Calibration]bool)
+	for i, aggregated := range hourly {
+		passages[i] = aggregated.CalibratedValue * calibration.PassagesPerValue
+		middle := aggregated.StartTime.Add(aggregated.EndTime.Sub(aggregated.StartTime) / 2)
+		shares[i] = entryShare(calibration, timeOfDay(middle.In(calibration.Location)))
+		estimate.Passages += passages[i]
+		reported += aggregated.ReportedHours
+		expected += aggregated.ExpectedHours
+		for _, applied := range aggregated.Calibrations {
+			if !seen[applied] {
+				seen[applied] = true
+				estimate.Calibrations = append(estimate.Calibrations, applied)
+			}
+		}
+	}
+	if *calibration.ResetAtEndOfDay && estimate.Passages > 0 {
+		shares, estimate.BalanceCorrection = balanceShares(passages, shares)
+	}
+	for i, aggregated := range hourly {
+		estimate.Hours[i] = &model.OccupancyHour{
+			StartTime: aggregated.StartTime,
+			EndTime:   aggregated.EndTime,
+			Passages:  passages[i],
+			Entries:   passages[i] * shares[i],
+			Exits:     passages[i] * (1 - shares[i]),
+		}
+	}
+
+	occupancy := 0.0
+	for _, hour := range estimate.Hours {
+		// Nobody can leave an empty building, so exits beyond the people
+		// present are ignored
+		occupancy = math.Max(occupancy+hour.Entries-hour.Exits, 0)
+		hour.Occupancy = occupancy
+		if occupancy > estimate.PeakOccupancy {
+			estimate.PeakOccupancy = occupancy
+			peak := hour.EndTime
+			estimate.PeakTime = &peak
+		}
+	}
+
+	estimate.Visits = estimate.Passages / calibration.PassagesPerVisit
+	estimate.UniqueVisitors = estimate.Visits / calibration.VisitsPerVisitor
+	if expected > 0 {
+		completeness := min(float64(reported)/float64(expected), 1)
+		estimate.Completeness = &completeness
+	}
+	return estimate, nil
+}
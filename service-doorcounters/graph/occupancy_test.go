@@ -0,0 +1,79 @@
+package graph
+
+import (
+	"math"
+	"testing"
+)
+
+func TestBalanceShares(t *testing.T) {
+	tests := []struct {
+		name           string
+		passages       []float64
+		shares         []float64
+		want           []float64
+		wantCorrection float64
+	}{
+		{
+			name:     "already balanced",
+			passages: []float64{10, 10},
+			shares:   []float64{0.75, 0.25},
+			want:     []float64{0.75, 0.25},
+		},
+		{
+			name:           "too many entries",
+			passages:       []float64{10, 10},
+			shares:         []float64{0.9, 0.6},
+			want:           []float64{0.65, 0.35},
+			wantCorrection: 5,
+		},
+		{
+			name:           "too few entries",
+			passages:       []float64{30, 10},
+			shares:         []float64{0.4, 0.2},
+			want:           []float64{0.55, 0.35},
+			wantCorrection: -6,
+		},
+		{
+			// The first share cannot drop below 0, so the second one makes
+			// up for it
+			name:           "clamped at 0",
+			passages:       []float64{2, 18},
+			shares:         []float64{0.1, 0.9},
+			want:           []float64{0, 10.0 / 18},
+			wantCorrection: 6.4,
+		},
+		{
+			name:           "clamped at 1",
+			passages:       []float64{18, 2},
+			shares:         []float64{0.1, 0.9},
+			want:           []float64{8.0 / 18, 1},
+			wantCorrection: -6.4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shifted, correction := balanceShares(tt.passages, tt.shares)
+
+			total, entries := 0.0, 0.0
+			for i := range tt.passages {
+				if shifted[i] < 0 || shifted[i] > 1 {
+					t.Errorf("share %d is %g, outside 0 and 1", i, shifted[i])
+				}
+				total += tt.passages[i]
+				entries += tt.passages[i] * shifted[i]
+			}
+			if math.Abs(entries-total/2) > 1e-6 {
+				t.Errorf("got %g entries, want half of %g passages", entries, total)
+			}
+			if math.Abs(correction-tt.wantCorrection) > 1e-6 {
+				t.Errorf("got a correction of %g, want %g", correction, tt.wantCorrection)
+			}
+			for i := range tt.want {
+				if math.Abs(shifted[i]-tt.want[i]) > 1e-6 {
+					t.Errorf("share %d: got %g, want %g", i, shifted[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -3,26 +3,39 @@ package graph
 //go:generate go run github.com/99designs/gqlgen generate
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
+	"math"
 	"net/http"
-	"os"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LarsDepuydt/masterthesis-api-aggregation/service-doorcounters/graph/data"
 )
 
 const (
-	baseURL      = "http://iot.multiteknik.dk:8080"
+	// DefaultBaseURL is the address of the ThingsBoard server
+	DefaultBaseURL = "http://iot.multiteknik.dk:8080"
+
 	authEndpoint = "/api/auth/login"
-	dataEndpoint = "/api/plugins/telemetry/DEVICE/47afeb80-276e-11ec-92de-537d4a380471/values/timeseries"
+	dataEndpoint = "/api/plugins/telemetry/%s/%s/values/timeseries"
+
+	// telemetryPageSize is the number of values per key fetched per request
+	telemetryPageSize = 10000
+
+	// upstreamTimeout limits how long a single request upstream may take
+	upstreamTimeout = 20 * time.Second
 )
 
 // Resolver serves as dependency injection for your app, add any dependencies you require here.
-type Resolver struct{}
-
-// AuthResponse stores the token received after login
-type AuthResponse struct {
-	Token string `json:"token"`
+type Resolver struct {
+	Tokens *TokenManager
+	Config *data.Config
 }
 
 // TelemetryResponse represents the API response
@@ -31,107 +44,159 @@ type TelemetryResponse map[string][]struct {
 	Value string `json:"value"`
 }
 
-// TelemetryData represents the structured telemetry data
+// TelemetryData represents the structured telemetry data of a device at one
+// timestamp, by telemetry key
 type TelemetryData struct {
-	Timestamp int64  `json:"timestamp"`
-	DoorA     *int32 `json:"c1"`
-	DoorB     *int32 `json:"c3"`
-	DoorC     *int32 `json:"c2"`
+	Timestamp int64            `json:"timestamp"`
+	Values    map[string]int32 `json:"values"`
 }
 
-// FetchAuthToken fetches the authentication token
-func FetchAuthToken() (string, error) {
-	username := os.Getenv("DOOR_USERNAME")
-	password := os.Getenv("DOOR_PASSWORD")
-
-	authPayload := map[string]string{"username": username, "password": password}
-	payloadBytes, _ := json.Marshal(authPayload)
+// getJSON sends a GET request with the current token and decodes the JSON
+// response into out. A request that is rejected with 401 is retried once with
+// a new token, as the server may have revoked the cached one.
+func getJSON(ctx context.Context, tokens *TokenManager, target string, out any) error {
+	for attempt := 0; ; attempt++ {
+		token, err := tokens.Token(ctx)
+		if err != nil {
+			return err
+		}
 
-	req, err := http.NewRequest("POST", baseURL+authEndpoint, bytes.NewBuffer(payloadBytes))
-	if err != nil {
-		return "", err
-	}
-	req.Header.Set("Content-Type", "application/json")
+		err = func() error {
+			ctx, cancel := context.WithTimeout(ctx, upstreamTimeout)
+			defer cancel()
+			req, err := http.NewRequestWithContext(ctx, "GET", target, nil)
+			if err != nil {
+				return err
+			}
+			req.Header.Set("X-Authorization", "Bearer "+token)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
+			resp, err := tokens.client.Do(req)
+			if err != nil {
+				return requestError(err)
+			}
+			defer resp.Body.Close()
+			if err := responseError(resp); err != nil {
+				return err
+			}
 
-	body, _ := io.ReadAll(resp.Body)
-	var authResp AuthResponse
-	json.Unmarshal(body, &authResp)
+			if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+				if ctx.Err() != nil {
+					return requestError(ctx.Err())
+				}
+				return &MalformedPayloadError{Err: err}
+			}
+			return nil
+		}()
 
-	if authResp.Token == "" {
-		return "", fmt.Errorf("failed to retrieve auth token")
+		var authErr *AuthError
+		if attempt == 0 && errors.As(err, &authErr) && authErr.StatusCode == http.StatusUnauthorized {
+			tokens.Invalidate(token)
+			continue
+		}
+		return err
 	}
-	return authResp.Token, nil
 }
 
-// FetchTelemetryData fetches IoT telemetry data
-func FetchTelemetryData(startTs, endTs int64) ([]TelemetryData, error) {
-	token, err := FetchAuthToken()
-	if err != nil {
+// fetchTelemetryPage fetches the oldest telemetry of the given keys of a
+// device from startTs on, at most telemetryPageSize values per key
+func fetchTelemetryPage(ctx context.Context, tokens *TokenManager, device *data.Device, keys []string, startTs, endTs int64) (TelemetryResponse, error) {
+	endpoint := fmt.Sprintf(dataEndpoint, url.PathEscape(device.EntityType), url.PathEscape(device.ID))
+	query := url.Values{}
+	query.Set("keys", strings.Join(keys, ","))
+	query.Set("startTs", strconv.FormatInt(startTs, 10))
+	query.Set("endTs", strconv.FormatInt(endTs, 10))
+	query.Set("limit", strconv.Itoa(telemetryPageSize))
+	query.Set("orderBy", "ASC")
+
+	var telemetryResponse TelemetryResponse
+	if err := getJSON(ctx, tokens, tokens.baseURL+endpoint+"?"+query.Encode(), &telemetryResponse); err != nil {
 		return nil, err
 	}
+	return telemetryResponse, nil
+}
 
-	url := fmt.Sprintf("%s%s?keys=c1,c2,c3&startTs=%d&endTs=%d&limit=100000", baseURL, dataEndpoint, startTs, endTs)
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Set("X-Authorization", "Bearer "+token)
+// parseTelemetryValue parses a reported value. ThingsBoard reports values as
+// strings, which may hold a whole number in decimal notation (e.g., "12.0").
+func parseTelemetryValue(value string) (int32, error) {
+	if n, err := strconv.ParseInt(value, 10, 32); err == nil {
+		return int32(n), nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f != math.Trunc(f) || f < math.MinInt32 || f > math.MaxInt32 {
+		return 0, fmt.Errorf("not a count: %q", value)
+	}
+	return int32(f), nil
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
+// FetchTelemetryData fetches IoT telemetry data of the given keys of a device,
+// ordered by timestamp. Upstream limits the values per key of a request, so
+// keys filling a page are fetched again from after their last value. Values
+// that cannot be parsed are left out and reported per key by a
+// PartialDataErrors, returned along with the remaining data.
+func FetchTelemetryData(ctx context.Context, tokens *TokenManager, device *data.Device, keys []string, startTs, endTs int64) ([]TelemetryData, error) {
+	byTimestamp := make(map[int64]map[string]int32)
+	// cursors holds the timestamp from which each key is still to be fetched
+	cursors := make(map[string]int64, len(keys))
+	for _, key := range keys {
+		cursors[key] = startTs
 	}
-	defer resp.Body.Close()
+	partial := make(PartialDataErrors)
+
+	for len(cursors) > 0 {
+		pending := make([]string, 0, len(cursors))
+		pageStart := endTs
+		for _, key := range keys {
+			if cursor, ok := cursors[key]; ok {
+				pending = append(pending, key)
+				pageStart = min(pageStart, cursor)
+			}
+		}
 
-	body, _ := io.ReadAll(resp.Body)
-	var telemetryResponse TelemetryResponse
-	json.Unmarshal(body, &telemetryResponse)
-
-	var data []TelemetryData
-	for key, values := range telemetryResponse {
-		for _, entry := range values {
-			// Convert string to integer
-			var valueInt int32
-			fmt.Sscanf(entry.Value, "%d", &valueInt)
-
-			// Find existing entry or create a new one
-			found := false
-			for i := range data {
-				if data[i].Timestamp == entry.Ts {
-					switch key {
-					case "c1": // Indgang A (to parking, street)
-						data[i].DoorA = &valueInt
-					case "c2": // Indgang C (to campus, bus station)
-						data[i].DoorC = &valueInt
-					case "c3": // Indgang B (to building)
-						data[i].DoorB = &valueInt
-					}
-					found = true
-					break
+		page, err := fetchTelemetryPage(ctx, tokens, device, pending, pageStart, endTs)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range pending {
+			values := page[key]
+			cursor := cursors[key]
+			for _, entry := range values {
+				// Values before the cursor of a key were fetched with an earlier page
+				if entry.Ts < cursor {
+					continue
 				}
-			}
 
-			// If not found, create a new entry
-			if !found {
-				newEntry := TelemetryData{
-					Timestamp: entry.Ts,
+				value, err := parseTelemetryValue(entry.Value)
+				if err != nil {
+					if partial[key] == nil {
+						partial[key] = &PartialDataError{Key: key}
+					}
+					partial[key].SkippedValues++
+					if len(partial[key].Examples) < 3 {
+						partial[key].Examples = append(partial[key].Examples, fmt.Sprintf("at %d: %v", entry.Ts, err))
+					}
+					continue
 				}
-				switch key {
-				case "c1":
-					newEntry.DoorA = &valueInt
-				case "c2":
-					newEntry.DoorC = &valueInt
-				case "c3":
-					newEntry.DoorB = &valueInt
+
+				if byTimestamp[entry.Ts] == nil {
+					byTimestamp[entry.Ts] = make(map[string]int32)
 				}
-				data = append(data, newEntry)
+				byTimestamp[entry.Ts][key] = value
+			}
+			if len(values) < telemetryPageSize {
+				delete(cursors, key)
+			} else {
+				cursors[key] = max(cursor, values[len(values)-1].Ts+1)
 			}
 		}
 	}
-	return data, nil
+
+	telemetry := make([]TelemetryData, 0, len(byTimestamp))
+	for ts, values := range byTimestamp {
+		telemetry = append(telemetry, TelemetryData{Timestamp: ts, Values: values})
+	}
+	sort.Slice(telemetry, func(i, j int) bool { return telemetry[i].Timestamp < telemetry[j].Timestamp })
+	if len(partial) > 0 {
+		return telemetry, partial
+	}
+	return telemetry, nil
 }
@@ -0,0 +1,176 @@
+package graph
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LarsDepuydt/masterthesis-api-aggregation/service-doorcounters/graph/data"
+)
+
+// telemetryValue is a value reported by the fake ThingsBoard server.
+type telemetryValue struct {
+	Ts    int64  `json:"ts"`
+	Value string `json:"value"`
+}
+
+// fakeThingsBoard serves the given values per key, ordered by timestamp, with
+// the limit and window of every request applied as ThingsBoard does. It
+// returns a token manager for the server and the number of telemetry requests
+// served.
+func fakeThingsBoard(t *testing.T, values map[string][]telemetryValue) (*TokenManager, *int) {
+	t.Helper()
+	claims := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"exp":%d}`, time.Now().Add(time.Hour).Unix())))
+	token := "header." + claims + ".signature"
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == authEndpoint {
+			json.NewEncoder(w).Encode(AuthResponse{Token: token})
+			return
+		}
+		requests++
+		query := r.URL.Query()
+		startTs, _ := strconv.ParseInt(query.Get("startTs"), 10, 64)
+		endTs, _ := strconv.ParseInt(query.Get("endTs"), 10, 64)
+		limit, _ := strconv.Atoi(query.Get("limit"))
+
+		response := make(map[string][]telemetryValue)
+		for _, key := range strings.Split(query.Get("keys"), ",") {
+			page := []telemetryValue{}
+			for _, value := range values[key] {
+				if value.Ts >= startTs && value.Ts <= endTs && len(page) < limit {
+					page = append(page, value)
+				}
+			}
+			response[key] = page
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(server.Close)
+
+	return NewTokenManager(server.URL, "user", "password"), &requests
+}
+
+// countsEvery returns n values of 1, every step milliseconds from first.
+func countsEvery(n int, first, step int64) []telemetryValue {
+	values := make([]telemetryValue, n)
+	for i := range values {
+		values[i] = telemetryValue{Ts: first + int64(i)*step, Value: "1"}
+	}
+	return values
+}
+
+// withValue replaces the value at index i.
+func withValue(values []telemetryValue, i int, value string) []telemetryValue {
+	values[i].Value = value
+	return values
+}
+
+func TestFetchTelemetryData(t *testing.T) {
+	tests := []struct {
+		name         string
+		values       map[string][]telemetryValue
+		wantRequests int
+		wantSkipped  map[string]int // skipped values per key, nil if none
+	}{
+		{
+			name:         "single page",
+			values:       map[string][]telemetryValue{"a": countsEvery(3, 1, 1), "b": countsEvery(2, 1, 2)},
+			wantRequests: 1,
+		},
+		{
+			// a needs three pages, b exactly fills one and c never fills one,
+			// so the keys advance unevenly
+			name: "keys advancing unevenly",
+			values: map[string][]telemetryValue{
+				"a": countsEvery(25000, 1, 1),
+				"b": countsEvery(telemetryPageSize, 1, 3),
+				"c": countsEvery(5, 1000, 1000),
+			},
+			wantRequests: 3,
+		},
+		{
+			name:         "page ending on a shared timestamp",
+			values:       map[string][]telemetryValue{"a": countsEvery(telemetryPageSize+1, 1, 1), "b": countsEvery(telemetryPageSize+1, 1, 1)},
+			wantRequests: 2,
+		},
+		{
+			name: "unparseable values",
+			values: map[string][]telemetryValue{
+				"a": {{Ts: 1, Value: "1"}, {Ts: 2, Value: "n/a"}, {Ts: 3, Value: "1.5"}},
+				"b": countsEvery(3, 1, 1),
+			},
+			wantRequests: 1,
+			wantSkipped:  map[string]int{"a": 2},
+		},
+		{
+			// The second page starts at the cursor of a, so it repeats values
+			// of b, including one that cannot be parsed
+			name: "values repeated on later pages",
+			values: map[string][]telemetryValue{
+				"a": countsEvery(2*telemetryPageSize, 1, 1),
+				"b": withValue(countsEvery(telemetryPageSize, 1, 3), 5000, "n/a"),
+			},
+			wantRequests: 3,
+			wantSkipped:  map[string]int{"b": 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, requests := fakeThingsBoard(t, tt.values)
+			keys := make([]string, 0, len(tt.values))
+			for key := range tt.values {
+				keys = append(keys, key)
+			}
+			device := &data.Device{ID: "device", EntityType: "DEVICE"}
+
+			telemetry, err := FetchTelemetryData(context.Background(), tokens, device, keys, 0, 1<<40)
+
+			var partial PartialDataErrors
+			if tt.wantSkipped == nil && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantSkipped != nil {
+				if !errors.As(err, &partial) {
+					t.Fatalf("expected PartialDataErrors, got %v", err)
+				}
+				if len(partial) != len(tt.wantSkipped) {
+					t.Errorf("got partial data for %d keys, want %d", len(partial), len(tt.wantSkipped))
+				}
+				for key, skipped := range tt.wantSkipped {
+					if partial[key] == nil || partial[key].SkippedValues != skipped {
+						t.Errorf("key %s: got %+v, want %d skipped values", key, partial[key], skipped)
+					}
+				}
+			}
+			if *requests != tt.wantRequests {
+				t.Errorf("got %d telemetry requests, want %d", *requests, tt.wantRequests)
+			}
+
+			got := make(map[string]int)
+			for i, d := range telemetry {
+				if i > 0 && d.Timestamp <= telemetry[i-1].Timestamp {
+					t.Fatalf("timestamps not strictly ascending at %d: %d after %d", i, d.Timestamp, telemetry[i-1].Timestamp)
+				}
+				for key := range d.Values {
+					got[key]++
+				}
+			}
+			for key, values := range tt.values {
+				if want := len(values) - tt.wantSkipped[key]; got[key] != want {
+					t.Errorf("key %s: got %d values, want %d", key, got[key], want)
+				}
+			}
+		})
+	}
+}
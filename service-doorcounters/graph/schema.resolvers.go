@@ -13,64 +13,91 @@ import (
 	"github.com/LarsDepuydt/masterthesis-api-aggregation/service-doorcounters/graph/model"
 )
 
+// EstimatedOccupancy is the resolver for the estimatedOccupancy field.
+func (r *buildingResolver) EstimatedOccupancy(ctx context.Context, obj *model.Building, date string) (*model.EstimatedOccupancy, error) {
+	building, ok := r.Config.Building(obj.ID)
+	if !ok {
+		return nil, fmt.Errorf("building %s has no door counters", obj.ID)
+	}
+	return r.estimateOccupancy(ctx, building, date)
+}
+
 // Entrances is the resolver for the entrances field.
 func (r *buildingResolver) Entrances(ctx context.Context, obj *model.Building) ([]*model.Entrance, error) {
-	// Check if this is our specific building
-	if obj.ID != "TMV25" {
-		return nil, fmt.Errorf("Entrences for buildings other then 'Thomas Manns Vej 25' are not implemented")
-	}
+	return r.Config.BuildingEntrances(obj.ID), nil
+}
 
-	// Return all entrances from our static data
-	return data.StaticEntrances, nil
+// AggregatedTelemetry is the resolver for the aggregatedTelemetry field.
+func (r *buildingResolver) AggregatedTelemetry(ctx context.Context, obj *model.Building, startTime time.Time, endTime *time.Time, interval model.TelemetryInterval, timezone *string) ([]*model.AggregatedTelemetry, error) {
+	var entrances []data.Entrance
+	if building, ok := r.Config.Building(obj.ID); ok {
+		entrances = building.Entrances
+	}
+	return r.aggregateTelemetry(ctx, entrances, startTime, endTime, interval, timezone)
 }
 
 // TelemetryData is the resolver for the telemetryData field.
 func (r *entranceResolver) TelemetryData(ctx context.Context, obj *model.Entrance, startTime time.Time, endTime *time.Time) ([]*model.TelemetryData, error) {
+	entrance, ok := r.Config.Entrance(obj.ID)
+	if !ok {
+		return nil, fmt.Errorf("unknown entrance ID: %s", obj.ID)
+	}
+	device, _ := r.Config.Device(entrance.Device)
+	fetches := r.fetchesFor(ctx)
+
 	// Convert times to milliseconds
-	startTs := startTime.Unix() * 1000
-	var endTs int64
+	startTs := startTime.UnixMilli()
+	endTs := fetches.now.UnixMilli()
 	if endTime != nil {
-		endTs = endTime.Unix() * 1000
-	} else {
-		endTs = time.Now().Unix() * 1000
+		endTs = endTime.UnixMilli()
 	}
 
-	// Fetch raw telemetry data
-	data, err := FetchTelemetryData(startTs, endTs)
-	if err != nil {
+	// Fetch raw telemetry data of all entrances counted by the device, shared
+	// with the other entrances of the request
+	telemetry, err := fetches.Fetch(ctx, device, startTs, endTs)
+	if err = withPartialData(ctx, err, entrance.Key); err != nil {
 		return nil, err
 	}
 
-	// Convert to GraphQL format with door-specific values
+	// Convert to GraphQL format with the value of this entrance, calibrated by
+	// the factor valid when its collection period started
 	var result []*model.TelemetryData
-	for _, d := range data {
-		var value *int32
-
-		// Select value based on entrance ID
-		switch obj.ID {
-		case "a":
-			value = d.DoorA
-		case "b":
-			value = d.DoorB
-		case "c":
-			value = d.DoorC
-		default:
-			return nil, fmt.Errorf("unknown entrance ID: %s", obj.ID)
+	calibrations := make(calibrationModels)
+	for _, d := range telemetry {
+		calibration := entrance.CalibrationAt(time.UnixMilli(d.Timestamp).Add(-collectionPeriod))
+		point := &model.TelemetryData{
+			Timestamp:         time.Unix(d.Timestamp/1000, 0).Format(time.RFC3339),
+			CalibrationFactor: 1,
+		}
+		if calibration != nil {
+			point.Calibration = calibrations.of(entrance, calibration)
+			point.CalibrationFactor = calibration.Factor
+		}
+		if v, ok := d.Values[entrance.Key]; ok {
+			calibrated := float64(v) * point.CalibrationFactor
+			point.Value = &v
+			point.CalibratedValue = &calibrated
 		}
 
-		result = append(result, &model.TelemetryData{
-			Timestamp: time.Unix(d.Timestamp/1000, 0).Format(time.RFC3339),
-			Value:     value,
-		})
+		result = append(result, point)
 	}
 
 	return result, nil
 }
 
+// AggregatedTelemetry is the resolver for the aggregatedTelemetry field.
+func (r *entranceResolver) AggregatedTelemetry(ctx context.Context, obj *model.Entrance, startTime time.Time, endTime *time.Time, interval model.TelemetryInterval, timezone *string) ([]*model.AggregatedTelemetry, error) {
+	entrance, ok := r.Config.Entrance(obj.ID)
+	if !ok {
+		return nil, fmt.Errorf("unknown entrance ID: %s", obj.ID)
+	}
+	return r.aggregateTelemetry(ctx, []data.Entrance{*entrance}, startTime, endTime, interval, timezone)
+}
+
 // GetEntrances is the resolver for the getEntrances field.
 func (r *queryResolver) GetEntrances(ctx context.Context, ids []string) ([]*model.Entrance, error) {
 	if len(ids) == 0 {
-		return data.StaticEntrances, nil
+		return r.Config.Entrances(), nil
 	}
 
 	// Create a set for faster lookups
@@ -81,7 +108,7 @@ func (r *queryResolver) GetEntrances(ctx context.Context, ids []string) ([]*mode
 
 	// Filter entrances based on IDs
 	filtered := make([]*model.Entrance, 0)
-	for _, entrance := range data.StaticEntrances {
+	for _, entrance := range r.Config.Entrances() {
 		if idSet[entrance.ID] {
 			filtered = append(filtered, entrance)
 		}
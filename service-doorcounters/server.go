@@ -11,6 +11,7 @@ import (
 	"github.com/99designs/gqlgen/graphql/handler/transport"
 	"github.com/99designs/gqlgen/graphql/playground"
 	"github.com/LarsDepuydt/masterthesis-api-aggregation/service-doorcounters/graph"
+	"github.com/LarsDepuydt/masterthesis-api-aggregation/service-doorcounters/graph/data"
 	"github.com/vektah/gqlparser/v2/ast"
 )
 
@@ -20,12 +21,29 @@ func main() {
 		log.Fatal("Could not find env variable that defined PORT")
 	}
 
-	srv := handler.New(graph.NewExecutableSchema(graph.Config{Resolvers: &graph.Resolver{}}))
+	configPath := os.Getenv("DOOR_CONFIG")
+	if configPath == "" {
+		configPath = "./doorcounters.json"
+	}
+	config, err := data.LoadConfig(configPath)
+	if err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+	log.Printf("Loaded %d entrances from %s", len(config.Entrances()), configPath)
+
+	resolver := &graph.Resolver{
+		Tokens: graph.NewTokenManager(graph.DefaultBaseURL, os.Getenv("DOOR_USERNAME"), os.Getenv("DOOR_PASSWORD")),
+		Config: config,
+	}
+
+	srv := handler.New(graph.NewExecutableSchema(graph.Config{Resolvers: resolver}))
 
 	srv.AddTransport(transport.Options{})
 	srv.AddTransport(transport.GET{})
 	srv.AddTransport(transport.POST{})
 
+	srv.SetErrorPresenter(graph.ErrorPresenter)
+
 	srv.SetQueryCache(lru.New[*ast.QueryDocument](1000))
 
 	srv.Use(extension.Introspection{})
@@ -34,7 +52,7 @@ func main() {
 	})
 
 	http.Handle("/", playground.Handler("GraphQL playground", "/query"))
-	http.Handle("/query", srv)
+	http.Handle("/query", resolver.WithTelemetryFetches(srv))
 
 	log.Printf("connect to http://localhost:%s/ for GraphQL playground", port)
 	log.Fatal(http.ListenAndServe(":"+port, nil))
@@ -1,5 +1,9 @@
 const { ApolloServer } = require("apollo-server");
-const { ApolloGateway, IntrospectAndCompose } = require("@apollo/gateway");
+const {
+  ApolloGateway,
+  IntrospectAndCompose,
+  RemoteGraphQLDataSource,
+} = require("@apollo/gateway");
 
 // Define the port, prioritizing the environment variable
 const APP_LISTEN_PORT = process.env.APP_LISTEN_PORT
@@ -16,11 +20,25 @@ const gateway = new ApolloGateway({
       { name: "coffee", url: "http://coffee:4005/query" },
     ],
   }),
+  // Forward the credentials of the request, subgraphs authenticate the user
+  // making a change themselves. Multipart requests are not supported, so
+  // mutations taking a file upload are sent to their subgraph directly.
+  buildService({ url }) {
+    return new RemoteGraphQLDataSource({
+      url,
+      willSendRequest({ request, context }) {
+        if (context.authorization) {
+          request.http.headers.set("authorization", context.authorization);
+        }
+      },
+    });
+  },
 });
 
 const server = new ApolloServer({
   gateway,
   subscriptions: false,
+  context: ({ req }) => ({ authorization: req.headers.authorization }),
 });
 
 server.listen({ host: "0.0.0.0", port: APP_LISTEN_PORT }).then(({ url }) => {